@@ -173,11 +173,16 @@ func main() {
 		log.Fatal(err)
 	}
 
+	machineHealthCheckDefaulter := mapiwebhooks.NewMachineHealthCheckDefaulter()
+	machineHealthCheckValidator := mapiwebhooks.NewMachineHealthCheckValidator(mgr.GetClient())
+
 	if *webhookEnabled {
 		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineMutatingHookPath, &webhook.Admission{Handler: machineDefaulter})
 		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineValidatingHookPath, &webhook.Admission{Handler: machineValidator})
 		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineSetMutatingHookPath, &webhook.Admission{Handler: machineSetDefaulter})
 		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineSetValidatingHookPath, &webhook.Admission{Handler: machineSetValidator})
+		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineHealthCheckMutatingHookPath, &webhook.Admission{Handler: machineHealthCheckDefaulter})
+		mgr.GetWebhookServer().Register(mapiwebhooks.DefaultMachineHealthCheckValidatingHookPath, &webhook.Admission{Handler: machineHealthCheckValidator})
 	}
 
 	log.Printf("Registering Components.")
@@ -4,12 +4,14 @@ import (
 	"flag"
 	"fmt"
 	"runtime"
+	"strings"
 
 	osconfigv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/library-go/pkg/config/leaderelection"
 	"github.com/openshift/machine-api-operator/pkg/controller"
 	"github.com/openshift/machine-api-operator/pkg/controller/nodelink"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
@@ -60,6 +62,36 @@ func main() {
 		fmt.Sprintf("The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership of a led but unrenewed leader slot. This is effectively the maximum duration that a leader can be stopped before it is replaced by another candidate. This is only applicable if leader election is enabled. Default: (%s)", defaultLeaderElectionValues.LeaseDuration.Duration),
 	)
 
+	matchingStrategies := flag.String(
+		"matching-strategies",
+		strings.Join(nodelink.DefaultMatchingStrategies, ","),
+		fmt.Sprintf("Comma separated list of strategies used to match Nodes and Machines, in priority order. Supported strategies are %s.", strings.Join(nodelink.SupportedMatchingStrategies, ", ")),
+	)
+
+	providerIDRules := flag.String(
+		"provider-id-rules",
+		nodelink.FormatProviderIDRules(nodelink.DefaultProviderIDRules),
+		"Comma separated list of scheme=rule providerID normalization rules of the normalizedProviderID matching strategy, the rule is exact, caseInsensitive or lastSegment.",
+	)
+
+	markUnlinkedNodes := flag.Bool(
+		"mark-unlinked-nodes",
+		false,
+		"Annotate the Nodes not linked to any Machine with the time since which they have been unlinked.",
+	)
+
+	maxConcurrentReconciles := flag.Int(
+		"max-concurrent-reconciles",
+		1,
+		"Maximum number of Nodes reconciled concurrently.",
+	)
+
+	metricsAddress := flag.String(
+		"metrics-bind-address",
+		metrics.DefaultNodeLinkMetricsAddress,
+		"Address for hosting metrics",
+	)
+
 	// Set log for controller-runtime
 	ctrl.SetLogger(klog.NewKlogr())
 
@@ -81,9 +113,8 @@ func main() {
 	})
 
 	opts := manager.Options{
-		// Disable metrics serving
 		Metrics: server.Options{
-			BindAddress: "0",
+			BindAddress: *metricsAddress,
 		},
 		LeaderElection:          *leaderElect,
 		LeaderElectionNamespace: *leaderElectResourceNamespace,
@@ -111,11 +142,27 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	rules, err := nodelink.ParseProviderIDRules(*providerIDRules)
+	if err != nil {
+		klog.Fatalf("Invalid --provider-id-rules: %v", err)
+	}
+
 	// Setup all Controllers
-	if err := controller.AddToManager(mgr, opts, nodelink.Add); err != nil {
+	addNodeLink := func(mgr manager.Manager, _ manager.Options) error {
+		return nodelink.AddWithOptions(mgr, nodelink.Options{
+			MatchingStrategies:      strings.Split(*matchingStrategies, ","),
+			ProviderIDRules:         rules,
+			MarkUnlinkedNodes:       *markUnlinkedNodes,
+			MaxConcurrentReconciles: *maxConcurrentReconciles,
+		})
+	}
+	if err := controller.AddToManager(mgr, opts, addNodeLink); err != nil {
 		klog.Fatal(err)
 	}
 
+	// Register the nodelink specific metrics
+	metrics.InitializeNodeLinkMetrics()
+
 	klog.Info("Starting the Cmd.")
 
 	// Start the Cmd
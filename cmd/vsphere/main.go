@@ -19,6 +19,7 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere"
 	machine "github.com/openshift/machine-api-operator/pkg/controller/vsphere"
 	machinesetcontroller "github.com/openshift/machine-api-operator/pkg/controller/vsphere/machineset"
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
 	"github.com/openshift/machine-api-operator/pkg/util"
 	"github.com/openshift/machine-api-operator/pkg/version"
@@ -90,6 +91,60 @@ func main() {
 		":9440",
 		"The address for health checking.",
 	)
+
+	orphanScanInterval := flag.Duration(
+		"orphaned-vm-scan-interval",
+		30*time.Minute,
+		"How often to scan vCenter for vms tagged with the infrastructure ID of the cluster which do not belong to any Machine. Zero disables the scan.",
+	)
+
+	orphanGracePeriod := flag.Duration(
+		"orphaned-vm-grace-period",
+		time.Hour,
+		"How old a vm which does not belong to any Machine has to be before it is reported as orphaned.",
+	)
+
+	destroyOrphanedVMs := flag.Bool(
+		"destroy-orphaned-vms",
+		false,
+		"Power off and destroy the orphaned vms, and release their IP address claims.",
+	)
+
+	vCenterQPS := flag.Float64(
+		"vcenter-qps",
+		session.DefaultQPS,
+		"Maximum rate of API requests to each vCenter. Zero disables the rate limit.",
+	)
+
+	vCenterBurst := flag.Int(
+		"vcenter-burst",
+		session.DefaultBurst,
+		"Maximum burst of API requests to each vCenter above the rate limit.",
+	)
+
+	vCenterMaxInFlightTasks := flag.Int(
+		"vcenter-max-inflight-tasks",
+		session.DefaultMaxInFlightTasks,
+		"Maximum number of clone tasks in flight on each vCenter. Zero disables the cap.",
+	)
+
+	vCenterFailureThreshold := flag.Int(
+		"vcenter-failure-threshold",
+		session.DefaultFailureThreshold,
+		"Number of consecutive server faults of a vCenter which open its circuit breaker. Zero disables the circuit breaker.",
+	)
+
+	vCenterCircuitBreakerCooldown := flag.Duration(
+		"vcenter-circuit-breaker-cooldown",
+		session.DefaultCircuitBreakerCooldown,
+		"How long the circuit breaker of a vCenter stays open before probing the vCenter again.",
+	)
+
+	powerOffPolicyName := flag.String(
+		"out-of-band-power-off-policy",
+		string(machine.PowerOffPolicyIgnore),
+		"What to do with the vm of a Running machine powered off out of band: Ignore, Report or PowerOn.",
+	)
 	flag.Parse()
 
 	if logToStderr != nil {
@@ -101,6 +156,19 @@ func main() {
 		os.Exit(0)
 	}
 
+	powerOffPolicy, err := machine.ParsePowerOffPolicy(*powerOffPolicyName)
+	if err != nil {
+		klog.Fatalf("Invalid --out-of-band-power-off-policy: %v", err)
+	}
+
+	session.SetClientLimits(session.ClientLimits{
+		QPS:                    float32(*vCenterQPS),
+		Burst:                  *vCenterBurst,
+		MaxInFlightTasks:       *vCenterMaxInFlightTasks,
+		FailureThreshold:       *vCenterFailureThreshold,
+		CircuitBreakerCooldown: *vCenterCircuitBreakerCooldown,
+	})
+
 	cfg := config.GetConfigOrDie()
 	syncPeriod := 10 * time.Minute
 
@@ -185,6 +253,7 @@ func main() {
 		TaskIDCache:                taskIDCache,
 		StaticIPFeatureGateEnabled: staticIPFeatureGateEnabled,
 		OpenshiftConfigNamespace:   vsphere.OpenshiftConfigNamespace,
+		PowerOffPolicy:             powerOffPolicy,
 	})
 
 	if err := configv1.Install(mgr.GetScheme()); err != nil {
@@ -207,6 +276,26 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	if err := mgr.Add(machine.NewCredentialsWatcher(mgr.GetCache())); err != nil {
+		klog.Fatalf("unable to add credentials watcher: %v", err)
+	}
+
+	if *orphanScanInterval > 0 {
+		if err := mgr.Add(machine.NewOrphanScanner(machine.OrphanScannerParams{
+			Client:                     mgr.GetClient(),
+			APIReader:                  mgr.GetAPIReader(),
+			EventRecorder:              mgr.GetEventRecorderFor("vspherecontroller"),
+			Namespace:                  *watchNamespace,
+			OpenshiftConfigNamespace:   vsphere.OpenshiftConfigNamespace,
+			Interval:                   *orphanScanInterval,
+			GracePeriod:                *orphanGracePeriod,
+			Destroy:                    *destroyOrphanedVMs,
+			StaticIPFeatureGateEnabled: staticIPFeatureGateEnabled,
+		})); err != nil {
+			klog.Fatalf("unable to add orphaned vm scanner: %v", err)
+		}
+	}
+
 	setupLog := ctrl.Log.WithName("setup")
 	if err = (&machinesetcontroller.Reconciler{
 		Client: mgr.GetClient(),
@@ -237,7 +237,7 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 		instanceExists, err := r.actuator.Exists(ctx, m)
 		if err != nil {
 			klog.Errorf("%v: failed to check if machine exists: %v", machineName, err)
-			return reconcile.Result{}, err
+			return delayIfRequeueAfterError(err)
 		}
 
 		if instanceExists {
@@ -283,7 +283,7 @@ func (r *ReconcileMachine) Reconcile(ctx context.Context, request reconcile.Requ
 			klog.Errorf("%v: error patching status: %v", machineName, patchErr)
 		}
 
-		return reconcile.Result{}, err
+		return delayIfRequeueAfterError(err)
 	}
 
 	if instanceExists {
@@ -14,7 +14,9 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/util/annotations"
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
 	"github.com/openshift/machine-api-operator/pkg/util/external"
+	"github.com/openshift/machine-api-operator/pkg/util/maintenance"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -40,12 +42,45 @@ const (
 	nodeMasterLabel               = "node-role.kubernetes.io/master"
 	machineRoleLabel              = "machine.openshift.io/cluster-api-machine-role"
 	machineMasterRole             = "master"
-	remediationStrategyAnnotation = "machine.openshift.io/remediation-strategy"
+	remediationStrategyAnnotation = annotations.RemediationStrategyAnnotation
 	remediationStrategyExternal   = machinev1.RemediationStrategyType("external-baremetal")
 	defaultNodeStartupTimeout     = 10 * time.Minute
 	machineNodeNameIndex          = "machineNodeNameIndex"
 	controllerName                = "machinehealthcheck-controller"
 
+	// externalRemediationTimeoutAnnotation can be applied to MachineHealthCheck objects using a RemediationTemplate
+	// to limit how long an external remediation request may take to bring its target back to healthy.
+	// Once the timeout expires the remediation request is deleted and the built-in remediation strategy is used instead.
+	externalRemediationTimeoutAnnotation = annotations.ExternalRemediationTimeoutAnnotation
+	// remediationRequestConditionPrefix prefixes the conditions of external remediation requests
+	// when they are surfaced on the MachineHealthCheck
+	remediationRequestConditionPrefix = "RemediationRequest"
+	// excludeFromRemediationAnnotation can be applied to Machine objects to exclude them from remediation,
+	// indefinitely or until the RFC 3339 time set as value
+	excludeFromRemediationAnnotation = annotations.ExcludeFromRemediationAnnotation
+	// maintenanceWindowsAnnotation can be applied to MachineHealthCheck objects to suppress remediation
+	// during recurring maintenance windows, while targets are still health checked
+	maintenanceWindowsAnnotation = annotations.MaintenanceWindowsAnnotation
+
+	// remediationSuppressedCondition is set on the MHC while remediation of some of its targets is suppressed
+	remediationSuppressedCondition machinev1.ConditionType = "RemediationSuppressed"
+	// maintenanceWindowReason is used when remediation is suppressed by a maintenance window of the MHC
+	maintenanceWindowReason = "MaintenanceWindow"
+	// machinesExcludedReason is used when unhealthy machines are excluded from remediation
+	machinesExcludedReason = "MachinesExcluded"
+	// replacementReadyTimeout is how long a remediation may wait for the remediated or replacement
+	// node to become Ready before it is reported as failed
+	replacementReadyTimeout = time.Hour
+
+	// Remediation failure reasons reported by metrics
+	remediationFailureNoControllerOwner        = "NoControllerOwner"
+	remediationFailureDeletionFailed           = "DeletionFailed"
+	remediationFailureExternalAnnotationFailed = "ExternalAnnotationFailed"
+	remediationFailureTemplateNotFound         = "TemplateNotFound"
+	remediationFailureRequestCreationFailed    = "RequestCreationFailed"
+	remediationFailureTimedOut                 = "TimedOut"
+	remediationFailureReplacementNotReady      = "ReplacementNotReady"
+
 	// Event types
 	// EventRemediationRestricted is emitted in case when machine remediation
 	// is restricted by remediation circuit shorting logic
@@ -68,6 +103,18 @@ const (
 	// EventExternalAnnotationAdded is emitted when external annotation was
 	// successfully added to a Node object
 	EventExternalAnnotationAdded string = "ExternalAnnotationAdded"
+	// EventExternalRemediationTimedOut is emitted when an external remediation request
+	// did not remediate its machine within the external remediation timeout
+	EventExternalRemediationTimedOut string = "ExternalRemediationTimedOut"
+	// EventRemediationSkippedExcluded is emitted when an unhealthy machine
+	// is not remediated because it is excluded from remediation
+	EventRemediationSkippedExcluded string = "RemediationSkippedExcluded"
+	// EventRemediationSkippedMaintenanceWindow is emitted when an unhealthy machine
+	// is not remediated because a maintenance window of its MHC is active
+	EventRemediationSkippedMaintenanceWindow string = "RemediationSkippedMaintenanceWindow"
+	// EventInvalidMaintenanceWindows is emitted when the maintenance windows
+	// of a MHC can't be parsed, in which case they are ignored
+	EventInvalidMaintenanceWindows string = "InvalidMaintenanceWindows"
 	// PausedAnnotation is an annotation that can be applied to MachineHealthCheck objects to prevent the MHC controller
 	// from processing it.
 	// TODO: move this annotation to the openshift/api package
@@ -149,6 +196,8 @@ type ReconcileMachineHealthCheck struct {
 	client   client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
+	// tracker follows targets from their detection as unhealthy until their remediation completes
+	tracker remediationTracker
 }
 
 type target struct {
@@ -169,6 +218,8 @@ func (r *ReconcileMachineHealthCheck) Reconcile(ctx context.Context, request rec
 			metrics.DeleteMachineHealthCheckNodesCovered(request.NamespacedName.Name, request.NamespacedName.Namespace)
 			// We also need to revert short circuiting of such object so it doesn't overflow to a new object.
 			metrics.ObserveMachineHealthCheckShortCircuitDisabled(request.NamespacedName.Name, request.NamespacedName.Namespace)
+			metrics.DeleteMachineHealthCheckTargetsPendingTimeout(request.NamespacedName.Name, request.NamespacedName.Namespace)
+			r.tracker.forget(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		klog.Errorf("Reconciling %s: failed to get MHC: %v", request.String(), err)
@@ -200,12 +251,15 @@ func (r *ReconcileMachineHealthCheck) Reconcile(ctx context.Context, request rec
 	}
 
 	// health check all targets and reconcile mhc status
-	currentHealthy, needRemediationTargets, nextCheckTimes, errList := r.healthCheckTargets(targets, nodeStartupTimeout.Duration)
+	currentHealthy, needRemediationTargets, nextCheckTimes, errList := r.healthCheckTargets(namespacedName(mhc), targets, nodeStartupTimeout.Duration)
 	healthyCount := len(currentHealthy)
 	mhc.Status.CurrentHealthy = &healthyCount
 	mhc.Status.ExpectedMachines = &totalTargets
 	unhealthyCount := totalTargets - healthyCount
 
+	metrics.ObserveMachineHealthCheckTargetsPendingTimeout(mhc.Name, mhc.Namespace, len(nextCheckTimes))
+	r.expireRemediations(mhc)
+
 	// check MHC current health against MaxUnhealthy
 	if !isAllowedRemediation(mhc) {
 		klog.Warningf("Reconciling %s: total targets: %v,  maxUnhealthy: %v, unhealthy: %v. Short-circuiting remediation",
@@ -256,14 +310,29 @@ func (r *ReconcileMachineHealthCheck) Reconcile(ctx context.Context, request rec
 	)
 	metrics.ObserveMachineHealthCheckShortCircuitDisabled(mhc.Name, mhc.Namespace)
 
+	// leave out targets excluded from remediation or waiting for a maintenance window to end
+	remediationTargets, suppressedTargets, suppressionNextCheckTimes := r.suppressRemediation(mhc, needRemediationTargets)
+	nextCheckTimes = append(nextCheckTimes, suppressionNextCheckTimes...)
+
 	conditions.MarkTrue(mhc, machinev1.RemediationAllowedCondition)
 	if err := r.reconcileStatus(mergeBase, mhc); err != nil {
 		klog.Errorf("Reconciling %s: error patching status: %v", request.String(), err)
 		return reconcile.Result{}, err
 	}
-	errList = append(errList, r.remediate(ctx, needRemediationTargets, mhc)...)
+	conditionsBeforeRemediation := conditions.DeepCopyConditions(mhc.Status.Conditions)
+	errList = append(errList, r.remediate(ctx, remediationTargets, mhc)...)
 	// deletes External Machine Remediation for healthy machines - indicating remediation was successful
 	r.cleanEMR(ctx, currentHealthy, mhc)
+	// escalates External Machine Remediation which timed out and surfaces the conditions of the remaining ones
+	remediationNextCheckTimes, remediationErrList := r.reconcileExternalRemediationRequests(ctx, needRemediationTargets, suppressedTargets, mhc)
+	nextCheckTimes = append(nextCheckTimes, remediationNextCheckTimes...)
+	errList = append(errList, remediationErrList...)
+	if !equality.Semantic.DeepEqual(conditionsBeforeRemediation, mhc.Status.Conditions) {
+		if err := r.reconcileStatus(mergeBase, mhc); err != nil {
+			klog.Errorf("Reconciling %s: error patching status: %v", request.String(), err)
+			return reconcile.Result{}, err
+		}
+	}
 	// return values
 	if len(errList) > 0 {
 		requeueError := apimachineryutilerrors.NewAggregate(errList)
@@ -300,6 +369,119 @@ func (r *ReconcileMachineHealthCheck) remediate(ctx context.Context, needRemedia
 	return errList
 }
 
+// suppressRemediation splits the targets needing remediation between the ones which can be remediated
+// and the ones which are suppressed, because their Machine is excluded from remediation or a maintenance
+// window of the MHC is active. It reflects the suppression in the MHC conditions and returns the durations
+// after which suppressed targets may be remediated.
+func (r *ReconcileMachineHealthCheck) suppressRemediation(m *machinev1.MachineHealthCheck, needRemediationTargets []target) ([]target, map[types.UID]bool, []time.Duration) {
+	now := time.Now()
+	mhcName := namespacedName(m)
+
+	// Events are only emitted when the suppression, or the invalid annotation, changes
+	var windowEnd time.Time
+	var inWindow bool
+	invalidMaintenanceWindows := ""
+	if value, ok := m.Annotations[maintenanceWindowsAnnotation]; ok {
+		windows, err := maintenance.Parse(value)
+		if err != nil {
+			klog.Errorf("%s: error parsing maintenance windows, they will be ignored: %v", mhcName, err)
+			invalidMaintenanceWindows = value
+			if r.tracker.reportInvalidMaintenanceWindows(mhcName, value) {
+				r.recorder.Eventf(m, corev1.EventTypeWarning, EventInvalidMaintenanceWindows, "Invalid %s annotation, maintenance windows are ignored: %v", maintenanceWindowsAnnotation, err)
+			}
+		}
+		windowEnd, inWindow = maintenance.Active(windows, now)
+	}
+	if invalidMaintenanceWindows == "" {
+		r.tracker.reportInvalidMaintenanceWindows(mhcName, "")
+	}
+
+	var remediationTargets []target
+	var excludedMachines []string
+	var nextCheckTimes []time.Duration
+	suppressedTargets := map[types.UID]bool{}
+	for _, t := range needRemediationTargets {
+		if excluded, until := excludedFromRemediation(&t.Machine, now); excluded {
+			klog.Infof("%s: machine is excluded from remediation, skipping remediation", t.string())
+			message := fmt.Sprintf("Machine %v is excluded from remediation", t.string())
+			if !until.IsZero() {
+				message = fmt.Sprintf("%s until %s", message, until.UTC().Format(time.RFC3339))
+				nextCheckTimes = append(nextCheckTimes, until.Sub(now)+time.Second)
+			}
+			if r.tracker.reportSuppressed(mhcName, t.Machine.UID, message) {
+				r.recorder.Event(&t.Machine, corev1.EventTypeNormal, EventRemediationSkippedExcluded, message)
+			}
+			excludedMachines = append(excludedMachines, t.Machine.Name)
+			suppressedTargets[t.Machine.UID] = true
+			continue
+		}
+		if inWindow {
+			klog.Infof("%s: maintenance window active until %v, skipping remediation", t.string(), windowEnd)
+			message := fmt.Sprintf("Machine %v will not be remediated before the end of the maintenance window at %s", t.string(), windowEnd.Format(time.RFC3339))
+			if r.tracker.reportSuppressed(mhcName, t.Machine.UID, message) {
+				r.recorder.Event(&t.Machine, corev1.EventTypeNormal, EventRemediationSkippedMaintenanceWindow, message)
+			}
+			nextCheckTimes = append(nextCheckTimes, windowEnd.Sub(now)+time.Second)
+			suppressedTargets[t.Machine.UID] = true
+			continue
+		}
+		remediationTargets = append(remediationTargets, t)
+	}
+	r.tracker.retainSuppressed(mhcName, suppressedTargets)
+
+	var messages []string
+	if inWindow {
+		messages = append(messages, fmt.Sprintf("Remediation is suppressed by a maintenance window until %s", windowEnd.Format(time.RFC3339)))
+	}
+	if len(excludedMachines) > 0 {
+		messages = append(messages, fmt.Sprintf("Unhealthy machines are excluded from remediation: %s", strings.Join(excludedMachines, ", ")))
+	}
+
+	switch {
+	case inWindow:
+		conditions.Set(m, &machinev1.Condition{
+			Type:     remediationSuppressedCondition,
+			Status:   corev1.ConditionTrue,
+			Severity: machinev1.ConditionSeverityInfo,
+			Reason:   maintenanceWindowReason,
+			Message:  strings.Join(messages, "; "),
+		})
+	case len(excludedMachines) > 0:
+		conditions.Set(m, &machinev1.Condition{
+			Type:     remediationSuppressedCondition,
+			Status:   corev1.ConditionTrue,
+			Severity: machinev1.ConditionSeverityInfo,
+			Reason:   machinesExcludedReason,
+			Message:  strings.Join(messages, "; "),
+		})
+	default:
+		conditions.Delete(m, remediationSuppressedCondition)
+	}
+
+	return remediationTargets, suppressedTargets, nextCheckTimes
+}
+
+// excludedFromRemediation returns whether the machine is excluded from remediation and, if the exclusion expires, until when.
+// An exclusion with an invalid expiry does not expire.
+func excludedFromRemediation(machine *machinev1.Machine, now time.Time) (bool, time.Time) {
+	value, ok := machine.Annotations[excludeFromRemediationAnnotation]
+	if !ok {
+		return false, time.Time{}
+	}
+	if value == "" {
+		return true, time.Time{}
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Errorf("%s/%s: invalid %s annotation, the exclusion won't expire: %v", machine.Namespace, machine.Name, excludeFromRemediationAnnotation, err)
+		return true, time.Time{}
+	}
+	if !until.After(now) {
+		return false, time.Time{}
+	}
+	return true, until
+}
+
 // deletes EMR (External Machine Remediation) for healthy machines
 func (r *ReconcileMachineHealthCheck) cleanEMR(ctx context.Context, currentHealthy []target, m *machinev1.MachineHealthCheck) {
 	if m.Spec.RemediationTemplate == nil {
@@ -326,8 +508,194 @@ func (r *ReconcileMachineHealthCheck) cleanEMR(ctx context.Context, currentHealt
 	}
 }
 
+// reconcileExternalRemediationRequests escalates the external remediation requests that did not remediate their
+// target within the external remediation timeout, and surfaces the conditions reported by the remaining
+// requests on the MHC. Requests of suppressed targets are not escalated.
+// It returns the durations after which pending requests will time out.
+func (r *ReconcileMachineHealthCheck) reconcileExternalRemediationRequests(ctx context.Context, needRemediationTargets []target, suppressedTargets map[types.UID]bool, m *machinev1.MachineHealthCheck) ([]time.Duration, []error) {
+	if m.Spec.RemediationTemplate == nil {
+		return nil, nil
+	}
+
+	timeout, err := getExternalRemediationTimeout(m)
+	if err != nil {
+		klog.Errorf("%s: error decoding external remediation timeout, timeout won't be enforced: %v", namespacedName(m), err)
+	}
+
+	var errList []error
+	var nextCheckTimes []time.Duration
+	var requests []*unstructured.Unstructured
+	for _, t := range needRemediationTargets {
+		obj, err := r.getExternalRemediationRequest(ctx, m, t.Machine.Name)
+		if err != nil {
+			if !apimachineryerrors.IsNotFound(err) {
+				errList = append(errList, fmt.Errorf("%s: failed to fetch remediation request: %v", t.string(), err))
+			}
+			continue
+		}
+		if obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		if timeout > 0 && !suppressedTargets[t.Machine.UID] {
+			// a request created during this reconcile may not have a creation timestamp yet
+			createdAt := obj.GetCreationTimestamp().Time
+			if createdAt.IsZero() {
+				createdAt = time.Now()
+			}
+			remaining := timeout - time.Since(createdAt)
+			if remaining <= 0 && !t.hasInternalRemediationFallback() {
+				// Escalating would delete the request without remediating the target, and the next reconcile
+				// would create it again, so the timed out request is kept
+				klog.V(3).Infof("%s: external remediation request %q timed out, but there is no built-in remediation to fall back to", t.string(), obj.GetName())
+				requests = append(requests, obj)
+				continue
+			}
+			if remaining <= 0 {
+				if err := r.escalateExternalRemediation(ctx, t, obj, timeout); err != nil {
+					klog.Errorf("Reconciling %s: error escalating external remediation: %v", t.string(), err)
+					errList = append(errList, err)
+				}
+				continue
+			}
+			nextCheckTimes = append(nextCheckTimes, remaining+time.Second)
+		}
+		requests = append(requests, obj)
+	}
+
+	setRemediationRequestConditions(m, requests)
+	return nextCheckTimes, errList
+}
+
+// escalateExternalRemediation deletes a timed out external remediation request and
+// falls back to the built-in remediation strategy of the MHC
+func (r *ReconcileMachineHealthCheck) escalateExternalRemediation(ctx context.Context, t target, obj *unstructured.Unstructured, timeout time.Duration) error {
+	klog.Infof("%s: external remediation request %q did not remediate the target within %v, escalating", t.string(), obj.GetName(), timeout)
+	if err := r.client.Delete(ctx, obj); err != nil && !apimachineryerrors.IsNotFound(err) {
+		return fmt.Errorf("%s: failed to delete timed out %v %q: %v", t.string(), obj.GroupVersionKind(), obj.GetName(), err)
+	}
+	r.recorder.Eventf(
+		&t.Machine,
+		corev1.EventTypeWarning,
+		EventExternalRemediationTimedOut,
+		"External remediation request %v %q for machine %v timed out after %v, falling back to built-in remediation",
+		obj.GetKind(),
+		obj.GetName(),
+		t.string(),
+		timeout,
+	)
+	if _, ok := r.tracker.takePending(namespacedName(&t.MHC), &t.Machine); ok {
+		metrics.ObserveMachineHealthCheckRemediationFailure(t.MHC.Name, t.MHC.Namespace, metrics.RemediationStrategyExternal, remediationFailureTimedOut)
+	}
+	return r.internalRemediation(t)
+}
+
+// getExternalRemediationTimeout returns the external remediation timeout configured on the MHC.
+// A zero duration means external remediation requests never time out.
+func getExternalRemediationTimeout(mhc *machinev1.MachineHealthCheck) (time.Duration, error) {
+	value, ok := mhc.Annotations[externalRemediationTimeoutAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for annotation %q: %v", value, externalRemediationTimeoutAnnotation, err)
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("invalid value %q for annotation %q: must not be negative", value, externalRemediationTimeoutAnnotation)
+	}
+	return timeout, nil
+}
+
+// setRemediationRequestConditions surfaces the conditions reported by external remediation requests
+// on the MHC. Each condition type reported by any request is set on the MHC with the
+// remediationRequestConditionPrefix, aggregating the requests with the worst status into its message.
+// Surfaced conditions which are no longer reported by any request are removed.
+func setRemediationRequestConditions(m *machinev1.MachineHealthCheck, requests []*unstructured.Unstructured) {
+	type requestCondition struct {
+		request string
+		status  corev1.ConditionStatus
+		reason  string
+		message string
+	}
+
+	reported := map[machinev1.ConditionType][]requestCondition{}
+	for _, obj := range requests {
+		requestConditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		if err != nil {
+			klog.Warningf("%s: unable to read conditions of remediation request %q: %v", namespacedName(m), obj.GetName(), err)
+			continue
+		}
+		for _, c := range requestConditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			conditionType, _, _ := unstructured.NestedString(condition, "type")
+			if conditionType == "" {
+				continue
+			}
+			status, _, _ := unstructured.NestedString(condition, "status")
+			reason, _, _ := unstructured.NestedString(condition, "reason")
+			message, _, _ := unstructured.NestedString(condition, "message")
+			t := machinev1.ConditionType(remediationRequestConditionPrefix + conditionType)
+			reported[t] = append(reported[t], requestCondition{
+				request: obj.GetName(),
+				status:  corev1.ConditionStatus(status),
+				reason:  reason,
+				message: message,
+			})
+		}
+	}
+
+	for _, c := range conditions.DeepCopyConditions(m.Status.Conditions) {
+		if _, ok := reported[c.Type]; !ok && strings.HasPrefix(string(c.Type), remediationRequestConditionPrefix) {
+			conditions.Delete(m, c.Type)
+		}
+	}
+
+	for t, requestConditions := range reported {
+		// False takes precedence over Unknown, which takes precedence over True
+		worst := corev1.ConditionTrue
+		for _, c := range requestConditions {
+			switch {
+			case c.status == corev1.ConditionFalse:
+				worst = corev1.ConditionFalse
+			case c.status != corev1.ConditionTrue && worst != corev1.ConditionFalse:
+				worst = corev1.ConditionUnknown
+			}
+		}
+		if worst == corev1.ConditionTrue {
+			conditions.MarkTrue(m, t)
+			continue
+		}
+
+		var reason string
+		var messages []string
+		for _, c := range requestConditions {
+			if (worst == corev1.ConditionFalse && c.status == corev1.ConditionFalse) ||
+				(worst == corev1.ConditionUnknown && c.status != corev1.ConditionTrue) {
+				if reason == "" {
+					reason = c.reason
+				}
+				messages = append(messages, fmt.Sprintf("%s: %s", c.request, c.message))
+			}
+		}
+		if worst == corev1.ConditionFalse {
+			conditions.MarkFalse(m, t, reason, machinev1.ConditionSeverityWarning, "%s", strings.Join(messages, "; "))
+		} else {
+			conditions.Set(m, conditions.UnknownCondition(t, reason, "%s", strings.Join(messages, "; ")))
+		}
+	}
+}
+
 func (r *ReconcileMachineHealthCheck) externalRemediation(ctx context.Context, m *machinev1.MachineHealthCheck, t target) error {
 	klog.V(3).Infof(" %s: start external remediation logic", t.string())
+	// The machine is already going away, or remediation was escalated to the
+	// built-in strategy after the external remediation timed out.
+	if !t.Machine.GetDeletionTimestamp().IsZero() || externalRemediationAnnotationExists(&t.Machine) {
+		return nil
+	}
 	re, err := r.externalRemediationRequestExists(ctx, m, t.Machine.Name)
 	if err != nil {
 		return fmt.Errorf("error retrieving external remediation  %v %q for machine %q in namespace %q: %v", m.Spec.RemediationTemplate.GroupVersionKind(), m.Spec.RemediationTemplate.Name, t.Machine.Name, t.Machine.Namespace, err)
@@ -347,6 +715,7 @@ func (r *ReconcileMachineHealthCheck) externalRemediation(ctx context.Context, m
 	from, err := external.Get(ctx, r.client, m.Spec.RemediationTemplate, t.Machine.Namespace)
 	if err != nil {
 		conditions.MarkFalse(m, machinev1.ExternalRemediationTemplateAvailable, machinev1.ExternalRemediationTemplateNotFound, machinev1.ConditionSeverityError, err.Error())
+		r.observeRemediationFailure(t, metrics.RemediationStrategyExternal, remediationFailureTemplateNotFound)
 		return fmt.Errorf("error retrieving remediation template %v %q for machine %q in namespace %q: %v", m.Spec.RemediationTemplate.GroupVersionKind(), m.Spec.RemediationTemplate.Name, t.Machine.Name, t.Machine.Namespace, err)
 	}
 
@@ -373,8 +742,10 @@ func (r *ReconcileMachineHealthCheck) externalRemediation(ctx context.Context, m
 	// Create the external clone.
 	if err := r.client.Create(ctx, to); err != nil {
 		conditions.MarkFalse(m, machinev1.ExternalRemediationRequestAvailable, machinev1.ExternalRemediationRequestCreationFailed, machinev1.ConditionSeverityError, err.Error())
+		r.observeRemediationFailure(t, metrics.RemediationStrategyExternal, remediationFailureRequestCreationFailed)
 		return fmt.Errorf("error creating remediation request for machine %q in namespace %q: %v", t.Machine.Name, t.Machine.Namespace, err)
 	}
+	r.observeRemediation(t, metrics.RemediationStrategyExternal)
 	return nil
 }
 
@@ -457,10 +828,11 @@ func (r *ReconcileMachineHealthCheck) reconcileStatus(baseToPatch client.Patch,
 
 // healthCheckTargets health checks a slice of targets
 // and gives a data to measure the average health
-func (r *ReconcileMachineHealthCheck) healthCheckTargets(targets []target, timeoutForMachineToHaveNode time.Duration) ([]target, []target, []time.Duration, []error) {
+func (r *ReconcileMachineHealthCheck) healthCheckTargets(mhc types.NamespacedName, targets []target, timeoutForMachineToHaveNode time.Duration) ([]target, []target, []time.Duration, []error) {
 	var errList []error
 	var needRemediationTargets, currentHealthy []target
 	var nextCheckTimes []time.Duration
+	unhealthyMachines := map[types.UID]bool{}
 	for _, t := range targets {
 		klog.V(3).Infof("Reconciling %s: health checking", t.string())
 		needsRemediation, nextCheck, err := t.needsRemediation(timeoutForMachineToHaveNode)
@@ -471,6 +843,8 @@ func (r *ReconcileMachineHealthCheck) healthCheckTargets(targets []target, timeo
 		}
 
 		if needsRemediation {
+			r.tracker.detectedUnhealthyAt(namespacedName(&t.MHC), t.Machine.UID, t.unhealthySince(time.Now()))
+			unhealthyMachines[t.Machine.UID] = true
 			needRemediationTargets = append(needRemediationTargets, t)
 			continue
 		}
@@ -485,6 +859,8 @@ func (r *ReconcileMachineHealthCheck) healthCheckTargets(targets []target, timeo
 				t.string(),
 				t.nodeName(),
 			)
+			r.tracker.detectedUnhealthyAt(namespacedName(&t.MHC), t.Machine.UID, t.unhealthySince(time.Now()))
+			unhealthyMachines[t.Machine.UID] = true
 			nextCheckTimes = append(nextCheckTimes, nextCheck)
 			continue
 		}
@@ -494,11 +870,70 @@ func (r *ReconcileMachineHealthCheck) healthCheckTargets(targets []target, timeo
 		// TODO once external remediation templates are used, also check for external remediation CRs!
 		if t.Machine.DeletionTimestamp == nil && t.Node != nil && !externalRemediationAnnotationExists(&t.Machine) {
 			currentHealthy = append(currentHealthy, t)
+			r.observeReplacementReady(t)
 		}
 	}
+	// Targets which are healthy again, or gone, will be detected anew if they go unhealthy
+	r.tracker.retainUnhealthy(mhc, unhealthyMachines)
 	return currentHealthy, needRemediationTargets, nextCheckTimes, errList
 }
 
+// observeRemediationFailure counts the failed remediation of the target once for each reason while it stays
+// unhealthy, not on every reconcile retrying to remediate it
+func (r *ReconcileMachineHealthCheck) observeRemediationFailure(t target, strategy, reason string) {
+	if r.tracker.reportFailure(namespacedName(&t.MHC), t.Machine.UID, reason) {
+		metrics.ObserveMachineHealthCheckRemediationFailure(t.MHC.Name, t.MHC.Namespace, strategy, reason)
+	}
+}
+
+// observeRemediation reports how long the target waited to be remediated since it was detected
+// unhealthy, and tracks the remediation until the remediated or replacement node is Ready
+func (r *ReconcileMachineHealthCheck) observeRemediation(t target, strategy string) {
+	now := time.Now()
+	mhc := namespacedName(&t.MHC)
+	detected := r.tracker.detectedUnhealthyAt(mhc, t.Machine.UID, t.unhealthySince(now))
+	metrics.ObserveMachineHealthCheckTimeToRemediation(t.MHC.Name, t.MHC.Namespace, strategy, now.Sub(detected))
+
+	remediation := pendingRemediation{
+		machineUID:   t.Machine.UID,
+		strategy:     strategy,
+		remediatedAt: now,
+	}
+	if owner := metav1.GetControllerOf(&t.Machine); owner != nil {
+		remediation.ownerUID = owner.UID
+	}
+	r.tracker.addPending(mhc, remediation)
+}
+
+// observeReplacementReady reports how long it took for a healthy target with a Ready node
+// to replace, or recover from, a pending remediation
+func (r *ReconcileMachineHealthCheck) observeReplacementReady(t target) {
+	readyCondition := conditions.GetNodeCondition(t.Node, corev1.NodeReady)
+	if readyCondition == nil || readyCondition.Status != corev1.ConditionTrue {
+		return
+	}
+	remediation, ok := r.tracker.takePending(namespacedName(&t.MHC), &t.Machine)
+	if !ok {
+		return
+	}
+	readyAt := readyCondition.LastTransitionTime.Time
+	if readyAt.Before(remediation.remediatedAt) {
+		// The node was not seen going NotReady, e.g. after a quick reboot
+		readyAt = time.Now()
+	}
+	klog.V(3).Infof("%s: node is Ready %v after %s remediation", t.string(), readyAt.Sub(remediation.remediatedAt), remediation.strategy)
+	metrics.ObserveMachineHealthCheckTimeToReplacementReady(t.MHC.Name, t.MHC.Namespace, remediation.strategy, readyAt.Sub(remediation.remediatedAt))
+}
+
+// expireRemediations reports the remediations whose remediated or replacement node
+// did not become Ready in time as failed
+func (r *ReconcileMachineHealthCheck) expireRemediations(mhc *machinev1.MachineHealthCheck) {
+	for _, remediation := range r.tracker.expirePending(namespacedName(mhc), time.Now(), replacementReadyTimeout) {
+		klog.Warningf("%s/%s: no Ready node within %v of %s remediation of machine with UID %s", mhc.Namespace, mhc.Name, replacementReadyTimeout, remediation.strategy, remediation.machineUID)
+		metrics.ObserveMachineHealthCheckRemediationFailure(mhc.Name, mhc.Namespace, remediation.strategy, remediationFailureReplacementNotReady)
+	}
+}
+
 func (r *ReconcileMachineHealthCheck) getTargetsFromMHC(mhc machinev1.MachineHealthCheck) ([]target, error) {
 	machines, err := r.getMachinesFromMHC(mhc)
 	if err != nil {
@@ -642,6 +1077,7 @@ func (r *ReconcileMachineHealthCheck) internalRemediation(t target) error {
 			"Machine %v has no controller owner, skipping remediation",
 			t.string(),
 		)
+		r.observeRemediationFailure(t, metrics.RemediationStrategyDelete, remediationFailureNoControllerOwner)
 		klog.Infof("%s: no controller owner, skipping remediation", t.string())
 		return nil
 	}
@@ -671,6 +1107,7 @@ func (r *ReconcileMachineHealthCheck) internalRemediation(t target) error {
 			t.string(),
 			err,
 		)
+		r.observeRemediationFailure(t, metrics.RemediationStrategyDelete, remediationFailureDeletionFailed)
 		return fmt.Errorf("%s: failed to delete machine: %v", t.string(), err)
 	}
 	r.recorder.Eventf(
@@ -681,6 +1118,7 @@ func (r *ReconcileMachineHealthCheck) internalRemediation(t target) error {
 		t.string(),
 	)
 	metrics.ObserveMachineHealthCheckRemediationSuccess(t.MHC.Name, t.MHC.Namespace)
+	r.observeRemediation(t, metrics.RemediationStrategyDelete)
 
 	return nil
 }
@@ -706,6 +1144,7 @@ func (t *target) remediationStrategyExternal(r *ReconcileMachineHealthCheck) err
 			t.string(),
 			err,
 		)
+		r.observeRemediationFailure(*t, metrics.RemediationStrategyExternal, remediationFailureExternalAnnotationFailed)
 		return err
 	}
 	r.recorder.Eventf(
@@ -715,6 +1154,7 @@ func (t *target) remediationStrategyExternal(r *ReconcileMachineHealthCheck) err
 		"Requesting external remediation of node associated with machine %v",
 		t.string(),
 	)
+	r.observeRemediation(*t, metrics.RemediationStrategyExternal)
 	return nil
 }
 
@@ -819,6 +1259,37 @@ func (t *target) needsRemediation(timeoutForMachineToHaveNode time.Duration) (bo
 	return false, minDuration(nextCheckTimes), nil
 }
 
+// unhealthySince returns when the target started to meet the unhealthy criteria of the MHC,
+// falling back to now when it can't be told from the target
+func (t *target) unhealthySince(now time.Time) time.Time {
+	if t.Node == nil {
+		if t.Machine.Status.LastUpdated != nil {
+			return t.Machine.Status.LastUpdated.Time
+		}
+		return now
+	}
+
+	since := now
+	for _, c := range t.MHC.Spec.UnhealthyConditions {
+		nodeCondition := conditions.GetNodeCondition(t.Node, c.Type)
+		if nodeCondition != nil && nodeCondition.Status == c.Status && nodeCondition.LastTransitionTime.Time.Before(since) {
+			since = nodeCondition.LastTransitionTime.Time
+		}
+	}
+	return since
+}
+
+// hasInternalRemediationFallback returns true when the built-in remediation of the MHC can remediate the target
+// after its external remediation timed out: by the external-baremetal strategy, or by deleting a Machine which has
+// a controller owner to replace it.
+func (t *target) hasInternalRemediationFallback() bool {
+	if derefStringPointer(t.Machine.Status.Phase) != machinev1.PhaseFailed &&
+		machinev1.RemediationStrategyType(t.MHC.Annotations[remediationStrategyAnnotation]) == remediationStrategyExternal {
+		return true
+	}
+	return t.hasControllerOwner()
+}
+
 func (t *target) hasControllerOwner() bool {
 	return metav1.GetControllerOf(&t.Machine) != nil
 }
@@ -15,6 +15,7 @@ import (
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 
 	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"github.com/openshift/machine-api-operator/pkg/util/maintenance"
 	maotesting "github.com/openshift/machine-api-operator/pkg/util/testing"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
@@ -590,6 +591,305 @@ func TestReconcileExternalRemediationTemplate(t *testing.T) {
 	}
 }
 
+func TestReconcileExternalRemediationTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	nodeUnHealthy := maotesting.NewNode("NodeUnhealthy", false)
+	machineWithNodeUnHealthy := maotesting.NewMachine("Machine", nodeUnHealthy.Name)
+	machineWithNodeUnHealthy.APIVersion = machinev1.SchemeGroupVersion.String()
+
+	ermTemplate := maotesting.NewExternalRemediationTemplate()
+	mhcWithTimeout := newMachineHealthCheckWithRemediationTemplate(ermTemplate)
+	mhcWithTimeout.Annotations = map[string]string{
+		externalRemediationTimeoutAnnotation: "10m",
+	}
+
+	ermTimedOut := maotesting.NewExternalRemediationMachine()
+	ermTimedOut.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-time.Hour)))
+
+	ermInProgress := maotesting.NewExternalRemediationMachine()
+	ermInProgress.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-time.Minute)))
+
+	ermFailing := maotesting.NewExternalRemediationMachine()
+	ermFailing.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-time.Minute)))
+	ermFailing.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{
+				"type":    "Succeeded",
+				"status":  "False",
+				"reason":  "PowerCycleFailed",
+				"message": "unable to power cycle host",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		erm                *unstructured.Unstructured
+		withoutOwner       bool
+		expectedResult     reconcile.Result
+		expectedEvents     []string
+		expectErmExists    bool
+		expectMachineExist bool
+		expectedConditions []machinev1.Condition
+	}{
+		{
+			name:               "external remediation timed out is escalated to machine deletion",
+			erm:                ermTimedOut,
+			expectedResult:     reconcile.Result{},
+			expectedEvents:     []string{EventExternalRemediationTimedOut, EventMachineDeleted},
+			expectErmExists:    false,
+			expectMachineExist: false,
+			expectedConditions: []machinev1.Condition{remediationAllowedCondition},
+		},
+		{
+			name:               "external remediation timed out is not escalated without built-in remediation",
+			erm:                ermTimedOut,
+			withoutOwner:       true,
+			expectedResult:     reconcile.Result{},
+			expectedEvents:     []string{},
+			expectErmExists:    true,
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{remediationAllowedCondition},
+		},
+		{
+			name:               "external remediation in progress is requeued until timeout",
+			erm:                ermInProgress,
+			expectedResult:     reconcile.Result{RequeueAfter: 9 * time.Minute},
+			expectedEvents:     []string{},
+			expectErmExists:    true,
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{remediationAllowedCondition},
+		},
+		{
+			name:               "external remediation conditions are surfaced on the MHC",
+			erm:                ermFailing,
+			expectedResult:     reconcile.Result{RequeueAfter: 9 * time.Minute},
+			expectedEvents:     []string{},
+			expectErmExists:    true,
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{
+				remediationAllowedCondition,
+				{
+					Type:     remediationRequestConditionPrefix + "Succeeded",
+					Status:   corev1.ConditionFalse,
+					Severity: machinev1.ConditionSeverityWarning,
+					Reason:   "PowerCycleFailed",
+					Message:  "Machine: unable to power cycle host",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machine := machineWithNodeUnHealthy.DeepCopy()
+			if tc.withoutOwner {
+				machine.OwnerReferences = nil
+			}
+			recorder := record.NewFakeRecorder(2)
+			r := newFakeReconcilerWithCustomRecorder(recorder,
+				mhcWithTimeout.DeepCopy(),
+				machine,
+				nodeUnHealthy.DeepCopy(),
+				ermTemplate.DeepCopy(),
+				tc.erm.DeepCopy(),
+			)
+
+			result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(mhcWithTimeout)})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.RequeueAfter).To(BeNumerically("~", tc.expectedResult.RequeueAfter, 2*time.Second))
+			assertEvents(t, tc.name, tc.expectedEvents, recorder.Events)
+
+			erm := &unstructured.Unstructured{}
+			erm.SetGroupVersionKind(tc.erm.GroupVersionKind())
+			err = r.client.Get(ctx, namespacedName(tc.erm), erm)
+			g.Expect(err == nil).To(Equal(tc.expectErmExists), "unexpected remediation request state: %v", err)
+
+			machine = &machinev1.Machine{}
+			err = r.client.Get(ctx, namespacedName(machineWithNodeUnHealthy), machine)
+			g.Expect(err == nil).To(Equal(tc.expectMachineExist), "unexpected machine state: %v", err)
+
+			mhc := &machinev1.MachineHealthCheck{}
+			g.Expect(r.client.Get(ctx, namespacedName(mhcWithTimeout), mhc)).To(Succeed())
+			g.Expect(mhc.Status.Conditions).To(conditions.MatchConditions(tc.expectedConditions))
+		})
+	}
+}
+
+func TestGetExternalRemediationTimeout(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{
+			name:     "annotation not set",
+			expected: 0,
+		},
+		{
+			name:        "valid duration",
+			annotations: map[string]string{externalRemediationTimeoutAnnotation: "1h30m"},
+			expected:    90 * time.Minute,
+		},
+		{
+			name:          "invalid duration",
+			annotations:   map[string]string{externalRemediationTimeoutAnnotation: "forever"},
+			expectedError: true,
+		},
+		{
+			name:          "negative duration",
+			annotations:   map[string]string{externalRemediationTimeoutAnnotation: "-5m"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mhc := maotesting.NewMachineHealthCheck("machineHealthCheck")
+			mhc.Annotations = tc.annotations
+
+			timeout, err := getExternalRemediationTimeout(mhc)
+			if tc.expectedError {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(timeout).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestReconcileRemediationSuppression(t *testing.T) {
+	ctx := context.Background()
+
+	nodeUnHealthy := maotesting.NewNode("NodeUnhealthy", false)
+	machineWithNodeUnHealthy := maotesting.NewMachine("Machine", nodeUnHealthy.Name)
+
+	now := time.Now()
+	excludedUntil := now.Add(time.Hour).UTC().Truncate(time.Second)
+
+	maintenanceWindows := `[{"schedule": "* * * * *", "duration": "1h"}]`
+	windows, err := maintenance.Parse(maintenanceWindows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	windowEnd, _ := maintenance.Active(windows, now)
+
+	testCases := []struct {
+		name               string
+		machineAnnotations map[string]string
+		mhcAnnotations     map[string]string
+		expectedResult     reconcile.Result
+		expectedEvents     []string
+		expectMachineExist bool
+		expectedConditions []machinev1.Condition
+	}{
+		{
+			name:               "machine excluded from remediation",
+			machineAnnotations: map[string]string{excludeFromRemediationAnnotation: ""},
+			expectedResult:     reconcile.Result{},
+			expectedEvents:     []string{EventRemediationSkippedExcluded},
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{
+				remediationAllowedCondition,
+				{
+					Type:     remediationSuppressedCondition,
+					Status:   corev1.ConditionTrue,
+					Severity: machinev1.ConditionSeverityInfo,
+					Reason:   machinesExcludedReason,
+					Message:  "Unhealthy machines are excluded from remediation: Machine",
+				},
+			},
+		},
+		{
+			name:               "machine excluded from remediation until a later time is requeued until then",
+			machineAnnotations: map[string]string{excludeFromRemediationAnnotation: excludedUntil.Format(time.RFC3339)},
+			expectedResult:     reconcile.Result{RequeueAfter: time.Hour},
+			expectedEvents:     []string{EventRemediationSkippedExcluded},
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{
+				remediationAllowedCondition,
+				{
+					Type:     remediationSuppressedCondition,
+					Status:   corev1.ConditionTrue,
+					Severity: machinev1.ConditionSeverityInfo,
+					Reason:   machinesExcludedReason,
+					Message:  "Unhealthy machines are excluded from remediation: Machine",
+				},
+			},
+		},
+		{
+			name:               "machine with an expired exclusion is remediated",
+			machineAnnotations: map[string]string{excludeFromRemediationAnnotation: now.Add(-time.Hour).UTC().Format(time.RFC3339)},
+			expectedResult:     reconcile.Result{},
+			expectedEvents:     []string{EventMachineDeleted},
+			expectMachineExist: false,
+			expectedConditions: []machinev1.Condition{remediationAllowedCondition},
+		},
+		{
+			name:               "machine is not remediated during a maintenance window",
+			mhcAnnotations:     map[string]string{maintenanceWindowsAnnotation: maintenanceWindows},
+			expectedResult:     reconcile.Result{RequeueAfter: windowEnd.Sub(now)},
+			expectedEvents:     []string{EventRemediationSkippedMaintenanceWindow},
+			expectMachineExist: true,
+			expectedConditions: []machinev1.Condition{
+				remediationAllowedCondition,
+				{
+					Type:     remediationSuppressedCondition,
+					Status:   corev1.ConditionTrue,
+					Severity: machinev1.ConditionSeverityInfo,
+					Reason:   maintenanceWindowReason,
+					Message:  fmt.Sprintf("Remediation is suppressed by a maintenance window until %s", windowEnd.Format(time.RFC3339)),
+				},
+			},
+		},
+		{
+			name:               "machine is remediated when maintenance windows are invalid",
+			mhcAnnotations:     map[string]string{maintenanceWindowsAnnotation: "weekends"},
+			expectedResult:     reconcile.Result{},
+			expectedEvents:     []string{EventInvalidMaintenanceWindows, EventMachineDeleted},
+			expectMachineExist: false,
+			expectedConditions: []machinev1.Condition{remediationAllowedCondition},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			machine := machineWithNodeUnHealthy.DeepCopy()
+			machine.Annotations = tc.machineAnnotations
+			mhc := maotesting.NewMachineHealthCheck("machineHealthCheck")
+			mhc.Annotations = tc.mhcAnnotations
+
+			recorder := record.NewFakeRecorder(2)
+			r := newFakeReconcilerWithCustomRecorder(recorder, mhc, machine, nodeUnHealthy.DeepCopy())
+
+			result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(mhc)})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result.RequeueAfter).To(BeNumerically("~", tc.expectedResult.RequeueAfter, 2*time.Second))
+			assertEvents(t, tc.name, tc.expectedEvents, recorder.Events)
+
+			err = r.client.Get(ctx, namespacedName(machine), &machinev1.Machine{})
+			g.Expect(err == nil).To(Equal(tc.expectMachineExist), "unexpected machine state: %v", err)
+
+			g.Expect(r.client.Get(ctx, namespacedName(mhc), mhc)).To(Succeed())
+			g.Expect(mhc.Status.Conditions).To(conditions.MatchConditions(tc.expectedConditions))
+
+			// The events are not emitted again while the suppression is unchanged
+			if tc.expectMachineExist {
+				_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(mhc)})
+				g.Expect(err).ToNot(HaveOccurred())
+				assertEvents(t, tc.name, []string{}, recorder.Events)
+			}
+		})
+	}
+}
+
 func TestHasControllerOwner(t *testing.T) {
 	machineWithMachineSet := maotesting.NewMachine("machineWithMachineSet", "node")
 
@@ -2635,7 +2935,7 @@ func TestHealthCheckTargets(t *testing.T) {
 		recorder := record.NewFakeRecorder(2)
 		r := newFakeReconcilerWithCustomRecorder(recorder)
 		t.Run(tc.testCase, func(t *testing.T) {
-			currentHealhty, needRemediationTargets, nextCheckTimes, errList := r.healthCheckTargets(tc.targets, tc.timeoutForMachineToHaveNode)
+			currentHealhty, needRemediationTargets, nextCheckTimes, errList := r.healthCheckTargets(types.NamespacedName{Namespace: namespace, Name: "mhc"}, tc.targets, tc.timeoutForMachineToHaveNode)
 			if len(currentHealhty) != tc.currentHealthy {
 				t.Errorf("Case: %v. Got: %v, expected: %v", tc.testCase, currentHealhty, tc.currentHealthy)
 			}
@@ -0,0 +1,219 @@
+package machinehealthcheck
+
+import (
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// remediationTracker keeps track of when targets were first detected unhealthy, and of the remediations
+// waiting for the remediated or replacement node to become Ready, so remediation latencies can be reported.
+// It also keeps track of the reported suppressions and invalid annotations, so their events are only emitted
+// when they change, and of the reported remediation failures, so they are counted once per unhealthy target.
+// The zero value is ready to use.
+type remediationTracker struct {
+	mu sync.Mutex
+	// detectedUnhealthy maps a MHC to the time each of its unhealthy targets, by Machine UID, was first detected
+	detectedUnhealthy map[types.NamespacedName]map[types.UID]time.Time
+	// pending maps a MHC to its remediations waiting for a Ready node, oldest first
+	pending map[types.NamespacedName][]pendingRemediation
+	// suppressed maps a MHC to the message of the last event reported for each of its targets, by Machine UID,
+	// whose remediation is suppressed
+	suppressed map[types.NamespacedName]map[types.UID]string
+	// invalidMaintenanceWindows maps a MHC to the last invalid maintenance windows annotation reported for it
+	invalidMaintenanceWindows map[types.NamespacedName]string
+	// failures maps a MHC to the reasons of the reported remediation failures of its unhealthy targets, by Machine UID
+	failures map[types.NamespacedName]map[types.UID]map[string]bool
+}
+
+// pendingRemediation is a remediation waiting for a Ready node
+type pendingRemediation struct {
+	machineUID   types.UID
+	ownerUID     types.UID
+	strategy     string
+	remediatedAt time.Time
+}
+
+// detectedUnhealthyAt records the target as unhealthy, if it was not already, and returns the time it was first detected unhealthy
+func (rt *remediationTracker) detectedUnhealthyAt(mhc types.NamespacedName, machineUID types.UID, at time.Time) time.Time {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.detectedUnhealthy == nil {
+		rt.detectedUnhealthy = map[types.NamespacedName]map[types.UID]time.Time{}
+	}
+	if rt.detectedUnhealthy[mhc] == nil {
+		rt.detectedUnhealthy[mhc] = map[types.UID]time.Time{}
+	}
+	if detected, ok := rt.detectedUnhealthy[mhc][machineUID]; ok {
+		return detected
+	}
+	rt.detectedUnhealthy[mhc][machineUID] = at
+	return at
+}
+
+// retainUnhealthy forgets the unhealthy targets of the MHC which are not part of the given Machine UIDs anymore
+func (rt *remediationTracker) retainUnhealthy(mhc types.NamespacedName, machineUIDs map[types.UID]bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for uid := range rt.detectedUnhealthy[mhc] {
+		if !machineUIDs[uid] {
+			delete(rt.detectedUnhealthy[mhc], uid)
+		}
+	}
+	for uid := range rt.failures[mhc] {
+		if !machineUIDs[uid] {
+			delete(rt.failures[mhc], uid)
+		}
+	}
+}
+
+// addPending records a remediation waiting for a Ready node
+func (rt *remediationTracker) addPending(mhc types.NamespacedName, remediation pendingRemediation) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.pending == nil {
+		rt.pending = map[types.NamespacedName][]pendingRemediation{}
+	}
+	rt.pending[mhc] = append(rt.pending[mhc], remediation)
+}
+
+// takePending returns and forgets the oldest pending remediation which the given Machine, backed by a Ready node, completes.
+// Remediations by deletion are completed by a newer Machine of the same controller owner, while external
+// remediations are completed by the remediated Machine itself.
+func (rt *remediationTracker) takePending(mhc types.NamespacedName, machine *machinev1.Machine) (pendingRemediation, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var ownerUID types.UID
+	if owner := metav1.GetControllerOf(machine); owner != nil {
+		ownerUID = owner.UID
+	}
+
+	for i, p := range rt.pending[mhc] {
+		completed := false
+		switch p.strategy {
+		case metrics.RemediationStrategyDelete:
+			// creation timestamps have a precision of a second
+			completed = p.machineUID != machine.UID && p.ownerUID != "" && p.ownerUID == ownerUID &&
+				!machine.CreationTimestamp.Time.Before(p.remediatedAt.Truncate(time.Second))
+		default:
+			completed = p.machineUID == machine.UID
+		}
+		if completed {
+			rt.pending[mhc] = append(rt.pending[mhc][:i], rt.pending[mhc][i+1:]...)
+			return p, true
+		}
+	}
+	return pendingRemediation{}, false
+}
+
+// expirePending returns and forgets the pending remediations older than the given timeout
+func (rt *remediationTracker) expirePending(mhc types.NamespacedName, now time.Time, timeout time.Duration) []pendingRemediation {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var expired, remaining []pendingRemediation
+	for _, p := range rt.pending[mhc] {
+		if now.Sub(p.remediatedAt) > timeout {
+			expired = append(expired, p)
+			continue
+		}
+		remaining = append(remaining, p)
+	}
+	if len(expired) > 0 {
+		rt.pending[mhc] = remaining
+	}
+	return expired
+}
+
+// reportSuppressed records the message of the suppression of the target's remediation, and returns true when it
+// was not reported yet
+func (rt *remediationTracker) reportSuppressed(mhc types.NamespacedName, machineUID types.UID, message string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.suppressed == nil {
+		rt.suppressed = map[types.NamespacedName]map[types.UID]string{}
+	}
+	if rt.suppressed[mhc] == nil {
+		rt.suppressed[mhc] = map[types.UID]string{}
+	}
+	if reported, ok := rt.suppressed[mhc][machineUID]; ok && reported == message {
+		return false
+	}
+	rt.suppressed[mhc][machineUID] = message
+	return true
+}
+
+// retainSuppressed forgets the suppressed targets of the MHC which are not part of the given Machine UIDs anymore
+func (rt *remediationTracker) retainSuppressed(mhc types.NamespacedName, machineUIDs map[types.UID]bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for uid := range rt.suppressed[mhc] {
+		if !machineUIDs[uid] {
+			delete(rt.suppressed[mhc], uid)
+		}
+	}
+}
+
+// reportInvalidMaintenanceWindows records the invalid maintenance windows annotation of the MHC, and returns true
+// when it was not reported yet. An empty value forgets the reported annotation.
+func (rt *remediationTracker) reportInvalidMaintenanceWindows(mhc types.NamespacedName, value string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if value == "" {
+		delete(rt.invalidMaintenanceWindows, mhc)
+		return false
+	}
+	if rt.invalidMaintenanceWindows == nil {
+		rt.invalidMaintenanceWindows = map[types.NamespacedName]string{}
+	}
+	if reported, ok := rt.invalidMaintenanceWindows[mhc]; ok && reported == value {
+		return false
+	}
+	rt.invalidMaintenanceWindows[mhc] = value
+	return true
+}
+
+// reportFailure records that the remediation of the unhealthy target failed for the given reason, and returns true
+// when it was not reported yet. It is reported anew once the target went unhealthy again.
+func (rt *remediationTracker) reportFailure(mhc types.NamespacedName, machineUID types.UID, reason string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.failures == nil {
+		rt.failures = map[types.NamespacedName]map[types.UID]map[string]bool{}
+	}
+	if rt.failures[mhc] == nil {
+		rt.failures[mhc] = map[types.UID]map[string]bool{}
+	}
+	if rt.failures[mhc][machineUID] == nil {
+		rt.failures[mhc][machineUID] = map[string]bool{}
+	}
+	if rt.failures[mhc][machineUID][reason] {
+		return false
+	}
+	rt.failures[mhc][machineUID][reason] = true
+	return true
+}
+
+// forget forgets everything tracked for the MHC
+func (rt *remediationTracker) forget(mhc types.NamespacedName) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.detectedUnhealthy, mhc)
+	delete(rt.pending, mhc)
+	delete(rt.suppressed, mhc)
+	delete(rt.invalidMaintenanceWindows, mhc)
+	delete(rt.failures, mhc)
+}
@@ -0,0 +1,411 @@
+package machinehealthcheck
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	maotesting "github.com/openshift/machine-api-operator/pkg/util/testing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestRemediationTrackerTakePending(t *testing.T) {
+	mhc := types.NamespacedName{Namespace: namespace, Name: "mhc"}
+	remediatedAt := time.Now()
+
+	newMachine := func(uid, ownerUID types.UID, created time.Time) *machinev1.Machine {
+		machine := maotesting.NewMachine("machine", "")
+		machine.UID = uid
+		machine.OwnerReferences[0].UID = ownerUID
+		machine.CreationTimestamp = metav1.NewTime(created)
+		return machine
+	}
+
+	testCases := []struct {
+		name          string
+		remediation   pendingRemediation
+		machine       *machinev1.Machine
+		expectedTaken bool
+	}{
+		{
+			name: "deletion completed by a newer machine of the same owner",
+			remediation: pendingRemediation{
+				machineUID:   "old",
+				ownerUID:     "machineset",
+				strategy:     metrics.RemediationStrategyDelete,
+				remediatedAt: remediatedAt,
+			},
+			machine:       newMachine("new", "machineset", remediatedAt.Add(time.Second)),
+			expectedTaken: true,
+		},
+		{
+			name: "deletion not completed by an older machine of the same owner",
+			remediation: pendingRemediation{
+				machineUID:   "old",
+				ownerUID:     "machineset",
+				strategy:     metrics.RemediationStrategyDelete,
+				remediatedAt: remediatedAt,
+			},
+			machine:       newMachine("other", "machineset", remediatedAt.Add(-time.Hour)),
+			expectedTaken: false,
+		},
+		{
+			name: "deletion not completed by a machine of another owner",
+			remediation: pendingRemediation{
+				machineUID:   "old",
+				ownerUID:     "machineset",
+				strategy:     metrics.RemediationStrategyDelete,
+				remediatedAt: remediatedAt,
+			},
+			machine:       newMachine("new", "other-machineset", remediatedAt.Add(time.Second)),
+			expectedTaken: false,
+		},
+		{
+			name: "external remediation completed by the remediated machine",
+			remediation: pendingRemediation{
+				machineUID:   "remediated",
+				ownerUID:     "machineset",
+				strategy:     metrics.RemediationStrategyExternal,
+				remediatedAt: remediatedAt,
+			},
+			machine:       newMachine("remediated", "machineset", remediatedAt.Add(-time.Hour)),
+			expectedTaken: true,
+		},
+		{
+			name: "external remediation not completed by another machine",
+			remediation: pendingRemediation{
+				machineUID:   "remediated",
+				ownerUID:     "machineset",
+				strategy:     metrics.RemediationStrategyExternal,
+				remediatedAt: remediatedAt,
+			},
+			machine:       newMachine("new", "machineset", remediatedAt.Add(time.Second)),
+			expectedTaken: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tracker := &remediationTracker{}
+			tracker.addPending(mhc, tc.remediation)
+
+			remediation, taken := tracker.takePending(mhc, tc.machine)
+			g.Expect(taken).To(Equal(tc.expectedTaken))
+			if tc.expectedTaken {
+				g.Expect(remediation).To(Equal(tc.remediation))
+				g.Expect(tracker.pending[mhc]).To(BeEmpty())
+			} else {
+				g.Expect(tracker.pending[mhc]).To(ConsistOf(tc.remediation))
+			}
+		})
+	}
+}
+
+func TestRemediationTrackerExpirePending(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := types.NamespacedName{Namespace: namespace, Name: "mhc"}
+	now := time.Now()
+	expired := pendingRemediation{machineUID: "expired", strategy: metrics.RemediationStrategyDelete, remediatedAt: now.Add(-2 * time.Hour)}
+	recent := pendingRemediation{machineUID: "recent", strategy: metrics.RemediationStrategyDelete, remediatedAt: now.Add(-time.Minute)}
+
+	tracker := &remediationTracker{}
+	tracker.addPending(mhc, expired)
+	tracker.addPending(mhc, recent)
+
+	g.Expect(tracker.expirePending(mhc, now, time.Hour)).To(ConsistOf(expired))
+	g.Expect(tracker.pending[mhc]).To(ConsistOf(recent))
+}
+
+func TestRemediationTrackerDetectedUnhealthy(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := types.NamespacedName{Namespace: namespace, Name: "mhc"}
+	firstDetected := time.Now().Add(-time.Minute)
+
+	tracker := &remediationTracker{}
+	g.Expect(tracker.detectedUnhealthyAt(mhc, "machine", firstDetected)).To(Equal(firstDetected))
+	// The first detection is kept while the target stays unhealthy
+	g.Expect(tracker.detectedUnhealthyAt(mhc, "machine", time.Now())).To(Equal(firstDetected))
+
+	// Once healthy again, the target is detected anew
+	tracker.retainUnhealthy(mhc, map[types.UID]bool{})
+	detected := time.Now()
+	g.Expect(tracker.detectedUnhealthyAt(mhc, "machine", detected)).To(Equal(detected))
+
+	tracker.forget(mhc)
+	g.Expect(tracker.detectedUnhealthy).ToNot(HaveKey(mhc))
+}
+
+func TestRemediationTrackerReportSuppressed(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := types.NamespacedName{Namespace: namespace, Name: "mhc"}
+
+	tracker := &remediationTracker{}
+	g.Expect(tracker.reportSuppressed(mhc, "machine", "excluded")).To(BeTrue())
+	// The suppression is only reported again when it changes
+	g.Expect(tracker.reportSuppressed(mhc, "machine", "excluded")).To(BeFalse())
+	g.Expect(tracker.reportSuppressed(mhc, "machine", "excluded until tomorrow")).To(BeTrue())
+
+	// Once its remediation is not suppressed anymore, the target is reported anew
+	tracker.retainSuppressed(mhc, map[types.UID]bool{})
+	g.Expect(tracker.reportSuppressed(mhc, "machine", "excluded until tomorrow")).To(BeTrue())
+
+	g.Expect(tracker.reportInvalidMaintenanceWindows(mhc, "weekends")).To(BeTrue())
+	g.Expect(tracker.reportInvalidMaintenanceWindows(mhc, "weekends")).To(BeFalse())
+	g.Expect(tracker.reportInvalidMaintenanceWindows(mhc, "")).To(BeFalse())
+	g.Expect(tracker.reportInvalidMaintenanceWindows(mhc, "weekends")).To(BeTrue())
+
+	tracker.forget(mhc)
+	g.Expect(tracker.suppressed).ToNot(HaveKey(mhc))
+	g.Expect(tracker.invalidMaintenanceWindows).ToNot(HaveKey(mhc))
+}
+
+func TestRemediationTrackerReportFailure(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := types.NamespacedName{Namespace: namespace, Name: "mhc"}
+
+	tracker := &remediationTracker{}
+	g.Expect(tracker.reportFailure(mhc, "machine", remediationFailureDeletionFailed)).To(BeTrue())
+	// The failure is only reported once for each reason while the target stays unhealthy
+	g.Expect(tracker.reportFailure(mhc, "machine", remediationFailureDeletionFailed)).To(BeFalse())
+	g.Expect(tracker.reportFailure(mhc, "machine", remediationFailureNoControllerOwner)).To(BeTrue())
+	tracker.retainUnhealthy(mhc, map[types.UID]bool{"machine": true})
+	g.Expect(tracker.reportFailure(mhc, "machine", remediationFailureDeletionFailed)).To(BeFalse())
+
+	// Once healthy again, the target is reported anew
+	tracker.retainUnhealthy(mhc, map[types.UID]bool{})
+	g.Expect(tracker.reportFailure(mhc, "machine", remediationFailureDeletionFailed)).To(BeTrue())
+
+	tracker.forget(mhc)
+	g.Expect(tracker.failures).ToNot(HaveKey(mhc))
+}
+
+func TestRemediationMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := maotesting.NewMachineHealthCheck("remediation-metrics")
+
+	unhealthyNode := maotesting.NewNode("unhealthy", false)
+	unhealthyNode.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	unhealthyMachine := maotesting.NewMachine("unhealthy", unhealthyNode.Name)
+	unhealthyMachine.OwnerReferences[0].UID = "machineset"
+
+	r := newFakeReconcilerWithCustomRecorder(record.NewFakeRecorder(2), mhc, unhealthyMachine, unhealthyNode)
+
+	unhealthyTarget := target{Machine: *unhealthyMachine, Node: unhealthyNode, MHC: *mhc}
+	_, needRemediationTargets, _, errList := r.healthCheckTargets(namespacedName(mhc), []target{unhealthyTarget}, defaultNodeStartupTimeout)
+	g.Expect(errList).To(BeEmpty())
+	g.Expect(needRemediationTargets).To(HaveLen(1))
+
+	remediationCount := histogramSampleCount(g, metrics.MachineHealthCheckTimeToRemediationSeconds, mhc, metrics.RemediationStrategyDelete)
+	g.Expect(r.internalRemediation(unhealthyTarget)).To(Succeed())
+	g.Expect(histogramSampleCount(g, metrics.MachineHealthCheckTimeToRemediationSeconds, mhc, metrics.RemediationStrategyDelete)).To(Equal(remediationCount + 1))
+	g.Expect(r.tracker.pending[namespacedName(mhc)]).To(HaveLen(1))
+
+	// The replacement machine of the same owner comes up with a Ready node
+	replacementNode := maotesting.NewNode("replacement", true)
+	replacementNode.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(time.Minute))
+	replacementMachine := maotesting.NewMachine("replacement", replacementNode.Name)
+	replacementMachine.OwnerReferences[0].UID = "machineset"
+	replacementMachine.CreationTimestamp = metav1.NewTime(time.Now())
+
+	readyCount := histogramSampleCount(g, metrics.MachineHealthCheckTimeToReplacementReadySeconds, mhc, metrics.RemediationStrategyDelete)
+	replacementTarget := target{Machine: *replacementMachine, Node: replacementNode, MHC: *mhc}
+	currentHealthy, _, _, errList := r.healthCheckTargets(namespacedName(mhc), []target{replacementTarget}, defaultNodeStartupTimeout)
+	g.Expect(errList).To(BeEmpty())
+	g.Expect(currentHealthy).To(HaveLen(1))
+	g.Expect(histogramSampleCount(g, metrics.MachineHealthCheckTimeToReplacementReadySeconds, mhc, metrics.RemediationStrategyDelete)).To(Equal(readyCount + 1))
+	g.Expect(r.tracker.pending[namespacedName(mhc)]).To(BeEmpty())
+	g.Expect(r.tracker.detectedUnhealthy[namespacedName(mhc)]).To(BeEmpty())
+}
+
+func TestRemediationFailureMetricsOncePerUnhealthyTarget(t *testing.T) {
+	ctx := context.Background()
+	errInjected := errors.New("injected error")
+
+	template := maotesting.NewExternalRemediationTemplate()
+	template.SetName("remediation-template")
+
+	testCases := []struct {
+		reason    string
+		strategy  string
+		external  bool
+		template  bool
+		noOwner   bool
+		funcs     interceptor.Funcs
+		remediate func(r *ReconcileMachineHealthCheck, t target) error
+	}{
+		{
+			reason:   remediationFailureNoControllerOwner,
+			strategy: metrics.RemediationStrategyDelete,
+			noOwner:  true,
+		},
+		{
+			reason:   remediationFailureDeletionFailed,
+			strategy: metrics.RemediationStrategyDelete,
+			funcs: interceptor.Funcs{
+				Delete: func(context.Context, client.WithWatch, client.Object, ...client.DeleteOption) error {
+					return errInjected
+				},
+			},
+		},
+		{
+			reason:   remediationFailureExternalAnnotationFailed,
+			strategy: metrics.RemediationStrategyExternal,
+			funcs: interceptor.Funcs{
+				Update: func(context.Context, client.WithWatch, client.Object, ...client.UpdateOption) error {
+					return errInjected
+				},
+			},
+		},
+		{
+			reason:   remediationFailureTemplateNotFound,
+			strategy: metrics.RemediationStrategyExternal,
+			external: true,
+		},
+		{
+			reason:   remediationFailureRequestCreationFailed,
+			strategy: metrics.RemediationStrategyExternal,
+			external: true,
+			template: true,
+			funcs: interceptor.Funcs{
+				Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+					return errInjected
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.reason, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mhc := maotesting.NewMachineHealthCheck("remediation-failure-" + strings.ToLower(tc.reason))
+			if tc.external {
+				mhc = newMachineHealthCheckWithRemediationTemplate(template)
+				mhc.Name = "remediation-failure-" + strings.ToLower(tc.reason)
+			}
+			unhealthyNode := maotesting.NewNode("unhealthy", false)
+			unhealthyNode.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-10 * time.Minute))
+			unhealthyMachine := maotesting.NewMachine("unhealthy", unhealthyNode.Name)
+			unhealthyMachine.APIVersion = machinev1.SchemeGroupVersion.String()
+			if tc.noOwner {
+				unhealthyMachine.OwnerReferences = nil
+			}
+
+			objects := []runtime.Object{mhc, unhealthyMachine, unhealthyNode}
+			if tc.template {
+				objects = append(objects, template.DeepCopy())
+			}
+			r := newFakeReconcilerWithCustomRecorder(record.NewFakeRecorder(10), objects...)
+			r.client = interceptor.NewClient(r.client.(client.WithWatch), tc.funcs)
+			unhealthyTarget := target{Machine: *unhealthyMachine, Node: unhealthyNode, MHC: *mhc}
+
+			remediate := func() {
+				_, needRemediationTargets, _, errList := r.healthCheckTargets(namespacedName(mhc), []target{unhealthyTarget}, defaultNodeStartupTimeout)
+				g.Expect(errList).To(BeEmpty())
+				g.Expect(needRemediationTargets).To(HaveLen(1))
+				switch {
+				case tc.external:
+					_ = r.externalRemediation(ctx, mhc, unhealthyTarget)
+				case tc.strategy == metrics.RemediationStrategyExternal:
+					// the annotation of the failed update is not kept, the machine is fetched anew by each reconcile
+					t := target{Machine: *unhealthyMachine.DeepCopy(), Node: unhealthyNode, MHC: *mhc}
+					_ = t.remediationStrategyExternal(r)
+				default:
+					_ = r.internalRemediation(unhealthyTarget)
+				}
+			}
+			failureCount := func() float64 {
+				return testutil.ToFloat64(metrics.MachineHealthCheckRemediationFailureTotal.WithLabelValues(
+					mhc.Name, mhc.Namespace, tc.strategy, tc.reason))
+			}
+
+			failures := failureCount()
+			// Every reconcile of the target retries to remediate it while it stays unhealthy
+			for i := 0; i < 3; i++ {
+				remediate()
+			}
+			g.Expect(failureCount()).To(Equal(failures + 1))
+
+			// Once the MHC has no unhealthy target anymore, the failure is counted anew
+			_, _, _, errList := r.healthCheckTargets(namespacedName(mhc), nil, defaultNodeStartupTimeout)
+			g.Expect(errList).To(BeEmpty())
+			remediate()
+			g.Expect(failureCount()).To(Equal(failures + 2))
+		})
+	}
+}
+
+func histogramSampleCount(g Gomega, histogram *prometheus.HistogramVec, mhc *machinev1.MachineHealthCheck, strategy string) uint64 {
+	metric := &dto.Metric{}
+	g.Expect(histogram.WithLabelValues(mhc.Name, mhc.Namespace, strategy).(prometheus.Metric).Write(metric)).To(Succeed())
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestUnhealthySince(t *testing.T) {
+	now := time.Now()
+	lastTransition := now.Add(-time.Hour)
+	lastUpdated := now.Add(-2 * time.Hour)
+
+	testCases := []struct {
+		name     string
+		node     *corev1.Node
+		machine  *machinev1.Machine
+		expected time.Time
+	}{
+		{
+			name: "with a node matching an unhealthy condition",
+			node: func() *corev1.Node {
+				node := maotesting.NewNode("node", false)
+				node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(lastTransition)
+				return node
+			}(),
+			machine:  maotesting.NewMachine("machine", "node"),
+			expected: lastTransition,
+		},
+		{
+			name:     "with a node not matching any unhealthy condition",
+			node:     maotesting.NewNode("node", true),
+			machine:  maotesting.NewMachine("machine", "node"),
+			expected: now,
+		},
+		{
+			name: "without a node",
+			machine: func() *machinev1.Machine {
+				machine := maotesting.NewMachine("machine", "")
+				machine.Status.LastUpdated = &metav1.Time{Time: lastUpdated}
+				return machine
+			}(),
+			expected: lastUpdated,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tgt := target{Machine: *tc.machine, Node: tc.node, MHC: *maotesting.NewMachineHealthCheck("mhc")}
+			g.Expect(tgt.unhealthySince(now)).To(Equal(tc.expected))
+		})
+	}
+}
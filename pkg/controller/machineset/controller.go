@@ -224,7 +224,9 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *machine
 		filteredMachines = append(filteredMachines, machineSetMachines[machineName])
 	}
 
-	syncErr := r.syncReplicas(machineSet, filteredMachines)
+	// A failure to update the node metadata of existing machines must not block syncing the replicas.
+	metadataErr := r.syncNodeMetadata(machineSet, filteredMachines)
+	syncErr := errors.Join(metadataErr, r.syncReplicas(machineSet, filteredMachines))
 
 	ms := machineSet.DeepCopy()
 	newStatus := r.calculateStatus(ms, filteredMachines)
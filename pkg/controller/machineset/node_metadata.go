@@ -0,0 +1,215 @@
+package machineset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// templateLabelsAnnotationKey, templateAnnotationsAnnotationKey and templateTaintsAnnotationKey record on a Machine
+// the comma separated keys of the node metadata copied from the MachineSet template, so they can be removed once
+// removed from the template. They are annotations of the Machine itself, not of its Node.
+const (
+	templateLabelsAnnotationKey      = "machine.openshift.io/template-node-labels"
+	templateAnnotationsAnnotationKey = "machine.openshift.io/template-node-annotations"
+	// template taints are identified by key and effect, as key:effect
+	templateTaintsAnnotationKey = "machine.openshift.io/template-node-taints"
+)
+
+// shouldPropagateNodeMetadata returns true if the MachineSet opted in to propagate the node metadata of its template
+// to the existing Machines
+func shouldPropagateNodeMetadata(ms *machinev1.MachineSet) bool {
+	return ms.Annotations[annotations.PropagateNodeMetadataAnnotation] == "true"
+}
+
+// syncNodeMetadata updates in place the node labels, annotations and taints of the given Machines which differ
+// from the MachineSet template, when the MachineSet opted in. The nodelink controller then syncs them to the Nodes.
+// Only the keys of the template are added, updated and, once removed from the template, removed: the node metadata
+// a Machine has on its own is kept. Machines are never replaced, nor is any other field of their spec changed.
+func (r *ReconcileMachineSet) syncNodeMetadata(ms *machinev1.MachineSet, machines []*machinev1.Machine) error {
+	if !shouldPropagateNodeMetadata(ms) {
+		return nil
+	}
+
+	var errstrings []string
+	for _, machine := range machines {
+		if !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		original := machine.DeepCopy()
+		syncTemplateNodeMetadata(&ms.Spec.Template.Spec, machine)
+		if equality.Semantic.DeepEqual(original, machine) {
+			continue
+		}
+
+		if err := r.Client.Patch(context.Background(), machine, client.MergeFrom(original)); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			klog.Errorf("Unable to update node metadata of Machine %q: %v", machine.Name, err)
+			errstrings = append(errstrings, err.Error())
+			continue
+		}
+
+		if nodeMetadataInSync(&original.Spec, &machine.Spec) {
+			// Only the template keys were recorded, the Machine was created or synced before they were
+			continue
+		}
+		klog.Infof("Updated node metadata of Machine %q from MachineSet %q template", machine.Name, ms.Name)
+		r.recorder.Eventf(machine, corev1.EventTypeNormal, "NodeMetadataUpdated", "Updated node labels, annotations and taints from MachineSet %s template", ms.Name)
+	}
+
+	if len(errstrings) > 0 {
+		return fmt.Errorf("failed to update node metadata of machines: %s", strings.Join(errstrings, "; "))
+	}
+	return nil
+}
+
+// syncTemplateNodeMetadata copies the node labels, annotations and taints of the template to the Machine spec, and
+// removes the ones previously copied which are not in the template anymore, recording the copied keys on the Machine.
+func syncTemplateNodeMetadata(template *machinev1.MachineSpec, machine *machinev1.Machine) {
+	machine.Spec.ObjectMeta.Labels = syncTemplateKeys(machine, templateLabelsAnnotationKey,
+		template.ObjectMeta.Labels, machine.Spec.ObjectMeta.Labels)
+	machine.Spec.ObjectMeta.Annotations = syncTemplateKeys(machine, templateAnnotationsAnnotationKey,
+		template.ObjectMeta.Annotations, machine.Spec.ObjectMeta.Annotations)
+	machine.Spec.Taints = syncTemplateTaints(machine, template.Taints, machine.Spec.Taints)
+}
+
+// syncTemplateKeys returns the values of the Machine with the values of the template, without the keys previously
+// copied from the template which are not in it anymore. A key the Machine already has with the same value, e.g.
+// added along with the template, is not copied from the template, so it is kept once removed from the template.
+func syncTemplateKeys(machine *machinev1.Machine, annotation string, template, values map[string]string) map[string]string {
+	previouslyCopied := sets.New(getTemplateKeys(machine, annotation)...)
+	if !hasTemplateKeys(machine, annotation) {
+		// The Machine was created with the values of the template before the copied keys were recorded
+		for k, v := range template {
+			if current, ok := values[k]; ok && current == v {
+				previouslyCopied.Insert(k)
+			}
+		}
+	}
+
+	synced := make(map[string]string, len(values))
+	for k, v := range values {
+		if _, ok := template[k]; previouslyCopied.Has(k) && !ok {
+			continue
+		}
+		synced[k] = v
+	}
+
+	var copied []string
+	for k, v := range template {
+		if current, ok := synced[k]; ok && current == v && !previouslyCopied.Has(k) {
+			continue
+		}
+		synced[k] = v
+		copied = append(copied, k)
+	}
+	setTemplateKeys(machine, annotation, copied)
+
+	if len(synced) == 0 {
+		return nil
+	}
+	return synced
+}
+
+// syncTemplateTaints returns the taints of the Machine with the taints of the template, without the taints
+// previously copied from the template which are not in it anymore. Taints are identified by key and effect. A taint
+// the Machine already has with the same key and effect is not copied from the template, it is left untouched.
+func syncTemplateTaints(machine *machinev1.Machine, template, taints []corev1.Taint) []corev1.Taint {
+	previouslyCopied := sets.New(getTemplateKeys(machine, templateTaintsAnnotationKey)...)
+	if !hasTemplateKeys(machine, templateTaintsAnnotationKey) {
+		// The Machine was created with the taints of the template before the copied taints were recorded
+		for _, tTaint := range template {
+			for _, mTaint := range taints {
+				if mTaint.Key == tTaint.Key && mTaint.Effect == tTaint.Effect && mTaint.Value == tTaint.Value {
+					previouslyCopied.Insert(taintKey(tTaint))
+				}
+			}
+		}
+	}
+	templateTaints := map[string]corev1.Taint{}
+	for _, tTaint := range template {
+		templateTaints[taintKey(tTaint)] = tTaint
+	}
+
+	var synced []corev1.Taint
+	present := sets.New[string]()
+	for _, mTaint := range taints {
+		key := taintKey(mTaint)
+		tTaint, inTemplate := templateTaints[key]
+		if previouslyCopied.Has(key) {
+			if !inTemplate {
+				continue
+			}
+			mTaint = tTaint
+		}
+		synced = append(synced, *mTaint.DeepCopy())
+		present.Insert(key)
+	}
+
+	var copied []string
+	for _, tTaint := range template {
+		key := taintKey(tTaint)
+		if present.Has(key) {
+			if previouslyCopied.Has(key) {
+				copied = append(copied, key)
+			}
+			continue
+		}
+		synced = append(synced, *tTaint.DeepCopy())
+		copied = append(copied, key)
+	}
+	setTemplateKeys(machine, templateTaintsAnnotationKey, copied)
+
+	return synced
+}
+
+// taintKey identifies a taint by its key and effect
+func taintKey(taint corev1.Taint) string {
+	return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+}
+
+// getTemplateKeys returns the keys recorded in the given template keys annotation of the Machine
+func getTemplateKeys(machine *machinev1.Machine, annotation string) []string {
+	value := machine.Annotations[annotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// hasTemplateKeys returns true when the given template keys annotation of the Machine was recorded, even empty.
+// A Machine without it was synced, if ever, before the template keys were recorded.
+func hasTemplateKeys(machine *machinev1.Machine, annotation string) bool {
+	_, ok := machine.Annotations[annotation]
+	return ok
+}
+
+// setTemplateKeys records the keys in the given template keys annotation of the Machine,
+// keeping the annotation empty when there are none
+func setTemplateKeys(machine *machinev1.Machine, annotation string, keys []string) {
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	sort.Strings(keys)
+	machine.Annotations[annotation] = strings.Join(keys, ",")
+}
+
+// nodeMetadataInSync returns true if the node labels, annotations and taints of both Machine specs match
+func nodeMetadataInSync(a, b *machinev1.MachineSpec) bool {
+	return equality.Semantic.DeepEqual(a.ObjectMeta.Labels, b.ObjectMeta.Labels) &&
+		equality.Semantic.DeepEqual(a.ObjectMeta.Annotations, b.ObjectMeta.Annotations) &&
+		equality.Semantic.DeepEqual(a.Taints, b.Taints)
+}
@@ -0,0 +1,170 @@
+package machineset
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSyncNodeMetadata(t *testing.T) {
+	templateSpec := machinev1.MachineSpec{
+		ObjectMeta: machinev1.ObjectMeta{
+			Labels:      map[string]string{"node-role.kubernetes.io/infra": ""},
+			Annotations: map[string]string{"example.com/team": "storage"},
+		},
+		Taints:     []corev1.Taint{{Key: "node-role.kubernetes.io/infra", Effect: corev1.TaintEffectNoSchedule}},
+		ProviderID: ptr.To("template-provider-id"),
+	}
+
+	newMachineSet := func(propagate string) *machinev1.MachineSet {
+		ms := &machinev1.MachineSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "machineset",
+				Namespace:   "default",
+				Annotations: map[string]string{},
+			},
+		}
+		if propagate != "" {
+			ms.Annotations[annotations.PropagateNodeMetadataAnnotation] = propagate
+		}
+		ms.Spec.Template.Spec = *templateSpec.DeepCopy()
+		return ms
+	}
+	newMachine := func(name string, spec machinev1.MachineSpec) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       spec,
+		}
+	}
+
+	providerID := "machine-provider-id"
+	outdatedSpec := machinev1.MachineSpec{
+		ObjectMeta: machinev1.ObjectMeta{Labels: map[string]string{"node-role.kubernetes.io/worker": ""}},
+		ProviderID: &providerID,
+	}
+	syncedSpec := *templateSpec.DeepCopy()
+	syncedSpec.ProviderID = &providerID
+	// The labels of the Machine which were never copied from the template are kept
+	syncedOutdatedSpec := *syncedSpec.DeepCopy()
+	syncedOutdatedSpec.ObjectMeta.Labels["node-role.kubernetes.io/worker"] = ""
+	syncedAnnotations := map[string]string{
+		templateLabelsAnnotationKey:      "node-role.kubernetes.io/infra",
+		templateAnnotationsAnnotationKey: "example.com/team",
+		templateTaintsAnnotationKey:      "node-role.kubernetes.io/infra:NoSchedule",
+	}
+
+	// The template no longer has the gpu label, annotation and taint the Machine got from it
+	ownSpec := *syncedSpec.DeepCopy()
+	ownSpec.ObjectMeta.Labels["example.com/gpu"] = "true"
+	ownSpec.ObjectMeta.Labels["example.com/own"] = "true"
+	ownSpec.ObjectMeta.Annotations["example.com/gpu"] = "true"
+	ownSpec.ObjectMeta.Annotations["example.com/team"] = "compute"
+	ownSpec.Taints = append(ownSpec.Taints,
+		corev1.Taint{Key: "example.com/gpu", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "example.com/own", Effect: corev1.TaintEffectNoExecute},
+	)
+	ownAnnotations := map[string]string{
+		templateLabelsAnnotationKey:      "example.com/gpu,node-role.kubernetes.io/infra",
+		templateAnnotationsAnnotationKey: "example.com/gpu,example.com/team",
+		templateTaintsAnnotationKey:      "example.com/gpu:NoSchedule,node-role.kubernetes.io/infra:NoSchedule",
+	}
+	syncedOwnSpec := *syncedSpec.DeepCopy()
+	syncedOwnSpec.ObjectMeta.Labels["example.com/own"] = "true"
+	syncedOwnSpec.Taints = append(syncedOwnSpec.Taints, corev1.Taint{Key: "example.com/own", Effect: corev1.TaintEffectNoExecute})
+
+	testCases := []struct {
+		name                string
+		propagate           string
+		machineSpec         machinev1.MachineSpec
+		machineAnnotations  map[string]string
+		expectedSpec        machinev1.MachineSpec
+		expectedAnnotations map[string]string
+		expectedEvents      int
+	}{
+		{
+			name:         "without the annotation, machines are left untouched",
+			machineSpec:  outdatedSpec,
+			expectedSpec: outdatedSpec,
+		},
+		{
+			name:         "with propagation disabled, machines are left untouched",
+			propagate:    "false",
+			machineSpec:  outdatedSpec,
+			expectedSpec: outdatedSpec,
+		},
+		{
+			name:                "with propagation enabled, only the node metadata is updated",
+			propagate:           "true",
+			machineSpec:         outdatedSpec,
+			expectedSpec:        syncedOutdatedSpec,
+			expectedAnnotations: syncedAnnotations,
+			expectedEvents:      1,
+		},
+		{
+			name:                "with propagation enabled, machines in sync are not updated",
+			propagate:           "true",
+			machineSpec:         syncedSpec,
+			machineAnnotations:  syncedAnnotations,
+			expectedSpec:        syncedSpec,
+			expectedAnnotations: syncedAnnotations,
+		},
+		{
+			name:                "with propagation enabled, the template keys of machines in sync are recorded",
+			propagate:           "true",
+			machineSpec:         syncedSpec,
+			expectedSpec:        syncedSpec,
+			expectedAnnotations: syncedAnnotations,
+		},
+		{
+			name:                "with propagation enabled, only the keys removed from the template are removed",
+			propagate:           "true",
+			machineSpec:         ownSpec,
+			machineAnnotations:  ownAnnotations,
+			expectedSpec:        syncedOwnSpec,
+			expectedAnnotations: syncedAnnotations,
+			expectedEvents:      1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ms := newMachineSet(tc.propagate)
+			machine := newMachine("machine", *tc.machineSpec.DeepCopy())
+			for k, v := range tc.machineAnnotations {
+				metav1.SetMetaDataAnnotation(&machine.ObjectMeta, k, v)
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileMachineSet{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(ms, machine).Build(),
+				scheme:   scheme.Scheme,
+				recorder: recorder,
+			}
+
+			g.Expect(r.syncNodeMetadata(ms, []*machinev1.Machine{machine})).To(Succeed())
+
+			updated := &machinev1.Machine{}
+			g.Expect(r.Client.Get(context.Background(), client.ObjectKeyFromObject(machine), updated)).To(Succeed())
+			g.Expect(updated.Spec).To(Equal(tc.expectedSpec))
+			g.Expect(updated.Annotations).To(Equal(tc.expectedAnnotations))
+			g.Expect(recorder.Events).To(HaveLen(tc.expectedEvents))
+
+			// The Machine does not share the node metadata of the template
+			ms.Spec.Template.Spec.ObjectMeta.Labels["example.com/template"] = "true"
+			ms.Spec.Template.Spec.ObjectMeta.Annotations["example.com/template"] = "true"
+			ms.Spec.Template.Spec.Taints[0].Value = "template"
+			g.Expect(machine.Spec).To(Equal(updated.Spec))
+		})
+	}
+}
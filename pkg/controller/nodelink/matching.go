@@ -0,0 +1,432 @@
+package nodelink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// MatchingStrategyProviderID matches Nodes and Machines with the same providerID
+	MatchingStrategyProviderID = "providerID"
+	// MatchingStrategyNormalizedProviderID matches Nodes and Machines whose providerIDs are the same once normalized,
+	// see normalizeProviderID
+	MatchingStrategyNormalizedProviderID = "normalizedProviderID"
+	// MatchingStrategyInternalIP matches Nodes and Machines sharing an internal IP
+	MatchingStrategyInternalIP = "internalIP"
+	// MatchingStrategyHostname matches Nodes and Machines sharing a hostname
+	MatchingStrategyHostname = "hostname"
+	// MatchingStrategyExternalIP matches Nodes and Machines sharing an external IP
+	MatchingStrategyExternalIP = "externalIP"
+	// MatchingStrategyAnnotation matches Nodes with the Machine named by their linkMachineAnnotationKey annotation
+	MatchingStrategyAnnotation = "annotation"
+
+	// linkMachineAnnotationKey can be set on a Node to explicitly name the Machine backing it, as namespace/name
+	linkMachineAnnotationKey = "machine.openshift.io/link-machine"
+
+	machineNormalizedProviderIDIndex = "machineNormalizedProviderIDIndex"
+	nodeNormalizedProviderIDIndex    = "nodeNormalizedProviderIDIndex"
+	machineHostnameIndex             = "machineHostnameIndex"
+	nodeHostnameIndex                = "nodeHostnameIndex"
+	machineExternalIPIndex           = "machineExternalIPIndex"
+	nodeExternalIPIndex              = "nodeExternalIPIndex"
+	machineNamespacedNameIndex       = "machineNamespacedNameIndex"
+	nodeLinkMachineIndex             = "nodeLinkMachineIndex"
+)
+
+// ProviderIDRule is how the path of the providerIDs of a scheme is normalized by the normalizedProviderID strategy
+type ProviderIDRule string
+
+const (
+	// ProviderIDRuleExact keeps the path of the providerID as is
+	ProviderIDRuleExact ProviderIDRule = "exact"
+	// ProviderIDRuleCaseInsensitive lower cases the path of the providerID
+	ProviderIDRuleCaseInsensitive ProviderIDRule = "caseInsensitive"
+	// ProviderIDRuleLastSegment keeps the lower cased last segment of the path of the providerID, for schemes
+	// whose other segments are redundant, e.g. the availability zone of "aws:///us-east-1a/i-0123"
+	ProviderIDRuleLastSegment ProviderIDRule = "lastSegment"
+)
+
+// DefaultProviderIDRules are the normalization rules of the providerID schemes known to have several formats
+var DefaultProviderIDRules = map[string]ProviderIDRule{
+	"aws":     ProviderIDRuleLastSegment,
+	"azure":   ProviderIDRuleCaseInsensitive,
+	"vsphere": ProviderIDRuleCaseInsensitive,
+}
+
+// ParseProviderIDRules parses a comma separated list of providerID normalization rules by scheme,
+// e.g. "aws=lastSegment,vsphere=caseInsensitive".
+func ParseProviderIDRules(value string) (map[string]ProviderIDRule, error) {
+	rules := map[string]ProviderIDRule{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		scheme, rule, found := strings.Cut(entry, "=")
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if !found || scheme == "" {
+			return nil, fmt.Errorf("invalid providerID rule %q, expected scheme=rule", entry)
+		}
+		switch r := ProviderIDRule(strings.TrimSpace(rule)); r {
+		case ProviderIDRuleExact, ProviderIDRuleCaseInsensitive, ProviderIDRuleLastSegment:
+			rules[scheme] = r
+		default:
+			return nil, fmt.Errorf("unknown providerID rule %q for scheme %q, supported rules are %s, %s, %s",
+				rule, scheme, ProviderIDRuleExact, ProviderIDRuleCaseInsensitive, ProviderIDRuleLastSegment)
+		}
+	}
+	return rules, nil
+}
+
+// FormatProviderIDRules formats providerID normalization rules as parsed by ParseProviderIDRules
+func FormatProviderIDRules(rules map[string]ProviderIDRule) string {
+	var entries []string
+	for _, scheme := range sortedKeys(rules) {
+		entries = append(entries, fmt.Sprintf("%s=%s", scheme, rules[scheme]))
+	}
+	return strings.Join(entries, ",")
+}
+
+// DefaultMatchingStrategies are the strategies used to match Nodes and Machines by default, in priority order.
+// The other strategies are opt-in.
+var DefaultMatchingStrategies = []string{
+	MatchingStrategyProviderID,
+	MatchingStrategyInternalIP,
+}
+
+// SupportedMatchingStrategies are all the strategies which can be used to match Nodes and Machines
+var SupportedMatchingStrategies = []string{
+	MatchingStrategyProviderID,
+	MatchingStrategyNormalizedProviderID,
+	MatchingStrategyInternalIP,
+	MatchingStrategyHostname,
+	MatchingStrategyExternalIP,
+	MatchingStrategyAnnotation,
+}
+
+// matchingStrategy matches Nodes and Machines having a key in common.
+// Keys are indexed in the cache for both Nodes and Machines.
+type matchingStrategy struct {
+	name         string
+	nodeIndex    string
+	machineIndex string
+	nodeKeys     func(node *corev1.Node) []string
+	machineKeys  func(machine *machinev1.Machine) []string
+	// linkable, if set, tells whether a Node and a Machine having a key in common can be linked
+	linkable func(node *corev1.Node, machine *machinev1.Machine) bool
+}
+
+var matchingStrategies = map[string]matchingStrategy{
+	MatchingStrategyProviderID: {
+		name:         MatchingStrategyProviderID,
+		nodeIndex:    nodeProviderIDIndex,
+		machineIndex: machineProviderIDIndex,
+		nodeKeys:     nodeProviderIDs,
+		machineKeys:  machineProviderIDs,
+	},
+	MatchingStrategyNormalizedProviderID: normalizedProviderIDStrategy(DefaultProviderIDRules),
+	MatchingStrategyInternalIP: {
+		name:         MatchingStrategyInternalIP,
+		nodeIndex:    nodeInternalIPIndex,
+		machineIndex: machineInternalIPIndex,
+		nodeKeys: func(node *corev1.Node) []string {
+			return addressesOfType(node.Status.Addresses, corev1.NodeInternalIP)
+		},
+		machineKeys: func(machine *machinev1.Machine) []string {
+			return addressesOfType(machine.Status.Addresses, corev1.NodeInternalIP)
+		},
+	},
+	MatchingStrategyHostname: {
+		name:         MatchingStrategyHostname,
+		nodeIndex:    nodeHostnameIndex,
+		machineIndex: machineHostnameIndex,
+		nodeKeys: func(node *corev1.Node) []string {
+			return toLower(addressesOfType(node.Status.Addresses, corev1.NodeHostName))
+		},
+		machineKeys: func(machine *machinev1.Machine) []string {
+			return toLower(addressesOfType(machine.Status.Addresses, corev1.NodeHostName))
+		},
+	},
+	MatchingStrategyExternalIP: {
+		name:         MatchingStrategyExternalIP,
+		nodeIndex:    nodeExternalIPIndex,
+		machineIndex: machineExternalIPIndex,
+		nodeKeys: func(node *corev1.Node) []string {
+			return addressesOfType(node.Status.Addresses, corev1.NodeExternalIP)
+		},
+		machineKeys: func(machine *machinev1.Machine) []string {
+			return addressesOfType(machine.Status.Addresses, corev1.NodeExternalIP)
+		},
+	},
+	MatchingStrategyAnnotation: {
+		name:         MatchingStrategyAnnotation,
+		nodeIndex:    nodeLinkMachineIndex,
+		machineIndex: machineNamespacedNameIndex,
+		nodeKeys: func(node *corev1.Node) []string {
+			if value := node.GetAnnotations()[linkMachineAnnotationKey]; value != "" {
+				return []string{value}
+			}
+			return nil
+		},
+		machineKeys: func(machine *machinev1.Machine) []string {
+			return []string{fmt.Sprintf("%s/%s", machine.GetNamespace(), machine.GetName())}
+		},
+		linkable: isNotLinkedToOtherNode,
+	},
+}
+
+// isNotLinkedToOtherNode returns false if the providerID or the nodeRef of the machine point at another node,
+// so the link annotation of a node cannot claim the machine of a different node
+func isNotLinkedToOtherNode(node *corev1.Node, machine *machinev1.Machine) bool {
+	if machine.Status.NodeRef != nil && machine.Status.NodeRef.Name != node.GetName() {
+		return false
+	}
+	if machine.Spec.ProviderID != nil && *machine.Spec.ProviderID != "" && node.Spec.ProviderID != "" &&
+		normalizeProviderID(*machine.Spec.ProviderID, DefaultProviderIDRules) != normalizeProviderID(node.Spec.ProviderID, DefaultProviderIDRules) {
+		return false
+	}
+	return true
+}
+
+// normalizedProviderIDStrategy returns the normalizedProviderID strategy with the given normalization rules
+func normalizedProviderIDStrategy(rules map[string]ProviderIDRule) matchingStrategy {
+	return matchingStrategy{
+		name:         MatchingStrategyNormalizedProviderID,
+		nodeIndex:    nodeNormalizedProviderIDIndex,
+		machineIndex: machineNormalizedProviderIDIndex,
+		nodeKeys: func(node *corev1.Node) []string {
+			return normalizeProviderIDs(nodeProviderIDs(node), rules)
+		},
+		machineKeys: func(machine *machinev1.Machine) []string {
+			return normalizeProviderIDs(machineProviderIDs(machine), rules)
+		},
+	}
+}
+
+// getMatchingStrategies returns the matching strategies with the given names, in the same order.
+// The providerIDs are normalized with the given rules, or the default rules if nil.
+func getMatchingStrategies(names []string, providerIDRules map[string]ProviderIDRule) ([]matchingStrategy, error) {
+	var strategies []matchingStrategy
+	seen := map[string]bool{}
+	for _, name := range names {
+		strategy, ok := matchingStrategies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown matching strategy %q, supported strategies are %s", name, strings.Join(SupportedMatchingStrategies, ", "))
+		}
+		if name == MatchingStrategyNormalizedProviderID && providerIDRules != nil {
+			strategy = normalizedProviderIDStrategy(providerIDRules)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate matching strategy %q", name)
+		}
+		seen[name] = true
+		strategies = append(strategies, strategy)
+	}
+	if len(strategies) == 0 {
+		return nil, fmt.Errorf("at least one matching strategy is required")
+	}
+	return strategies, nil
+}
+
+// ambiguousMatchError is returned when a strategy matches an object with several objects of the other kind
+type ambiguousMatchError struct {
+	strategy string
+	kind     string
+	names    []string
+	// resolvedBy is the lower priority strategy which then matched a unique object, if any
+	resolvedBy string
+}
+
+func (e *ambiguousMatchError) Error() string {
+	return fmt.Sprintf("%s matches %d %ss: %s", e.strategy, len(e.names), e.kind, strings.Join(e.names, ", "))
+}
+
+// findMachineFromNodeByStrategy finds the machine matching the node with the given strategy.
+// An ambiguousMatchError is returned if several machines match.
+func (r *ReconcileNodeLink) findMachineFromNodeByStrategy(ctx context.Context, node *corev1.Node, s matchingStrategy) (*machinev1.Machine, error) {
+	klog.V(3).Infof("Finding machine from node %q by %s", node.GetName(), s.name)
+	keys := s.nodeKeys(node)
+	if len(keys) == 0 {
+		klog.V(3).Infof("Node %q has no %s", node.GetName(), s.name)
+		return nil, nil
+	}
+
+	matches := map[string]machinev1.Machine{}
+	for _, key := range keys {
+		machines, err := r.listMachinesByFieldFunc(ctx, s.machineIndex, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting machine list: %v", err)
+		}
+		for i := range machines {
+			if s.linkable != nil && !s.linkable(node, &machines[i]) {
+				klog.Warningf("Not linking node %q to machine %q matched by %s %q: the machine is linked to another node", node.GetName(), machines[i].GetName(), s.name, key)
+				continue
+			}
+			matches[client.ObjectKeyFromObject(&machines[i]).String()] = machines[i]
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		klog.V(3).Infof("Matching machine not found for node %q with %s %q", node.GetName(), s.name, keys)
+		return nil, nil
+	case 1:
+		for _, machine := range matches {
+			klog.V(3).Infof("Found machine %q for node %q with %s %q", machine.GetName(), node.GetName(), s.name, keys)
+			return machine.DeepCopy(), nil
+		}
+	}
+	return nil, &ambiguousMatchError{strategy: s.name, kind: "machine", names: sortedKeys(matches)}
+}
+
+// findNodeFromMachineByStrategy finds the node matching the machine with the given strategy.
+// An ambiguousMatchError is returned if several nodes match.
+func (r *ReconcileNodeLink) findNodeFromMachineByStrategy(ctx context.Context, machine *machinev1.Machine, s matchingStrategy) (*corev1.Node, error) {
+	klog.V(3).Infof("Finding node from machine %q by %s", machine.GetName(), s.name)
+	keys := s.machineKeys(machine)
+	if len(keys) == 0 {
+		klog.V(3).Infof("Machine %q has no %s", machine.GetName(), s.name)
+		return nil, nil
+	}
+
+	matches := map[string]corev1.Node{}
+	for _, key := range keys {
+		nodes, err := r.listNodesByFieldFunc(ctx, s.nodeIndex, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting node list: %v", err)
+		}
+		for i := range nodes {
+			if s.linkable != nil && !s.linkable(&nodes[i], machine) {
+				klog.Warningf("Not linking machine %q to node %q matched by %s %q: the machine is linked to another node", machine.GetName(), nodes[i].GetName(), s.name, key)
+				continue
+			}
+			matches[nodes[i].GetName()] = nodes[i]
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		klog.V(3).Infof("Matching node not found for machine %q with %s %q", machine.GetName(), s.name, keys)
+		return nil, nil
+	case 1:
+		for _, node := range matches {
+			klog.V(3).Infof("Found node %q for machine %q with %s %q", node.GetName(), machine.GetName(), s.name, keys)
+			return node.DeepCopy(), nil
+		}
+	}
+	return nil, &ambiguousMatchError{strategy: s.name, kind: "node", names: sortedKeys(matches)}
+}
+
+// indexNodeByStrategy returns an indexer for the node keys of the strategy
+func indexNodeByStrategy(s matchingStrategy) client.IndexerFunc {
+	return func(object client.Object) []string {
+		node, ok := object.(*corev1.Node)
+		if !ok {
+			klog.Warningf("Expected a node for indexing field, got: %T", object)
+			return nil
+		}
+		keys := s.nodeKeys(node)
+		if len(keys) > 0 {
+			klog.V(3).Infof("Adding %s %q for node %q to indexer", s.name, keys, node.GetName())
+		}
+		return keys
+	}
+}
+
+// indexMachineByStrategy returns an indexer for the machine keys of the strategy
+func indexMachineByStrategy(s matchingStrategy) client.IndexerFunc {
+	return func(object client.Object) []string {
+		machine, ok := object.(*machinev1.Machine)
+		if !ok {
+			klog.Warningf("Expected a machine for indexing field, got: %T", object)
+			return nil
+		}
+		keys := s.machineKeys(machine)
+		if len(keys) > 0 {
+			klog.V(3).Infof("Adding %s %q for machine %q to indexer", s.name, keys, machine.GetName())
+		}
+		return keys
+	}
+}
+
+func nodeProviderIDs(node *corev1.Node) []string {
+	if node.Spec.ProviderID != "" {
+		return []string{node.Spec.ProviderID}
+	}
+	return nil
+}
+
+func machineProviderIDs(machine *machinev1.Machine) []string {
+	if machine.Spec.ProviderID != nil && *machine.Spec.ProviderID != "" {
+		return []string{*machine.Spec.ProviderID}
+	}
+	return nil
+}
+
+// normalizeProviderID normalizes a providerID with the rule of its scheme, so the formats used by different
+// components for the same instance match. The scheme is lower cased and empty path segments are dropped, e.g.
+// "openstack:///0123" and "openstack://0123" match; the rest of the path is kept as is for schemes without a rule.
+func normalizeProviderID(providerID string, rules map[string]ProviderIDRule) string {
+	providerID = strings.TrimSpace(providerID)
+	scheme, path, found := strings.Cut(providerID, "://")
+	if !found {
+		return providerID
+	}
+	scheme = strings.ToLower(scheme)
+
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	if len(segments) == 0 {
+		return ""
+	}
+	switch rules[scheme] {
+	case ProviderIDRuleLastSegment:
+		return fmt.Sprintf("%s://%s", scheme, strings.ToLower(segments[len(segments)-1]))
+	case ProviderIDRuleCaseInsensitive:
+		return fmt.Sprintf("%s://%s", scheme, strings.ToLower(strings.Join(segments, "/")))
+	default:
+		return fmt.Sprintf("%s://%s", scheme, strings.Join(segments, "/"))
+	}
+}
+
+func normalizeProviderIDs(providerIDs []string, rules map[string]ProviderIDRule) []string {
+	var normalized []string
+	for _, providerID := range providerIDs {
+		if n := normalizeProviderID(providerID, rules); n != "" {
+			normalized = append(normalized, n)
+		}
+	}
+	return normalized
+}
+
+func addressesOfType(addresses []corev1.NodeAddress, addressType corev1.NodeAddressType) []string {
+	var keys []string
+	for _, a := range addresses {
+		if a.Type == addressType && a.Address != "" {
+			keys = append(keys, a.Address)
+		}
+	}
+	return keys
+}
+
+func toLower(values []string) []string {
+	for i := range values {
+		values[i] = strings.ToLower(values[i])
+	}
+	return values
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
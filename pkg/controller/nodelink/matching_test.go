@@ -0,0 +1,383 @@
+package nodelink
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// newIndexedReconciler returns a reconciler whose field lists are served from the keys of the
+// given strategies, as the cache indexes would
+func newIndexedReconciler(strategyNames []string, nodes []*corev1.Node, machines []*machinev1.Machine) (*ReconcileNodeLink, *record.FakeRecorder) {
+	strategies, err := getMatchingStrategies(strategyNames, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	nodeIndexes := map[string]map[string][]corev1.Node{}
+	machineIndexes := map[string]map[string][]machinev1.Machine{}
+	for _, s := range strategies {
+		nodeIndexes[s.nodeIndex] = map[string][]corev1.Node{}
+		for _, node := range nodes {
+			for _, key := range s.nodeKeys(node) {
+				nodeIndexes[s.nodeIndex][key] = append(nodeIndexes[s.nodeIndex][key], *node)
+			}
+		}
+		machineIndexes[s.machineIndex] = map[string][]machinev1.Machine{}
+		for _, machine := range machines {
+			for _, key := range s.machineKeys(machine) {
+				machineIndexes[s.machineIndex][key] = append(machineIndexes[s.machineIndex][key], *machine)
+			}
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileNodeLink{
+		recorder:   recorder,
+		strategies: strategies,
+		listNodesByFieldFunc: func(_ context.Context, key, value string) ([]corev1.Node, error) {
+			return nodeIndexes[key][value], nil
+		},
+		listMachinesByFieldFunc: func(_ context.Context, key, value string) ([]machinev1.Machine, error) {
+			return machineIndexes[key][value], nil
+		},
+	}
+	return r, recorder
+}
+
+func TestNormalizeProviderID(t *testing.T) {
+	testCases := []struct {
+		providerID string
+		rules      map[string]ProviderIDRule
+		expected   string
+	}{
+		{
+			providerID: "aws:///us-east-1a/i-0123456789",
+			expected:   "aws://i-0123456789",
+		},
+		{
+			providerID: "aws:///i-0123456789",
+			expected:   "aws://i-0123456789",
+		},
+		{
+			providerID: "vsphere://4207A1B2-0000-1111-2222-333344445555",
+			expected:   "vsphere://4207a1b2-0000-1111-2222-333344445555",
+		},
+		{
+			providerID: "azure:///subscriptions/sub/resourceGroups/RG-1/providers/Microsoft.Compute/virtualMachines/vm-0",
+			expected:   "azure://subscriptions/sub/resourcegroups/rg-1/providers/microsoft.compute/virtualmachines/vm-0",
+		},
+		{
+			providerID: "gce://project/us-central1-a/instance-1",
+			expected:   "gce://project/us-central1-a/instance-1",
+		},
+		{
+			providerID: "GCE://Project//us-central1-a/Instance-1",
+			expected:   "gce://Project/us-central1-a/Instance-1",
+		},
+		{
+			providerID: "gce://project/us-central1-a/instance-1",
+			rules:      map[string]ProviderIDRule{"gce": ProviderIDRuleLastSegment},
+			expected:   "gce://instance-1",
+		},
+		{
+			providerID: "vsphere://4207A1B2-0000-1111-2222-333344445555",
+			rules:      map[string]ProviderIDRule{},
+			expected:   "vsphere://4207A1B2-0000-1111-2222-333344445555",
+		},
+		{
+			providerID: "openstack:///",
+			expected:   "",
+		},
+		{
+			providerID: " Instance-1 ",
+			expected:   "Instance-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.providerID, func(t *testing.T) {
+			g := NewWithT(t)
+			rules := tc.rules
+			if rules == nil {
+				rules = DefaultProviderIDRules
+			}
+			g.Expect(normalizeProviderID(tc.providerID, rules)).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestNormalizeProviderIDDoesNotCollide(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(normalizeProviderID("gce://project-a/us-central1-a/instance-1", DefaultProviderIDRules)).ToNot(
+		Equal(normalizeProviderID("gce://project-b/us-central1-b/instance-1", DefaultProviderIDRules)))
+	g.Expect(normalizeProviderID("azure:///subscriptions/sub/resourceGroups/rg-a/providers/Microsoft.Compute/virtualMachines/vm-0", DefaultProviderIDRules)).ToNot(
+		Equal(normalizeProviderID("azure:///subscriptions/sub/resourceGroups/rg-b/providers/Microsoft.Compute/virtualMachines/vm-0", DefaultProviderIDRules)))
+}
+
+func TestParseProviderIDRules(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      map[string]ProviderIDRule
+		expectedError string
+	}{
+		{
+			name:     "Empty",
+			value:    "",
+			expected: map[string]ProviderIDRule{},
+		},
+		{
+			name:  "Several rules",
+			value: "AWS=lastSegment, gce=exact,azure=caseInsensitive",
+			expected: map[string]ProviderIDRule{
+				"aws":   ProviderIDRuleLastSegment,
+				"gce":   ProviderIDRuleExact,
+				"azure": ProviderIDRuleCaseInsensitive,
+			},
+		},
+		{
+			name:          "Missing rule",
+			value:         "aws",
+			expectedError: `invalid providerID rule "aws", expected scheme=rule`,
+		},
+		{
+			name:          "Unknown rule",
+			value:         "aws=firstSegment",
+			expectedError: `unknown providerID rule "firstSegment" for scheme "aws"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			rules, err := ParseProviderIDRules(tc.value)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(rules).To(Equal(tc.expected))
+		})
+	}
+
+	// The default rules round trip through the flag format
+	rules, err := ParseProviderIDRules(FormatProviderIDRules(DefaultProviderIDRules))
+	NewWithT(t).Expect(err).ToNot(HaveOccurred())
+	NewWithT(t).Expect(rules).To(Equal(DefaultProviderIDRules))
+}
+
+func TestGetMatchingStrategies(t *testing.T) {
+	g := NewWithT(t)
+
+	strategies, err := getMatchingStrategies([]string{MatchingStrategyHostname, MatchingStrategyProviderID}, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(strategies).To(HaveLen(2))
+	g.Expect(strategies[0].name).To(Equal(MatchingStrategyHostname))
+	g.Expect(strategies[1].name).To(Equal(MatchingStrategyProviderID))
+
+	_, err = getMatchingStrategies([]string{"serialNumber"}, nil)
+	g.Expect(err).To(MatchError("unknown matching strategy \"serialNumber\", supported strategies are providerID, normalizedProviderID, internalIP, hostname, externalIP, annotation"))
+
+	_, err = getMatchingStrategies([]string{MatchingStrategyHostname, MatchingStrategyHostname}, nil)
+	g.Expect(err).To(MatchError("duplicate matching strategy \"hostname\""))
+
+	_, err = getMatchingStrategies(nil, nil)
+	g.Expect(err).To(MatchError("at least one matching strategy is required"))
+}
+
+func TestFindMachineFromNodeWithStrategies(t *testing.T) {
+	address := func(addressType corev1.NodeAddressType, value string) []corev1.NodeAddress {
+		return []corev1.NodeAddress{{Type: addressType, Address: value}}
+	}
+	withLinkAnnotation := func(n *corev1.Node, value string) *corev1.Node {
+		n.Annotations = map[string]string{linkMachineAnnotationKey: value}
+		return n
+	}
+
+	testCases := []struct {
+		name            string
+		strategies      []string
+		node            *corev1.Node
+		machines        []*machinev1.Machine
+		expectedMachine string
+		expectedEvents  []string
+	}{
+		{
+			name:            "by normalized providerID",
+			strategies:      SupportedMatchingStrategies,
+			node:            node("node", "aws:///us-east-1a/i-0123", nil, nil),
+			machines:        []*machinev1.Machine{machine("machine", "aws:///i-0123", nil, nil, nil)},
+			expectedMachine: "machine",
+		},
+		{
+			name:            "by hostname",
+			strategies:      SupportedMatchingStrategies,
+			node:            node("node", "", address(corev1.NodeHostName, "Worker-0"), nil),
+			machines:        []*machinev1.Machine{machine("machine", "", address(corev1.NodeHostName, "worker-0"), nil, nil)},
+			expectedMachine: "machine",
+		},
+		{
+			name:            "by external IP",
+			strategies:      SupportedMatchingStrategies,
+			node:            node("node", "", address(corev1.NodeExternalIP, "203.0.113.10"), nil),
+			machines:        []*machinev1.Machine{machine("machine", "", address(corev1.NodeExternalIP, "203.0.113.10"), nil, nil)},
+			expectedMachine: "machine",
+		},
+		{
+			name:            "by annotation",
+			strategies:      SupportedMatchingStrategies,
+			node:            withLinkAnnotation(node("node", "", nil, nil), namespace+"/machine"),
+			machines:        []*machinev1.Machine{machine("machine", "", nil, nil, nil), machine("other", "", nil, nil, nil)},
+			expectedMachine: "machine",
+		},
+		{
+			name:       "higher priority strategies win",
+			strategies: SupportedMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "", address(corev1.NodeInternalIP, "10.0.0.1"), nil), namespace+"/by-annotation"),
+			machines: []*machinev1.Machine{
+				machine("by-internal-ip", "", address(corev1.NodeInternalIP, "10.0.0.1"), nil, nil),
+				machine("by-annotation", "", nil, nil, nil),
+			},
+			expectedMachine: "by-internal-ip",
+		},
+		{
+			name:       "the link annotation does not claim the machine of another node by nodeRef",
+			strategies: SupportedMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "", nil, nil), namespace+"/master-0"),
+			machines: []*machinev1.Machine{
+				machine("master-0", "", nil, nil, &corev1.ObjectReference{Kind: "Node", Name: "master-0"}),
+			},
+			expectedMachine: "",
+		},
+		{
+			name:       "the link annotation does not claim the machine of another node by providerID",
+			strategies: SupportedMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "aws:///i-node", nil, nil), namespace+"/master-0"),
+			machines: []*machinev1.Machine{
+				machine("master-0", "aws:///i-master-0", nil, nil, nil),
+			},
+			expectedMachine: "",
+		},
+		{
+			name:       "the link annotation claims a machine already linked to the node",
+			strategies: SupportedMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "aws:///us-east-1a/i-node", nil, nil), namespace+"/machine"),
+			machines: []*machinev1.Machine{
+				machine("machine", "aws:///i-node", nil, nil, &corev1.ObjectReference{Kind: "Node", Name: "node"}),
+			},
+			expectedMachine: "machine",
+		},
+		{
+			name:       "only providerID and internalIP are used by default",
+			strategies: DefaultMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "", address(corev1.NodeHostName, "worker-0"), nil), namespace+"/machine"),
+			machines: []*machinev1.Machine{
+				machine("machine", "", address(corev1.NodeHostName, "worker-0"), nil, nil),
+			},
+			expectedMachine: "",
+		},
+		{
+			name:       "disabled strategies are not used",
+			strategies: []string{MatchingStrategyProviderID, MatchingStrategyInternalIP},
+			node:       node("node", "", address(corev1.NodeHostName, "worker-0"), nil),
+			machines: []*machinev1.Machine{
+				machine("machine", "", address(corev1.NodeHostName, "worker-0"), nil, nil),
+			},
+			expectedMachine: "",
+		},
+		{
+			name:       "the link annotation resolves ambiguous matches",
+			strategies: SupportedMatchingStrategies,
+			node:       withLinkAnnotation(node("node", "", address(corev1.NodeInternalIP, "10.0.0.1"), nil), namespace+"/by-annotation"),
+			machines: []*machinev1.Machine{
+				machine("machine-a", "", address(corev1.NodeInternalIP, "10.0.0.1"), nil, nil),
+				machine("machine-b", "", address(corev1.NodeInternalIP, "10.0.0.1"), nil, nil),
+				machine("by-annotation", "", nil, nil, nil),
+			},
+			expectedMachine: "by-annotation",
+			expectedEvents:  []string{"Warning AmbiguousMachineMatch Node node internalIP matches 2 machines: openshift-machine-api/machine-a, openshift-machine-api/machine-b, linking machine by-annotation matched by annotation"},
+		},
+		{
+			name:       "ambiguous matches are not linked",
+			strategies: SupportedMatchingStrategies,
+			node:       node("node", "", append(address(corev1.NodeInternalIP, "10.0.0.1"), address(corev1.NodeHostName, "worker")...), nil),
+			machines: []*machinev1.Machine{
+				machine("machine-a", "", append(address(corev1.NodeInternalIP, "10.0.0.1"), address(corev1.NodeHostName, "worker")...), nil, nil),
+				machine("machine-b", "", append(address(corev1.NodeInternalIP, "10.0.0.1"), address(corev1.NodeHostName, "worker")...), nil, nil),
+			},
+			expectedMachine: "",
+			expectedEvents:  []string{"Warning AmbiguousMachineMatch Node node internalIP matches 2 machines: openshift-machine-api/machine-a, openshift-machine-api/machine-b, not linking"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r, recorder := newIndexedReconciler(tc.strategies, []*corev1.Node{tc.node}, tc.machines)
+			m, err := r.findMachineFromNode(context.Background(), tc.node)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.expectedMachine == "" {
+				g.Expect(m).To(BeNil())
+			} else {
+				g.Expect(m).ToNot(BeNil())
+				g.Expect(m.Name).To(Equal(tc.expectedMachine))
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			g.Expect(events).To(Equal(tc.expectedEvents))
+		})
+	}
+}
+
+func TestFindNodeFromMachineWithStrategies(t *testing.T) {
+	g := NewWithT(t)
+
+	addresses := []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.10"}}
+	m := machine("machine", "", addresses, nil, nil)
+	nodes := []*corev1.Node{node("node-a", "", addresses, nil), node("node-b", "", addresses, nil)}
+
+	r, recorder := newIndexedReconciler(SupportedMatchingStrategies, nodes, []*machinev1.Machine{m})
+	n, err := r.findNodeFromMachine(context.Background(), m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).To(BeNil())
+	g.Expect(recorder.Events).To(Receive(Equal("Warning AmbiguousNodeMatch Machine machine externalIP matches 2 nodes: node-a, node-b, not linking")))
+
+	// The link annotation of a node resolves the ambiguity
+	nodes[1].Annotations = map[string]string{linkMachineAnnotationKey: namespace + "/machine"}
+	r, recorder = newIndexedReconciler(SupportedMatchingStrategies, nodes, []*machinev1.Machine{m})
+	n, err = r.findNodeFromMachine(context.Background(), m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).ToNot(BeNil())
+	g.Expect(n.Name).To(Equal("node-b"))
+	g.Expect(recorder.Events).To(Receive(Equal("Warning AmbiguousNodeMatch Machine machine externalIP matches 2 nodes: node-a, node-b, linking node node-b matched by annotation")))
+
+	r, _ = newIndexedReconciler(SupportedMatchingStrategies, nodes[:1], []*machinev1.Machine{m})
+	n, err = r.findNodeFromMachine(context.Background(), m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).ToNot(BeNil())
+	g.Expect(n.Name).To(Equal("node-a"))
+}
+
+func TestFindNodeFromMachineWithLinkAnnotation(t *testing.T) {
+	g := NewWithT(t)
+
+	m := machine("master-0", "", nil, nil, &corev1.ObjectReference{Kind: "Node", Name: "master-0"})
+	nodes := []*corev1.Node{node("node", "", nil, nil)}
+	nodes[0].Annotations = map[string]string{linkMachineAnnotationKey: namespace + "/master-0"}
+
+	r, _ := newIndexedReconciler([]string{MatchingStrategyAnnotation}, nodes, []*machinev1.Machine{m})
+	n, err := r.findNodeFromMachine(context.Background(), m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(n).To(BeNil())
+}
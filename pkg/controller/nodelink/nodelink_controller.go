@@ -2,13 +2,19 @@ package nodelink
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -24,8 +30,38 @@ const (
 	machineProviderIDIndex = "machineProviderIDIndex"
 	nodeInternalIPIndex    = "nodeInternalIPIndex"
 	nodeProviderIDIndex    = "nodeProviderIDIndex"
+
+	// managedLabelsAnnotationKey, managedAnnotationsAnnotationKey and managedTaintsAnnotationKey record on a Node
+	// the comma separated keys copied from the Machine spec, so they can be removed once removed from the Machine.
+	// They are kept empty once the Machine has none, a Node without them was not synced since they are recorded.
+	managedLabelsAnnotationKey      = "machine.openshift.io/managed-labels"
+	managedAnnotationsAnnotationKey = "machine.openshift.io/managed-annotations"
+	// managed taints are identified by key and effect, as key:effect
+	managedTaintsAnnotationKey = "machine.openshift.io/managed-taints"
+
+	// NodeReadyCondition reports on a Machine whether its Node is Ready, as last observed by the nodelink controller.
+	// Watchers of the Machine, e.g. the machine controller, are notified of readiness changes by its transitions.
+	// TODO: move this condition type to the openshift/api package
+	NodeReadyCondition machinev1.ConditionType = "NodeReady"
+	// NodeNotReadyReason is the reason of the NodeReady condition when the Node is not Ready
+	NodeNotReadyReason = "NodeNotReady"
+
+	// EventAmbiguousMachineMatch is emitted on a Node matching several Machines
+	EventAmbiguousMachineMatch = "AmbiguousMachineMatch"
+	// EventAmbiguousNodeMatch is emitted on a Machine matching several Nodes
+	EventAmbiguousNodeMatch = "AmbiguousNodeMatch"
 )
 
+// reservedAnnotationKeys are the annotations of a Node owned by the nodelink controller,
+// which can't be copied from the Machine spec
+var reservedAnnotationKeys = map[string]bool{
+	machineAnnotationKey:            true,
+	managedLabelsAnnotationKey:      true,
+	managedAnnotationsAnnotationKey: true,
+	managedTaintsAnnotationKey:      true,
+	unlinkedSinceAnnotationKey:      true,
+}
+
 // blank assignment to verify that ReconcileNodeLink implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileNodeLink{}
 
@@ -38,120 +74,102 @@ type ReconcileNodeLink struct {
 	// and emulate Client.List.MatchingField behaviour
 	listNodesByFieldFunc    func(ctx context.Context, key, value string) ([]corev1.Node, error)
 	listMachinesByFieldFunc func(ctx context.Context, key, value string) ([]machinev1.Machine, error)
-	nodeReadinessCache      map[string]bool
+	recorder                record.EventRecorder
+	// strategies match Nodes and Machines, in priority order
+	strategies []matchingStrategy
+	// markUnlinkedNodes enables annotating the Nodes not linked to any Machine
+	markUnlinkedNodes bool
+	unlinked          unlinkedInventory
+}
+
+// Options configures the Nodelink Controller
+type Options struct {
+	// MatchingStrategies match Nodes and Machines, in priority order
+	MatchingStrategies []string
+	// ProviderIDRules are the normalization rules of the normalizedProviderID strategy by providerID scheme,
+	// defaults to DefaultProviderIDRules
+	ProviderIDRules map[string]ProviderIDRule
+	// MarkUnlinkedNodes enables annotating the Nodes not linked to any Machine
+	// with the time since which they have been unlinked
+	MarkUnlinkedNodes bool
+	// MaxConcurrentReconciles is the maximum number of Nodes reconciled concurrently, defaults to 1
+	MaxConcurrentReconciles int
 }
 
 // Add creates a new Nodelink Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager, opts manager.Options) error {
-	reconciler, err := newReconciler(mgr)
+	return AddWithMatchingStrategies(mgr, DefaultMatchingStrategies)
+}
+
+// AddWithMatchingStrategies creates a new Nodelink Controller matching Nodes and Machines with the given
+// strategies, in priority order, and adds it to the Manager.
+func AddWithMatchingStrategies(mgr manager.Manager, strategies []string) error {
+	return AddWithOptions(mgr, Options{MatchingStrategies: strategies})
+}
+
+// AddWithOptions creates a new Nodelink Controller configured with the given options, and adds it
+// to the Manager along with the periodic scan for unlinked Nodes and Machines.
+func AddWithOptions(mgr manager.Manager, opts Options) error {
+	reconciler, err := newReconciler(mgr, opts.MatchingStrategies, opts.ProviderIDRules)
 	if err != nil {
 		return fmt.Errorf("error building reconciler: %v", err)
 	}
-	return add(mgr, reconciler, reconciler.nodeRequestFromMachine)
+	reconciler.markUnlinkedNodes = opts.MarkUnlinkedNodes
+
+	if err := mgr.Add(manager.RunnableFunc(reconciler.runUnlinkedScans)); err != nil {
+		return fmt.Errorf("error adding unlinked scan: %v", err)
+	}
+	return add(mgr, reconciler, reconciler.nodeRequestFromMachine, opts.MaxConcurrentReconciles)
 }
 
 func indexNodeByProviderID(object client.Object) []string {
-	if node, ok := object.(*corev1.Node); ok {
-		if node.Spec.ProviderID != "" {
-			klog.V(3).Infof("Adding providerID %q for node %q to indexer", node.Spec.ProviderID, node.GetName())
-			return []string{node.Spec.ProviderID}
-		}
-		return nil
-	}
-	klog.Warningf("Expected a node for indexing field, got: %T", object)
-	return nil
+	return indexNodeByStrategy(matchingStrategies[MatchingStrategyProviderID])(object)
 }
 
 func indexMachineByProvider(object client.Object) []string {
-	if machine, ok := object.(*machinev1.Machine); ok {
-		if machine.Spec.ProviderID != nil {
-			if *machine.Spec.ProviderID != "" {
-				klog.V(3).Infof("Adding providerID %q for machine %q to indexer", *machine.Spec.ProviderID, machine.GetName())
-				return []string{*machine.Spec.ProviderID}
-			}
-		}
-		return nil
-	}
-	klog.Warningf("Expected a machine for indexing field, got: %T", object)
-	return nil
+	return indexMachineByStrategy(matchingStrategies[MatchingStrategyProviderID])(object)
 }
 
 func indexNodeByInternalIP(object client.Object) []string {
-	node, ok := object.(*corev1.Node)
-	if !ok {
-		klog.Warningf("expected a node for indexing field, got: %T", object)
-		return nil
-	}
-
-	var keys []string
-	for _, a := range node.Status.Addresses {
-		if a.Type == corev1.NodeInternalIP {
-			keys = append(keys, a.Address)
-			klog.V(3).Infof("Adding internal IP %q for node %q to indexer", a.Address, node.GetName())
-		}
-	}
-
-	return keys
+	return indexNodeByStrategy(matchingStrategies[MatchingStrategyInternalIP])(object)
 }
 
 func indexMachineByInternalIP(object client.Object) []string {
-	machine, ok := object.(*machinev1.Machine)
-	if !ok {
-		klog.Warningf("Expected a machine for indexing field, got: %T", object)
-		return nil
-	}
-
-	var keys []string
-	for _, a := range machine.Status.Addresses {
-		if a.Type == corev1.NodeInternalIP {
-			keys = append(keys, a.Address)
-			klog.V(3).Infof("Adding internal IP %q for machine %q to indexer", a.Address, machine.GetName())
-		}
-	}
-
-	return keys
+	return indexMachineByStrategy(matchingStrategies[MatchingStrategyInternalIP])(object)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) (*ReconcileNodeLink, error) {
-	// set convenient indexers
-	if err := mgr.GetCache().IndexField(context.TODO(),
-		&corev1.Node{},
-		nodeProviderIDIndex,
-		indexNodeByProviderID,
-	); err != nil {
-		return nil, fmt.Errorf("error setting index fields: %v", err)
-	}
-
-	if err := mgr.GetCache().IndexField(context.TODO(),
-		&machinev1.Machine{},
-		machineProviderIDIndex,
-		indexMachineByProvider,
-	); err != nil {
-		return nil, fmt.Errorf("error setting index fields: %v", err)
+func newReconciler(mgr manager.Manager, strategyNames []string, providerIDRules map[string]ProviderIDRule) (*ReconcileNodeLink, error) {
+	strategies, err := getMatchingStrategies(strategyNames, providerIDRules)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := mgr.GetCache().IndexField(context.TODO(),
-		&corev1.Node{},
-		nodeInternalIPIndex,
-		indexNodeByInternalIP,
-	); err != nil {
-		return nil, fmt.Errorf("error setting index fields: %v", err)
-	}
+	// set convenient indexers
+	for _, s := range strategies {
+		if err := mgr.GetCache().IndexField(context.TODO(),
+			&corev1.Node{},
+			s.nodeIndex,
+			indexNodeByStrategy(s),
+		); err != nil {
+			return nil, fmt.Errorf("error setting index fields: %v", err)
+		}
 
-	if err := mgr.GetCache().IndexField(context.TODO(),
-		&machinev1.Machine{},
-		machineInternalIPIndex,
-		indexMachineByInternalIP,
-	); err != nil {
-		return nil, fmt.Errorf("error setting index fields: %v", err)
+		if err := mgr.GetCache().IndexField(context.TODO(),
+			&machinev1.Machine{},
+			s.machineIndex,
+			indexMachineByStrategy(s),
+		); err != nil {
+			return nil, fmt.Errorf("error setting index fields: %v", err)
+		}
 	}
 
 	r := ReconcileNodeLink{
-		client: mgr.GetClient(),
+		client:     mgr.GetClient(),
+		recorder:   mgr.GetEventRecorderFor("nodelink-controller"),
+		strategies: strategies,
 	}
-	r.nodeReadinessCache = make(map[string]bool)
 
 	// This is useful for unit testing so we can mock cache IndexField
 	// and emulate Client.List.MatchingField behaviour
@@ -161,9 +179,9 @@ func newReconciler(mgr manager.Manager) (*ReconcileNodeLink, error) {
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler, mapFn handler.TypedMapFunc[*machinev1.Machine]) error {
+func add(mgr manager.Manager, r reconcile.Reconciler, mapFn handler.TypedMapFunc[*machinev1.Machine], maxConcurrentReconciles int) error {
 	// Create a new controller
-	c, err := controller.New("nodelink-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("nodelink-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: maxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
@@ -194,7 +212,7 @@ func (r *ReconcileNodeLink) Reconcile(ctx context.Context, request reconcile.Req
 	node := &corev1.Node{}
 	err := r.client.Get(context.TODO(), request.NamespacedName, node)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if apierrors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -230,21 +248,15 @@ func (r *ReconcileNodeLink) Reconcile(ctx context.Context, request reconcile.Req
 		modNode.Annotations = map[string]string{}
 	}
 	modNode.Annotations[machineAnnotationKey] = fmt.Sprintf("%s/%s", machine.GetNamespace(), machine.GetName())
-	for k, v := range machine.Spec.Annotations {
-		klog.V(4).Infof("Copying annotation %s = %s", k, v)
-		modNode.Annotations[k] = v
-	}
+	delete(modNode.Annotations, unlinkedSinceAnnotationKey)
+	syncAnnotationsToNode(modNode, machine)
 
 	if modNode.Labels == nil {
 		modNode.Labels = map[string]string{}
 	}
+	syncLabelsToNode(modNode, machine)
 
-	for k, v := range machine.Spec.Labels {
-		klog.V(4).Infof("Copying label %s = %s", k, v)
-		modNode.Labels[k] = v
-	}
-
-	addTaintsToNode(modNode, machine)
+	syncTaintsToNode(modNode, machine)
 
 	if !reflect.DeepEqual(node, modNode) {
 		klog.V(3).Infof("Node %q has changed, updating", modNode.GetName())
@@ -256,39 +268,53 @@ func (r *ReconcileNodeLink) Reconcile(ctx context.Context, request reconcile.Req
 	return reconcile.Result{}, nil
 }
 
-// updateNodeRef set the given node as nodeRef in the machine status
+// updateNodeRef sets the given node as nodeRef in the machine status, along with the NodeReady condition.
+// The machine is only updated when either changed, the state is kept on the machine itself, so that no update
+// is needed after a restart of the controller, and concurrent reconciles don't share any state.
 func (r *ReconcileNodeLink) updateNodeRef(machine *machinev1.Machine, node *corev1.Node) error {
-	now := metav1.Now()
-	machine.Status.LastUpdated = &now
-
 	if !node.DeletionTimestamp.IsZero() {
-		delete(r.nodeReadinessCache, node.GetName())
-		return nil
-	}
-
-	nodeReady := isNodeReady(node)
-	// skip update if cached and no change in readiness.
-	if cachedReady, ok := r.nodeReadinessCache[node.GetName()]; ok &&
-		cachedReady == nodeReady {
 		return nil
 	}
 
-	// if the nodeReadiness has changed the machine is updated so
-	// watchers can take action, e.g machine controller
-	machine.Status.NodeRef = &corev1.ObjectReference{
+	nodeRef := &corev1.ObjectReference{
 		Kind: "Node",
 		Name: node.GetName(),
 		UID:  node.GetUID(),
 	}
-	if err := r.client.Status().Update(context.Background(), machine); err != nil {
+	readyCondition := conditions.TrueCondition(NodeReadyCondition)
+	if !isNodeReady(node) {
+		readyCondition = conditions.FalseCondition(NodeReadyCondition, NodeNotReadyReason, machinev1.ConditionSeverityWarning, "Node %s is not Ready", node.GetName())
+	}
+
+	if reflect.DeepEqual(machine.Status.NodeRef, nodeRef) && conditionMatches(conditions.Get(machine, NodeReadyCondition), readyCondition) {
+		return nil
+	}
+
+	// if the nodeRef or the node readiness has changed the machine is updated so
+	// watchers can take action, e.g machine controller.
+	// The optimistic lock prevents overwriting the conditions set concurrently by other controllers.
+	patchBase := client.MergeFromWithOptions(machine.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	machine.Status.NodeRef = nodeRef
+	conditions.Set(machine, readyCondition)
+	now := metav1.Now()
+	machine.Status.LastUpdated = &now
+	if err := r.client.Status().Patch(context.Background(), machine, patchBase); err != nil {
 		return fmt.Errorf("error updating machine %q: %v", machine.GetName(), err)
 	}
-	r.nodeReadinessCache[node.GetName()] = nodeReady
 
 	klog.Infof("Successfully updated nodeRef for machine %q and node %q", machine.GetName(), node.GetName())
 	return nil
 }
 
+// conditionMatches returns true if the existing condition has the same state as the expected one
+func conditionMatches(existing, expected *machinev1.Condition) bool {
+	return existing != nil &&
+		existing.Status == expected.Status &&
+		existing.Reason == expected.Reason &&
+		existing.Severity == expected.Severity &&
+		existing.Message == expected.Message
+}
+
 // nodeRequestFromMachine returns a reconcile.request for the node backed by the received machine
 func (r *ReconcileNodeLink) nodeRequestFromMachine(ctx context.Context, o *machinev1.Machine) []reconcile.Request {
 	klog.V(3).Infof("Watched machine event, finding node to reconcile.Request")
@@ -332,174 +358,277 @@ func (r *ReconcileNodeLink) nodeRequestFromMachine(ctx context.Context, o *machi
 	return []reconcile.Request{}
 }
 
-// findNodeFromMachine find a node from by providerID and fallback to find by IP
+// findNodeFromMachine finds a node from the machine with the matching strategies, in priority order.
+// When a strategy matches several nodes, a warning event is emitted, and no node is returned unless a lower
+// priority strategy matches a unique node.
 func (r *ReconcileNodeLink) findNodeFromMachine(ctx context.Context, machine *machinev1.Machine) (*corev1.Node, error) {
 	klog.V(3).Infof("Finding node from machine %q", machine.GetName())
-	node, err := r.findNodeFromMachineByProviderID(ctx, machine)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find node from machine %q by ProviderID: %v", machine.GetName(), err)
-	}
-	if node != nil {
-		return node, nil
-	}
-
-	node, err = r.findNodeFromMachineByIP(ctx, machine)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find node from machine %q by internal IP: %v", machine.GetName(), err)
-	}
-	return node, nil
-}
-
-func (r *ReconcileNodeLink) findNodeFromMachineByProviderID(ctx context.Context, machine *machinev1.Machine) (*corev1.Node, error) {
-	klog.V(3).Infof("Finding node from machine %q by providerID", machine.GetName())
-	if machine.Spec.ProviderID == nil {
-		klog.Warningf("Machine %q has no providerID", machine.GetName())
+	node, err := r.matchNodeFromMachine(ctx, machine)
+	var ambiguousErr *ambiguousMatchError
+	if errors.As(err, &ambiguousErr) {
+		if node != nil {
+			klog.Warningf("Machine %q: %v, linking node %q matched by %s", machine.GetName(), err, node.GetName(), ambiguousErr.resolvedBy)
+			r.recorder.Eventf(machine, corev1.EventTypeWarning, EventAmbiguousNodeMatch, "Machine %s %v, linking node %s matched by %s", machine.GetName(), err, node.GetName(), ambiguousErr.resolvedBy)
+			return node, nil
+		}
+		klog.Warningf("Machine %q: %v, not linking", machine.GetName(), err)
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, EventAmbiguousNodeMatch, "Machine %s %v, not linking", machine.GetName(), err)
 		return nil, nil
 	}
+	return node, err
+}
 
-	nodes, err := r.listNodesByFieldFunc(ctx, nodeProviderIDIndex, *machine.Spec.ProviderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed getting node list: %v", err)
-	}
-
-	if len(nodes) > 1 {
-		return nil, fmt.Errorf("failed getting node: expected 1 node, got %v", len(nodes))
+// matchNodeFromMachine finds a node from the machine with the matching strategies, in priority order.
+// A strategy matching several nodes does not stop the next ones, e.g. the explicit link annotation, from finding
+// a unique node. An ambiguousMatchError is returned for the first strategy matching several nodes, along with the
+// node a lower priority strategy matched, if any.
+func (r *ReconcileNodeLink) matchNodeFromMachine(ctx context.Context, machine *machinev1.Machine) (*corev1.Node, error) {
+	var ambiguousErr *ambiguousMatchError
+	for _, s := range r.strategies {
+		node, err := r.findNodeFromMachineByStrategy(ctx, machine, s)
+		var strategyAmbiguousErr *ambiguousMatchError
+		if errors.As(err, &strategyAmbiguousErr) {
+			klog.V(3).Infof("%v, trying the next strategies", err)
+			if ambiguousErr == nil {
+				ambiguousErr = strategyAmbiguousErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find node from machine %q by %s: %v", machine.GetName(), s.name, err)
+		}
+		if node != nil {
+			if ambiguousErr != nil {
+				ambiguousErr.resolvedBy = s.name
+				return node, ambiguousErr
+			}
+			return node, nil
+		}
 	}
-
-	if len(nodes) == 1 {
-		klog.V(3).Infof("Found node %q for machine %q with providerID %q", nodes[0].GetName(), machine.GetName(), nodes[0].Spec.ProviderID)
-		return nodes[0].DeepCopy(), nil
+	if ambiguousErr != nil {
+		return nil, ambiguousErr
 	}
-
 	return nil, nil
 }
 
-func (r *ReconcileNodeLink) findNodeFromMachineByIP(ctx context.Context, machine *machinev1.Machine) (*corev1.Node, error) {
-	klog.V(3).Infof("Finding node from machine %q by IP", machine.GetName())
-	var machineInternalAddress string
-	for _, a := range machine.Status.Addresses {
-		if a.Type == corev1.NodeInternalIP {
-			machineInternalAddress = a.Address
-			klog.V(3).Infof("Found internal IP for machine %q: %q", machine.GetName(), machineInternalAddress)
-			break
+// findMachineFromNode finds a machine from the node with the matching strategies, in priority order.
+// When a strategy matches several machines, a warning event is emitted, and no machine is returned unless a lower
+// priority strategy matches a unique machine.
+func (r *ReconcileNodeLink) findMachineFromNode(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
+	klog.V(3).Infof("Finding machine from node %q", node.GetName())
+	machine, err := r.matchMachineFromNode(ctx, node)
+	var ambiguousErr *ambiguousMatchError
+	if errors.As(err, &ambiguousErr) {
+		if machine != nil {
+			klog.Warningf("Node %q: %v, linking machine %q matched by %s", node.GetName(), err, machine.GetName(), ambiguousErr.resolvedBy)
+			r.recorder.Eventf(node, corev1.EventTypeWarning, EventAmbiguousMachineMatch, "Node %s %v, linking machine %s matched by %s", node.GetName(), err, machine.GetName(), ambiguousErr.resolvedBy)
+			return machine, nil
 		}
-	}
-
-	if machineInternalAddress == "" {
-		klog.Warningf("not found internal IP for machine %q", machine.GetName())
+		klog.Warningf("Node %q: %v, not linking", node.GetName(), err)
+		r.recorder.Eventf(node, corev1.EventTypeWarning, EventAmbiguousMachineMatch, "Node %s %v, not linking", node.GetName(), err)
 		return nil, nil
 	}
+	return machine, err
+}
 
-	nodes, err := r.listNodesByFieldFunc(ctx, nodeInternalIPIndex, machineInternalAddress)
-	if err != nil {
-		return nil, fmt.Errorf("failed getting node list: %v", err)
-	}
-
-	if len(nodes) > 1 {
-		return nil, fmt.Errorf("failed getting node: expected 1 node, got %v", len(nodes))
+// matchMachineFromNode finds a machine from the node with the matching strategies, in priority order.
+// A strategy matching several machines does not stop the next ones, e.g. the explicit link annotation, from finding
+// a unique machine. An ambiguousMatchError is returned for the first strategy matching several machines, along with
+// the machine a lower priority strategy matched, if any.
+func (r *ReconcileNodeLink) matchMachineFromNode(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
+	var ambiguousErr *ambiguousMatchError
+	for _, s := range r.strategies {
+		machine, err := r.findMachineFromNodeByStrategy(ctx, node, s)
+		var strategyAmbiguousErr *ambiguousMatchError
+		if errors.As(err, &strategyAmbiguousErr) {
+			klog.V(3).Infof("%v, trying the next strategies", err)
+			if ambiguousErr == nil {
+				ambiguousErr = strategyAmbiguousErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find machine from node %q by %s: %v", node.GetName(), s.name, err)
+		}
+		if machine != nil {
+			if ambiguousErr != nil {
+				ambiguousErr.resolvedBy = s.name
+				return machine, ambiguousErr
+			}
+			return machine, nil
+		}
 	}
-
-	if len(nodes) == 1 {
-		klog.V(3).Infof("Found node %q for machine %q with internal IP %q", nodes[0].GetName(), machine.GetName(), machineInternalAddress)
-		return nodes[0].DeepCopy(), nil
+	if ambiguousErr != nil {
+		return nil, ambiguousErr
 	}
-
-	klog.V(3).Infof("Matching node not found for machine %q with internal IP %q", machine.GetName(), machineInternalAddress)
 	return nil, nil
 }
 
-func (r *ReconcileNodeLink) findMachineFromNode(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
-	klog.V(3).Infof("Finding machine from node %q", node.GetName())
-	machine, err := r.findMachineFromNodeByProviderID(ctx, node)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find machine from node %q by ProviderID: %v", node.GetName(), err)
+// syncLabelsToNode copies the labels from the machine spec to the node, and removes the labels
+// previously copied which are not in the machine spec anymore. Other labels are left untouched.
+// A label the node already had with the same value is not managed, so it is kept once removed from the machine.
+func syncLabelsToNode(node *corev1.Node, machine *machinev1.Machine) {
+	previouslyManaged := sets.New(getManagedKeys(node, managedLabelsAnnotationKey)...)
+	if !hasManagedKeys(node, managedLabelsAnnotationKey) {
+		// The labels copied before the managed labels were recorded are the ones with the value of the machine spec
+		for k, v := range machine.Spec.Labels {
+			if current, ok := node.Labels[k]; ok && current == v {
+				previouslyManaged.Insert(k)
+			}
+		}
 	}
-	if machine != nil {
-		return machine, nil
+	for k := range previouslyManaged {
+		if _, ok := machine.Spec.Labels[k]; !ok {
+			klog.V(4).Infof("Removing label %s no longer in machine %q from node %q", k, machine.GetName(), node.GetName())
+			delete(node.Labels, k)
+		}
 	}
 
-	machine, err = r.findMachineFromNodeByIP(ctx, node)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find machine from node %q by internal IP: %v", node.GetName(), err)
+	var managed []string
+	for k, v := range machine.Spec.Labels {
+		if current, ok := node.Labels[k]; ok && current == v && !previouslyManaged.Has(k) {
+			klog.V(4).Infof("Label %s = %s already set on node %q, not managing it", k, v, node.GetName())
+			continue
+		}
+		klog.V(4).Infof("Copying label %s = %s", k, v)
+		node.Labels[k] = v
+		managed = append(managed, k)
 	}
-	return machine, nil
+	setManagedKeys(node, managedLabelsAnnotationKey, managed)
 }
 
-func (r *ReconcileNodeLink) findMachineFromNodeByProviderID(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
-	klog.V(3).Infof("Finding machine from node %q by ProviderID", node.GetName())
-	if node.Spec.ProviderID == "" {
-		klog.Warningf("Node %q has no providerID", node.GetName())
-		return nil, nil
-	}
-
-	machines, err := r.listMachinesByFieldFunc(ctx, machineProviderIDIndex, node.Spec.ProviderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed getting node list: %v", err)
+// syncAnnotationsToNode copies the annotations from the machine spec to the node, and removes the annotations
+// previously copied which are not in the machine spec anymore. Other annotations are left untouched.
+// An annotation the node already had with the same value is not managed, so it is kept once removed from the machine.
+func syncAnnotationsToNode(node *corev1.Node, machine *machinev1.Machine) {
+	previouslyManaged := sets.New(getManagedKeys(node, managedAnnotationsAnnotationKey)...)
+	if !hasManagedKeys(node, managedAnnotationsAnnotationKey) {
+		// The annotations copied before the managed annotations were recorded are the ones with the value of the machine spec
+		for k, v := range machine.Spec.Annotations {
+			if current, ok := node.Annotations[k]; ok && current == v && !reservedAnnotationKeys[k] {
+				previouslyManaged.Insert(k)
+			}
+		}
 	}
-
-	if len(machines) > 1 {
-		return nil, fmt.Errorf("failed getting machine: expected 1 machine, got %v", len(machines))
+	for k := range previouslyManaged {
+		if _, ok := machine.Spec.Annotations[k]; !ok && !reservedAnnotationKeys[k] {
+			klog.V(4).Infof("Removing annotation %s no longer in machine %q from node %q", k, machine.GetName(), node.GetName())
+			delete(node.Annotations, k)
+		}
 	}
 
-	if len(machines) > 0 {
-		klog.V(3).Infof("Found machine %q for node %q with providerID %q", machines[0].GetName(), node.GetName(), node.Spec.ProviderID)
-		return machines[0].DeepCopy(), nil
+	var managed []string
+	for k, v := range machine.Spec.Annotations {
+		if reservedAnnotationKeys[k] {
+			klog.Warningf("Skipping annotation %s of machine %q, it is reserved to the nodelink controller", k, machine.GetName())
+			continue
+		}
+		if current, ok := node.Annotations[k]; ok && current == v && !previouslyManaged.Has(k) {
+			klog.V(4).Infof("Annotation %s = %s already set on node %q, not managing it", k, v, node.GetName())
+			continue
+		}
+		klog.V(4).Infof("Copying annotation %s = %s", k, v)
+		node.Annotations[k] = v
+		managed = append(managed, k)
 	}
-	return nil, nil
+	setManagedKeys(node, managedAnnotationsAnnotationKey, managed)
 }
 
-func (r *ReconcileNodeLink) findMachineFromNodeByIP(ctx context.Context, node *corev1.Node) (*machinev1.Machine, error) {
-	klog.V(3).Infof("Finding machine from node %q by IP", node.GetName())
-	var nodeInternalAddress string
-	for _, a := range node.Status.Addresses {
-		if a.Type == corev1.NodeInternalIP {
-			nodeInternalAddress = a.Address
-			klog.V(3).Infof("Found internal IP for node %q: %q", node.GetName(), nodeInternalAddress)
-			break
+// syncTaintsToNode adds the taints from the machine spec to the node, updates the values of the taints it previously
+// added, and removes the ones which are not in the machine spec anymore. Taints are identified by key and effect.
+// Taints are to be an authoritative list on the machine spec per cluster-api comments.
+// However, we believe many components can directly taint a node and there is no direct source of truth that should
+// enforce a single writer of taints, so a taint with the same key and effect already added by another component is left untouched.
+func syncTaintsToNode(node *corev1.Node, machine *machinev1.Machine) {
+	previouslyManaged := map[string]bool{}
+	for _, k := range getManagedKeys(node, managedTaintsAnnotationKey) {
+		previouslyManaged[k] = true
+	}
+	if !hasManagedKeys(node, managedTaintsAnnotationKey) {
+		// The taints added before the managed taints were recorded are the ones with the value of the machine spec
+		for _, mTaint := range machine.Spec.Taints {
+			for _, nTaint := range node.Spec.Taints {
+				if nTaint.Key == mTaint.Key && nTaint.Effect == mTaint.Effect && nTaint.Value == mTaint.Value {
+					previouslyManaged[taintKey(mTaint)] = true
+				}
+			}
 		}
 	}
-
-	if nodeInternalAddress == "" {
-		klog.Warningf("Node %q has no internal IP", node.GetName())
-		return nil, nil
-	}
-
-	machines, err := r.listMachinesByFieldFunc(ctx, machineInternalIPIndex, nodeInternalAddress)
-	if err != nil {
-		return nil, fmt.Errorf("failed getting node list: %v", err)
-	}
-
-	if len(machines) > 1 {
-		return nil, fmt.Errorf("failed getting machine: expected 1 machine, got %v", len(machines))
+	machineTaints := map[string]bool{}
+	for _, mTaint := range machine.Spec.Taints {
+		machineTaints[taintKey(mTaint)] = true
 	}
 
-	if len(machines) == 1 {
-		klog.V(3).Infof("Found machine %q for node %q with internal IP %q", machines[0].GetName(), node.GetName(), nodeInternalAddress)
-		return machines[0].DeepCopy(), nil
+	// filter in place, so an empty list of taints stays empty rather than nil
+	taints := node.Spec.Taints[:0]
+	for _, nTaint := range node.Spec.Taints {
+		if previouslyManaged[taintKey(nTaint)] && !machineTaints[taintKey(nTaint)] {
+			klog.V(4).Infof("Removing taint %v no longer in machine %q from node %q", nTaint, machine.GetName(), node.GetName())
+			continue
+		}
+		taints = append(taints, nTaint)
 	}
+	node.Spec.Taints = taints
 
-	klog.V(3).Infof("Matching machine not found for node %q with internal IP %q", node.GetName(), nodeInternalAddress)
-	return nil, nil
-}
-
-// addTaintsToNode adds taints from machine object to the node object
-// Taints are to be an authoritative list on the machine spec per cluster-api comments.
-// However, we believe many components can directly taint a node and there is no direct source of truth that should enforce a single writer of taints
-func addTaintsToNode(node *corev1.Node, machine *machinev1.Machine) {
+	var managed []string
 	for _, mTaint := range machine.Spec.Taints {
 		klog.V(4).Infof("Adding taint %v from machine %q to node %q", mTaint, machine.GetName(), node.GetName())
+		key := taintKey(mTaint)
 		alreadyPresent := false
-		for _, nTaint := range node.Spec.Taints {
-			if nTaint.Key == mTaint.Key && nTaint.Effect == mTaint.Effect {
+		for i := range node.Spec.Taints {
+			nTaint := &node.Spec.Taints[i]
+			if nTaint.Key != mTaint.Key || nTaint.Effect != mTaint.Effect {
+				continue
+			}
+			alreadyPresent = true
+			if !previouslyManaged[key] {
 				klog.V(4).Infof("Skipping to add machine taint, %v, to the node. Node already has a taint with same key and effect", mTaint)
-				alreadyPresent = true
 				break
 			}
+			if nTaint.Value != mTaint.Value {
+				klog.V(4).Infof("Updating value of taint %v from machine %q on node %q", mTaint, machine.GetName(), node.GetName())
+				nTaint.Value = mTaint.Value
+			}
+			managed = append(managed, key)
+			break
 		}
 		if !alreadyPresent {
 			node.Spec.Taints = append(node.Spec.Taints, mTaint)
+			managed = append(managed, key)
 		}
 	}
+	setManagedKeys(node, managedTaintsAnnotationKey, managed)
+}
+
+// taintKey identifies a taint by its key and effect
+func taintKey(taint corev1.Taint) string {
+	return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+}
+
+// getManagedKeys returns the keys recorded in the given managed keys annotation of the node
+func getManagedKeys(node *corev1.Node, annotation string) []string {
+	value := node.Annotations[annotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// hasManagedKeys returns true when the given managed keys annotation of the node was recorded, even empty.
+// A node without it was synced, if ever, before the managed keys were recorded.
+func hasManagedKeys(node *corev1.Node, annotation string) bool {
+	_, ok := node.Annotations[annotation]
+	return ok
+}
+
+// setManagedKeys records the keys in the given managed keys annotation of the node,
+// keeping the annotation empty when there are none
+func setManagedKeys(node *corev1.Node, annotation string, keys []string) {
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	sort.Strings(keys)
+	node.Annotations[annotation] = strings.Join(keys, ",")
 }
 
 func (r *ReconcileNodeLink) listNodesByField(ctx context.Context, key, value string) ([]corev1.Node, error) {
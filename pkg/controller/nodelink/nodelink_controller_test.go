@@ -9,10 +9,13 @@ import (
 	"testing"
 	"time"
 
+	. "github.com/onsi/gomega"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -140,7 +143,12 @@ func newFakeReconciler(client client.Client, machine *machinev1.Machine, node *c
 	r.buildFakeNodeIndexer(*node)
 	r.buildFakeMachineIndexer(*machine)
 
-	r.nodeReadinessCache = make(map[string]bool)
+	r.recorder = record.NewFakeRecorder(10)
+	strategies, err := getMatchingStrategies(DefaultMatchingStrategies, nil)
+	if err != nil {
+		panic(err)
+	}
+	r.strategies = strategies
 	return r
 }
 
@@ -191,7 +199,7 @@ func TestFindMachineFromNodeByProviderID(t *testing.T) {
 	for _, tc := range testCases {
 		r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.machine).WithStatusSubresource(&machinev1.Machine{}).Build(), tc.machine, tc.node)
 
-		machine, err := r.findMachineFromNodeByProviderID(context.Background(), tc.node)
+		machine, err := r.findMachineFromNodeByStrategy(context.Background(), tc.node, matchingStrategies[MatchingStrategyProviderID])
 		if err != nil {
 			t.Errorf("unexpected error finding machine from node by providerID: %v", err)
 		}
@@ -251,7 +259,7 @@ func TestFindMachineFromNodeByIP(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.machine).Build(), tc.machine, tc.node)
-		machine, err := r.findMachineFromNodeByIP(context.Background(), tc.node)
+		machine, err := r.findMachineFromNodeByStrategy(context.Background(), tc.node, matchingStrategies[MatchingStrategyInternalIP])
 		if err != nil {
 			t.Errorf("unexpected error finding machine from node by IP: %v", err)
 		}
@@ -287,7 +295,7 @@ func TestFindNodeFromMachineByProviderID(t *testing.T) {
 	for _, tc := range testCases {
 		r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.node).Build(), tc.machine, tc.node)
 
-		node, err := r.findNodeFromMachineByProviderID(context.Background(), tc.machine)
+		node, err := r.findNodeFromMachineByStrategy(context.Background(), tc.machine, matchingStrategies[MatchingStrategyProviderID])
 		if err != nil {
 			t.Errorf("unexpected error finding machine from node by providerID: %v", err)
 		}
@@ -352,7 +360,7 @@ func TestFindNodeFromMachineByIP(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.node).Build(), tc.machine, tc.node)
-		node, err := r.findNodeFromMachineByIP(context.Background(), tc.machine)
+		node, err := r.findNodeFromMachineByStrategy(context.Background(), tc.machine, matchingStrategies[MatchingStrategyInternalIP])
 		if err != nil {
 			t.Errorf("unexpected error finding node from machine by IP: %v", err)
 		}
@@ -363,7 +371,7 @@ func TestFindNodeFromMachineByIP(t *testing.T) {
 	}
 }
 
-func TestAddTaintsToNode(t *testing.T) {
+func TestSyncTaintsToNode(t *testing.T) {
 	testCases := []struct {
 		description             string
 		nodeTaints              []corev1.Taint
@@ -400,7 +408,7 @@ func TestAddTaintsToNode(t *testing.T) {
 	for _, test := range testCases {
 		machine := machine("", "", nil, test.machineTaints, nil)
 		node := node("", "", nil, test.nodeTaints)
-		addTaintsToNode(node, machine)
+		syncTaintsToNode(node, machine)
 		if !reflect.DeepEqual(node.Spec.Taints, test.expectedFinalNodeTaints) {
 			t.Errorf("Test case: %s. Expected: %v, got: %v", test.description, test.expectedFinalNodeTaints, node.Spec.Taints)
 		}
@@ -714,13 +722,38 @@ func TestIndexMachineByInternalIP(t *testing.T) {
 }
 
 func TestUpdateNodeRef(t *testing.T) {
+	withConditions := func(m *machinev1.Machine, c ...machinev1.Condition) *machinev1.Machine {
+		m.Status.Conditions = c
+		return m
+	}
+	notReady := func(n *corev1.Node) *corev1.Node {
+		n.Status.Conditions[0].Status = corev1.ConditionFalse
+		return n
+	}
+	readyCondition := machinev1.Condition{
+		Type:               NodeReadyCondition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: knownDate,
+	}
+	notReadyCondition := machinev1.Condition{
+		Type:               NodeReadyCondition,
+		Status:             corev1.ConditionFalse,
+		Reason:             NodeNotReadyReason,
+		Severity:           machinev1.ConditionSeverityWarning,
+		Message:            "Node readinessChangedNode is not Ready",
+		LastTransitionTime: knownDate,
+	}
+
 	testCases := []struct {
-		machine            *machinev1.Machine
-		node               *corev1.Node
-		nodeRef            *corev1.ObjectReference
-		nodeReadinessCache map[string]bool
+		name              string
+		machine           *machinev1.Machine
+		node              *corev1.Node
+		nodeRef           *corev1.ObjectReference
+		expectedCondition *machinev1.Condition
+		expectUpdate      bool
 	}{
 		{
+			name:    "new node",
 			machine: machine("fakeMachine", "", nil, nil, nil),
 			node:    node("newNode", "", nil, nil),
 			nodeRef: &corev1.ObjectReference{
@@ -728,25 +761,63 @@ func TestUpdateNodeRef(t *testing.T) {
 				Name: "newNode",
 				UID:  "",
 			},
-			nodeReadinessCache: map[string]bool{},
+			expectedCondition: &machinev1.Condition{Type: NodeReadyCondition, Status: corev1.ConditionTrue},
+			expectUpdate:      true,
 		},
 		{
-			machine: machine("fakeMachine", "", nil, nil, nil),
-			node:    node("readinessChangedNode", "", nil, nil),
+			name: "node readiness changed to Ready",
+			machine: withConditions(machine("fakeMachine", "", nil, nil, &corev1.ObjectReference{
+				Kind: "Node",
+				Name: "readinessChangedNode",
+			}), notReadyCondition),
+			node: node("readinessChangedNode", "", nil, nil),
+			nodeRef: &corev1.ObjectReference{
+				Kind: "Node",
+				Name: "readinessChangedNode",
+				UID:  "",
+			},
+			expectedCondition: &machinev1.Condition{Type: NodeReadyCondition, Status: corev1.ConditionTrue},
+			expectUpdate:      true,
+		},
+		{
+			name: "node readiness changed to not Ready",
+			machine: withConditions(machine("fakeMachine", "", nil, nil, &corev1.ObjectReference{
+				Kind: "Node",
+				Name: "readinessChangedNode",
+			}), readyCondition),
+			node: notReady(node("readinessChangedNode", "", nil, nil)),
 			nodeRef: &corev1.ObjectReference{
 				Kind: "Node",
 				Name: "readinessChangedNode",
 				UID:  "",
 			},
-			nodeReadinessCache: map[string]bool{"readinessChangedNode": false},
+			expectedCondition: &notReadyCondition,
+			expectUpdate:      true,
+		},
+		{
+			name: "node readiness unchanged",
+			machine: withConditions(machine("fakeMachine", "", nil, nil, &corev1.ObjectReference{
+				Kind: "Node",
+				Name: "unchangedNode",
+			}), readyCondition),
+			node: node("unchangedNode", "", nil, nil),
+			nodeRef: &corev1.ObjectReference{
+				Kind: "Node",
+				Name: "unchangedNode",
+				UID:  "",
+			},
+			expectedCondition: &readyCondition,
+			expectUpdate:      false,
 		},
 		{
-			machine:            machine("fakeMachine", "", nil, nil, nil),
-			node:               node("deleting", "", nil, nil),
-			nodeRef:            nil,
-			nodeReadinessCache: map[string]bool{},
+			name:         "deleting node",
+			machine:      machine("fakeMachine", "", nil, nil, nil),
+			node:         node("deleting", "", nil, nil),
+			nodeRef:      nil,
+			expectUpdate: false,
 		},
 		{
+			name: "deleting node, with a nodeRef",
 			machine: machine("fakeMachine", "", nil, nil, &corev1.ObjectReference{
 				Kind: "Node",
 				Name: "newNode",
@@ -758,36 +829,42 @@ func TestUpdateNodeRef(t *testing.T) {
 				Name: "newNode",
 				UID:  "",
 			},
-			nodeReadinessCache: map[string]bool{},
+			expectUpdate: false,
 		},
 	}
 
 	for _, tc := range testCases {
-		r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.machine).WithStatusSubresource(&machinev1.Machine{}).Build(), tc.machine, tc.node)
-		if tc.node.GetName() == "deleting" {
-			now := metav1.Now()
-			tc.node.DeletionTimestamp = &now
-		}
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
 
-		if err := r.updateNodeRef(tc.machine, tc.node); err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
+			r := newFakeReconciler(fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.machine).WithStatusSubresource(&machinev1.Machine{}).Build(), tc.machine, tc.node)
+			if tc.node.GetName() == "deleting" {
+				now := metav1.Now()
+				tc.node.DeletionTimestamp = &now
+			}
 
-		got := &machinev1.Machine{}
-		if err := r.client.Get(
-			context.TODO(),
-			client.ObjectKey{
-				Namespace: tc.machine.GetNamespace(),
-				Name:      tc.machine.GetName(),
-			},
-			got,
-		); err != nil {
-			t.Errorf("unexpected error getting machine: %v", err)
-		}
+			g.Expect(r.updateNodeRef(tc.machine.DeepCopy(), tc.node)).To(Succeed())
 
-		if !reflect.DeepEqual(got.Status.NodeRef, tc.nodeRef) {
-			t.Errorf("Expected: %v, got: %v", tc.nodeRef, got.Status.NodeRef)
-		}
+			got := &machinev1.Machine{}
+			g.Expect(r.client.Get(context.TODO(), client.ObjectKeyFromObject(tc.machine), got)).To(Succeed())
+			g.Expect(got.Status.NodeRef).To(Equal(tc.nodeRef))
+
+			condition := conditions.Get(got, NodeReadyCondition)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+			} else {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(*condition).To(conditions.MatchCondition(*tc.expectedCondition))
+			}
+
+			if tc.expectUpdate {
+				g.Expect(got.ResourceVersion).ToNot(Equal(tc.machine.ResourceVersion))
+				g.Expect(got.Status.LastUpdated).ToNot(BeNil())
+			} else {
+				g.Expect(got.ResourceVersion).To(Equal(tc.machine.ResourceVersion))
+				g.Expect(got.Status.LastUpdated).To(BeNil())
+			}
+		})
 	}
 }
 
@@ -823,3 +900,145 @@ func TestFindMachineFromNodeDoesNotPanicBZ1747246(t *testing.T) {
 		t.Errorf("expected error to contain %q, got %v", errmsg, err)
 	}
 }
+
+func TestSyncNodeMetadataRemovals(t *testing.T) {
+	g := NewWithT(t)
+
+	n := node("node", "", nil, []corev1.Taint{{Key: "other", Value: "v", Effect: corev1.TaintEffectNoSchedule}})
+	n.Labels = map[string]string{"other": "v", "preset": "v", "overridden": "v"}
+	// The node was synced since the managed keys are recorded, while the machine had none
+	n.Annotations = map[string]string{
+		"other":                         "v",
+		managedLabelsAnnotationKey:      "",
+		managedAnnotationsAnnotationKey: "",
+		managedTaintsAnnotationKey:      "",
+	}
+
+	m := machine("machine", "", nil, []corev1.Taint{
+		{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "removed", Value: "v", Effect: corev1.TaintEffectNoExecute},
+	}, nil)
+	m.Spec.Labels = map[string]string{"kept": "v", "removed": "v", "preset": "v", "overridden": "machine"}
+	m.Spec.Annotations = map[string]string{"kept": "v", "removed": "v", machineAnnotationKey: "reserved"}
+
+	sync := func() {
+		syncLabelsToNode(n, m)
+		syncAnnotationsToNode(n, m)
+		syncTaintsToNode(n, m)
+	}
+
+	// A label already set on the node with the same value is not managed, one with another value is
+	sync()
+	g.Expect(n.Labels).To(Equal(map[string]string{"other": "v", "kept": "v", "removed": "v", "preset": "v", "overridden": "machine"}))
+	g.Expect(n.Annotations).To(Equal(map[string]string{
+		"other":                         "v",
+		"kept":                          "v",
+		"removed":                       "v",
+		managedLabelsAnnotationKey:      "kept,overridden,removed",
+		managedAnnotationsAnnotationKey: "kept,removed",
+		managedTaintsAnnotationKey:      "dedicated:NoSchedule,removed:NoExecute",
+	}))
+	g.Expect(n.Spec.Taints).To(ConsistOf(
+		corev1.Taint{Key: "other", Value: "v", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "removed", Value: "v", Effect: corev1.TaintEffectNoExecute},
+	))
+
+	// Keys removed from the machine are removed from the node, values changed are updated,
+	// and keys set by others are left untouched
+	m.Spec.Labels = map[string]string{"kept": "changed"}
+	m.Spec.Annotations = map[string]string{"kept": "v"}
+	m.Spec.Taints = []corev1.Taint{
+		{Key: "dedicated", Value: "storage", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "other", Value: "changed", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	sync()
+	g.Expect(n.Labels).To(Equal(map[string]string{"other": "v", "kept": "changed", "preset": "v"}))
+	g.Expect(n.Annotations).To(Equal(map[string]string{
+		"other":                         "v",
+		"kept":                          "v",
+		managedLabelsAnnotationKey:      "kept",
+		managedAnnotationsAnnotationKey: "kept",
+		managedTaintsAnnotationKey:      "dedicated:NoSchedule",
+	}))
+	g.Expect(n.Spec.Taints).To(ConsistOf(
+		corev1.Taint{Key: "other", Value: "v", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "dedicated", Value: "storage", Effect: corev1.TaintEffectNoSchedule},
+	))
+
+	// Once the machine has none left, the managed keys annotations are kept empty
+	m.Spec.Labels = nil
+	m.Spec.Annotations = nil
+	m.Spec.Taints = nil
+
+	sync()
+	g.Expect(n.Labels).To(Equal(map[string]string{"other": "v", "preset": "v"}))
+	g.Expect(n.Annotations).To(Equal(map[string]string{
+		"other":                         "v",
+		managedLabelsAnnotationKey:      "",
+		managedAnnotationsAnnotationKey: "",
+		managedTaintsAnnotationKey:      "",
+	}))
+	g.Expect(n.Spec.Taints).To(ConsistOf(corev1.Taint{Key: "other", Value: "v", Effect: corev1.TaintEffectNoSchedule}))
+}
+
+func TestSyncNodeMetadataSyncedBeforeManagedKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	// The node was synced before the managed keys were recorded: it has the metadata of the machine spec,
+	// along with a label and a taint another component set with other values
+	n := node("node", "", nil, []corev1.Taint{
+		{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "shared", Value: "other", Effect: corev1.TaintEffectNoExecute},
+	})
+	n.Labels = map[string]string{"role": "infra", "zone": "other"}
+	n.Annotations = map[string]string{"note": "v"}
+
+	m := machine("machine", "", nil, []corev1.Taint{
+		{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "shared", Value: "machine", Effect: corev1.TaintEffectNoExecute},
+	}, nil)
+	m.Spec.Labels = map[string]string{"role": "infra", "zone": "machine"}
+	m.Spec.Annotations = map[string]string{"note": "v"}
+
+	sync := func() {
+		syncLabelsToNode(n, m)
+		syncAnnotationsToNode(n, m)
+		syncTaintsToNode(n, m)
+	}
+
+	// The keys with the value of the machine spec are adopted, the others are left to the component which set them
+	sync()
+	g.Expect(n.Labels).To(Equal(map[string]string{"role": "infra", "zone": "machine"}))
+	g.Expect(n.Annotations).To(Equal(map[string]string{
+		"note":                          "v",
+		managedLabelsAnnotationKey:      "role,zone",
+		managedAnnotationsAnnotationKey: "note",
+		managedTaintsAnnotationKey:      "dedicated:NoSchedule",
+	}))
+	g.Expect(n.Spec.Taints).To(ConsistOf(
+		corev1.Taint{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "shared", Value: "other", Effect: corev1.TaintEffectNoExecute},
+	))
+
+	// The adopted keys are updated and removed along with the machine spec
+	m.Spec.Labels = map[string]string{"zone": "machine"}
+	m.Spec.Annotations = nil
+	m.Spec.Taints = []corev1.Taint{
+		{Key: "dedicated", Value: "storage", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "shared", Value: "machine", Effect: corev1.TaintEffectNoExecute},
+	}
+
+	sync()
+	g.Expect(n.Labels).To(Equal(map[string]string{"zone": "machine"}))
+	g.Expect(n.Annotations).To(Equal(map[string]string{
+		managedLabelsAnnotationKey:      "zone",
+		managedAnnotationsAnnotationKey: "",
+		managedTaintsAnnotationKey:      "dedicated:NoSchedule",
+	}))
+	g.Expect(n.Spec.Taints).To(ConsistOf(
+		corev1.Taint{Key: "dedicated", Value: "storage", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "shared", Value: "other", Effect: corev1.TaintEffectNoExecute},
+	))
+}
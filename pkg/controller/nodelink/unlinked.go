@@ -0,0 +1,176 @@
+package nodelink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// unlinkedSinceAnnotationKey marks, when enabled, the Nodes not linked to any Machine with the RFC 3339 time
+	// since which they have been unlinked. It is removed once the Node is linked.
+	unlinkedSinceAnnotationKey = "machine.openshift.io/unlinked-since"
+
+	// EventNodeUnlinked is emitted on a Node which has not been linked to any Machine for unlinkedReportAfter
+	EventNodeUnlinked = "NodeUnlinked"
+	// EventMachineUnlinked is emitted on a Machine which has not been linked to any Node for unlinkedReportAfter
+	EventMachineUnlinked = "MachineUnlinked"
+
+	// unlinkedScanInterval is how often the Nodes and Machines are scanned for unlinked ones
+	unlinkedScanInterval = time.Minute
+	// unlinkedReportAfter is how long a Node or Machine may stay unlinked before an event is emitted,
+	// which leaves time for new Machines to get provisioned and their Nodes to join
+	unlinkedReportAfter = 30 * time.Minute
+)
+
+// unlinkedInventory keeps track of the Nodes and Machines which are not linked, and since when.
+// It is only used by the scan loop, the zero value is ready to use.
+type unlinkedInventory struct {
+	nodes    map[string]*unlinkedEntry
+	machines map[types.NamespacedName]*unlinkedEntry
+}
+
+// unlinkedEntry is a Node or Machine not linked
+type unlinkedEntry struct {
+	since    time.Time
+	reported bool
+}
+
+// unlinkedSince returns since when an object found unlinked at the given time has been unlinked.
+// An object which was never linked has been unlinked since its creation.
+func unlinkedSince(obj client.Object, linkedBefore bool, now time.Time) time.Time {
+	created := obj.GetCreationTimestamp()
+	if linkedBefore || created.IsZero() {
+		return now
+	}
+	return created.Time
+}
+
+// runUnlinkedScans scans for unlinked Nodes and Machines every unlinkedScanInterval, until the context is done
+func (r *ReconcileNodeLink) runUnlinkedScans(ctx context.Context) error {
+	ticker := time.NewTicker(unlinkedScanInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.scanUnlinked(ctx, time.Now()); err != nil {
+			klog.Errorf("Failed to scan for unlinked nodes and machines: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanUnlinked updates the inventory of the Nodes not linked to any Machine and of the Machines not linked to
+// any Node, reports them as metrics, and emits an event for those unlinked for longer than unlinkedReportAfter
+func (r *ReconcileNodeLink) scanUnlinked(ctx context.Context, now time.Time) error {
+	nodes := &corev1.NodeList{}
+	if err := r.client.List(ctx, nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+	machines := &machinev1.MachineList{}
+	if err := r.client.List(ctx, machines); err != nil {
+		return fmt.Errorf("failed to list machines: %v", err)
+	}
+
+	unlinkedNodes := map[string]*unlinkedEntry{}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !node.DeletionTimestamp.IsZero() {
+			continue
+		}
+		machine, err := r.matchMachineFromNode(ctx, node)
+		var ambiguousErr *ambiguousMatchError
+		if err != nil && !errors.As(err, &ambiguousErr) {
+			return err
+		}
+		if machine != nil {
+			continue
+		}
+
+		entry, ok := r.unlinked.nodes[node.GetName()]
+		if !ok {
+			_, linkedBefore := node.GetAnnotations()[machineAnnotationKey]
+			entry = &unlinkedEntry{since: unlinkedSince(node, linkedBefore, now)}
+		}
+		unlinkedNodes[node.GetName()] = entry
+
+		if !entry.reported && now.Sub(entry.since) >= unlinkedReportAfter {
+			klog.Warningf("Node %q has not been linked to any machine since %s", node.GetName(), entry.since.Format(time.RFC3339))
+			r.recorder.Eventf(node, corev1.EventTypeWarning, EventNodeUnlinked, "Node %s has not been linked to any machine since %s", node.GetName(), entry.since.Format(time.RFC3339))
+			entry.reported = true
+		}
+		if r.markUnlinkedNodes {
+			if err := r.markNodeUnlinked(ctx, node, entry.since); err != nil {
+				klog.Errorf("Failed to mark node %q as unlinked: %v", node.GetName(), err)
+			}
+		}
+	}
+
+	unlinkedMachines := map[types.NamespacedName]*unlinkedEntry{}
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		if !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+		node, err := r.matchNodeFromMachine(ctx, machine)
+		var ambiguousErr *ambiguousMatchError
+		if err != nil && !errors.As(err, &ambiguousErr) {
+			return err
+		}
+		if node != nil {
+			continue
+		}
+
+		key := client.ObjectKeyFromObject(machine)
+		entry, ok := r.unlinked.machines[key]
+		if !ok {
+			entry = &unlinkedEntry{since: unlinkedSince(machine, machine.Status.NodeRef != nil, now)}
+		}
+		unlinkedMachines[key] = entry
+
+		if !entry.reported && now.Sub(entry.since) >= unlinkedReportAfter {
+			klog.Warningf("Machine %q has not been linked to any node since %s", machine.GetName(), entry.since.Format(time.RFC3339))
+			r.recorder.Eventf(machine, corev1.EventTypeWarning, EventMachineUnlinked, "Machine %s has not been linked to any node since %s", machine.GetName(), entry.since.Format(time.RFC3339))
+			entry.reported = true
+		}
+	}
+
+	r.unlinked.nodes = unlinkedNodes
+	r.unlinked.machines = unlinkedMachines
+
+	nodesSince := map[string]time.Time{}
+	for name, entry := range unlinkedNodes {
+		nodesSince[name] = entry.since
+	}
+	metrics.ObserveUnlinkedNodes(nodesSince)
+	machinesSince := map[types.NamespacedName]time.Time{}
+	for key, entry := range unlinkedMachines {
+		machinesSince[key] = entry.since
+	}
+	metrics.ObserveUnlinkedMachines(machinesSince)
+	return nil
+}
+
+// markNodeUnlinked sets the unlinked-since annotation on the node, unless already set
+func (r *ReconcileNodeLink) markNodeUnlinked(ctx context.Context, node *corev1.Node, since time.Time) error {
+	if _, ok := node.GetAnnotations()[unlinkedSinceAnnotationKey]; ok {
+		return nil
+	}
+
+	patchBase := client.MergeFrom(node.DeepCopy())
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[unlinkedSinceAnnotationKey] = since.UTC().Format(time.RFC3339)
+	return r.client.Patch(ctx, node, patchBase)
+}
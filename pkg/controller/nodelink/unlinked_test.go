@@ -0,0 +1,87 @@
+package nodelink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScanUnlinked(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now().Truncate(time.Second)
+	created := func(obj client.Object, ago time.Duration) {
+		obj.SetCreationTimestamp(metav1.NewTime(now.Add(-ago)))
+	}
+
+	linkedNode := node("linked", "aws:///i-linked", nil, nil)
+	linkedMachine := machine("linked", "aws:///i-linked", nil, nil, nil)
+	// joined without any machine two hours ago
+	orphanNode := node("orphan", "aws:///i-orphan", nil, nil)
+	created(orphanNode, 2*time.Hour)
+	// still provisioning
+	newMachine := machine("provisioning", "", nil, nil, nil)
+	created(newMachine, time.Minute)
+	// its node is gone
+	nodeLostMachine := machine("node-lost", "aws:///i-gone", nil, nil, &corev1.ObjectReference{Kind: "Node", Name: "gone"})
+	created(nodeLostMachine, 24*time.Hour)
+
+	nodes := []*corev1.Node{linkedNode, orphanNode}
+	machines := []*machinev1.Machine{linkedMachine, newMachine, nodeLostMachine}
+	r, recorder := newIndexedReconciler(DefaultMatchingStrategies, nodes, machines)
+	r.client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(linkedNode, orphanNode, linkedMachine, newMachine, nodeLostMachine).Build()
+	r.markUnlinkedNodes = true
+
+	g.Expect(r.scanUnlinked(context.Background(), now)).To(Succeed())
+
+	g.Expect(r.unlinked.nodes).To(HaveLen(1))
+	g.Expect(r.unlinked.nodes).To(HaveKeyWithValue("orphan", &unlinkedEntry{since: now.Add(-2 * time.Hour), reported: true}))
+	g.Expect(r.unlinked.machines).To(HaveLen(2))
+	g.Expect(r.unlinked.machines).To(HaveKeyWithValue(types.NamespacedName{Namespace: namespace, Name: "provisioning"}, &unlinkedEntry{since: now.Add(-time.Minute)}))
+	// a machine which was linked before has been unlinked since first found so
+	g.Expect(r.unlinked.machines).To(HaveKeyWithValue(types.NamespacedName{Namespace: namespace, Name: "node-lost"}, &unlinkedEntry{since: now}))
+
+	g.Expect(recorder.Events).To(Receive(Equal("Warning NodeUnlinked Node orphan has not been linked to any machine since " + now.Add(-2*time.Hour).Format(time.RFC3339))))
+	g.Expect(recorder.Events).ToNot(Receive())
+
+	g.Expect(gaugeValue(g, metrics.UnlinkedNodes)).To(Equal(1.0))
+	g.Expect(gaugeValue(g, metrics.UnlinkedMachines)).To(Equal(2.0))
+	g.Expect(gaugeValue(g, metrics.UnlinkedNodeSinceTimestampSeconds.WithLabelValues("orphan"))).To(Equal(float64(now.Add(-2 * time.Hour).Unix())))
+
+	annotated := &corev1.Node{}
+	g.Expect(r.client.Get(context.Background(), client.ObjectKeyFromObject(orphanNode), annotated)).To(Succeed())
+	g.Expect(annotated.Annotations).To(HaveKeyWithValue(unlinkedSinceAnnotationKey, now.Add(-2*time.Hour).UTC().Format(time.RFC3339)))
+
+	// Later on, events are emitted for the machines unlinked long enough, but not again for the node
+	later := now.Add(unlinkedReportAfter)
+	g.Expect(r.scanUnlinked(context.Background(), later)).To(Succeed())
+	g.Expect(r.unlinked.machines).To(HaveKeyWithValue(types.NamespacedName{Namespace: namespace, Name: "node-lost"}, &unlinkedEntry{since: now, reported: true}))
+
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	g.Expect(events).To(ConsistOf(
+		"Warning MachineUnlinked Machine node-lost has not been linked to any node since "+now.Format(time.RFC3339),
+		"Warning MachineUnlinked Machine provisioning has not been linked to any node since "+now.Add(-time.Minute).Format(time.RFC3339),
+	))
+}
+
+func gaugeValue(g Gomega, gauge prometheus.Gauge) float64 {
+	metric := &dto.Metric{}
+	g.Expect(gauge.Write(metric)).To(Succeed())
+	return metric.GetGauge().GetValue()
+}
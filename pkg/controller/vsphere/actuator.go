@@ -4,11 +4,13 @@ package vsphere
 // The lifetime of scope and reconciler is a machine actuator operation.
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
@@ -16,7 +18,7 @@ import (
 )
 
 const (
-	scopeFailFmt        = "%s: failed to create scope for machine: %v"
+	scopeFailFmt        = "%s: failed to create scope for machine: %w"
 	reconcilerFailFmt   = "%s: reconciler failed to %s machine: %w"
 	createEventAction   = "Create"
 	updateEventAction   = "Update"
@@ -33,6 +35,7 @@ type Actuator struct {
 	TaskIDCache                map[string]string
 	StaticIPFeatureGateEnabled bool
 	openshiftConfigNamespace   string
+	powerOffPolicy             PowerOffPolicy
 }
 
 // ActuatorParams holds parameter information for Actuator.
@@ -43,6 +46,8 @@ type ActuatorParams struct {
 	TaskIDCache                map[string]string
 	StaticIPFeatureGateEnabled bool
 	OpenshiftConfigNamespace   string
+	// PowerOffPolicy is what to do with the vm of a Running machine powered off out of band, Ignore when unset
+	PowerOffPolicy PowerOffPolicy
 }
 
 // NewActuator returns an actuator.
@@ -54,12 +59,18 @@ func NewActuator(params ActuatorParams) *Actuator {
 		TaskIDCache:                params.TaskIDCache,
 		StaticIPFeatureGateEnabled: params.StaticIPFeatureGateEnabled,
 		openshiftConfigNamespace:   params.OpenshiftConfigNamespace,
+		powerOffPolicy:             params.PowerOffPolicy,
 	}
 }
 
 // Set corresponding event based on error. It also returns the original error
 // for convenience, so callers can do "return handleMachineError(...)".
+// A throttled vCenter is not a failure, the machine is requeued until the vCenter can be reached again.
 func (a *Actuator) handleMachineError(machine *machinev1.Machine, err error, eventAction string) error {
+	if requeueErr := requeueIfThrottled(err); requeueErr != nil {
+		klog.Infof("%v: %v", machine.GetName(), err)
+		return requeueErr
+	}
 	klog.Errorf("%v error: %v", machine.GetName(), err)
 	if eventAction != noEventAction {
 		a.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "Failed"+eventAction, "%v", err)
@@ -76,8 +87,10 @@ func (a *Actuator) Create(ctx context.Context, machine *machinev1.Machine) error
 		client:                     a.client,
 		machine:                    machine,
 		apiReader:                  a.apiReader,
+		eventRecorder:              a.eventRecorder,
 		StaticIPFeatureGateEnabled: a.StaticIPFeatureGateEnabled,
 		openshiftConfigNameSpace:   a.openshiftConfigNamespace,
+		powerOffPolicy:             a.powerOffPolicy,
 	})
 	if err != nil {
 		fmtErr := fmt.Errorf(scopeFailFmt, machine.GetName(), err)
@@ -102,7 +115,8 @@ func (a *Actuator) Create(ctx context.Context, machine *machinev1.Machine) error
 	if err != nil {
 		fmtErr := fmt.Errorf(reconcilerFailFmt, machine.GetName(), createEventAction, err)
 		retErr = a.handleMachineError(machine, fmtErr, createEventAction)
-	} else {
+	} else if !isAdoptionDryRun(machine) {
+		// The dry run of an adoption creates nothing, it is reported by its own event
 		a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, createEventAction, "Created Machine %v", machine.GetName())
 	}
 
@@ -120,13 +134,22 @@ func (a *Actuator) Exists(ctx context.Context, machine *machinev1.Machine) (bool
 		client:                     a.client,
 		machine:                    machine,
 		apiReader:                  a.apiReader,
+		eventRecorder:              a.eventRecorder,
 		StaticIPFeatureGateEnabled: a.StaticIPFeatureGateEnabled,
 		openshiftConfigNameSpace:   a.openshiftConfigNamespace,
+		powerOffPolicy:             a.powerOffPolicy,
 	})
 	if err != nil {
+		if requeueErr := requeueIfThrottled(err); requeueErr != nil {
+			return false, requeueErr
+		}
 		return false, fmt.Errorf(scopeFailFmt, machine.GetName(), err)
 	}
-	return newReconciler(scope).exists()
+	exists, err := newReconciler(scope).exists()
+	if requeueErr := requeueIfThrottled(err); requeueErr != nil {
+		return false, requeueErr
+	}
+	return exists, err
 }
 
 func (a *Actuator) Update(ctx context.Context, machine *machinev1.Machine) error {
@@ -139,8 +162,10 @@ func (a *Actuator) Update(ctx context.Context, machine *machinev1.Machine) error
 		client:                     a.client,
 		machine:                    machine,
 		apiReader:                  a.apiReader,
+		eventRecorder:              a.eventRecorder,
 		StaticIPFeatureGateEnabled: a.StaticIPFeatureGateEnabled,
 		openshiftConfigNameSpace:   a.openshiftConfigNamespace,
+		powerOffPolicy:             a.powerOffPolicy,
 	})
 	if err != nil {
 		fmtErr := fmt.Errorf(scopeFailFmt, machine.GetName(), err)
@@ -181,8 +206,10 @@ func (a *Actuator) Delete(ctx context.Context, machine *machinev1.Machine) error
 		client:                     a.client,
 		machine:                    machine,
 		apiReader:                  a.apiReader,
+		eventRecorder:              a.eventRecorder,
 		StaticIPFeatureGateEnabled: a.StaticIPFeatureGateEnabled,
 		openshiftConfigNameSpace:   a.openshiftConfigNamespace,
+		powerOffPolicy:             a.powerOffPolicy,
 	})
 	if err != nil {
 		fmtErr := fmt.Errorf(scopeFailFmt, machine.GetName(), err)
@@ -198,3 +225,18 @@ func (a *Actuator) Delete(ctx context.Context, machine *machinev1.Machine) error
 	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, deleteEventAction, "Deleted machine %v", machine.GetName())
 	return scope.PatchMachine()
 }
+
+// requeueIfThrottled returns a RequeueAfterError when the error is caused by a throttled vCenter, nil otherwise.
+func requeueIfThrottled(err error) error {
+	var throttledErr *session.ThrottledError
+	if errors.As(err, &throttledErr) {
+		return &machinecontroller.RequeueAfterError{RequeueAfter: throttledErr.RetryAfter}
+	}
+	return nil
+}
+
+// isThrottled returns true when the error is caused by a throttled vCenter.
+func isThrottled(err error) bool {
+	var throttledErr *session.ThrottledError
+	return errors.As(err, &throttledErr)
+}
@@ -2,6 +2,7 @@ package vsphere
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"path/filepath"
@@ -11,12 +12,15 @@ import (
 	. "github.com/onsi/gomega"
 	configv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
 	"github.com/vmware/govmomi/simulator"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ipamv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
@@ -404,3 +408,24 @@ func TestMachineEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleThrottledMachineError(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := record.NewFakeRecorder(10)
+	a := NewActuator(ActuatorParams{EventRecorder: recorder})
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"}}
+
+	// A throttled vCenter requeues the machine without a failure event
+	throttledErr := fmt.Errorf(reconcilerFailFmt, machine.Name, createEventAction,
+		&session.ThrottledError{Server: "vcenter", Reason: session.ThrottledReasonCircuitBreaker, RetryAfter: time.Minute})
+	err := a.handleMachineError(machine, throttledErr, createEventAction)
+	var requeueErr *machinecontroller.RequeueAfterError
+	g.Expect(errors.As(err, &requeueErr)).To(BeTrue())
+	g.Expect(requeueErr.RequeueAfter).To(Equal(time.Minute))
+	g.Expect(recorder.Events).To(BeEmpty())
+
+	otherErr := errors.New("clone failed")
+	g.Expect(a.handleMachineError(machine, otherErr, createEventAction)).To(Equal(otherErr))
+	g.Expect(recorder.Events).To(HaveLen(1))
+}
@@ -0,0 +1,248 @@
+package vsphere
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+const (
+	// adoptedCondition reports the adoption of an existing vm by the machine
+	adoptedCondition = "Adopted"
+
+	adoptedReason                    = "Adopted"
+	adoptionDryRunReason             = "DryRun"
+	adoptionVerificationFailedReason = "VerificationFailed"
+
+	adoptedEventReason        = "Adopted"
+	adoptionDryRunEventReason = "AdoptionDryRun"
+)
+
+// isAdopted returns true when the machine adopted an existing vm, the vm is then found by the BIOS UUID of the
+// provider ID of the machine.
+func isAdopted(s *machineScope) bool {
+	condition := findCondition(s.providerStatus.Conditions, adoptedCondition)
+	return condition != nil && condition.Status == metav1.ConditionTrue && ptr.Deref(s.machine.Spec.ProviderID, "") != ""
+}
+
+// isAdoptionDryRun returns true when the machine adopts an existing vm in dry run.
+func isAdoptionDryRun(machine *machinev1.Machine) bool {
+	if _, ok := machine.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; !ok {
+		return false
+	}
+	dryRun, err := vsphereutil.AdoptVMDryRun(machine)
+	return err == nil && dryRun
+}
+
+// findAdoptedVM finds the vm adopted by the machine by the BIOS UUID of its provider ID.
+func findAdoptedVM(s *machineScope) (types.ManagedObjectReference, error) {
+	biosUUID := strings.TrimPrefix(*s.machine.Spec.ProviderID, providerIDPrefix)
+	ref, err := s.GetSession().FindRefByBIOSUUID(s.Context, biosUUID)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if ref == nil {
+		return types.ManagedObjectReference{}, errNotFound{uuid: biosUUID}
+	}
+	return ref.Reference(), nil
+}
+
+// adopt adopts the existing vm referenced by the adopt vm annotation instead of cloning a vm. The vm is verified,
+// tagged, and the machine is reconciled with it. In dry run, what the adoption would change is only reported.
+func (r *Reconciler) adopt(adoptedVM *vsphereutil.AdoptedVM) error {
+	dryRun, err := vsphereutil.AdoptVMDryRun(r.machine)
+	if err != nil {
+		return machinecontroller.InvalidMachineConfiguration("%v: %v", r.machine.GetName(), err)
+	}
+
+	vm, err := r.findVMToAdopt(adoptedVM)
+	if err != nil {
+		return fmt.Errorf("%v: unable to find vm %s to adopt: %w", r.machine.GetName(), adoptedVM, err)
+	}
+
+	changes, err := r.verifyVMToAdopt(vm)
+	if err != nil {
+		r.setAdoptedCondition(metav1.ConditionFalse, adoptionVerificationFailedReason, err.Error())
+		return fmt.Errorf("%v: unable to adopt vm %s: %w", r.machine.GetName(), adoptedVM, err)
+	}
+
+	if dryRun {
+		message := fmt.Sprintf("Adopting vm %s would %s", adoptedVM, strings.Join(changes, ", "))
+		klog.Infof("%v: %s", r.machine.GetName(), message)
+		// The event is recorded once for the same changes, the dry run is reconciled until the annotation is removed
+		if condition := findCondition(r.providerStatus.Conditions, adoptedCondition); condition == nil ||
+			condition.Reason != adoptionDryRunReason || condition.Message != message {
+			r.recordEvent(corev1.EventTypeNormal, adoptionDryRunEventReason, "%s", message)
+		}
+		r.setAdoptedCondition(metav1.ConditionFalse, adoptionDryRunReason, message)
+		return nil
+	}
+
+	klog.Infof("%v: adopting vm %s", r.machine.GetName(), adoptedVM)
+	if err := vm.reconcileTags(r.Context, r.session, r.machine, r.providerSpec); err != nil {
+		return fmt.Errorf("%v: failed to reconcile tags of vm %s: %w", r.machine.GetName(), adoptedVM, err)
+	}
+
+	// The vm is found by the provider ID of the machine once the condition is set, the machine stays in the
+	// adoption until the provider ID is set
+	r.setAdoptedCondition(metav1.ConditionTrue, adoptedReason, fmt.Sprintf("Adopted vm %s", adoptedVM))
+	if err := r.reconcileMachineWithCloudState(vm, ""); err != nil {
+		return fmt.Errorf("%v: failed to reconcile machine with adopted vm %s: %w", r.machine.GetName(), adoptedVM, err)
+	}
+	r.recordEvent(corev1.EventTypeNormal, adoptedEventReason, "Adopted vm %s", adoptedVM)
+	return nil
+}
+
+// findVMToAdopt finds the vm referenced by the adopt vm annotation, by its instance or BIOS UUID, or by its
+// inventory path.
+func (r *Reconciler) findVMToAdopt(adoptedVM *vsphereutil.AdoptedVM) (*virtualMachine, error) {
+	var ref object.Reference
+	if adoptedVM.InventoryPath != "" {
+		obj, err := r.session.Finder.VirtualMachine(r.Context, adoptedVM.InventoryPath)
+		if err != nil {
+			return nil, err
+		}
+		ref = obj
+	} else {
+		var err error
+		ref, err = r.session.FindRefByInstanceUUID(r.Context, adoptedVM.UUID)
+		if err == nil && ref == nil {
+			ref, err = r.session.FindRefByBIOSUUID(r.Context, adoptedVM.UUID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ref == nil {
+			return nil, errNotFound{uuid: adoptedVM.UUID}
+		}
+	}
+
+	return &virtualMachine{
+		Context: r.Context,
+		Obj:     object.NewVirtualMachine(r.session.Client.Client, ref.Reference()),
+		Ref:     ref.Reference(),
+	}, nil
+}
+
+// verifyVMToAdopt verifies the vm can be adopted by the machine, and returns what the adoption changes.
+func (r *Reconciler) verifyVMToAdopt(vm *virtualMachine) ([]string, error) {
+	// The addresses of the vm are not claimed from the pools
+	for _, device := range r.providerSpec.Network.Devices {
+		if len(device.AddressesFromPools) > 0 {
+			return nil, errors.New("a vm can not be adopted by a machine with IP address pools")
+		}
+	}
+
+	var o mo.VirtualMachine
+	if err := vm.Obj.Properties(r.Context, vm.Ref, []string{"name", "config", "runtime.powerState"}, &o); err != nil {
+		return nil, fmt.Errorf("unable to get properties of vm: %w", err)
+	}
+	if o.Config == nil {
+		return nil, errors.New("vm has no configuration")
+	}
+	if o.Config.Template {
+		return nil, fmt.Errorf("vm %s is a template", o.Name)
+	}
+	if o.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		return nil, fmt.Errorf("vm %s is %s, it must be powered on to be adopted", o.Name, o.Runtime.PowerState)
+	}
+
+	providerID, err := convertUUIDToProviderID(o.Config.Uuid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BIOS UUID of vm %s: %w", o.Name, err)
+	}
+
+	// The vms of machines are found by instance UUID, by name, or by provider ID for the adopted ones
+	machines := &machinev1.MachineList{}
+	if err := r.client.List(r.Context, machines, runtimeclient.InNamespace(r.machine.Namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list machines: %w", err)
+	}
+	for _, machine := range machines.Items {
+		if machine.UID == r.machine.UID {
+			continue
+		}
+		if string(machine.UID) == o.Config.InstanceUuid || machine.Name == o.Name || ptr.Deref(machine.Spec.ProviderID, "") == providerID {
+			return nil, fmt.Errorf("vm %s belongs to machine %s", o.Name, machine.Name)
+		}
+	}
+
+	networkStatusList, err := vm.getNetworkStatusList(r.session.Client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("error getting network status: %w", err)
+	}
+	if len(networkStatusList) != len(r.providerSpec.Network.Devices) {
+		return nil, fmt.Errorf("vm %s has %d network devices, the provider spec has %d",
+			o.Name, len(networkStatusList), len(r.providerSpec.Network.Devices))
+	}
+
+	var changes []string
+	tags, err := r.missingTags(vm)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		changes = append(changes, fmt.Sprintf("attach tags %v", tags))
+	}
+
+	changes = append(changes, fmt.Sprintf("set provider ID %s", providerID))
+
+	addresses := []string{}
+	for _, networkStatus := range networkStatusList {
+		addresses = append(addresses, networkStatus.IPAddrs...)
+	}
+	changes = append(changes, fmt.Sprintf("set addresses %v and DNS name %s", addresses, o.Name))
+
+	// The resize is reconciled once the vm is adopted
+	if r.providerSpec.NumCPUs != 0 && r.providerSpec.NumCPUs != o.Config.Hardware.NumCPU {
+		changes = append(changes, fmt.Sprintf("resize vm from %d to %d CPUs", o.Config.Hardware.NumCPU, r.providerSpec.NumCPUs))
+	}
+	if r.providerSpec.MemoryMiB != 0 && r.providerSpec.MemoryMiB != int64(o.Config.Hardware.MemoryMB) {
+		changes = append(changes, fmt.Sprintf("resize vm from %dMiB to %dMiB of memory", o.Config.Hardware.MemoryMB, r.providerSpec.MemoryMiB))
+	}
+	return changes, nil
+}
+
+// missingTags returns the tags of the machine which are not attached to the vm.
+func (r *Reconciler) missingTags(vm *virtualMachine) ([]string, error) {
+	var missing []string
+	err := r.session.WithCachingTagsManager(r.Context, func(c *session.CachingTagsManager) error {
+		tagIDs := append([]string{r.machine.Labels[machinev1.MachineClusterIDLabel]}, r.providerSpec.TagIDs...)
+		for _, tagID := range tagIDs {
+			attached, err := vm.checkAttachedTag(r.Context, tagID, c)
+			if err != nil {
+				return err
+			}
+			if !attached {
+				missing = append(missing, tagID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to check tags of vm: %w", err)
+	}
+	return missing, nil
+}
+
+func (r *Reconciler) setAdoptedCondition(status metav1.ConditionStatus, reason, message string) {
+	r.providerStatus.Conditions = setConditions(metav1.Condition{
+		Type:    adoptedCondition,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}, r.providerStatus.Conditions)
+}
@@ -0,0 +1,303 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestAdopt(t *testing.T) {
+	const infraID = "infra-id"
+
+	testCases := []struct {
+		name              string
+		byInventoryPath   bool
+		dryRun            bool
+		poweredOff        bool
+		otherMachine      func(vm *simulator.VirtualMachine) *machinev1.Machine
+		expectedError     string
+		expectedCondition *metav1.Condition
+		expectedAdopted   bool
+		expectedEvents    int
+	}{
+		{
+			name:   "Dry run",
+			dryRun: true,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: adoptionDryRunReason,
+			},
+			expectedEvents: 1,
+		},
+		{
+			name: "Adopt by UUID",
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: adoptedReason,
+			},
+			expectedAdopted: true,
+			expectedEvents:  1,
+		},
+		{
+			name:            "Adopt by inventory path",
+			byInventoryPath: true,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: adoptedReason,
+			},
+			expectedAdopted: true,
+			expectedEvents:  1,
+		},
+		{
+			name:          "Powered off vm",
+			poweredOff:    true,
+			expectedError: "it must be powered on to be adopted",
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: adoptionVerificationFailedReason,
+			},
+		},
+		{
+			name: "Vm of another machine",
+			otherMachine: func(vm *simulator.VirtualMachine) *machinev1.Machine {
+				return &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{
+					Name:      "other",
+					Namespace: "test",
+					UID:       apimachinerytypes.UID(vm.Config.InstanceUuid),
+				}}
+			},
+			expectedError: "belongs to machine other",
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: adoptionVerificationFailedReason,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, false, tc.poweredOff)
+			simVM := simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine)
+
+			_, err := createTagAndCategory(session, tagToCategoryName(infraID), infraID)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			reference := simVM.Config.Uuid
+			if tc.byInventoryPath {
+				obj, err := session.Finder.VirtualMachine(context.TODO(), simVM.Name)
+				g.Expect(err).ToNot(HaveOccurred())
+				reference = obj.InventoryPath
+			}
+			annotations := map[string]string{vsphereutil.AdoptVMAnnotation: reference}
+			if tc.dryRun {
+				annotations[vsphereutil.AdoptVMDryRunAnnotation] = "true"
+			}
+
+			machine := &machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "machine",
+					Namespace:   "test",
+					UID:         "a8d8b5b1-d6c4-4a84-8a1b-c1a2d7c9e0f3",
+					Labels:      map[string]string{machinev1.MachineClusterIDLabel: infraID},
+					Annotations: annotations,
+				},
+				Status: machinev1.MachineStatus{Phase: ptr.To(machinev1.PhaseProvisioning)},
+			}
+			objects := []runtimeclient.Object{machine}
+			if tc.otherMachine != nil {
+				objects = append(objects, tc.otherMachine(simVM))
+			}
+			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := newReconciler(&machineScope{
+				Context:       context.TODO(),
+				session:       session,
+				client:        client,
+				apiReader:     client,
+				eventRecorder: recorder,
+				machine:       machine,
+				providerSpec: &machinev1.VSphereMachineProviderSpec{
+					Network: machinev1.NetworkSpec{Devices: []machinev1.NetworkDeviceSpec{{NetworkName: "VM Network"}}},
+				},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{},
+			})
+
+			err = r.create()
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			condition := findCondition(r.providerStatus.Conditions, adoptedCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+			g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+			g.Expect(recorder.Events).To(HaveLen(tc.expectedEvents))
+
+			missingTags, err := r.missingTags(vm)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			ref, err := findVM(r.machineScope)
+			if !tc.expectedAdopted {
+				// The vm does not belong to the machine, nothing is changed
+				g.Expect(r.machine.Spec.ProviderID).To(BeNil())
+				g.Expect(r.machine.Status.Addresses).To(BeEmpty())
+				g.Expect(missingTags).To(ConsistOf(infraID))
+				g.Expect(isNotFound(err)).To(BeTrue())
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ref).To(Equal(vm.Ref))
+			g.Expect(r.machine.Spec.ProviderID).To(Equal(ptr.To(providerIDPrefix + simVM.Config.Uuid)))
+			g.Expect(r.machine.Status.Addresses).ToNot(BeEmpty())
+			g.Expect(r.machine.Annotations).To(HaveKeyWithValue("machine.openshift.io/instance-state", string(types.VirtualMachinePowerStatePoweredOn)))
+			g.Expect(ptr.Deref(r.providerStatus.InstanceID, "")).To(Equal(simVM.Config.Uuid))
+			g.Expect(missingTags).To(BeEmpty())
+		})
+	}
+
+	t.Run("Dry run reported once", func(t *testing.T) {
+		g := NewWithT(t)
+
+		model, session, server := initSimulator(t)
+		defer model.Remove()
+		defer server.Close()
+
+		vm := getResizeTestVM(t, session.Client.Client, false, false)
+		simVM := simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine)
+
+		machine := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "machine",
+				Namespace: "test",
+				Labels:    map[string]string{machinev1.MachineClusterIDLabel: infraID},
+				Annotations: map[string]string{
+					vsphereutil.AdoptVMAnnotation:       simVM.Config.Uuid,
+					vsphereutil.AdoptVMDryRunAnnotation: "true",
+				},
+			},
+		}
+		client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(machine).Build()
+		recorder := record.NewFakeRecorder(10)
+		r := newReconciler(&machineScope{
+			Context:       context.TODO(),
+			session:       session,
+			client:        client,
+			apiReader:     client,
+			eventRecorder: recorder,
+			machine:       machine,
+			providerSpec: &machinev1.VSphereMachineProviderSpec{
+				NumCPUs: 4,
+				Network: machinev1.NetworkSpec{Devices: []machinev1.NetworkDeviceSpec{{NetworkName: "VM Network"}}},
+			},
+			providerStatus: &machinev1.VSphereMachineProviderStatus{},
+		})
+
+		for i := 0; i < 3; i++ {
+			g.Expect(r.create()).To(Succeed())
+		}
+		g.Expect(recorder.Events).To(HaveLen(1))
+		g.Expect(findCondition(r.providerStatus.Conditions, adoptedCondition).Message).To(And(
+			ContainSubstring("set provider ID "+providerIDPrefix+simVM.Config.Uuid),
+			ContainSubstring("resize vm from 2 to 4 CPUs"),
+		))
+	})
+}
+
+func TestFindVMToAdoptNotFound(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	r := newReconciler(&machineScope{
+		Context: context.TODO(),
+		session: session,
+		machine: &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine"}},
+	})
+
+	_, err := r.findVMToAdopt(&vsphereutil.AdoptedVM{UUID: "4217b9a5-0f2d-4d8e-a5f4-0d3c5e1f8a31"})
+	g.Expect(isNotFound(err)).To(BeTrue())
+
+	_, err = r.findVMToAdopt(&vsphereutil.AdoptedVM{InventoryPath: "/DC0/vm/missing"})
+	g.Expect(isNotFound(err)).To(BeTrue())
+}
+
+func TestFindVMWithAdoptVMAnnotation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		providerID    *string
+		taskRef       string
+		expectedFound bool
+	}{
+		{
+			name: "Not yet adopted",
+		},
+		{
+			name:          "With a task",
+			taskRef:       "task-1",
+			expectedFound: true,
+		},
+		{
+			name:          "With a provider ID",
+			providerID:    ptr.To(providerIDPrefix + "4217b9a5-0f2d-4d8e-a5f4-0d3c5e1f8a31"),
+			expectedFound: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, false, false)
+			simVM := simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine)
+
+			s := &machineScope{
+				Context: context.TODO(),
+				session: session,
+				machine: &machinev1.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        simVM.Name,
+						Annotations: map[string]string{vsphereutil.AdoptVMAnnotation: "/DC0/vm/other"},
+					},
+					Spec: machinev1.MachineSpec{ProviderID: tc.providerID},
+				},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{TaskRef: tc.taskRef},
+			}
+
+			ref, err := findVM(s)
+			if tc.expectedFound {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ref).To(Equal(vm.Ref))
+			} else {
+				g.Expect(isNotFound(err)).To(BeTrue())
+			}
+		})
+	}
+}
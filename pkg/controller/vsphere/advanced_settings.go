@@ -0,0 +1,48 @@
+package vsphere
+
+import (
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/ptr"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+// getExtraConfigOptionValues returns the advanced settings of the machine as option values of the clone, sorted by
+// key. The keys are validated, they can not override the settings of the machine controller.
+func getExtraConfigOptionValues(extraConfig vsphereutil.ExtraConfig) []types.BaseOptionValue {
+	optionValues := []types.BaseOptionValue{}
+	for _, key := range extraConfig.Keys() {
+		optionValues = append(optionValues, &types.OptionValue{
+			Key:   key,
+			Value: extraConfig[key],
+		})
+	}
+	return optionValues
+}
+
+// configureResourceAllocation sets the CPU and memory reservations and shares of the machine in the configuration of
+// the clone. The allocations of the template are kept for the unset values.
+func configureResourceAllocation(config *types.VirtualMachineConfigSpec, allocation *vsphereutil.ResourceAllocation) {
+	if allocation.CPU != nil {
+		config.CpuAllocation = &types.ResourceAllocationInfo{
+			Reservation: allocation.CPU.ReservationMHz,
+			Shares:      getSharesInfo(allocation.CPU.ResourceShares),
+		}
+	}
+	if allocation.Memory != nil {
+		config.MemoryAllocation = &types.ResourceAllocationInfo{
+			Reservation: allocation.Memory.ReservationMiB,
+			Shares:      getSharesInfo(allocation.Memory.ResourceShares),
+		}
+	}
+}
+
+func getSharesInfo(shares vsphereutil.ResourceShares) *types.SharesInfo {
+	if shares.SharesLevel == "" {
+		return nil
+	}
+	return &types.SharesInfo{
+		Level:  types.SharesLevel(shares.SharesLevel),
+		Shares: ptr.Deref(shares.Shares, 0),
+	}
+}
@@ -0,0 +1,75 @@
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/ptr"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestGetExtraConfigOptionValues(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(getExtraConfigOptionValues(nil)).To(BeEmpty())
+	g.Expect(getExtraConfigOptionValues(vsphereutil.ExtraConfig{
+		"sched.cpu.latencySensitivity": "high",
+		"disk.EnableUUID":              "TRUE",
+	})).To(Equal([]types.BaseOptionValue{
+		&types.OptionValue{Key: "disk.EnableUUID", Value: "TRUE"},
+		&types.OptionValue{Key: "sched.cpu.latencySensitivity", Value: "high"},
+	}))
+}
+
+func TestConfigureResourceAllocation(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		allocation               *vsphereutil.ResourceAllocation
+		expectedCPUAllocation    *types.ResourceAllocationInfo
+		expectedMemoryAllocation *types.ResourceAllocationInfo
+	}{
+		{
+			name:       "Allocation of the template",
+			allocation: &vsphereutil.ResourceAllocation{},
+		},
+		{
+			name: "CPU reservation",
+			allocation: &vsphereutil.ResourceAllocation{
+				CPU: &vsphereutil.CPUAllocation{ReservationMHz: ptr.To[int64](4000)},
+			},
+			expectedCPUAllocation: &types.ResourceAllocationInfo{Reservation: ptr.To[int64](4000)},
+		},
+		{
+			name: "Memory reservation and shares",
+			allocation: &vsphereutil.ResourceAllocation{
+				CPU: &vsphereutil.CPUAllocation{
+					ResourceShares: vsphereutil.ResourceShares{SharesLevel: vsphereutil.SharesLevelHigh},
+				},
+				Memory: &vsphereutil.MemoryAllocation{
+					ReservationMiB: ptr.To[int64](16384),
+					ResourceShares: vsphereutil.ResourceShares{SharesLevel: vsphereutil.SharesLevelCustom, Shares: ptr.To[int32](163840)},
+				},
+			},
+			expectedCPUAllocation: &types.ResourceAllocationInfo{
+				Shares: &types.SharesInfo{Level: types.SharesLevelHigh},
+			},
+			expectedMemoryAllocation: &types.ResourceAllocationInfo{
+				Reservation: ptr.To[int64](16384),
+				Shares:      &types.SharesInfo{Level: types.SharesLevelCustom, Shares: 163840},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			config := &types.VirtualMachineConfigSpec{}
+			configureResourceAllocation(config, tc.allocation)
+			g.Expect(config.CpuAllocation).To(Equal(tc.expectedCPUAllocation))
+			g.Expect(config.MemoryAllocation).To(Equal(tc.expectedMemoryAllocation))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+// reconfigureVmTaskDescriptionId is the description ID of the task configuring a vm deployed from a content library
+const reconfigureVmTaskDescriptionId = "VirtualMachine.reconfigure"
+
+// deployContentLibraryItem deploys the content library item as the powered off vm of the machine, unless
+// a previous reconcile already did. The vAPI deploy calls are synchronous and can not set the instance uuid
+// of the vm, which is set, along with the rest of the configuration of a clone, by a reconfigure task afterwards.
+// The deployed vm is recorded in the provider status before it is configured, so a reconcile which lost the
+// reconfigure task configures it again instead of powering it on.
+func deployContentLibraryItem(s *machineScope, source *vsphereutil.ContentLibraryItem, folder *object.Folder, pool *object.ResourcePool, datastore types.ManagedObjectReference, storageProfileID string) (*object.VirtualMachine, error) {
+	if s.deployedVM != "" {
+		klog.V(3).Infof("%v: content library item %q already deployed as vm %s", s.machine.GetName(), source, s.deployedVM)
+		return object.NewVirtualMachine(s.session.Client.Client, deployedVMRef(s)), nil
+	}
+	vmRef, err := findVM(s)
+	if err == nil {
+		klog.V(3).Infof("%v: content library item %q already deployed", s.machine.GetName(), source)
+		return object.NewVirtualMachine(s.session.Client.Client, vmRef), nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+
+	var deployed *types.ManagedObjectReference
+	err = s.GetSession().WithRestClient(s, func(c *rest.Client) error {
+		item, err := findContentLibraryItem(s, library.NewManager(c), source)
+		if err != nil {
+			return err
+		}
+
+		klog.Infof("%v: deploying %s content library item %q", s.machine.GetName(), item.Type, source)
+		switch item.Type {
+		case library.ItemTypeVMTX:
+			storage := &vcenter.DiskStorage{Datastore: datastore.Value}
+			if storageProfileID != "" {
+				storage.StoragePolicy = &vcenter.StoragePolicy{Policy: storageProfileID, Type: "USE_SPECIFIED_POLICY"}
+			}
+			deployed, err = vcenter.NewManager(c).DeployTemplateLibraryItem(s, item.ID, vcenter.DeployTemplate{
+				Name: s.machine.GetName(),
+				Placement: &vcenter.Placement{
+					Folder:       folder.Reference().Value,
+					ResourcePool: pool.Reference().Value,
+				},
+				VMHomeStorage: storage,
+				DiskStorage:   storage,
+				PoweredOn:     false,
+			})
+		case library.ItemTypeOVF:
+			deployed, err = vcenter.NewManager(c).DeployLibraryItem(s, item.ID, vcenter.Deploy{
+				DeploymentSpec: vcenter.DeploymentSpec{
+					Name:               s.machine.GetName(),
+					AcceptAllEULA:      true,
+					DefaultDatastoreID: datastore.Value,
+					StorageProfileID:   storageProfileID,
+				},
+				Target: vcenter.Target{
+					FolderID:       folder.Reference().Value,
+					ResourcePoolID: pool.Reference().Value,
+				},
+			})
+		default:
+			return machinecontroller.InvalidMachineConfiguration(
+				"content library item %q is of type %q, only %q and %q items can be deployed", source, item.Type, library.ItemTypeOVF, library.ItemTypeVMTX)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to deploy content library item %q: %w", source, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.deployedVM = deployed.Value
+	if err := s.PatchMachine(); err != nil {
+		return nil, fmt.Errorf("%v: failed to record deployed vm %s: %w", s.machine.GetName(), deployed.Value, err)
+	}
+	return object.NewVirtualMachine(s.session.Client.Client, *deployed), nil
+}
+
+// deployedVMRef returns the reference of the vm deployed from the content library item
+func deployedVMRef(s *machineScope) types.ManagedObjectReference {
+	return types.ManagedObjectReference{Type: "VirtualMachine", Value: s.deployedVM}
+}
+
+// isDeployedVMConfigured returns true when the creation task configured the vm deployed from the content library
+// item, the instance uuid of the machine being set by that task only.
+func isDeployedVMConfigured(s *machineScope) (bool, error) {
+	vm := object.NewVirtualMachine(s.session.Client.Client, deployedVMRef(s))
+	var o mo.VirtualMachine
+	if err := vm.Properties(s, vm.Reference(), []string{"config.instanceUuid"}, &o); err != nil {
+		return false, fmt.Errorf("unable to get the instance uuid of deployed vm %s: %w", s.deployedVM, err)
+	}
+	return o.Config != nil && o.Config.InstanceUuid == string(s.machine.UID), nil
+}
+
+// findContentLibraryItem returns the item of the content library, both being looked up by name
+func findContentLibraryItem(s *machineScope, m *library.Manager, source *vsphereutil.ContentLibraryItem) (*library.Item, error) {
+	lib, err := m.GetLibraryByName(s, source.Library)
+	if isThrottled(err) {
+		return nil, fmt.Errorf("unable to get content library %q: %w", source.Library, err)
+	}
+	if err != nil {
+		return nil, machinecontroller.InvalidMachineConfiguration("content library %q not found: %v", source.Library, err)
+	}
+	ids, err := m.FindLibraryItems(s, library.FindItem{LibraryID: lib.ID, Name: source.Item})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find content library item %q: %w", source, err)
+	}
+	switch len(ids) {
+	case 0:
+		return nil, machinecontroller.InvalidMachineConfiguration("content library item %q not found", source)
+	case 1:
+	default:
+		return nil, machinecontroller.InvalidMachineConfiguration("multiple content library items %q found", source)
+	}
+	item, err := m.GetLibraryItem(s, ids[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to get content library item %q: %w", source, err)
+	}
+	return item, nil
+}
+
+// isCreationTask returns true when the task creates the vm of the machine: the clone of its template,
+// or the configuration of the vm deployed from its content library item.
+func isCreationTask(s *machineScope, descriptionID string) bool {
+	if descriptionID == cloneVmTaskDescriptionId {
+		return true
+	}
+	_, fromContentLibrary := s.machine.GetAnnotations()[vsphereutil.ContentLibraryItemAnnotation]
+	return fromContentLibrary && descriptionID == reconfigureVmTaskDescriptionId
+}
@@ -0,0 +1,128 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+)
+
+const (
+	credentialsUsernameSuffix = ".username"
+	credentialsPasswordSuffix = ".password"
+
+	// failedLoginEventReason is recorded on a machine when vCenter rejects the rotated credentials
+	failedLoginEventReason = "FailedLogin"
+)
+
+// CredentialsWatcher watches the credentials secrets, and invalidates the vCenter sessions logged in with the
+// credentials they no longer hold, so that rotated credentials are used without restarting the controller.
+type CredentialsWatcher struct {
+	informers cache.Informers
+}
+
+// NewCredentialsWatcher returns a credentials watcher, to be added to a manager.
+func NewCredentialsWatcher(informers cache.Informers) *CredentialsWatcher {
+	return &CredentialsWatcher{informers: informers}
+}
+
+// Start registers the handlers of the secret events, and waits until the context is done.
+func (w *CredentialsWatcher) Start(ctx context.Context) error {
+	informer, err := w.informers.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		return fmt.Errorf("unable to get secrets informer: %w", err)
+	}
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok := oldObj.(*corev1.Secret)
+			if !ok {
+				return
+			}
+			newSecret, ok := newObj.(*corev1.Secret)
+			if !ok {
+				return
+			}
+			invalidateCredentials(ctx, oldSecret, newSecret)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if secret, ok := obj.(*corev1.Secret); ok {
+				invalidateCredentials(ctx, secret, nil)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("unable to watch secrets: %w", err)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection makes every replica watch the secrets, each of them caches its own sessions.
+func (w *CredentialsWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// vCenterCredentials are the credentials of a vCenter held by a credentials secret
+type vCenterCredentials struct {
+	server   string
+	username string
+	password string
+}
+
+// invalidateCredentials evicts the sessions of the credentials superseded by an update of a secret
+func invalidateCredentials(ctx context.Context, oldSecret, newSecret *corev1.Secret) {
+	for _, credentials := range supersededCredentials(oldSecret, newSecret) {
+		if evicted := session.InvalidateCredentials(ctx, credentials.server, credentials.username, credentials.password); evicted > 0 {
+			klog.Infof("Credentials of vCenter %s rotated in secret %s/%s, evicted %d sessions",
+				credentials.server, oldSecret.Namespace, oldSecret.Name, evicted)
+		}
+	}
+}
+
+// supersededCredentials returns the vCenter credentials of the old secret which the new one does not hold anymore.
+// The new secret is nil when the secret was deleted.
+func supersededCredentials(oldSecret, newSecret *corev1.Secret) []vCenterCredentials {
+	oldCredentials := getVCenterCredentials(oldSecret)
+	if len(oldCredentials) == 0 {
+		return nil
+	}
+	newCredentials := map[string]vCenterCredentials{}
+	if newSecret != nil {
+		newCredentials = getVCenterCredentials(newSecret)
+	}
+
+	var superseded []vCenterCredentials
+	for server, credentials := range oldCredentials {
+		if newCredentials[server] != credentials {
+			superseded = append(superseded, credentials)
+		}
+	}
+	return superseded
+}
+
+// getVCenterCredentials returns the credentials of a secret by vCenter, whose keys are <server>.username and
+// <server>.password as read by getCredentialsSecret
+func getVCenterCredentials(secret *corev1.Secret) map[string]vCenterCredentials {
+	credentials := map[string]vCenterCredentials{}
+	for key, username := range secret.Data {
+		server, ok := strings.CutSuffix(key, credentialsUsernameSuffix)
+		if !ok || server == "" {
+			continue
+		}
+		credentials[server] = vCenterCredentials{
+			server:   server,
+			username: string(username),
+			password: string(secret.Data[server+credentialsPasswordSuffix]),
+		}
+	}
+	return credentials
+}
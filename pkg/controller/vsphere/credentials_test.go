@@ -0,0 +1,93 @@
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSupersededCredentials(t *testing.T) {
+	newSecret := func(data map[string]string) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsphere-cloud-credentials", Namespace: "openshift-machine-api"},
+			Data:       map[string][]byte{},
+		}
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		return secret
+	}
+
+	oldSecret := newSecret(map[string]string{
+		"vcenter-a.example.com.username": "admin",
+		"vcenter-a.example.com.password": "secret",
+		"vcenter-b.example.com.username": "machine-api",
+		"vcenter-b.example.com.password": "secret",
+	})
+
+	testCases := []struct {
+		name      string
+		oldSecret *corev1.Secret
+		newSecret *corev1.Secret
+		expected  []vCenterCredentials
+	}{
+		{
+			name:      "Unchanged credentials",
+			oldSecret: oldSecret,
+			newSecret: oldSecret.DeepCopy(),
+		},
+		{
+			name:      "Secret without credentials",
+			oldSecret: newSecret(map[string]string{"foo": "bar"}),
+			newSecret: newSecret(map[string]string{"foo": "baz"}),
+		},
+		{
+			name:      "Rotated password",
+			oldSecret: oldSecret,
+			newSecret: newSecret(map[string]string{
+				"vcenter-a.example.com.username": "admin",
+				"vcenter-a.example.com.password": "rotated",
+				"vcenter-b.example.com.username": "machine-api",
+				"vcenter-b.example.com.password": "secret",
+			}),
+			expected: []vCenterCredentials{{server: "vcenter-a.example.com", username: "admin", password: "secret"}},
+		},
+		{
+			name:      "Rotated username",
+			oldSecret: oldSecret,
+			newSecret: newSecret(map[string]string{
+				"vcenter-a.example.com.username": "admin",
+				"vcenter-a.example.com.password": "secret",
+				"vcenter-b.example.com.username": "machine-api-2",
+				"vcenter-b.example.com.password": "secret",
+			}),
+			expected: []vCenterCredentials{{server: "vcenter-b.example.com", username: "machine-api", password: "secret"}},
+		},
+		{
+			name:      "Removed vCenter",
+			oldSecret: oldSecret,
+			newSecret: newSecret(map[string]string{
+				"vcenter-a.example.com.username": "admin",
+				"vcenter-a.example.com.password": "secret",
+			}),
+			expected: []vCenterCredentials{{server: "vcenter-b.example.com", username: "machine-api", password: "secret"}},
+		},
+		{
+			name:      "Deleted secret",
+			oldSecret: oldSecret,
+			expected: []vCenterCredentials{
+				{server: "vcenter-a.example.com", username: "admin", password: "secret"},
+				{server: "vcenter-b.example.com", username: "machine-api", password: "secret"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(supersededCredentials(tc.oldSecret, tc.newSecret)).To(ConsistOf(tc.expected))
+		})
+	}
+}
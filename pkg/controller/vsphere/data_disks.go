@@ -0,0 +1,85 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/vim25/types"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+// dataDiskRecord is a data disk created along with the vm of a machine. It is identified by its controller and unit
+// number when the vm is cloned, and by its backing file once the clone finished, so that only the disks created by the
+// controller are destroyed along with the vm, whatever their file names.
+type dataDiskRecord struct {
+	// Name is the name of the disk in the data disks annotation
+	Name string `json:"name"`
+	// ControllerType and BusNumber identify the controller the disk is attached to
+	ControllerType vsphereutil.DiskControllerType `json:"controllerType"`
+	BusNumber      int32                          `json:"busNumber"`
+	// UnitNumber is the unit number of the disk on its controller
+	UnitNumber int32 `json:"unitNumber"`
+	// FileName is the backing file of the disk, e.g. "[datastore] machine-name/machine-name_1.vmdk", once the vm is
+	// cloned
+	FileName string `json:"fileName,omitempty"`
+}
+
+// recordDataDiskFiles records the backing files of the data disks created along with the vm. It is called once the
+// vm is cloned, before it is powered on and the cluster storage can attach disks to it.
+func (vm *virtualMachine) recordDataDiskFiles(dataDisks []dataDiskRecord) error {
+	var devices []types.BaseVirtualDevice
+	for i := range dataDisks {
+		dataDisk := &dataDisks[i]
+		if dataDisk.FileName != "" {
+			continue
+		}
+		if devices == nil {
+			var err error
+			if devices, err = vm.Obj.Device(vm.Context); err != nil {
+				return err
+			}
+		}
+
+		controller, err := findDataDiskController(devices, &vsphereutil.DataDiskController{Type: dataDisk.ControllerType, BusNumber: dataDisk.BusNumber})
+		if err != nil {
+			return err
+		}
+		if controller == nil {
+			return fmt.Errorf("%s controller %d of data disk %q not found", dataDisk.ControllerType, dataDisk.BusNumber, dataDisk.Name)
+		}
+		controllerKey := controller.GetVirtualController().Key
+		for _, device := range devices {
+			disk, ok := device.(*types.VirtualDisk)
+			if !ok || disk.ControllerKey != controllerKey || disk.UnitNumber == nil || *disk.UnitNumber != dataDisk.UnitNumber {
+				continue
+			}
+			if backing, ok := disk.Backing.(types.BaseVirtualDeviceFileBackingInfo); ok {
+				dataDisk.FileName = backing.GetVirtualDeviceFileBackingInfo().FileName
+			}
+		}
+		if dataDisk.FileName == "" {
+			return fmt.Errorf("data disk %q not found on unit %d of %s controller %d",
+				dataDisk.Name, dataDisk.UnitNumber, dataDisk.ControllerType, dataDisk.BusNumber)
+		}
+	}
+	return nil
+}
+
+// filterOutMachineDataDisks filters out the data disks created along with the vm, by their recorded backing files
+func filterOutMachineDataDisks(attachedDisks []attachedDisk, dataDisks []dataDiskRecord) []attachedDisk {
+	fileNames := map[string]bool{}
+	for _, dataDisk := range dataDisks {
+		if dataDisk.FileName != "" {
+			fileNames[dataDisk.FileName] = true
+		}
+	}
+
+	var disks []attachedDisk
+	for _, disk := range attachedDisks {
+		if fileNames[disk.fileName] {
+			continue
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
@@ -0,0 +1,367 @@
+package vsphere
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+// errDRSUpdateInProgress is returned while the DRS groups and rules of the cluster of the vm are being updated
+var errDRSUpdateInProgress = errors.New("DRS groups update in progress, requeuing")
+
+// drsClusterKey identifies a cluster across the vCenters the controller talks to
+type drsClusterKey struct {
+	server  string
+	cluster types.ManagedObjectReference
+}
+
+// drsCluster serializes the updates of the DRS groups and rules of a cluster, as a group or rule update replaces
+// its whole list of vms, and concurrent reconciles would otherwise overwrite each other's changes.
+type drsCluster struct {
+	sync.Mutex
+	// taskRef is the last reconfigure task of the cluster, its configuration is not read again until the task finished
+	taskRef string
+	// machine is the name of the machine which started the task, the only one the error of the task is reported to
+	machine string
+}
+
+var (
+	drsClustersMu sync.Mutex
+	drsClusters   = map[drsClusterKey]*drsCluster{}
+)
+
+// getDRSCluster returns the state of the cluster, shared by all the machines running in it
+func getDRSCluster(cluster *object.ClusterComputeResource) *drsCluster {
+	key := drsClusterKey{server: cluster.Client().URL().Host, cluster: cluster.Reference()}
+
+	drsClustersMu.Lock()
+	defer drsClustersMu.Unlock()
+	state, ok := drsClusters[key]
+	if !ok {
+		state = &drsCluster{}
+		drsClusters[key] = state
+	}
+	return state
+}
+
+// reconcileDRSGroups adds the vm to the DRS VM group of the machine, creating the group if needed,
+// and keeps the anti-affinity and host affinity rules of the group up to date.
+func (r *Reconciler) reconcileDRSGroups(vm *virtualMachine) error {
+	options, err := vsphereutil.DRS(r.machine)
+	if err != nil {
+		return machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if options == nil {
+		r.drsGroups = nil
+		return nil
+	}
+	// The cluster is only read again when the options changed since the vm joined its group, the anti-affinity
+	// rule being updated by the other vms of the group as they join and leave it
+	if r.drsGroups != nil && *r.drsGroups == *options {
+		return nil
+	}
+
+	cluster, err := vm.getCluster()
+	if err != nil {
+		return err
+	}
+
+	state := getDRSCluster(cluster)
+	state.Lock()
+	defer state.Unlock()
+
+	config, err := r.getClusterConfiguration(cluster, state)
+	if err != nil {
+		return err
+	}
+
+	spec := &types.ClusterConfigSpecEx{}
+	group := findVMGroup(config, options.VMGroup)
+	switch {
+	case group == nil:
+		klog.V(3).Infof("%v: creating DRS vm group %q", r.machine.GetName(), options.VMGroup)
+		group = &types.ClusterVmGroup{
+			ClusterGroupInfo: types.ClusterGroupInfo{Name: options.VMGroup},
+			Vm:               []types.ManagedObjectReference{vm.Ref},
+		}
+		spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+			Info:            group,
+		})
+	case !slices.Contains(group.Vm, vm.Ref):
+		klog.V(3).Infof("%v: joining DRS vm group %q", r.machine.GetName(), options.VMGroup)
+		group.Vm = append(group.Vm, vm.Ref)
+		spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+			Info:            group,
+		})
+	}
+
+	hostRule := findRule(config, options.HostAffinityRuleName())
+	if options.HostGroup == "" && hostRule != nil {
+		// The host group was unset since the rule was created
+		spec.RulesSpec = append(spec.RulesSpec, types.ClusterRuleSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: hostRule.GetClusterRuleInfo().Key,
+			},
+		})
+	}
+	if options.HostGroup != "" {
+		if findHostGroup(config, options.HostGroup) == nil {
+			return machinecontroller.InvalidMachineConfiguration("DRS host group %q not found", options.HostGroup)
+		}
+		rule := &types.ClusterVmHostRuleInfo{
+			ClusterRuleInfo: types.ClusterRuleInfo{
+				Name:      options.HostAffinityRuleName(),
+				Enabled:   ptr.To(true),
+				Mandatory: ptr.To(false),
+			},
+			VmGroupName:         options.VMGroup,
+			AffineHostGroupName: options.HostGroup,
+		}
+		existing, _ := hostRule.(*types.ClusterVmHostRuleInfo)
+		switch {
+		case existing == nil:
+			spec.RulesSpec = append(spec.RulesSpec, types.ClusterRuleSpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+				Info:            rule,
+			})
+		case existing.AffineHostGroupName != options.HostGroup:
+			rule.Key = existing.Key
+			spec.RulesSpec = append(spec.RulesSpec, types.ClusterRuleSpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+				Info:            rule,
+			})
+		}
+	}
+
+	// The anti-affinity rule is removed if it was disabled since it was created
+	antiAffinityVMs := group.Vm
+	if !options.AntiAffinity {
+		antiAffinityVMs = nil
+	}
+	spec.RulesSpec = append(spec.RulesSpec, antiAffinityRuleSpecs(config, options, antiAffinityVMs)...)
+
+	if len(spec.GroupSpec) == 0 && len(spec.RulesSpec) == 0 {
+		r.drsGroups = options
+		return nil
+	}
+	return r.reconfigureCluster(cluster, state, spec)
+}
+
+// leaveDRSGroups removes the vm from the DRS VM group of the machine, and removes the group and its rules
+// once it has no vm left. vCenter drops destroyed vms from the groups by itself, but not the emptied groups and rules.
+func (r *Reconciler) leaveDRSGroups(vm *virtualMachine) error {
+	options, err := vsphereutil.DRS(r.machine)
+	if err != nil {
+		// An invalid configuration must not block the deletion, the vm could not have joined any group with it
+		klog.Warningf("%v: skipping DRS groups cleanup: %v", r.machine.GetName(), err)
+		return nil
+	}
+	if options == nil {
+		return nil
+	}
+
+	cluster, err := vm.getCluster()
+	if err != nil {
+		return err
+	}
+
+	state := getDRSCluster(cluster)
+	state.Lock()
+	defer state.Unlock()
+
+	config, err := r.getClusterConfiguration(cluster, state)
+	if err != nil {
+		return err
+	}
+
+	group := findVMGroup(config, options.VMGroup)
+	if group == nil || !slices.Contains(group.Vm, vm.Ref) {
+		r.drsGroups = nil
+		return nil
+	}
+	group.Vm = slices.DeleteFunc(group.Vm, func(ref types.ManagedObjectReference) bool {
+		return ref == vm.Ref
+	})
+
+	spec := &types.ClusterConfigSpecEx{}
+	// The anti-affinity rule lists the vms of the group, and the host affinity rule references the group,
+	// so both are updated or removed before the group itself.
+	spec.RulesSpec = append(spec.RulesSpec, antiAffinityRuleSpecs(config, options, group.Vm)...)
+	if len(group.Vm) > 0 {
+		klog.V(3).Infof("%v: leaving DRS vm group %q", r.machine.GetName(), options.VMGroup)
+		spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+			Info:            group,
+		})
+	} else {
+		klog.V(3).Infof("%v: removing empty DRS vm group %q", r.machine.GetName(), options.VMGroup)
+		if rule := findRule(config, options.HostAffinityRuleName()); rule != nil {
+			spec.RulesSpec = append(spec.RulesSpec, types.ClusterRuleSpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationRemove,
+					RemoveKey: rule.GetClusterRuleInfo().Key,
+				},
+			})
+		}
+		spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: options.VMGroup,
+			},
+		})
+	}
+
+	return r.reconfigureCluster(cluster, state, spec)
+}
+
+// antiAffinityRuleSpecs returns the specs keeping the anti-affinity rule of the group in sync with the given vms.
+// vSphere requires at least two vms in an anti-affinity rule, so the rule only exists from the second vm on.
+func antiAffinityRuleSpecs(config *types.ClusterConfigInfoEx, options *vsphereutil.DRSOptions, vms []types.ManagedObjectReference) []types.ClusterRuleSpec {
+	existing, _ := findRule(config, options.AntiAffinityRuleName()).(*types.ClusterAntiAffinityRuleSpec)
+
+	if len(vms) < 2 {
+		if existing == nil {
+			return nil
+		}
+		return []types.ClusterRuleSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: existing.Key,
+			},
+		}}
+	}
+
+	rule := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:    options.AntiAffinityRuleName(),
+			Enabled: ptr.To(true),
+		},
+		Vm: vms,
+	}
+	if existing == nil {
+		return []types.ClusterRuleSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+			Info:            rule,
+		}}
+	}
+	if sameVMs(existing.Vm, vms) {
+		return nil
+	}
+	rule.Key = existing.Key
+	return []types.ClusterRuleSpec{{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationEdit},
+		Info:            rule,
+	}}
+}
+
+// getClusterConfiguration returns the configuration of the cluster once its last reconfigure task finished,
+// and errDRSUpdateInProgress until then. The lock of the cluster state must be held.
+func (r *Reconciler) getClusterConfiguration(cluster *object.ClusterComputeResource, state *drsCluster) (*types.ClusterConfigInfoEx, error) {
+	if state.taskRef != "" {
+		moTask, err := r.session.GetTask(r.Context, state.taskRef)
+		if err != nil && !isRetrieveMONotFound(state.taskRef, err) {
+			return nil, fmt.Errorf("unable to get reconfigure task %s of cluster %s: %w", state.taskRef, cluster.Reference().Value, err)
+		}
+		if moTask != nil {
+			finished, taskErr := taskIsFinished(moTask)
+			if !finished {
+				return nil, fmt.Errorf("%w: cluster %s is being reconfigured", errDRSUpdateInProgress, cluster.Reference().Value)
+			}
+			if taskErr != nil {
+				klog.Warningf("%v: reconfigure task %s of cluster %s started by %v finished with error: %v",
+					r.machine.GetName(), state.taskRef, cluster.Reference().Value, state.machine, taskErr)
+				if state.machine == r.machine.GetName() {
+					state.taskRef, state.machine = "", ""
+					return nil, fmt.Errorf("unable to update DRS groups and rules of cluster %s: %w", cluster.Reference().Value, taskErr)
+				}
+			}
+		}
+		state.taskRef, state.machine = "", ""
+	}
+
+	config, err := cluster.Configuration(r.Context)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get configuration of cluster %s: %w", cluster.Reference().Value, err)
+	}
+	return config, nil
+}
+
+// reconfigureCluster starts the update of the DRS groups and rules, and returns errDRSUpdateInProgress.
+// The task is not waited for, the next reconcile of the machine finds the changes applied once it finished.
+func (r *Reconciler) reconfigureCluster(cluster *object.ClusterComputeResource, state *drsCluster, spec *types.ClusterConfigSpecEx) error {
+	task, err := cluster.Reconfigure(r.Context, spec, true)
+	if err != nil {
+		return fmt.Errorf("unable to update DRS groups and rules of cluster %s: %w", cluster.Reference().Value, err)
+	}
+	state.taskRef, state.machine = task.Reference().Value, r.machine.GetName()
+	return fmt.Errorf("%w: started reconfigure task %s of cluster %s", errDRSUpdateInProgress, state.taskRef, cluster.Reference().Value)
+}
+
+// getCluster returns the cluster the vm runs in, DRS groups and rules being cluster wide
+func (vm *virtualMachine) getCluster() (*object.ClusterComputeResource, error) {
+	pool, err := vm.Obj.ResourcePool(vm.Context)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resource pool of vm: %w", err)
+	}
+	owner, err := pool.Owner(vm.Context)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get owner of resource pool %s: %w", pool.Reference().Value, err)
+	}
+	cluster, ok := owner.(*object.ClusterComputeResource)
+	if !ok {
+		return nil, machinecontroller.InvalidMachineConfiguration(
+			"DRS groups require the vm to run in a cluster, found %s %s", owner.Reference().Type, owner.Reference().Value)
+	}
+	return cluster, nil
+}
+
+func findVMGroup(config *types.ClusterConfigInfoEx, name string) *types.ClusterVmGroup {
+	for _, group := range config.Group {
+		if vmGroup, ok := group.(*types.ClusterVmGroup); ok && vmGroup.Name == name {
+			return vmGroup
+		}
+	}
+	return nil
+}
+
+func findHostGroup(config *types.ClusterConfigInfoEx, name string) *types.ClusterHostGroup {
+	for _, group := range config.Group {
+		if hostGroup, ok := group.(*types.ClusterHostGroup); ok && hostGroup.Name == name {
+			return hostGroup
+		}
+	}
+	return nil
+}
+
+func findRule(config *types.ClusterConfigInfoEx, name string) types.BaseClusterRuleInfo {
+	for _, rule := range config.Rule {
+		if rule.GetClusterRuleInfo().Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+func sameVMs(a, b []types.ManagedObjectReference) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ref := range a {
+		if !slices.Contains(b, ref) {
+			return false
+		}
+	}
+	return true
+}
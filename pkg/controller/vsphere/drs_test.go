@@ -0,0 +1,181 @@
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestDRSGroups(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	cluster, err := session.Finder.ClusterComputeResource(context.TODO(), "DC0_C0")
+	g.Expect(err).ToNot(HaveOccurred())
+	hosts, err := cluster.Hosts(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Create the host group the machines should run on
+	task, err := cluster.Reconfigure(context.TODO(), &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+			Info: &types.ClusterHostGroup{
+				ClusterGroupInfo: types.ClusterGroupInfo{Name: "rack-a"},
+				Host:             []types.ManagedObjectReference{hosts[0].Reference()},
+			},
+		}},
+	}, true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(context.TODO())).To(Succeed())
+
+	var vms []*virtualMachine
+	for _, obj := range simulator.Map.All("VirtualMachine") {
+		simVM := obj.(*simulator.VirtualMachine)
+		owner, err := object.NewResourcePool(session.Client.Client, *simVM.ResourcePool).Owner(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		if owner.Reference() != cluster.Reference() {
+			continue
+		}
+		vms = append(vms, &virtualMachine{
+			Context: context.TODO(),
+			Obj:     object.NewVirtualMachine(session.Client.Client, simVM.Reference()),
+			Ref:     simVM.Reference(),
+		})
+	}
+	g.Expect(len(vms)).To(BeNumerically(">=", 2))
+
+	getReconciler := func(annotation string) *Reconciler {
+		return newReconciler(&machineScope{
+			Context: context.TODO(),
+			session: session,
+			machine: &machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "machine",
+					Namespace:   "test",
+					Annotations: map[string]string{vsphereutil.DRSAnnotation: annotation},
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: machinev1.SchemeGroupVersion.String(),
+						Kind:       "MachineSet",
+						Name:       "workers",
+						Controller: ptr.To(true),
+					}},
+				},
+			},
+		})
+	}
+	getConfig := func() *types.ClusterConfigInfoEx {
+		config, err := cluster.Configuration(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		return config
+	}
+
+	// As the machine controller requeues the machine, the reconcile is retried until the reconfigure task finished
+	untilApplied := func(reconcile func(*virtualMachine) error, vm *virtualMachine) error {
+		for {
+			err := reconcile(vm)
+			if !errors.Is(err, errDRSUpdateInProgress) {
+				return err
+			}
+			g.Expect(waitForTaskRef(session.Client.Client, getDRSCluster(cluster).taskRef)).To(Succeed())
+		}
+	}
+
+	options := `{"antiAffinity": true, "hostGroup": "rack-a"}`
+	r0, r1 := getReconciler(options), getReconciler(options)
+
+	// The first vm creates the group and the host affinity rule
+	err = r0.reconcileDRSGroups(vms[0])
+	g.Expect(errors.Is(err, errDRSUpdateInProgress)).To(BeTrue())
+	g.Expect(r0.drsGroups).To(BeNil())
+	g.Expect(untilApplied(r0.reconcileDRSGroups, vms[0])).To(Succeed())
+	g.Expect(r0.drsGroups).To(Equal(&vsphereutil.DRSOptions{VMGroup: "workers", AntiAffinity: true, HostGroup: "rack-a"}))
+	config := getConfig()
+	g.Expect(findVMGroup(config, "workers").Vm).To(ConsistOf(vms[0].Ref))
+	hostRule, ok := findRule(config, "workers-host-affinity").(*types.ClusterVmHostRuleInfo)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(hostRule.VmGroupName).To(Equal("workers"))
+	g.Expect(hostRule.AffineHostGroupName).To(Equal("rack-a"))
+	g.Expect(hostRule.Mandatory).To(Equal(ptr.To(false)))
+	g.Expect(findRule(config, "workers-anti-affinity")).To(BeNil())
+
+	// The second vm joins the group and creates the anti-affinity rule
+	g.Expect(untilApplied(r1.reconcileDRSGroups, vms[1])).To(Succeed())
+	config = getConfig()
+	g.Expect(findVMGroup(config, "workers").Vm).To(ConsistOf(vms[0].Ref, vms[1].Ref))
+	antiAffinityRule, ok := findRule(config, "workers-anti-affinity").(*types.ClusterAntiAffinityRuleSpec)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(antiAffinityRule.Vm).To(ConsistOf(vms[0].Ref, vms[1].Ref))
+
+	// Reconciling again changes nothing, and starts no task
+	lastTaskRef := getDRSCluster(cluster).taskRef
+	g.Expect(r0.reconcileDRSGroups(vms[0])).To(Succeed())
+	g.Expect(getReconciler(options).reconcileDRSGroups(vms[0])).To(Succeed())
+	g.Expect(getDRSCluster(cluster).taskRef).To(Equal(lastTaskRef))
+	g.Expect(getConfig()).To(Equal(config))
+
+	// Leaving the group updates the anti-affinity rule, which needs two vms
+	g.Expect(untilApplied(r0.leaveDRSGroups, vms[0])).To(Succeed())
+	g.Expect(r0.drsGroups).To(BeNil())
+	config = getConfig()
+	g.Expect(findVMGroup(config, "workers").Vm).To(ConsistOf(vms[1].Ref))
+	g.Expect(findRule(config, "workers-anti-affinity")).To(BeNil())
+	g.Expect(findRule(config, "workers-host-affinity")).ToNot(BeNil())
+
+	// Leaving a group twice is a no-op
+	g.Expect(r0.leaveDRSGroups(vms[0])).To(Succeed())
+
+	// The last vm leaving the group removes it along with its rules
+	g.Expect(untilApplied(r1.leaveDRSGroups, vms[1])).To(Succeed())
+	config = getConfig()
+	g.Expect(findVMGroup(config, "workers")).To(BeNil())
+	g.Expect(findRule(config, "workers-host-affinity")).To(BeNil())
+	g.Expect(findHostGroup(config, "rack-a")).ToNot(BeNil())
+
+	// Unset options remove the rules they created
+	g.Expect(untilApplied(getReconciler(`{"vmGroup": "infra", "antiAffinity": true, "hostGroup": "rack-a"}`).reconcileDRSGroups, vms[0])).To(Succeed())
+	g.Expect(untilApplied(getReconciler(`{"vmGroup": "infra", "antiAffinity": true, "hostGroup": "rack-a"}`).reconcileDRSGroups, vms[1])).To(Succeed())
+	g.Expect(untilApplied(getReconciler(`{"vmGroup": "infra"}`).reconcileDRSGroups, vms[1])).To(Succeed())
+	config = getConfig()
+	g.Expect(findVMGroup(config, "infra").Vm).To(ConsistOf(vms[0].Ref, vms[1].Ref))
+	g.Expect(findRule(config, "infra-anti-affinity")).To(BeNil())
+	g.Expect(findRule(config, "infra-host-affinity")).To(BeNil())
+
+	// The failure of a reconfigure task is only reported to the machine which started it
+	failedTask, err := vms[0].Obj.UpgradeVM(context.TODO(), "vmx-17")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(failedTask.Wait(context.TODO())).ToNot(Succeed())
+	state := getDRSCluster(cluster)
+	state.taskRef, state.machine = failedTask.Reference().Value, "other"
+	g.Expect(getReconciler(`{"vmGroup": "infra"}`).reconcileDRSGroups(vms[0])).To(Succeed())
+	g.Expect(state.taskRef).To(BeEmpty())
+	state.taskRef, state.machine = failedTask.Reference().Value, "machine"
+	g.Expect(getReconciler(`{"vmGroup": "infra"}`).reconcileDRSGroups(vms[0])).To(MatchError(ContainSubstring("unable to update DRS groups and rules of cluster")))
+	g.Expect(state.taskRef).To(BeEmpty())
+
+	// A missing host group is a configuration error
+	err = getReconciler(`{"hostGroup": "rack-b"}`).reconcileDRSGroups(vms[0])
+	g.Expect(err).To(MatchError("DRS host group \"rack-b\" not found"))
+	var machineError *machinecontroller.MachineError
+	g.Expect(errors.As(err, &machineError)).To(BeTrue())
+	g.Expect(machineError.Reason).To(Equal(machinev1.InvalidConfigurationMachineError))
+
+	// Machines without DRS options are left alone
+	r := getReconciler("")
+	delete(r.machine.Annotations, vsphereutil.DRSAnnotation)
+	g.Expect(r.reconcileDRSGroups(vms[0])).To(Succeed())
+	g.Expect(r.leaveDRSGroups(vms[0])).To(Succeed())
+}
@@ -0,0 +1,113 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+const (
+	// firmwareCondition reports whether the firmware and the security devices of the vm match the firmware options
+	// of the machine
+	firmwareCondition = "Firmware"
+
+	firmwareConfiguredReason = "FirmwareConfigured"
+	firmwareMismatchReason   = "FirmwareMismatch"
+)
+
+// configureFirmware sets the firmware options of the machine in the configuration of the clone, and adds a vTPM
+// unless the source of the clone has one.
+func configureFirmware(s *machineScope, source *object.VirtualMachine, devices object.VirtualDeviceList,
+	config *types.VirtualMachineConfigSpec, options *vsphereutil.FirmwareOptions) error {
+	if minimumHWVersion := options.MinimumHWVersion(); minimumHWVersion > 0 {
+		hwVersion, err := getHwVersion(s.Context, source)
+		if err != nil {
+			return machinecontroller.InvalidMachineConfiguration(
+				"Unable to detect machine template HW version for machine '%s': %v", s.machine.GetName(), err,
+			)
+		}
+		if hwVersion < minimumHWVersion {
+			return machinecontroller.InvalidMachineConfiguration(
+				"%s requires hardware version %d or higher, the machine template version is %d",
+				options, minimumHWVersion, hwVersion,
+			)
+		}
+	}
+
+	klog.V(3).Infof("%v: configuring %s", s.machine.GetName(), options)
+	config.Firmware = options.Firmware
+	if options.SecureBoot != nil {
+		config.BootOptions = &types.VirtualMachineBootOptions{EfiSecureBootEnabled: options.SecureBoot}
+	}
+
+	if options.VTPM && len(devices.SelectByType((*types.VirtualTPM)(nil))) == 0 {
+		// The key of the new device must not be used by the devices added to the clone
+		allDevices := append(object.VirtualDeviceList{}, devices...)
+		for _, deviceSpec := range config.DeviceChange {
+			allDevices = append(allDevices, deviceSpec.GetVirtualDeviceConfigSpec().Device)
+		}
+		config.DeviceChange = append(config.DeviceChange, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+			Device: &types.VirtualTPM{
+				VirtualDevice: types.VirtualDevice{Key: allDevices.NewKey()},
+			},
+		})
+	}
+	return nil
+}
+
+// reconcileFirmware reports whether the firmware and the security devices of the vm match the firmware options of
+// the machine in the firmware condition.
+func (r *Reconciler) reconcileFirmware(vm *virtualMachine) error {
+	options, err := vsphereutil.Firmware(r.machine)
+	if err != nil {
+		return machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if options == nil {
+		return nil
+	}
+
+	var o mo.VirtualMachine
+	if err := vm.Obj.Properties(r.Context, vm.Ref, []string{"config.firmware", "config.bootOptions", "config.hardware.device"}, &o); err != nil {
+		return fmt.Errorf("unable to get firmware of vm: %w", err)
+	}
+	if o.Config == nil {
+		return nil
+	}
+
+	actual := &vsphereutil.FirmwareOptions{
+		Firmware:   o.Config.Firmware,
+		SecureBoot: ptr.To(false),
+		VTPM:       len(object.VirtualDeviceList(o.Config.Hardware.Device).SelectByType((*types.VirtualTPM)(nil))) > 0,
+	}
+	if o.Config.BootOptions != nil {
+		actual.SecureBoot = ptr.To(ptr.Deref(o.Config.BootOptions.EfiSecureBootEnabled, false))
+	}
+
+	matches := (options.Firmware == "" || options.Firmware == actual.Firmware) &&
+		(options.SecureBoot == nil || *options.SecureBoot == *actual.SecureBoot) &&
+		(!options.VTPM || actual.VTPM)
+
+	condition := metav1.Condition{
+		Type:    firmwareCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  firmwareConfiguredReason,
+		Message: fmt.Sprintf("The vm has %s", actual),
+	}
+	if !matches {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = firmwareMismatchReason
+		condition.Message = fmt.Sprintf("The vm has %s, the machine requires %s", actual, options)
+		klog.Warningf("%v: %s", r.machine.GetName(), condition.Message)
+	}
+	r.providerStatus.Conditions = setConditions(condition, r.providerStatus.Conditions)
+	return nil
+}
@@ -0,0 +1,217 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestConfigureFirmware(t *testing.T) {
+	testCases := []struct {
+		name               string
+		options            *vsphereutil.FirmwareOptions
+		hwVersion          string
+		templateHasTPM     bool
+		expectedFirmware   string
+		expectedSecureBoot *bool
+		expectedTPM        bool
+		expectedError      string
+	}{
+		{
+			name:             "EFI",
+			options:          &vsphereutil.FirmwareOptions{Firmware: vsphereutil.FirmwareEFI},
+			expectedFirmware: vsphereutil.FirmwareEFI,
+		},
+		{
+			name:               "Secure Boot and vTPM",
+			options:            &vsphereutil.FirmwareOptions{Firmware: vsphereutil.FirmwareEFI, SecureBoot: ptr.To(true), VTPM: true},
+			expectedFirmware:   vsphereutil.FirmwareEFI,
+			expectedSecureBoot: ptr.To(true),
+			expectedTPM:        true,
+		},
+		{
+			name:               "vTPM of the template",
+			options:            &vsphereutil.FirmwareOptions{Firmware: vsphereutil.FirmwareEFI, SecureBoot: ptr.To(true), VTPM: true},
+			templateHasTPM:     true,
+			expectedFirmware:   vsphereutil.FirmwareEFI,
+			expectedSecureBoot: ptr.To(true),
+		},
+		{
+			name:          "Hardware version too low for vTPM",
+			options:       &vsphereutil.FirmwareOptions{Firmware: vsphereutil.FirmwareEFI, VTPM: true},
+			hwVersion:     "vmx-13",
+			expectedError: "firmware efi, vTPM requires hardware version 14 or higher, the machine template version is 13",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			simVM := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			simVM.Config.Version = minimumHWVersionString
+			if tc.hwVersion != "" {
+				simVM.Config.Version = tc.hwVersion
+			}
+			if tc.templateHasTPM {
+				simVM.Config.Hardware.Device = append(simVM.Config.Hardware.Device, &types.VirtualTPM{
+					VirtualDevice: types.VirtualDevice{Key: 11000},
+				})
+			}
+			template := object.NewVirtualMachine(session.Client.Client, simVM.Reference())
+			devices, err := template.Device(context.TODO())
+			g.Expect(err).ToNot(HaveOccurred())
+
+			s := &machineScope{
+				Context: context.TODO(),
+				session: session,
+				machine: &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine"}},
+			}
+			config := &types.VirtualMachineConfigSpec{
+				DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+					&types.VirtualDeviceConfigSpec{
+						Operation: types.VirtualDeviceConfigSpecOperationAdd,
+						Device:    &types.VirtualDisk{VirtualDevice: types.VirtualDevice{Key: devices.NewKey()}},
+					},
+				},
+			}
+
+			err = configureFirmware(s, template, devices, config, tc.options)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(config.Firmware).To(Equal(tc.expectedFirmware))
+			if tc.expectedSecureBoot == nil {
+				g.Expect(config.BootOptions).To(BeNil())
+			} else {
+				g.Expect(config.BootOptions.EfiSecureBootEnabled).To(Equal(tc.expectedSecureBoot))
+			}
+
+			var tpms []*types.VirtualTPM
+			keys := map[int32]bool{}
+			for _, deviceSpec := range config.DeviceChange {
+				device := deviceSpec.GetVirtualDeviceConfigSpec().Device
+				g.Expect(keys).ToNot(HaveKey(device.GetVirtualDevice().Key))
+				keys[device.GetVirtualDevice().Key] = true
+				if tpm, ok := device.(*types.VirtualTPM); ok {
+					tpms = append(tpms, tpm)
+				}
+			}
+			if tc.expectedTPM {
+				g.Expect(tpms).To(HaveLen(1))
+			} else {
+				g.Expect(tpms).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestReconcileFirmware(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotation        string
+		firmware          string
+		secureBoot        bool
+		tpm               bool
+		expectedCondition *metav1.Condition
+	}{
+		{
+			name: "Without firmware options",
+		},
+		{
+			name:       "Matching firmware options",
+			annotation: `{"firmware": "efi", "secureBoot": true, "vTPM": true}`,
+			firmware:   vsphereutil.FirmwareEFI,
+			secureBoot: true,
+			tpm:        true,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  firmwareConfiguredReason,
+				Message: "The vm has firmware efi, Secure Boot enabled, vTPM",
+			},
+		},
+		{
+			name:       "Secure Boot disabled",
+			annotation: `{"firmware": "efi", "secureBoot": true}`,
+			firmware:   vsphereutil.FirmwareEFI,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  firmwareMismatchReason,
+				Message: "The vm has firmware efi, Secure Boot disabled, the machine requires firmware efi, Secure Boot enabled",
+			},
+		},
+		{
+			name:       "BIOS firmware",
+			annotation: `{"firmware": "efi"}`,
+			firmware:   vsphereutil.FirmwareBIOS,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  firmwareMismatchReason,
+				Message: "The vm has firmware bios, Secure Boot disabled, the machine requires firmware efi",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			simVM := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			simVM.Config.Firmware = tc.firmware
+			simVM.Config.BootOptions = &types.VirtualMachineBootOptions{EfiSecureBootEnabled: ptr.To(tc.secureBoot)}
+			if tc.tpm {
+				simVM.Config.Hardware.Device = append(simVM.Config.Hardware.Device, &types.VirtualTPM{
+					VirtualDevice: types.VirtualDevice{Key: 11000},
+				})
+			}
+			vm := &virtualMachine{
+				Context: context.TODO(),
+				Obj:     object.NewVirtualMachine(session.Client.Client, simVM.Reference()),
+				Ref:     simVM.Reference(),
+			}
+
+			machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+			if tc.annotation != "" {
+				machine.Annotations = map[string]string{vsphereutil.FirmwareAnnotation: tc.annotation}
+			}
+			r := newReconciler(&machineScope{
+				Context:        context.TODO(),
+				session:        session,
+				machine:        machine,
+				providerStatus: &machinev1.VSphereMachineProviderStatus{},
+			})
+
+			g.Expect(r.reconcileFirmware(vm)).To(Succeed())
+
+			condition := findCondition(r.providerStatus.Conditions, firmwareCondition)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+			g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+			g.Expect(condition.Message).To(Equal(tc.expectedCondition.Message))
+		})
+	}
+}
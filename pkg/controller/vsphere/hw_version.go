@@ -0,0 +1,133 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+const (
+	// hwVersionCondition reports whether the hardware version of the vm is at least the minimum hardware version of
+	// the machine, and the steps of its upgrade
+	hwVersionCondition = "HardwareVersion"
+
+	hwVersionUpToDateReason = "HardwareVersionUpToDate"
+	hwUpgradeRequiredReason = "UpgradeRequired"
+
+	// hwUpgradingReason is the step of an upgrade upgrading the powered off vm, or the cloned vm
+	hwUpgradingReason = "Upgrading"
+)
+
+// upgradeClonedHWVersion upgrades the hardware version of a cloned vm, before it is powered on for the first time,
+// when it is lower than the minimum hardware version of the machine. It returns the reference of the upgrade task.
+func (r *Reconciler) upgradeClonedHWVersion(vm *virtualMachine) (string, error) {
+	minimumHWVersion, err := vsphereutil.MinimumHWVersion(r.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if minimumHWVersion == 0 {
+		return "", nil
+	}
+
+	hwVersion, err := getHwVersion(r.Context, vm.Obj)
+	if err != nil {
+		return "", err
+	}
+	if hwVersion >= minimumHWVersion {
+		r.setHWVersionCondition(metav1.ConditionTrue, hwVersionUpToDateReason, fmt.Sprintf("The vm has hardware version %d", hwVersion))
+		return "", nil
+	}
+
+	klog.Infof("%v: upgrading cloned vm from hardware version %d to %d", r.machine.GetName(), hwVersion, minimumHWVersion)
+	taskRef, err := r.startHWUpgrade(vm, minimumHWVersion)
+	if err != nil {
+		return "", r.stepFailed(hwVersionCondition, hwUpgradingReason, err)
+	}
+	r.setHWVersionCondition(metav1.ConditionFalse, hwUpgradingReason,
+		fmt.Sprintf("Upgrading the vm from hardware version %d to %d", hwVersion, minimumHWVersion))
+	return taskRef, nil
+}
+
+// reconcileHWVersionUpgrade upgrades the vm of a running machine to the minimum hardware version of the machine, if
+// the machine allows it. The node is drained, and the vm powered off, upgraded and powered on again by a power cycle.
+// It returns true while a task of the upgrade is started.
+func (r *Reconciler) reconcileHWVersionUpgrade(vm *virtualMachine) (bool, error) {
+	minimumHWVersion, err := vsphereutil.MinimumHWVersion(r.machine)
+	if err != nil {
+		return false, machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	upgrading := hwUpgradePowerCycle.inProgress(r.providerStatus.Conditions)
+	if minimumHWVersion == 0 && !upgrading {
+		return false, nil
+	}
+
+	hwVersion, err := getHwVersion(r.Context, vm.Obj)
+	if err != nil {
+		return false, err
+	}
+	powerState, err := vm.getPowerState()
+	if err != nil {
+		return false, fmt.Errorf("unable to get power state of vm: %w", err)
+	}
+	poweredOff := powerState == types.VirtualMachinePowerStatePoweredOff
+
+	if hwVersion >= minimumHWVersion {
+		if !upgrading {
+			r.setHWVersionCondition(metav1.ConditionTrue, hwVersionUpToDateReason, fmt.Sprintf("The vm has hardware version %d", hwVersion))
+			return false, nil
+		}
+		return r.finishPowerCycle(hwUpgradePowerCycle, vm, poweredOff, "Powering on the upgraded vm",
+			fmt.Sprintf("Upgraded to hardware version %d with a power cycle", hwVersion))
+	}
+
+	allowed, err := vsphereutil.HWUpgradePowerCycleAllowed(r.machine)
+	if err != nil {
+		return false, machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if poweredOff && (upgrading || allowed) {
+		klog.Infof("%v: upgrading vm from hardware version %d to %d", r.machine.GetName(), hwVersion, minimumHWVersion)
+		taskRef, err := r.startHWUpgrade(vm, minimumHWVersion)
+		if err != nil {
+			return false, r.stepFailed(hwVersionCondition, hwUpgradingReason, err)
+		}
+		r.startStep(hwVersionCondition, taskRef, taskOperationUpgradeHardware, hwUpgradingReason,
+			fmt.Sprintf("Upgrading the powered off vm from hardware version %d to %d", hwVersion, minimumHWVersion))
+		return true, nil
+	}
+	if !allowed {
+		if upgrading {
+			// The power cycle was disallowed while draining the node
+			if err := r.uncordonNode(); err != nil {
+				return false, err
+			}
+		}
+		r.setHWVersionCondition(metav1.ConditionFalse, hwUpgradeRequiredReason, fmt.Sprintf(
+			"The vm has hardware version %d, lower than %d, set the %s annotation to \"true\" to drain the node and power cycle the vm to upgrade it",
+			hwVersion, minimumHWVersion, vsphereutil.HWUpgradePowerCycleAnnotation))
+		return false, nil
+	}
+
+	return r.powerOff(hwUpgradePowerCycle, vm)
+}
+
+// startHWUpgrade starts the upgrade of the powered off vm to the hardware version
+func (r *Reconciler) startHWUpgrade(vm *virtualMachine, hwVersion int) (string, error) {
+	// The task counts against the maximum number of tasks in flight on the vCenter
+	task, err := r.session.StartTask(func() (*object.Task, error) {
+		return vm.Obj.UpgradeVM(r.Context, fmt.Sprintf("vmx-%d", hwVersion))
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to upgrade vm to hardware version %d: %w", hwVersion, err)
+	}
+	return task.Reference().Value, nil
+}
+
+func (r *Reconciler) setHWVersionCondition(status metav1.ConditionStatus, reason, message string) {
+	r.setStepCondition(hwVersionCondition, status, reason, message)
+}
@@ -0,0 +1,270 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestUpgradeClonedHWVersion(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		expectedUpgrade   bool
+		expectedVersion   string
+		expectedCondition *metav1.Condition
+	}{
+		{
+			name:            "Without minimum hardware version",
+			expectedVersion: "vmx-15",
+		},
+		{
+			name:            "Hardware version up to date",
+			annotations:     map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-15"},
+			expectedVersion: "vmx-15",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  hwVersionUpToDateReason,
+				Message: "The vm has hardware version 15",
+			},
+		},
+		{
+			name:            "Hardware version upgraded",
+			annotations:     map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-17"},
+			expectedUpgrade: true,
+			expectedVersion: "vmx-17",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  hwUpgradingReason,
+				Message: "Upgrading the vm from hardware version 15 to 17",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, false, true)
+			simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine).Config.Version = "vmx-15"
+
+			r := newReconciler(&machineScope{
+				Context:        context.TODO(),
+				session:        session,
+				machine:        &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Annotations: tc.annotations}},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{},
+			})
+
+			taskRef, err := r.upgradeClonedHWVersion(vm)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.expectedUpgrade {
+				g.Expect(taskRef).ToNot(BeEmpty())
+				g.Expect(waitForTaskRef(session.Client.Client, taskRef)).To(Succeed())
+			} else {
+				g.Expect(taskRef).To(BeEmpty())
+			}
+
+			expectHWVersionCondition(g, r.providerStatus.Conditions, tc.expectedCondition)
+			g.Expect(getVMVersion(vm)).To(Equal(tc.expectedVersion))
+		})
+	}
+}
+
+func TestReconcileHWVersionUpgrade(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		poweredOff        bool
+		conditions        []metav1.Condition
+		expectedUpgrading bool
+		expectedCondition *metav1.Condition
+		expectedVersion   string
+		expectedPowerOff  bool
+	}{
+		{
+			name:            "Without minimum hardware version",
+			expectedVersion: "vmx-15",
+		},
+		{
+			name:            "Hardware version up to date",
+			annotations:     map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-15"},
+			expectedVersion: "vmx-15",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  hwVersionUpToDateReason,
+				Message: "The vm has hardware version 15",
+			},
+		},
+		{
+			name:            "Power cycle not allowed",
+			annotations:     map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-17"},
+			expectedVersion: "vmx-15",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  hwUpgradeRequiredReason,
+				Message: "The vm has hardware version 15, lower than 17, set the machine.openshift.io/vsphere-hw-upgrade-power-cycle annotation to \"true\" to drain the node and power cycle the vm to upgrade it",
+			},
+		},
+		{
+			name: "Powering off",
+			annotations: map[string]string{
+				vsphereutil.MinimumHWVersionAnnotation:    "vmx-17",
+				vsphereutil.HWUpgradePowerCycleAnnotation: "true",
+			},
+			expectedUpgrading: true,
+			expectedVersion:   "vmx-15",
+			expectedPowerOff:  true,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  poweringOffReason,
+				Message: "Powering off the vm",
+			},
+		},
+		{
+			name: "Upgrading",
+			annotations: map[string]string{
+				vsphereutil.MinimumHWVersionAnnotation:    "vmx-17",
+				vsphereutil.HWUpgradePowerCycleAnnotation: "true",
+			},
+			poweredOff: true,
+			conditions: []metav1.Condition{
+				{Type: hwVersionCondition, Status: metav1.ConditionFalse, Reason: poweringOffReason},
+			},
+			expectedUpgrading: true,
+			expectedVersion:   "vmx-17",
+			expectedPowerOff:  true,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  hwUpgradingReason,
+				Message: "Upgrading the powered off vm from hardware version 15 to 17",
+			},
+		},
+		{
+			name:        "Upgrade resumed after power cycle disallowed",
+			annotations: map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-17"},
+			poweredOff:  true,
+			conditions: []metav1.Condition{
+				{Type: hwVersionCondition, Status: metav1.ConditionFalse, Reason: poweringOffReason},
+			},
+			expectedUpgrading: true,
+			expectedVersion:   "vmx-17",
+			expectedPowerOff:  true,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  hwUpgradingReason,
+				Message: "Upgrading the powered off vm from hardware version 15 to 17",
+			},
+		},
+		{
+			name:        "Powering on",
+			annotations: map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-15"},
+			poweredOff:  true,
+			conditions: []metav1.Condition{
+				{Type: hwVersionCondition, Status: metav1.ConditionFalse, Reason: hwUpgradingReason},
+			},
+			expectedUpgrading: true,
+			expectedVersion:   "vmx-15",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  poweringOnReason,
+				Message: "Powering on the upgraded vm",
+			},
+		},
+		{
+			name:        "Upgraded",
+			annotations: map[string]string{vsphereutil.MinimumHWVersionAnnotation: "vmx-15"},
+			conditions: []metav1.Condition{
+				{Type: hwVersionCondition, Status: metav1.ConditionFalse, Reason: poweringOnReason},
+			},
+			expectedVersion: "vmx-15",
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  hwVersionUpToDateReason,
+				Message: "Upgraded to hardware version 15 with a power cycle",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, false, tc.poweredOff)
+			simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine).Config.Version = "vmx-15"
+
+			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			r := newReconciler(&machineScope{
+				Context:   context.TODO(),
+				session:   session,
+				client:    client,
+				apiReader: client,
+				machine: &machinev1.Machine{
+					ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "test", Annotations: tc.annotations},
+					Status:     machinev1.MachineStatus{Phase: ptr.To(machinev1.PhaseRunning)},
+				},
+				providerSpec:   &machinev1.VSphereMachineProviderSpec{},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{Conditions: tc.conditions},
+			})
+
+			upgrading, err := r.reconcileHWVersionUpgrade(vm)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(upgrading).To(Equal(tc.expectedUpgrading))
+			if tc.expectedUpgrading {
+				g.Expect(r.providerStatus.TaskRef).ToNot(BeEmpty())
+				g.Expect(waitForTaskRef(session.Client.Client, r.providerStatus.TaskRef)).To(Succeed())
+			} else {
+				g.Expect(r.providerStatus.TaskRef).To(BeEmpty())
+			}
+
+			expectHWVersionCondition(g, r.providerStatus.Conditions, tc.expectedCondition)
+			g.Expect(getVMVersion(vm)).To(Equal(tc.expectedVersion))
+
+			expectedPowerState := types.VirtualMachinePowerStatePoweredOn
+			if tc.expectedPowerOff {
+				expectedPowerState = types.VirtualMachinePowerStatePoweredOff
+			}
+			g.Expect(vm.getPowerState()).To(Equal(expectedPowerState))
+		})
+	}
+}
+
+func waitForTaskRef(c *vim25.Client, taskRef string) error {
+	task := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: taskRef})
+	return task.Wait(context.TODO())
+}
+
+func getVMVersion(vm *virtualMachine) string {
+	return simulator.Map.Get(vm.Ref).(*simulator.VirtualMachine).Config.Version
+}
+
+func expectHWVersionCondition(g *WithT, conditions []metav1.Condition, expected *metav1.Condition) {
+	condition := findCondition(conditions, hwVersionCondition)
+	if expected == nil {
+		g.Expect(condition).To(BeNil())
+		return
+	}
+	g.Expect(condition).ToNot(BeNil())
+	g.Expect(condition.Status).To(Equal(expected.Status))
+	g.Expect(condition.Reason).To(Equal(expected.Reason))
+	g.Expect(condition.Message).To(Equal(expected.Message))
+}
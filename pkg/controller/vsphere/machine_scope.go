@@ -8,9 +8,11 @@ import (
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
 	apicorev1 "k8s.io/api/core/v1"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
 	apimachineryutilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	vsphere "k8s.io/cloud-provider-vsphere/pkg/common/config"
 	"k8s.io/klog/v2"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,9 +27,11 @@ type machineScopeParams struct {
 	context.Context
 	client                     runtimeclient.Client
 	apiReader                  runtimeclient.Reader
+	eventRecorder              record.EventRecorder
 	machine                    *machinev1.Machine
 	StaticIPFeatureGateEnabled bool
 	openshiftConfigNameSpace   string
+	powerOffPolicy             PowerOffPolicy
 }
 
 // machineScope defines a scope defined around a machine and its cluster.
@@ -39,14 +43,26 @@ type machineScope struct {
 	client runtimeclient.Client
 	// client reader that bypasses the manager's cache
 	apiReader runtimeclient.Reader
+	// records the events of the machine
+	eventRecorder record.EventRecorder
 	// vSphere cloud-provider config
 	vSphereConfig *vsphere.Config
 	// machine resource
-	machine                    *machinev1.Machine
-	providerSpec               *machinev1.VSphereMachineProviderSpec
-	providerStatus             *machinev1.VSphereMachineProviderStatus
+	machine        *machinev1.Machine
+	providerSpec   *machinev1.VSphereMachineProviderSpec
+	providerStatus *machinev1.VSphereMachineProviderStatus
+	// the last tasks started for the machine, kept along with the provider status
+	taskHistory []taskRecord
+	// the data disks created along with the vm, kept along with the provider status
+	dataDisks []dataDiskRecord
+	// the DRS options the vm last joined its DRS group with, kept along with the provider status
+	drsGroups *vsphereutil.DRSOptions
+	// the vm deployed from the content library item until it is configured, kept along with the provider status
+	deployedVM                 string
 	machineToBePatched         runtimeclient.Patch
 	staticIPFeatureGateEnabled bool
+	// what to do with the vm of a Running machine powered off out of band
+	powerOffPolicy PowerOffPolicy
 }
 
 // newMachineScope creates a new machineScope from the supplied parameters.
@@ -71,6 +87,11 @@ func newMachineScope(params machineScopeParams) (*machineScope, error) {
 		return nil, machinecontroller.InvalidMachineConfiguration("failed to get machine provider status: %v", err.Error())
 	}
 
+	extendedStatus, err := extendedProviderStatusFromRawExtension(params.machine.Status.ProviderStatus)
+	if err != nil {
+		return nil, machinecontroller.InvalidMachineConfiguration("failed to get machine provider status: %v", err.Error())
+	}
+
 	user, password, err := getCredentialsSecret(params.client, params.machine.GetNamespace(), *providerSpec)
 	if err != nil {
 		return nil, fmt.Errorf("%v: error getting credentials: %w", params.machine.GetName(), err)
@@ -84,6 +105,11 @@ func newMachineScope(params machineScopeParams) (*machineScope, error) {
 		server, providerSpec.Workspace.Datacenter,
 		user, password, getVCenterInsecureFlagFromConfig(vSphereConfig, providerSpec.Workspace.Server))
 	if err != nil {
+		var loginErr *session.LoginError
+		if errors.As(err, &loginErr) && loginErr.CredentialsRotated && params.eventRecorder != nil {
+			params.eventRecorder.Eventf(params.machine, apicorev1.EventTypeWarning, failedLoginEventReason,
+				"vCenter %s rejected the rotated credentials of the credentials secret: %v", providerSpec.Workspace.Server, loginErr.Err)
+		}
 		return nil, fmt.Errorf("failed to create vSphere session: %w", err)
 	}
 
@@ -91,12 +117,18 @@ func newMachineScope(params machineScopeParams) (*machineScope, error) {
 		Context:                    params.Context,
 		client:                     params.client,
 		apiReader:                  params.apiReader,
+		eventRecorder:              params.eventRecorder,
 		session:                    authSession,
 		machine:                    params.machine,
 		providerSpec:               providerSpec,
 		providerStatus:             providerStatus,
+		taskHistory:                extendedStatus.TaskHistory,
+		dataDisks:                  extendedStatus.DataDisks,
+		drsGroups:                  extendedStatus.DRSGroups,
+		deployedVM:                 extendedStatus.DeployedVM,
 		vSphereConfig:              vSphereConfig,
 		staticIPFeatureGateEnabled: params.StaticIPFeatureGateEnabled,
+		powerOffPolicy:             params.powerOffPolicy,
 		machineToBePatched:         runtimeclient.MergeFrom(params.machine.DeepCopy()),
 	}, nil
 }
@@ -105,7 +137,13 @@ func newMachineScope(params machineScopeParams) (*machineScope, error) {
 func (s *machineScope) PatchMachine() error {
 	klog.V(3).Infof("%v: patching machine", s.machine.GetName())
 
-	providerStatus, err := RawExtensionFromProviderStatus(s.providerStatus)
+	providerStatus, err := rawExtensionFromExtendedProviderStatus(&extendedProviderStatus{
+		VSphereMachineProviderStatus: s.providerStatus,
+		TaskHistory:                  s.taskHistory,
+		DataDisks:                    s.dataDisks,
+		DRSGroups:                    s.drsGroups,
+		DeployedVM:                   s.deployedVM,
+	})
 	if err != nil {
 		return machinecontroller.InvalidMachineConfiguration("failed to get machine provider status: %v", err.Error())
 	}
@@ -285,8 +323,8 @@ func getCredentialsSecret(client runtimeclient.Client, namespace string, spec ma
 		return "", "", errors.New("no workspace")
 	}
 
-	credentialsSecretUser := fmt.Sprintf("%s.username", spec.Workspace.Server)
-	credentialsSecretPassword := fmt.Sprintf("%s.password", spec.Workspace.Server)
+	credentialsSecretUser := spec.Workspace.Server + credentialsUsernameSuffix
+	credentialsSecretPassword := spec.Workspace.Server + credentialsPasswordSuffix
 
 	user, exists := credentialsSecret.Data[credentialsSecretUser]
 	if !exists {
@@ -0,0 +1,331 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	apimachineryutilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+	ipamutils "github.com/openshift/machine-api-operator/pkg/util/ipam"
+)
+
+const (
+	orphanedVMEventReason              = "OrphanedVM"
+	orphanedVMDestroyedEventReason     = "OrphanedVMDestroyed"
+	failedDestroyOrphanedVMEventReason = "FailedDestroyOrphanedVM"
+)
+
+// OrphanScanner periodically looks for the vms tagged with the infrastructure ID of the cluster which do not belong
+// to any Machine, e.g. because the finalizer of their Machine was removed, or because their clone finished after
+// their Machine was deleted. The orphaned vms older than the grace period are reported through events on the
+// Infrastructure and metrics, and, if enabled, destroyed along with the IP address claims of their Machine.
+type OrphanScanner struct {
+	client                     runtimeclient.Client
+	apiReader                  runtimeclient.Reader
+	eventRecorder              record.EventRecorder
+	namespace                  string
+	openshiftConfigNamespace   string
+	interval                   time.Duration
+	gracePeriod                time.Duration
+	destroy                    bool
+	staticIPFeatureGateEnabled bool
+}
+
+// OrphanScannerParams holds parameter information for OrphanScanner.
+type OrphanScannerParams struct {
+	Client                     runtimeclient.Client
+	APIReader                  runtimeclient.Reader
+	EventRecorder              record.EventRecorder
+	Namespace                  string
+	OpenshiftConfigNamespace   string
+	Interval                   time.Duration
+	GracePeriod                time.Duration
+	Destroy                    bool
+	StaticIPFeatureGateEnabled bool
+}
+
+// NewOrphanScanner returns an orphan scanner, to be added to a manager.
+func NewOrphanScanner(params OrphanScannerParams) *OrphanScanner {
+	return &OrphanScanner{
+		client:                     params.Client,
+		apiReader:                  params.APIReader,
+		eventRecorder:              params.EventRecorder,
+		namespace:                  params.Namespace,
+		openshiftConfigNamespace:   params.OpenshiftConfigNamespace,
+		interval:                   params.Interval,
+		gracePeriod:                params.GracePeriod,
+		destroy:                    params.Destroy,
+		staticIPFeatureGateEnabled: params.StaticIPFeatureGateEnabled,
+	}
+}
+
+// Start scans vCenter for orphaned vms every interval until the context is done.
+func (o *OrphanScanner) Start(ctx context.Context) error {
+	klog.Infof("Scanning for orphaned vms every %v, destroying them: %t", o.interval, o.destroy)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := o.scan(ctx); err != nil {
+			klog.Errorf("Failed to scan for orphaned vms: %v", err)
+		}
+	}, o.interval)
+	return nil
+}
+
+// NeedLeaderElection makes only the leader scan for orphaned vms, so they are not destroyed twice.
+func (o *OrphanScanner) NeedLeaderElection() bool {
+	return true
+}
+
+// orphanedVM is a vm tagged with the infrastructure ID which does not belong to any Machine
+type orphanedVM struct {
+	ref          types.ManagedObjectReference
+	name         string
+	instanceUUID string
+	createDate   *time.Time
+	powerState   types.VirtualMachinePowerState
+}
+
+// age returns for how long the vm exists. A vm without creation date is considered older than any grace period.
+func (vm orphanedVM) age() time.Duration {
+	if vm.createDate == nil {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Since(*vm.createDate)
+}
+
+// scanTarget is a vCenter the scanner connects to with the workspace and credentials of a Machine or MachineSet
+type scanTarget struct {
+	namespace    string
+	providerSpec *machinev1.VSphereMachineProviderSpec
+}
+
+func (o *OrphanScanner) scan(ctx context.Context) error {
+	infra, err := getInfrastructure(o.apiReader)
+	if err != nil {
+		return err
+	}
+	infraID := infra.Status.InfrastructureName
+	if infraID == "" {
+		klog.V(3).Info("The infrastructure has no ID, skipping the scan for orphaned vms")
+		return nil
+	}
+
+	// Machines are listed before the vms, so a vm cloned in between is at most as old as the grace period
+	machines := &machinev1.MachineList{}
+	if err := o.apiReader.List(ctx, machines, runtimeclient.InNamespace(o.namespace)); err != nil {
+		return fmt.Errorf("unable to list machines: %w", err)
+	}
+	machineSets := &machinev1.MachineSetList{}
+	if err := o.apiReader.List(ctx, machineSets, runtimeclient.InNamespace(o.namespace)); err != nil {
+		return fmt.Errorf("unable to list machinesets: %w", err)
+	}
+
+	// The vms of machines are found by instance UUID, by name for the ones created by the installer, or by the BIOS
+	// UUID of their provider ID for the adopted ones
+	owners := sets.New[string]()
+	targets := map[string]scanTarget{}
+	for _, machine := range machines.Items {
+		owners.Insert(string(machine.UID), machine.Name)
+		if providerID := ptr.Deref(machine.Spec.ProviderID, ""); providerID != "" {
+			owners.Insert(strings.TrimPrefix(providerID, providerIDPrefix))
+		}
+		addScanTarget(targets, machine.Namespace, machine.Spec.ProviderSpec.Value)
+	}
+	for _, machineSet := range machineSets.Items {
+		addScanTarget(targets, machineSet.Namespace, machineSet.Spec.Template.Spec.ProviderSpec.Value)
+	}
+
+	vSphereConfig, err := getVSphereConfig(o.apiReader, o.openshiftConfigNamespace)
+	if err != nil {
+		klog.Errorf("Failed to fetch vSphere config: %v", err)
+	}
+
+	var errs []error
+	for _, server := range sets.List(sets.KeySet(targets)) {
+		target := targets[server]
+		user, password, err := getCredentialsSecret(o.client, target.namespace, *target.providerSpec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vCenter %s: error getting credentials: %w", server, err))
+			continue
+		}
+		s, err := session.GetOrCreate(ctx,
+			fmt.Sprintf("%s:%s", server, getVCenterPortFromConfig(vSphereConfig, server)), target.providerSpec.Workspace.Datacenter,
+			user, password, getVCenterInsecureFlagFromConfig(vSphereConfig, server))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vCenter %s: failed to create vSphere session: %w", server, err))
+			continue
+		}
+		if err := o.scanVCenter(ctx, s, server, infra, owners, target.namespace); err != nil {
+			errs = append(errs, fmt.Errorf("vCenter %s: %w", server, err))
+		}
+	}
+	return apimachineryutilerrors.NewAggregate(errs)
+}
+
+// addScanTarget records the vCenter of a provider spec, the tags of a vCenter are shared by all its datacenters
+func addScanTarget(targets map[string]scanTarget, namespace string, rawProviderSpec *runtime.RawExtension) {
+	providerSpec, err := ProviderSpecFromRawExtension(rawProviderSpec)
+	if err != nil || providerSpec.Workspace == nil || providerSpec.Workspace.Server == "" {
+		return
+	}
+	if _, ok := targets[providerSpec.Workspace.Server]; !ok {
+		targets[providerSpec.Workspace.Server] = scanTarget{namespace: namespace, providerSpec: providerSpec}
+	}
+}
+
+// scanVCenter reports the orphaned vms of a vCenter older than the grace period, and destroys them if enabled
+func (o *OrphanScanner) scanVCenter(ctx context.Context, s *session.Session, server string, infra *configv1.Infrastructure, owners sets.Set[string], namespace string) error {
+	vms, err := findOrphanedVMs(ctx, s, infra.Status.InfrastructureName, owners)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	orphans := 0
+	for _, vm := range vms {
+		if vm.age() < o.gracePeriod {
+			klog.V(3).Infof("vm %s does not belong to any machine yet, ignoring it for the grace period", vm.name)
+			continue
+		}
+		orphans++
+		klog.Warningf("vm %s with instance uuid %s on vCenter %s does not belong to any machine", vm.name, vm.instanceUUID, server)
+		o.eventRecorder.Eventf(infra, corev1.EventTypeWarning, orphanedVMEventReason,
+			"vm %s with instance uuid %s on vCenter %s does not belong to any machine", vm.name, vm.instanceUUID, server)
+		if !o.destroy {
+			continue
+		}
+
+		if err := o.destroyOrphanedVM(ctx, s, vm, namespace); err != nil {
+			o.eventRecorder.Eventf(infra, corev1.EventTypeWarning, failedDestroyOrphanedVMEventReason,
+				"failed to destroy orphaned vm %s on vCenter %s: %v", vm.name, server, err)
+			errs = append(errs, fmt.Errorf("failed to destroy orphaned vm %s: %w", vm.name, err))
+			continue
+		}
+		orphans--
+		metrics.RegisterVSphereOrphanedVMDestroyed(server)
+		o.eventRecorder.Eventf(infra, corev1.EventTypeNormal, orphanedVMDestroyedEventReason,
+			"Destroyed orphaned vm %s on vCenter %s", vm.name, server)
+	}
+	metrics.SetVSphereOrphanedVMs(server, orphans)
+	return apimachineryutilerrors.NewAggregate(errs)
+}
+
+// findOrphanedVMs returns the vms tagged with the infrastructure ID which are not templates and whose instance
+// uuid or name is not the one of a machine
+func findOrphanedVMs(ctx context.Context, s *session.Session, infraID string, owners sets.Set[string]) ([]orphanedVM, error) {
+	var refs []types.ManagedObjectReference
+	if err := s.WithCachingTagsManager(ctx, func(m *session.CachingTagsManager) error {
+		// The infrastructure ID tag is created by the installer, it does not exist in UPI clusters
+		tagIDs, err := m.ListTagsForCategory(ctx, tagToCategoryName(infraID))
+		if err != nil {
+			if isNotFoundErr(err) {
+				return nil
+			}
+			return err
+		}
+		for _, id := range tagIDs {
+			tag, err := m.GetTag(ctx, id)
+			if err != nil {
+				return err
+			}
+			if tag.Name != infraID {
+				continue
+			}
+			objects, err := m.ListAttachedObjects(ctx, tag.ID)
+			if err != nil {
+				return err
+			}
+			for _, obj := range objects {
+				if obj.Reference().Type == "VirtualMachine" {
+					refs = append(refs, obj.Reference())
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to list vms tagged with %s: %w", infraID, err)
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	var vms []mo.VirtualMachine
+	pc := property.DefaultCollector(s.Client.Client)
+	if err := pc.Retrieve(ctx, refs, []string{"name", "config.instanceUuid", "config.uuid", "config.template", "config.createDate", "runtime.powerState"}, &vms); err != nil {
+		return nil, fmt.Errorf("unable to get properties of the vms tagged with %s: %w", infraID, err)
+	}
+
+	var orphans []orphanedVM
+	for _, vm := range vms {
+		// The RHCOS template is tagged by the installer
+		if vm.Config == nil || vm.Config.Template {
+			continue
+		}
+		if owners.Has(vm.Config.InstanceUuid) || owners.Has(vm.Name) || owners.Has(vm.Config.Uuid) {
+			continue
+		}
+		orphans = append(orphans, orphanedVM{
+			ref:          vm.Reference(),
+			name:         vm.Name,
+			instanceUUID: vm.Config.InstanceUuid,
+			createDate:   vm.Config.CreateDate,
+			powerState:   vm.Runtime.PowerState,
+		})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].name < orphans[j].name })
+	return orphans, nil
+}
+
+// destroyOrphanedVM powers off and destroys an orphaned vm, then releases the IP address claims of its machine,
+// whose UID is the instance uuid of the vm
+func (o *OrphanScanner) destroyOrphanedVM(ctx context.Context, s *session.Session, vm orphanedVM, namespace string) error {
+	obj := object.NewVirtualMachine(s.Client.Client, vm.ref)
+	if vm.powerState == types.VirtualMachinePowerStatePoweredOn {
+		task, err := obj.PowerOff(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to power off vm: %w", err)
+		}
+		if err := task.Wait(ctx); err != nil {
+			return fmt.Errorf("unable to power off vm: %w", err)
+		}
+	}
+	task, err := obj.Destroy(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to destroy vm: %w", err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return fmt.Errorf("unable to destroy vm: %w", err)
+	}
+	klog.Infof("Destroyed orphaned vm %s", vm.name)
+
+	if !o.staticIPFeatureGateEnabled || vm.instanceUUID == "" {
+		return nil
+	}
+	released, err := ipamutils.ReleaseIPAddressClaimsForOwner(ctx, o.client, namespace, apimachinerytypes.UID(vm.instanceUUID))
+	if err != nil {
+		return fmt.Errorf("unable to release IP address claims: %w", err)
+	}
+	if released > 0 {
+		klog.Infof("Released %d IP address claims of orphaned vm %s", released, vm.name)
+	}
+	return nil
+}
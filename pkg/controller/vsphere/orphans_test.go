@@ -0,0 +1,172 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ipamv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScanVCenterForOrphanedVMs(t *testing.T) {
+	const infraID = "infraid"
+
+	testCases := []struct {
+		name               string
+		gracePeriod        time.Duration
+		destroy            bool
+		expectedEvents     []string
+		expectedDestroyed  bool
+		expectedClaimFound bool
+	}{
+		{
+			name:               "Orphaned vm younger than the grace period",
+			gracePeriod:        time.Hour,
+			expectedClaimFound: true,
+		},
+		{
+			name:               "Orphaned vm reported",
+			expectedEvents:     []string{"Warning OrphanedVM vm orphan with instance uuid"},
+			expectedClaimFound: true,
+		},
+		{
+			name:    "Orphaned vm destroyed",
+			destroy: true,
+			expectedEvents: []string{
+				"Warning OrphanedVM vm orphan with instance uuid",
+				"Normal OrphanedVMDestroyed Destroyed orphaned vm orphan",
+			},
+			expectedDestroyed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, server := initSimulatorCustom(t, func(m *simulator.Model) { m.Machine = 5 })
+			defer model.Remove()
+			defer server.Close()
+			session := getSimulatorSession(t, server)
+
+			// Tag a template, the vm of a machine found by instance uuid, the one of a machine found by name,
+			// the one adopted by a machine found by the BIOS uuid of its provider ID, and an orphaned vm
+			simVMs := simulator.Map.All("VirtualMachine")
+			g.Expect(len(simVMs)).To(BeNumerically(">=", 5))
+			template := simVMs[0].(*simulator.VirtualMachine)
+			template.Config.Template = true
+			ownedByUUID := simVMs[1].(*simulator.VirtualMachine)
+			ownedByName := simVMs[2].(*simulator.VirtualMachine)
+			orphan := simVMs[3].(*simulator.VirtualMachine)
+			orphan.Name = "orphan"
+			orphan.Config.Name = "orphan"
+			ownedByProviderID := simVMs[4].(*simulator.VirtualMachine)
+
+			tagID, err := createTagAndCategory(session, tagToCategoryName(infraID), infraID)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(session.WithRestClient(context.TODO(), func(c *rest.Client) error {
+				m := tags.NewManager(c)
+				for _, vm := range []*simulator.VirtualMachine{template, ownedByUUID, ownedByName, ownedByProviderID, orphan} {
+					if err := m.AttachTag(context.TODO(), tagID, vm.Reference()); err != nil {
+						return err
+					}
+				}
+				return nil
+			})).To(Succeed())
+
+			// The claim of the machine of the orphaned vm, whose UID is the instance uuid of the vm
+			claim := &ipamv1beta1.IPAddressClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "orphan-claim-0-0",
+					Namespace:  "test",
+					Finalizers: []string{machinev1.IPClaimProtectionFinalizer},
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&machinev1.Machine{
+						ObjectMeta: metav1.ObjectMeta{Name: "orphan", UID: apimachinerytypes.UID(orphan.Config.InstanceUuid)},
+					}, machinev1.SchemeGroupVersion.WithKind("Machine"))},
+				},
+			}
+			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(claim).Build()
+			recorder := record.NewFakeRecorder(10)
+
+			o := NewOrphanScanner(OrphanScannerParams{
+				Client:                     client,
+				APIReader:                  client,
+				EventRecorder:              recorder,
+				GracePeriod:                tc.gracePeriod,
+				Destroy:                    tc.destroy,
+				StaticIPFeatureGateEnabled: true,
+			})
+			infra := &configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{Name: globalInfrastuctureName},
+				Status:     configv1.InfrastructureStatus{InfrastructureName: infraID},
+			}
+			owners := sets.New(ownedByUUID.Config.InstanceUuid, ownedByName.Name, ownedByProviderID.Config.Uuid)
+
+			vms, err := findOrphanedVMs(context.TODO(), session, infraID, owners)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(vms).To(HaveLen(1))
+			g.Expect(vms[0].ref).To(Equal(orphan.Reference()))
+			g.Expect(vms[0].instanceUUID).To(Equal(orphan.Config.InstanceUuid))
+
+			g.Expect(o.scanVCenter(context.TODO(), session, server.URL.Host, infra, owners, "test")).To(Succeed())
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			g.Expect(events).To(HaveLen(len(tc.expectedEvents)))
+			for i, event := range tc.expectedEvents {
+				g.Expect(events[i]).To(HavePrefix(event))
+			}
+
+			_, destroyed := simulator.Map.Get(orphan.Reference()).(*simulator.VirtualMachine)
+			g.Expect(!destroyed).To(Equal(tc.expectedDestroyed))
+			for _, vm := range []*simulator.VirtualMachine{template, ownedByUUID, ownedByName} {
+				g.Expect(simulator.Map.Get(vm.Reference())).ToNot(BeNil())
+			}
+
+			err = client.Get(context.TODO(), runtimeclient.ObjectKeyFromObject(claim), &ipamv1beta1.IPAddressClaim{})
+			if tc.expectedClaimFound {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestFindOrphanedVMsWithoutInfrastructureTag(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	// UPI clusters have no infrastructure ID tag
+	vms, err := findOrphanedVMs(context.TODO(), session, "infraid", sets.New[string]())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(vms).To(BeEmpty())
+}
+
+func TestOrphanedVMAge(t *testing.T) {
+	g := NewWithT(t)
+
+	createDate := time.Now().Add(-time.Hour)
+	g.Expect(orphanedVM{createDate: &createDate}.age()).To(BeNumerically("~", time.Hour, time.Minute))
+	g.Expect(orphanedVM{powerState: types.VirtualMachinePowerStatePoweredOn}.age()).To(BeNumerically(">", 100*365*24*time.Hour))
+}
@@ -0,0 +1,136 @@
+package vsphere
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The reasons of the steps shared by the power cycles, along with the step applying their change
+	drainingReason    = "Draining"
+	poweringOffReason = "PoweringOff"
+	poweringOnReason  = "PoweringOn"
+)
+
+// powerCycle drains the node of a running machine, and powers off its vm to apply a change which requires it,
+// before powering it on again. The steps are reported by the reason of a condition of the provider status, and
+// each task is tracked by the task reference of the provider status, so the power cycle is resumed from its step
+// on the next reconcile.
+type powerCycle struct {
+	// conditionType is the condition reporting the steps of the power cycle
+	conditionType string
+	// applyingReason is the reason of the step applying the change to the powered off vm
+	applyingReason string
+	// doneReason is the reason of the condition once the vm is powered on again
+	doneReason string
+}
+
+var (
+	resizePowerCycle = powerCycle{
+		conditionType:  resizeCondition,
+		applyingReason: reconfiguringReason,
+		doneReason:     resizeSucceededReason,
+	}
+	hwUpgradePowerCycle = powerCycle{
+		conditionType:  hwVersionCondition,
+		applyingReason: hwUpgradingReason,
+		doneReason:     hwVersionUpToDateReason,
+	}
+)
+
+// inProgress returns true when the conditions report a step of the power cycle
+func (c powerCycle) inProgress(conditions []metav1.Condition) bool {
+	condition := findCondition(conditions, c.conditionType)
+	if condition == nil {
+		return false
+	}
+	switch condition.Reason {
+	case drainingReason, poweringOffReason, c.applyingReason, poweringOnReason:
+		return true
+	}
+	return false
+}
+
+// isPowerCycling returns true when the vm is powered off on purpose, by a step of a power cycle
+func isPowerCycling(conditions []metav1.Condition) bool {
+	return resizePowerCycle.inProgress(conditions) || hwUpgradePowerCycle.inProgress(conditions)
+}
+
+// powerOff drains the node of the machine, and starts the power off of the vm once the node is drained.
+// It returns true once the power off task is started.
+func (r *Reconciler) powerOff(c powerCycle, vm *virtualMachine) (bool, error) {
+	r.setStepCondition(c.conditionType, metav1.ConditionFalse, drainingReason, "Draining the node before powering off the vm")
+	drained, err := r.drainNode()
+	if err != nil {
+		return false, r.stepFailed(c.conditionType, drainingReason, err)
+	}
+	if !drained {
+		return false, fmt.Errorf("waiting for the node of the machine to be drained before powering off the vm")
+	}
+
+	taskRef, err := vm.powerOffVM()
+	if err != nil {
+		return false, r.stepFailed(c.conditionType, poweringOffReason, fmt.Errorf("unable to power off vm: %w", err))
+	}
+	r.startStep(c.conditionType, taskRef, taskOperationPowerOff, poweringOffReason, "Powering off the vm")
+	return true, nil
+}
+
+// finishPowerCycle starts the power on of the vm once the change is applied, and makes the node of the machine
+// schedulable again once the vm is powered on. It returns true once the power on task is started.
+func (r *Reconciler) finishPowerCycle(c powerCycle, vm *virtualMachine, poweredOff bool, poweringOnMessage, doneMessage string) (bool, error) {
+	if poweredOff {
+		taskRef, err := vm.powerOnVM()
+		if err != nil {
+			return false, r.stepFailed(c.conditionType, poweringOnReason, fmt.Errorf("unable to power on vm: %w", err))
+		}
+		r.startStep(c.conditionType, taskRef, taskOperationPowerOn, poweringOnReason, poweringOnMessage)
+		return true, nil
+	}
+	if err := r.uncordonNode(); err != nil {
+		return false, r.stepFailed(c.conditionType, poweringOnReason, err)
+	}
+	r.setStepCondition(c.conditionType, metav1.ConditionTrue, c.doneReason, doneMessage)
+	return false, nil
+}
+
+// startStep reports the step of the condition, and tracks its task until it finishes
+func (r *Reconciler) startStep(conditionType, taskRef string, operation taskOperation, reason, message string) {
+	recordTask(r.machineScope, taskRef, operation)
+	r.providerStatus.TaskRef = taskRef
+	r.setStepCondition(conditionType, metav1.ConditionFalse, reason, message)
+}
+
+// stepFailed reports the error of a step of the condition, which is retried on the next reconcile
+func (r *Reconciler) stepFailed(conditionType, reason string, err error) error {
+	r.setStepCondition(conditionType, metav1.ConditionFalse, reason, err.Error())
+	return err
+}
+
+// stepTaskFailed reports the error of the failed task of a step of a resize, or of a hardware upgrade, and forgets
+// the task so the step is retried on the next reconcile. It returns false when the task is not the one of a step.
+func (r *Reconciler) stepTaskFailed(err error) bool {
+	var conditionType string
+	switch {
+	case isResizing(r.providerStatus.Conditions):
+		conditionType = resizeCondition
+	case hwUpgradePowerCycle.inProgress(r.providerStatus.Conditions):
+		conditionType = hwVersionCondition
+	default:
+		return false
+	}
+	condition := findCondition(r.providerStatus.Conditions, conditionType)
+	r.setStepCondition(conditionType, metav1.ConditionFalse, condition.Reason, err.Error())
+	r.providerStatus.TaskRef = ""
+	return true
+}
+
+func (r *Reconciler) setStepCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	r.providerStatus.Conditions = setConditions(metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}, r.providerStatus.Conditions)
+}
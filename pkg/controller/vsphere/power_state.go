@@ -0,0 +1,128 @@
+package vsphere
+
+import (
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// PowerOffPolicy is what the actuator does when the vm of a Running machine is powered off, or suspended, out of
+// band, e.g. by a vCenter user.
+type PowerOffPolicy string
+
+const (
+	// PowerOffPolicyIgnore leaves the vm alone, its power state is only recorded in the instance state annotation
+	PowerOffPolicyIgnore PowerOffPolicy = "Ignore"
+	// PowerOffPolicyReport reports the vm by an event and a condition, and leaves it alone
+	PowerOffPolicyReport PowerOffPolicy = "Report"
+	// PowerOffPolicyPowerOn reports the vm by an event and a condition, and powers it on again
+	PowerOffPolicyPowerOn PowerOffPolicy = "PowerOn"
+)
+
+const (
+	// poweredOnCondition reports the vm of a Running machine powered off, or suspended, out of band
+	poweredOnCondition = "PoweredOn"
+
+	poweredOnReason            = "PoweredOn"
+	unexpectedPowerStateReason = "UnexpectedPowerState"
+	restoringPowerStateReason  = "RestoringPowerState"
+
+	unexpectedPowerStateEventReason = "UnexpectedPowerState"
+	restoringPowerStateEventReason  = "RestoringPowerState"
+)
+
+// ParsePowerOffPolicy returns the policy of the given name.
+func ParsePowerOffPolicy(name string) (PowerOffPolicy, error) {
+	switch policy := PowerOffPolicy(name); policy {
+	case PowerOffPolicyIgnore, PowerOffPolicyReport, PowerOffPolicyPowerOn:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown power off policy %q, must be one of %q, %q or %q",
+			name, PowerOffPolicyIgnore, PowerOffPolicyReport, PowerOffPolicyPowerOn)
+	}
+}
+
+// reconcileOutOfBandPowerOff detects the vm of a Running machine which was powered off, or suspended, out of band,
+// and reports or powers it on depending on the power off policy. It returns true when the vm is being powered on.
+func (r *Reconciler) reconcileOutOfBandPowerOff(vm *virtualMachine) (bool, error) {
+	if r.powerOffPolicy == "" || r.powerOffPolicy == PowerOffPolicyIgnore {
+		return false, nil
+	}
+	if ptr.Deref(r.machine.Status.Phase, "") != machinev1.PhaseRunning {
+		return false, nil
+	}
+	if isPowerCycling(r.providerStatus.Conditions) {
+		// The vm is powered off on purpose, to be resized or upgraded
+		return false, nil
+	}
+
+	powerState, err := vm.getPowerState()
+	if err != nil {
+		return false, fmt.Errorf("unable to get power state of vm: %w", err)
+	}
+
+	condition := findCondition(r.providerStatus.Conditions, poweredOnCondition)
+	if powerState == types.VirtualMachinePowerStatePoweredOn {
+		if condition != nil && condition.Status != metav1.ConditionTrue {
+			klog.Infof("%v: vm is powered on again", r.machine.GetName())
+			r.setPoweredOnCondition(metav1.ConditionTrue, poweredOnReason, "The vm is powered on")
+		}
+		return false, nil
+	}
+
+	// The instance state annotation is set before the vm is powered on, the network of a vm which is not powered on
+	// can not be reconciled
+	if err := r.reconcilePowerStateAnnontation(vm); err != nil {
+		return false, err
+	}
+
+	// The event is recorded once, when the power off is detected
+	if condition == nil || condition.Status == metav1.ConditionTrue {
+		klog.Warningf("%v: vm of the Running machine is %s", r.machine.GetName(), powerState)
+		r.recordEvent(corev1.EventTypeWarning, unexpectedPowerStateEventReason,
+			"The vm of the Running machine is %s, it was not powered off by the machine controller", powerState)
+	}
+	r.setPoweredOnCondition(metav1.ConditionFalse, unexpectedPowerStateReason,
+		fmt.Sprintf("The vm of the Running machine is %s", powerState))
+
+	if r.powerOffPolicy != PowerOffPolicyPowerOn {
+		return false, nil
+	}
+
+	klog.Infof("%v: powering on vm which is %s", r.machine.GetName(), powerState)
+	taskRef, err := vm.powerOnVM()
+	if err != nil {
+		return false, fmt.Errorf("unable to power on vm: %w", err)
+	}
+	r.recordEvent(corev1.EventTypeNormal, restoringPowerStateEventReason, "Powering on the vm which is %s", powerState)
+
+	// The machine is reconciled with the vm once the power on task is finished
+	recordTask(r.machineScope, taskRef, taskOperationPowerOn)
+	return true, setProviderStatus(taskRef, metav1.Condition{
+		Type:    poweredOnCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  restoringPowerStateReason,
+		Message: "Powering on the vm",
+	}, r.machineScope, vm)
+}
+
+func (r *Reconciler) setPoweredOnCondition(status metav1.ConditionStatus, reason, message string) {
+	r.providerStatus.Conditions = setConditions(metav1.Condition{
+		Type:    poweredOnCondition,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}, r.providerStatus.Conditions)
+}
+
+func (r *Reconciler) recordEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if r.eventRecorder == nil {
+		return
+	}
+	r.eventRecorder.Eventf(r.machine, eventType, reason, messageFmt, args...)
+}
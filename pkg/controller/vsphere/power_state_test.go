@@ -0,0 +1,203 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+func TestReconcileOutOfBandPowerOff(t *testing.T) {
+	testCases := []struct {
+		name               string
+		policy             PowerOffPolicy
+		phase              string
+		poweredOff         bool
+		conditions         []metav1.Condition
+		expectedPoweringOn bool
+		expectedCondition  *metav1.Condition
+		expectedEvents     int
+		expectedPowerState types.VirtualMachinePowerState
+		expectedAnnotation string
+	}{
+		{
+			name:               "Ignore policy",
+			policy:             PowerOffPolicyIgnore,
+			phase:              machinev1.PhaseRunning,
+			poweredOff:         true,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+		{
+			name:               "Machine not Running",
+			policy:             PowerOffPolicyPowerOn,
+			phase:              machinev1.PhaseProvisioned,
+			poweredOff:         true,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+		{
+			name:       "Powered off to be resized",
+			policy:     PowerOffPolicyPowerOn,
+			phase:      machinev1.PhaseRunning,
+			poweredOff: true,
+			conditions: []metav1.Condition{
+				{Type: resizeCondition, Status: metav1.ConditionFalse, Reason: reconfiguringReason},
+			},
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+		{
+			name:       "Powered off by the power cycle of a resize",
+			policy:     PowerOffPolicyPowerOn,
+			phase:      machinev1.PhaseRunning,
+			poweredOff: true,
+			conditions: []metav1.Condition{
+				{Type: resizeCondition, Status: metav1.ConditionFalse, Reason: poweringOffReason},
+			},
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+		{
+			name:       "Powered off to be upgraded",
+			policy:     PowerOffPolicyPowerOn,
+			phase:      machinev1.PhaseRunning,
+			poweredOff: true,
+			conditions: []metav1.Condition{
+				{Type: hwVersionCondition, Status: metav1.ConditionFalse, Reason: hwUpgradingReason},
+			},
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+		},
+		{
+			name:               "Powered on",
+			policy:             PowerOffPolicyReport,
+			phase:              machinev1.PhaseRunning,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOn,
+		},
+		{
+			name:   "Powered on again",
+			policy: PowerOffPolicyReport,
+			phase:  machinev1.PhaseRunning,
+			conditions: []metav1.Condition{
+				{Type: poweredOnCondition, Status: metav1.ConditionFalse, Reason: restoringPowerStateReason},
+			},
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: poweredOnReason,
+			},
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOn,
+		},
+		{
+			name:       "Report policy",
+			policy:     PowerOffPolicyReport,
+			phase:      machinev1.PhaseRunning,
+			poweredOff: true,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: unexpectedPowerStateReason,
+			},
+			expectedEvents:     1,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+			expectedAnnotation: string(types.VirtualMachinePowerStatePoweredOff),
+		},
+		{
+			name:       "Report policy when already reported",
+			policy:     PowerOffPolicyReport,
+			phase:      machinev1.PhaseRunning,
+			poweredOff: true,
+			conditions: []metav1.Condition{
+				{Type: poweredOnCondition, Status: metav1.ConditionFalse, Reason: unexpectedPowerStateReason},
+			},
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: unexpectedPowerStateReason,
+			},
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOff,
+			expectedAnnotation: string(types.VirtualMachinePowerStatePoweredOff),
+		},
+		{
+			name:               "PowerOn policy",
+			policy:             PowerOffPolicyPowerOn,
+			phase:              machinev1.PhaseRunning,
+			poweredOff:         true,
+			expectedPoweringOn: true,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: restoringPowerStateReason,
+			},
+			expectedEvents:     2,
+			expectedPowerState: types.VirtualMachinePowerStatePoweredOn,
+			expectedAnnotation: string(types.VirtualMachinePowerStatePoweredOff),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, true, tc.poweredOff)
+			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := newReconciler(&machineScope{
+				Context:       context.TODO(),
+				session:       session,
+				client:        client,
+				apiReader:     client,
+				eventRecorder: recorder,
+				machine: &machinev1.Machine{
+					ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "test"},
+					Status:     machinev1.MachineStatus{Phase: ptr.To(tc.phase)},
+				},
+				providerSpec:   &machinev1.VSphereMachineProviderSpec{},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{Conditions: tc.conditions},
+				powerOffPolicy: tc.policy,
+			})
+
+			poweringOn, err := r.reconcileOutOfBandPowerOff(vm)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(poweringOn).To(Equal(tc.expectedPoweringOn))
+
+			condition := findCondition(r.providerStatus.Conditions, poweredOnCondition)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+			} else {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+				g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+			}
+			if tc.expectedPoweringOn {
+				g.Expect(r.providerStatus.TaskRef).ToNot(BeEmpty())
+			}
+
+			g.Expect(recorder.Events).To(HaveLen(tc.expectedEvents))
+			g.Expect(r.machine.Annotations[machinecontroller.MachineInstanceStateAnnotationName]).To(Equal(tc.expectedAnnotation))
+
+			g.Eventually(func() (types.VirtualMachinePowerState, error) {
+				return vm.getPowerState()
+			}, 5*time.Second).Should(Equal(tc.expectedPowerState))
+		})
+	}
+}
+
+func TestParsePowerOffPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	for _, policy := range []PowerOffPolicy{PowerOffPolicyIgnore, PowerOffPolicyReport, PowerOffPolicyPowerOn} {
+		parsed, err := ParsePowerOffPolicy(string(policy))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(parsed).To(Equal(policy))
+	}
+
+	_, err := ParsePowerOffPolicy("Restart")
+	g.Expect(err).To(MatchError(ContainSubstring("unknown power off policy \"Restart\"")))
+}
@@ -0,0 +1,54 @@
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+// extendedProviderStatus is the provider status of a machine, extended with the state of the controller which
+// VSphereMachineProviderStatus has no field for
+type extendedProviderStatus struct {
+	*machinev1.VSphereMachineProviderStatus `json:",inline"`
+	// TaskHistory is the last tasks started for the machine
+	TaskHistory []taskRecord `json:"taskHistory,omitempty"`
+	// DataDisks is the data disks created along with the vm
+	DataDisks []dataDiskRecord `json:"dataDisks,omitempty"`
+	// DRSGroups is the DRS options the vm last joined its DRS group with
+	DRSGroups *vsphereutil.DRSOptions `json:"drsGroups,omitempty"`
+	// DeployedVM is the vm deployed from the content library item, until the creation task configured it
+	DeployedVM string `json:"deployedVM,omitempty"`
+}
+
+// extendedProviderStatusFromRawExtension unmarshals the extended fields of the JSON-encoded provider status
+func extendedProviderStatusFromRawExtension(rawExtension *runtime.RawExtension) (*extendedProviderStatus, error) {
+	status := &extendedProviderStatus{}
+	if rawExtension == nil || len(rawExtension.Raw) == 0 {
+		return status, nil
+	}
+
+	if err := json.Unmarshal(rawExtension.Raw, status); err != nil {
+		return nil, fmt.Errorf("error unmarshalling extended providerStatus: %v", err)
+	}
+	return status, nil
+}
+
+// rawExtensionFromExtendedProviderStatus marshals the provider status along with its extended fields
+func rawExtensionFromExtendedProviderStatus(status *extendedProviderStatus) (*runtime.RawExtension, error) {
+	if status == nil || status.VSphereMachineProviderStatus == nil {
+		return &runtime.RawExtension{}, nil
+	}
+
+	rawBytes, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling providerStatus: %v", err)
+	}
+
+	return &runtime.RawExtension{
+		Raw: rawBytes,
+	}, nil
+}
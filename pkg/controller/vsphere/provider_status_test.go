@@ -0,0 +1,67 @@
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestExtendedProviderStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	status := &machinev1.VSphereMachineProviderStatus{
+		TaskRef:       "task-2",
+		InstanceState: ptr.To("poweredOn"),
+	}
+	taskHistory := []taskRecord{
+		{Ref: "task-1", Operation: taskOperationCreate, State: types.TaskInfoStateSuccess, StartTime: metav1.Unix(1, 0)},
+		{Ref: "task-2", Operation: taskOperationPowerOn, State: types.TaskInfoStateRunning, StartTime: metav1.Unix(2, 0)},
+	}
+	dataDisks := []dataDiskRecord{
+		{Name: "images", ControllerType: vsphereutil.ControllerTypeSCSI, UnitNumber: 1, FileName: "[DS] machine/machine_1.vmdk"},
+	}
+
+	raw, err := rawExtensionFromExtendedProviderStatus(&extendedProviderStatus{
+		VSphereMachineProviderStatus: status,
+		TaskHistory:                  taskHistory,
+		DataDisks:                    dataDisks,
+		DRSGroups:                    &vsphereutil.DRSOptions{VMGroup: "workers", AntiAffinity: true},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(raw.Raw)).To(ContainSubstring(`"taskRef":"task-2"`))
+	g.Expect(string(raw.Raw)).To(ContainSubstring(`"taskHistory":[`))
+	g.Expect(string(raw.Raw)).To(ContainSubstring(`"dataDisks":[`))
+	g.Expect(string(raw.Raw)).To(ContainSubstring(`"drsGroups":{"vmGroup":"workers","antiAffinity":true}`))
+
+	parsedStatus, err := ProviderStatusFromRawExtension(raw)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(parsedStatus).To(Equal(status))
+
+	extended, err := extendedProviderStatusFromRawExtension(raw)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(extended.TaskHistory).To(HaveLen(2))
+	g.Expect(extended.TaskHistory[1].Ref).To(Equal("task-2"))
+	g.Expect(extended.TaskHistory[1].Operation).To(Equal(taskOperationPowerOn))
+	g.Expect(extended.TaskHistory[1].StartTime.Unix()).To(Equal(int64(2)))
+	g.Expect(extended.DataDisks).To(Equal(dataDisks))
+	g.Expect(extended.DRSGroups).To(Equal(&vsphereutil.DRSOptions{VMGroup: "workers", AntiAffinity: true}))
+
+	// A provider status without extended fields
+	raw, err = RawExtensionFromProviderStatus(status)
+	g.Expect(err).ToNot(HaveOccurred())
+	extended, err = extendedProviderStatusFromRawExtension(raw)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(extended.TaskHistory).To(BeEmpty())
+	g.Expect(extended.DataDisks).To(BeEmpty())
+	g.Expect(extended.DRSGroups).To(BeNil())
+
+	extended, err = extendedProviderStatusFromRawExtension(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(extended.TaskHistory).To(BeEmpty())
+}
@@ -35,6 +35,7 @@ import (
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
 )
 
 const (
@@ -81,6 +82,15 @@ func (r *Reconciler) create() error {
 		return fmt.Errorf("%v: failed validating machine provider spec: %w", r.machine.GetName(), err)
 	}
 
+	// An existing vm is adopted instead of cloning a vm
+	adoptedVM, err := vsphereutil.AdoptVM(r.machine)
+	if err != nil {
+		return machinecontroller.InvalidMachineConfiguration("%v: %v", r.machine.GetName(), err)
+	}
+	if adoptedVM != nil {
+		return r.adopt(adoptedVM)
+	}
+
 	if ipam.HasStaticIPConfiguration(r.providerSpec) {
 		if !r.staticIPFeatureGateEnabled {
 			return fmt.Errorf("%v: static IP/IPAM configuration is only available with the VSphereStaticIPs feature gate", r.machine.GetName())
@@ -120,13 +130,30 @@ func (r *Reconciler) create() error {
 			return fmt.Errorf("%v: not connected to a vCenter", r.machine.GetName())
 		}
 
+		// A vm deployed from a content library item is only powered on once configured, its configuration
+		// is resumed when the reconfigure task failed to start or was lost.
+		if r.deployedVM != "" {
+			configured, err := isDeployedVMConfigured(r.machineScope)
+			if err != nil {
+				return fmt.Errorf("%v: %w", r.machine.GetName(), err)
+			}
+			if configured {
+				r.deployedVM = ""
+			} else {
+				klog.Infof("%v: resuming the configuration of deployed vm %s", r.machine.GetName(), r.deployedVM)
+			}
+		}
+
 		// Attempt to power on instance in situation where we alredy cloned the instance and lost taskRef.
 		klog.V(4).Infof("%v: InstanceState is: %q", r.machine.GetName(), ptr.Deref(r.machineScope.providerStatus.InstanceState, ""))
-		if types.VirtualMachinePowerState(ptr.Deref(r.machineScope.providerStatus.InstanceState, "")) == types.VirtualMachinePowerStatePoweredOff {
+		if types.VirtualMachinePowerState(ptr.Deref(r.machineScope.providerStatus.InstanceState, "")) == types.VirtualMachinePowerStatePoweredOff && r.deployedVM == "" {
 			klog.Infof("Powering on cloned machine without taskID: %v", r.machine.Name)
 
 			task, err := powerOn(r.machineScope)
 			if err != nil {
+				if isThrottled(err) {
+					return fmt.Errorf("%v: failed to power on machine: %w", r.machine.GetName(), err)
+				}
 				metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
 					Name:      r.machine.Name,
 					Namespace: r.machine.Namespace,
@@ -143,12 +170,17 @@ func (r *Reconciler) create() error {
 				return fmt.Errorf("%v: failed to power on machine: %w", r.machine.GetName(), err)
 			}
 
+			recordTask(r.machineScope, task, taskOperationPowerOn)
 			return setProviderStatus(task, conditionSuccess(), r.machineScope, nil)
 		}
 
 		klog.Infof("%v: cloning", r.machine.GetName())
 		task, err := clone(r.machineScope)
 		if err != nil {
+			if isThrottled(err) {
+				// Not a failure, the clone is retried once the vCenter is not throttled anymore
+				return err
+			}
 			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
 				Name:      r.machine.Name,
 				Namespace: r.machine.Namespace,
@@ -162,11 +194,15 @@ func (r *Reconciler) create() error {
 			}
 			return err
 		}
+		recordTask(r.machineScope, task, taskOperationCreate)
 		return setProviderStatus(task, conditionSuccess(), r.machineScope, nil)
 	}
 
 	moTask, err := r.session.GetTask(r.Context, r.providerStatus.TaskRef)
 	if err != nil {
+		if isThrottled(err) {
+			return err
+		}
 		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
 			Name:      r.machine.Name,
 			Namespace: r.machine.Namespace,
@@ -180,6 +216,7 @@ func (r *Reconciler) create() error {
 		// TODO: change error message here to indicate this might be expected.
 		return fmt.Errorf("unexpected moTask nil")
 	}
+	updateTaskHistory(r.machineScope, moTask)
 
 	if taskIsFinished, err := taskIsFinished(moTask); err != nil {
 		if taskIsFinished {
@@ -206,11 +243,57 @@ func (r *Reconciler) create() error {
 		}
 	}
 
-	// if clone task finished successfully, power on the vm
-	if moTask.Info.DescriptionId == cloneVmTaskDescriptionId {
+	// if clone task, or the hardware upgrade following it, finished successfully, power on the vm
+	if operation := getTaskOperation(r.machineScope, moTask); operation == taskOperationCreate || operation == taskOperationUpgradeHardware {
+		// The vm deployed from a content library item is configured once its creation task finished
+		r.deployedVM = ""
+
+		vmRef, err := findVM(r.machineScope)
+		if err != nil {
+			return fmt.Errorf("%v: failed to find cloned vm: %w", r.machine.GetName(), err)
+		}
+		vm := &virtualMachine{
+			Context: r.machineScope.Context,
+			Obj:     object.NewVirtualMachine(r.machineScope.session.Client.Client, vmRef),
+			Ref:     vmRef,
+		}
+
+		// Record the files of the data disks before the vm is powered on and the cluster storage can attach disks
+		if err := vm.recordDataDiskFiles(r.dataDisks); err != nil {
+			return fmt.Errorf("%v: failed to find data disks: %w", r.machine.GetName(), err)
+		}
+
+		// Join the DRS groups before powering on the vm, so DRS places it according to the rules of the groups
+		if _, ok := r.machine.GetAnnotations()[vsphereutil.DRSAnnotation]; ok {
+			if err := r.reconcileDRSGroups(vm); err != nil {
+				return fmt.Errorf("%v: failed to reconcile DRS groups: %w", r.machine.GetName(), err)
+			}
+		}
+
+		// Upgrade the hardware version before the first power on, the vm is powered on once the upgrade finished
+		upgradeTask, err := r.upgradeClonedHWVersion(vm)
+		if err != nil {
+			if isThrottled(err) {
+				return fmt.Errorf("%v: failed to upgrade hardware version: %w", r.machine.GetName(), err)
+			}
+			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+				Name:      r.machine.Name,
+				Namespace: r.machine.Namespace,
+				Reason:    "Hardware upgrade finished with error",
+			})
+			return fmt.Errorf("%v: failed to upgrade hardware version: %w", r.machine.GetName(), err)
+		}
+		if upgradeTask != "" {
+			recordTask(r.machineScope, upgradeTask, taskOperationUpgradeHardware)
+			return setProviderStatus(upgradeTask, conditionSuccess(), r.machineScope, nil)
+		}
+
 		klog.Infof("Powering on cloned machine: %v", r.machine.Name)
 		task, err := powerOn(r.machineScope)
 		if err != nil {
+			if isThrottled(err) {
+				return err
+			}
 			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
 				Name:      r.machine.Name,
 				Namespace: r.machine.Namespace,
@@ -224,6 +307,7 @@ func (r *Reconciler) create() error {
 			}
 			return err
 		}
+		recordTask(r.machineScope, task, taskOperationPowerOn)
 		return setProviderStatus(task, conditionSuccess(), r.machineScope, nil)
 	}
 
@@ -250,12 +334,18 @@ func (r *Reconciler) update() error {
 			}
 		}
 		if moTask != nil {
+			updateTaskHistory(r.machineScope, moTask)
 			if taskIsFinished, err := taskIsFinished(moTask); err != nil {
 				metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
 					Name:      r.machine.Name,
 					Namespace: r.machine.Namespace,
 					Reason:    "Task finished with error",
 				})
+				// The failed step of a resize, or of a hardware upgrade, is retried on the next reconcile
+				if r.stepTaskFailed(err) {
+					klog.Warningf("%v: %v task %v finished with error, retrying its step: %v",
+						r.machine.GetName(), moTask.Info.DescriptionId, moTask.Reference().Value, err)
+				}
 				return fmt.Errorf("%v task %v finished with error: %w", moTask.Info.DescriptionId, moTask.Reference().Value, err)
 			} else if !taskIsFinished {
 				return fmt.Errorf("%v task %v has not finished", moTask.Info.DescriptionId, moTask.Reference().Value)
@@ -291,6 +381,55 @@ func (r *Reconciler) update() error {
 		return fmt.Errorf("failed to reconcile tags: %w", err)
 	}
 
+	// The update of the DRS groups of a running vm goes on in the background, the next update finds it applied
+	if err := r.reconcileDRSGroups(vm); err != nil && !errors.Is(err, errDRSUpdateInProgress) {
+		metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
+			Name:      r.machine.Name,
+			Namespace: r.machine.Namespace,
+			Reason:    "ReconcileDRSGroups finished with error",
+		})
+		return fmt.Errorf("failed to reconcile DRS groups: %w", err)
+	}
+
+	resizing, err := r.reconcileResize(vm)
+	if err != nil {
+		metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
+			Name:      r.machine.Name,
+			Namespace: r.machine.Namespace,
+			Reason:    "ReconcileResize finished with error",
+		})
+		return fmt.Errorf("failed to resize vm: %w", err)
+	}
+	if resizing {
+		return nil
+	}
+
+	upgrading, err := r.reconcileHWVersionUpgrade(vm)
+	if err != nil {
+		metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
+			Name:      r.machine.Name,
+			Namespace: r.machine.Namespace,
+			Reason:    "ReconcileHWVersionUpgrade finished with error",
+		})
+		return fmt.Errorf("failed to upgrade hardware version: %w", err)
+	}
+	if upgrading {
+		return nil
+	}
+
+	poweringOn, err := r.reconcileOutOfBandPowerOff(vm)
+	if err != nil {
+		metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
+			Name:      r.machine.Name,
+			Namespace: r.machine.Namespace,
+			Reason:    "ReconcileOutOfBandPowerOff finished with error",
+		})
+		return fmt.Errorf("failed to reconcile power state: %w", err)
+	}
+	if poweringOn {
+		return nil
+	}
+
 	if err := r.reconcileMachineWithCloudState(vm, r.providerStatus.TaskRef); err != nil {
 		metrics.RegisterFailedInstanceUpdate(&metrics.MachineLabels{
 			Name:      r.machine.Name,
@@ -348,8 +487,6 @@ func (r *Reconciler) exists() (bool, error) {
 
 func (r *Reconciler) delete() error {
 	if r.providerStatus.TaskRef != "" {
-		// TODO: We need to use a separate status field for the create and the
-		// delete taskref.
 		moTask, err := r.session.GetTask(r.Context, r.providerStatus.TaskRef)
 		if err != nil {
 			if !isRetrieveMONotFound(r.providerStatus.TaskRef, err) {
@@ -357,9 +494,12 @@ func (r *Reconciler) delete() error {
 			}
 		}
 		if moTask != nil {
+			updateTaskHistory(r.machineScope, moTask)
 			if taskIsFinished, err := taskIsFinished(moTask); err != nil {
-				// Check if latest task is not a task for vm cloning
-				if taskIsFinished && moTask.Info.DescriptionId != cloneVmTaskDescriptionId {
+				// Only the failed tasks of the deletion are retried, the ones of other operations, e.g. the clone,
+				// do not prevent the deletion. The operation of an unknown task is not known.
+				operation := getTaskOperation(r.machineScope, moTask)
+				if taskIsFinished && (operation == taskOperationDelete || operation == "") {
 					metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
 						Name:      r.machine.Name,
 						Namespace: r.machine.Namespace,
@@ -369,7 +509,7 @@ func (r *Reconciler) delete() error {
 					return fmt.Errorf("%v task %v finished with error: %w", moTask.Info.DescriptionId, moTask.Reference().Value, err)
 				} else {
 					klog.Warningf(
-						"TaskRef points to clone task which finished with error: %v. Proceeding with machine deletion", err,
+						"TaskRef points to %s task which finished with error: %v. Proceeding with machine deletion", operation, err,
 					)
 				}
 			} else if !taskIsFinished {
@@ -414,6 +554,7 @@ func (r *Reconciler) delete() error {
 		if err != nil {
 			return fmt.Errorf("%v: failed to power off vm: %w", r.machine.GetName(), err)
 		}
+		recordTask(r.machineScope, powerOffTaskRef, taskOperationDelete)
 		if err := setProviderStatus(powerOffTaskRef, conditionSuccess(), r.machineScope, vm); err != nil {
 			return fmt.Errorf("failed to set provider status: %w", err)
 		}
@@ -456,8 +597,9 @@ func (r *Reconciler) delete() error {
 	if err != nil {
 		return fmt.Errorf("%v: can not obtain virtual disks attached to the vm: %w", r.machine.GetName(), err)
 	}
-	// Currently, MAPI does not provide any API knobs to configure additional volumes for a VM.
-	// So, we are expecting the VM to have only one disk, which is OS disk.
+	// The data disks of the machine are destroyed along with the VM, like its OS disk.
+	// Besides them, we are expecting the VM to have at most one disk, which is OS disk if it is not named after the machine.
+	disks = filterOutMachineDataDisks(disks, r.dataDisks)
 	if len(disks) > 1 {
 		// If node drain was skipped we need to detach disks forcefully to prevent possible data corruption.
 		if drainSkipped {
@@ -482,6 +624,10 @@ func (r *Reconciler) delete() error {
 		)
 	}
 
+	if err := r.leaveDRSGroups(vm); err != nil {
+		return fmt.Errorf("%v: failed to leave DRS groups: %w", r.machine.GetName(), err)
+	}
+
 	task, err := vm.Obj.Destroy(r.Context)
 	if err != nil {
 		metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
@@ -492,6 +638,7 @@ func (r *Reconciler) delete() error {
 		return fmt.Errorf("%v: failed to destroy vm: %w", r.machine.GetName(), err)
 	}
 
+	recordTask(r.machineScope, task.Reference().Value, taskOperationDelete)
 	if err := setProviderStatus(task.Reference().Value, conditionSuccess(), r.machineScope, vm); err != nil {
 		return fmt.Errorf("failed to set provider status: %w", err)
 	}
@@ -533,13 +680,20 @@ func (r *Reconciler) reconcileMachineWithCloudState(vm *virtualMachine, taskRef
 		return err
 	}
 
-	klog.V(3).Infof("%v: reconciling network", r.machine.GetName())
-	if err := r.reconcileNetwork(vm); err != nil {
+	// The power state annotation is reconciled before the network, which can not be reconciled while the vm is
+	// powered off, so that it stays accurate
+	klog.V(3).Infof("%v: reconciling powerstate annotation", r.machine.GetName())
+	if err := r.reconcilePowerStateAnnontation(vm); err != nil {
 		return err
 	}
 
-	klog.V(3).Infof("%v: reconciling powerstate annotation", r.machine.GetName())
-	if err := r.reconcilePowerStateAnnontation(vm); err != nil {
+	klog.V(3).Infof("%v: reconciling firmware", r.machine.GetName())
+	if err := r.reconcileFirmware(vm); err != nil {
+		return err
+	}
+
+	klog.V(3).Infof("%v: reconciling network", r.machine.GetName())
+	if err := r.reconcileNetwork(vm); err != nil {
 		return err
 	}
 
@@ -604,7 +758,7 @@ func convertUUIDToProviderID(UUID string) (string, error) {
 func (r *Reconciler) reconcileNetwork(vm *virtualMachine) error {
 	currentNetworkStatusList, err := vm.getNetworkStatusList(r.session.Client.Client)
 	if err != nil {
-		return fmt.Errorf("error getting network status: %v", err)
+		return fmt.Errorf("error getting network status: %w", err)
 	}
 
 	//If the VM is powered on then issue requeues until all of the VM's
@@ -630,7 +784,7 @@ func (r *Reconciler) reconcileNetwork(vm *virtualMachine) error {
 
 	vmName, err := vm.Obj.ObjectName(vm.Context)
 	if err != nil {
-		return fmt.Errorf("error getting virtual machine name: %v", err)
+		return fmt.Errorf("error getting virtual machine name: %w", err)
 	}
 
 	ipAddrs = append(ipAddrs, corev1.NodeAddress{
@@ -645,7 +799,7 @@ func (r *Reconciler) reconcileNetwork(vm *virtualMachine) error {
 	if ipam.HasStaticIPConfiguration(r.providerSpec) {
 		err = ipam.VerifyIPAddressOwners(r.Context, r.client, r.machine, r.providerSpec.Network.Devices)
 		if err != nil {
-			return fmt.Errorf("error verifying ip address claims: %v", err)
+			return fmt.Errorf("error verifying ip address claims: %w", err)
 		}
 	}
 
@@ -682,6 +836,15 @@ func validateMachine(machine machinev1.Machine) error {
 func findVM(s *machineScope) (types.ManagedObjectReference, error) {
 	uuid := string(s.machine.UID)
 
+	if isAdopted(s) {
+		return findAdoptedVM(s)
+	}
+	if _, ok := s.machine.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; ok && ptr.Deref(s.machine.Spec.ProviderID, "") == "" && s.providerStatus.TaskRef == "" {
+		// The vm to adopt does not belong to the machine until it is adopted, even if it has the name of the machine.
+		// A machine with a providerID or a task is looked up as usual, the annotation does not hide its vm.
+		return types.ManagedObjectReference{}, errNotFound{instanceUUID: true, uuid: uuid}
+	}
+
 	vm, err := s.GetSession().FindVM(s.Context, uuid, s.machine.Name)
 	if err != nil {
 		if isNotFound(err) {
@@ -734,77 +897,143 @@ func getSubnetMask(prefix netip.Prefix) (string, error) {
 	return maskStr, nil
 }
 
-// getAddressesFromPool retrieves IP addresses and associated gateway from IP address pools
-func getAddressesFromPool(configIdx int, networkConfig machinev1.NetworkDeviceSpec, s *machineScope) ([]string, string, error) {
+// getAddressesFromPool retrieves IP addresses and associated gateways from IP address pools. The pools of a device
+// can be of both IP families, e.g. an IPv4 and an IPv6 pool for a dual-stack node, each providing its gateway.
+func getAddressesFromPool(configIdx int, networkConfig machinev1.NetworkDeviceSpec, s *machineScope) ([]string, []string, error) {
 	addresses := []string{}
-	var gateway string
+	gateways := []string{}
 	for poolIdx := range networkConfig.AddressesFromPools {
 		claimName := ipam.GetIPAddressClaimName(s.machine, configIdx, poolIdx)
 		ipAddress, err := ipam.RetrieveBoundIPAddress(s.Context, s.client, s.machine, claimName)
 		if err != nil {
-			return nil, "", fmt.Errorf("error retrieving bound IP address: %w", err)
+			return nil, nil, fmt.Errorf("error retrieving bound IP address: %w", err)
 		}
 		ipAddressSpec := ipAddress.Spec
 		addresses = append(addresses, fmt.Sprintf("%s/%d", ipAddressSpec.Address, ipAddressSpec.Prefix))
 		if len(ipAddressSpec.Gateway) > 0 {
-			gateway = ipAddressSpec.Gateway
+			address, err := netip.ParseAddr(ipAddressSpec.Address)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing address of IPAddress %s: %w", ipAddress.Name, err)
+			}
+			gateway, err := netip.ParseAddr(ipAddressSpec.Gateway)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing gateway of IPAddress %s: %w", ipAddress.Name, err)
+			}
+			if vsphereutil.AddressFamily(address) != vsphereutil.AddressFamily(gateway) {
+				return nil, nil, fmt.Errorf("gateway %s of IPAddress %s is not an %s address like %s",
+					ipAddressSpec.Gateway, ipAddress.Name, vsphereutil.AddressFamily(address), ipAddressSpec.Address)
+			}
+			gateways = append(gateways, ipAddressSpec.Gateway)
+		}
+	}
+	return addresses, gateways, nil
+}
+
+// getDeviceGateways returns the gateway of each IP family of a network device. The gateways of its IP address pools
+// take precedence over the gateway of the provider spec, which takes precedence over the gateways of the
+// network devices annotation.
+func getDeviceGateways(gatewaysFromPool []string, networkConfig machinev1.NetworkDeviceSpec, options vsphereutil.NetworkDeviceOptions) (map[string]netip.Addr, error) {
+	candidates := append([]string{}, gatewaysFromPool...)
+	candidates = append(candidates, networkConfig.Gateway)
+	candidates = append(candidates, options.Gateways...)
+
+	gateways := map[string]netip.Addr{}
+	for _, gateway := range candidates {
+		if len(gateway) == 0 {
+			continue
+		}
+		gatewayIp, err := netip.ParseAddr(gateway)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing gateway address: %w", err)
+		}
+		family := vsphereutil.AddressFamily(gatewayIp)
+		if _, ok := gateways[family]; !ok {
+			gateways[family] = gatewayIp
 		}
 	}
-	return addresses, gateway, nil
+	return gateways, nil
 }
 
-// constructKargsFromNetworkConfig builds a string which comprises ip and nameserver stanzas
+// constructKargsFromNetworkConfig builds a string which comprises ip, rd.route and nameserver stanzas
 // which are consumed by guestinfo.afterburn.initrd.network-kargs.
+// The default gateway of each IP family is the gateway of the first device with an address of the family, the
+// secondary devices reach other networks through their static routes only.
 func constructKargsFromNetworkConfig(s *machineScope) (string, error) {
 	outKargs := ""
 	networkConfigs := s.providerSpec.Network.Devices
+	deviceOptions, err := vsphereutil.MachineNetworkDevices(s.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if len(deviceOptions) > len(networkConfigs) {
+		return "", machinecontroller.InvalidMachineConfiguration("%s annotation has options for %d network devices, but the machine has %d",
+			vsphereutil.NetworkDevicesAnnotation, len(deviceOptions), len(networkConfigs))
+	}
+
+	// With the network devices annotation, only the first device with a gateway of each IP family has a default gateway
+	// and the other devices reach the networks beyond their subnets through their routes. Without it, the gateway of
+	// every device is passed as before.
+	_, singleDefaultGateway := s.machine.GetAnnotations()[vsphereutil.NetworkDevicesAnnotation]
+	// the index of the device which has the default gateway of each IP family
+	defaultGatewayDevices := map[string]int{}
 	for configIdx, networkConfig := range networkConfigs {
+		var options vsphereutil.NetworkDeviceOptions
+		if configIdx < len(deviceOptions) {
+			options = deviceOptions[configIdx]
+		}
+
 		// retrieve any IP addresses assigned by an IP address pool
-		addressesFromPool, gatewayFromPool, err := getAddressesFromPool(configIdx, networkConfig, s)
+		addressesFromPool, gatewaysFromPool, err := getAddressesFromPool(configIdx, networkConfig, s)
 		if err != nil {
 			return "", fmt.Errorf("error getting addresses from IP pool: %w", err)
 		}
-		var gateway string
-		if len(gatewayFromPool) > 0 {
-			gateway = gatewayFromPool
-		} else {
-			gateway = networkConfig.Gateway
-		}
-
-		var gatewayIp netip.Addr
-		if len(gateway) > 0 {
-			gatewayIp, err = netip.ParseAddr(gateway)
-			if err != nil {
-				return "", fmt.Errorf("error parsing gateway address: %w", err)
-			}
+		gateways, err := getDeviceGateways(gatewaysFromPool, networkConfig, options)
+		if err != nil {
+			return "", err
 		}
 
 		ipAddresses := []string{}
 		ipAddresses = append(ipAddresses, networkConfig.IPAddrs...)
 		ipAddresses = append(ipAddresses, addressesFromPool...)
 
-		// construct IP address network kargs for each IP address
+		prefixes := []netip.Prefix{}
+		families := map[string]bool{}
 		for _, address := range ipAddresses {
 			prefix, err := netip.ParsePrefix(address)
 			if err != nil {
 				return "", fmt.Errorf("error parsing prefix: %w", err)
 			}
+			prefixes = append(prefixes, prefix)
+			families[vsphereutil.AddressFamily(prefix.Addr())] = true
+		}
+		for family := range gateways {
+			if _, ok := defaultGatewayDevices[family]; !ok && families[family] {
+				defaultGatewayDevices[family] = configIdx
+			}
+		}
+
+		// construct IP address network kargs for each IP address
+		for _, prefix := range prefixes {
 			var ipStr, gatewayStr, maskStr string
 			addr := prefix.Addr()
+			gatewayIp, hasGateway := gateways[vsphereutil.AddressFamily(addr)]
+			if singleDefaultGateway {
+				hasGateway = hasGateway && defaultGatewayDevices[vsphereutil.AddressFamily(addr)] == configIdx
+			}
 			// IPv6 addresses must be wrapped in [] for dracut network kargs
 			if addr.Is6() {
 				maskStr = fmt.Sprintf("%d", prefix.Bits())
 				ipStr = fmt.Sprintf("[%s]", addr.String())
-				if len(gateway) > 0 && gatewayIp.Is6() {
-					gatewayStr = fmt.Sprintf("[%s]", gateway)
+				if hasGateway {
+					gatewayStr = fmt.Sprintf("[%s]", gatewayIp.String())
 				}
 			} else if addr.Is4() {
 				maskStr, err = getSubnetMask(prefix)
 				if err != nil {
 					return "", fmt.Errorf("error getting subnet mask: %w", err)
 				}
-				if len(gateway) > 0 && gatewayIp.Is4() {
-					gatewayStr = gateway
+				if hasGateway {
+					gatewayStr = gatewayIp.String()
 				}
 				ipStr = addr.String()
 			} else {
@@ -814,6 +1043,27 @@ func constructKargsFromNetworkConfig(s *machineScope) (string, error) {
 			outKargs = outKargs + fmt.Sprintf("ip=%s::%s:%s:::none ", ipStr, gatewayStr, maskStr)
 		}
 
+		// construct route network karg for each static route of the device
+		for _, route := range options.Routes {
+			to, err := netip.ParsePrefix(route.To)
+			if err != nil {
+				return "", fmt.Errorf("error parsing route destination: %w", err)
+			}
+			via, err := netip.ParseAddr(route.Via)
+			if err != nil {
+				return "", fmt.Errorf("error parsing route gateway: %w", err)
+			}
+			if !families[vsphereutil.AddressFamily(via)] {
+				return "", machinecontroller.InvalidMachineConfiguration("network device %d has a route to %s, but no %s address",
+					configIdx, route.To, vsphereutil.AddressFamily(via))
+			}
+			if via.Is6() {
+				outKargs = outKargs + fmt.Sprintf("rd.route=[%s]:[%s] ", to.String(), via.String())
+			} else {
+				outKargs = outKargs + fmt.Sprintf("rd.route=%s:%s ", to.String(), via.String())
+			}
+		}
+
 		// construct nameserver network karg for each defined nameserver
 		for _, nameserver := range networkConfig.Nameservers {
 			ip := net.ParseIP(nameserver)
@@ -845,39 +1095,20 @@ func getHwVersion(ctx context.Context, vm *object.VirtualMachine) (int, error) {
 	return parsedVersion, nil
 }
 
-func clone(s *machineScope) (string, error) {
-	userData, err := s.GetUserData()
-	if err != nil {
-		return "", err
-	}
-
+// getCloneTemplate returns the template of the machine, along with the snapshot to create a linked clone from, if any.
+func getCloneTemplate(s *machineScope) (*object.VirtualMachine, *types.ManagedObjectReference, error) {
 	vmTemplate, err := s.GetSession().FindVM(*s, "", s.providerSpec.Template)
 	if err != nil {
 		const multipleFoundMsg = "multiple templates found, specify one in config"
 		const notFoundMsg = "template not found, specify valid value"
 		defaultError := fmt.Errorf("unable to get template %q: %w", s.providerSpec.Template, err)
-		return "", handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
+		return nil, nil, handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
 	}
 
-	hwVersion, err := getHwVersion(s.Context, vmTemplate)
-	if err != nil {
-		return "", machinecontroller.InvalidMachineConfiguration(
-			"Unable to detect machine template HW version for machine '%s': %v", s.machine.GetName(), err,
-		)
-	}
-	if hwVersion < minimumHWVersion {
-		return "", machinecontroller.InvalidMachineConfiguration(
-			fmt.Sprintf(
-				"Hardware lower than %d is not supported, clone stopped. "+
-					"Detected machine template version is %d. "+
-					"Please update machine template: https://docs.openshift.com/container-platform/latest/updating/updating_a_cluster/updating-hardware-on-nodes-running-on-vsphere.html",
-				minimumHWVersion, hwVersion,
-			),
-		)
+	if err := checkHwVersion(s, vmTemplate); err != nil {
+		return nil, nil, err
 	}
 
-	// Default clone type is FullClone, having snapshot on clonee template will cause incorrect disk sizing.
-	diskMoveType := fullCloneDiskMoveType
 	var snapshotRef *types.ManagedObjectReference
 
 	// If a linked clone is requested then a MoRef for a snapshot must be
@@ -892,7 +1123,7 @@ func clone(s *machineScope) (string, error) {
 			klog.V(3).Infof("%v: no snapshot name provided, getting snapshot using template", s.machine.GetName())
 			var vm mo.VirtualMachine
 			if err := vmTemplate.Properties(s.Context, vmTemplate.Reference(), []string{"snapshot"}, &vm); err != nil {
-				return "", fmt.Errorf("error getting snapshot information for template %s: %w", vmTemplate.Name(), err)
+				return nil, nil, fmt.Errorf("error getting snapshot information for template %s: %w", vmTemplate.Name(), err)
 			}
 
 			if vm.Snapshot != nil {
@@ -902,15 +1133,84 @@ func clone(s *machineScope) (string, error) {
 			klog.V(3).Infof("%v: searching for snapshot by name %s", s.machine.GetName(), s.providerSpec.Snapshot)
 			var err error
 			snapshotRef, err = vmTemplate.FindSnapshot(s.Context, s.providerSpec.Snapshot)
+			if isThrottled(err) {
+				return nil, nil, fmt.Errorf("error finding snapshot %s of template %s: %w", s.providerSpec.Snapshot, vmTemplate.Name(), err)
+			}
 			if err != nil {
 				// Maybe return an error there?
 				klog.V(3).Infof("%v: failed to find snapshot %s, fallback to FullClone", s.machine.GetName(), s.providerSpec.Snapshot)
 			}
 		}
+	}
+
+	return vmTemplate, snapshotRef, nil
+}
+
+// checkHwVersion checks the hardware version of the template, or of the vm deployed from a content library item
+func checkHwVersion(s *machineScope, vm *object.VirtualMachine) error {
+	hwVersion, err := getHwVersion(s.Context, vm)
+	if isThrottled(err) {
+		return err
+	}
+	if err != nil {
+		return machinecontroller.InvalidMachineConfiguration(
+			"Unable to detect machine template HW version for machine '%s': %v", s.machine.GetName(), err,
+		)
+	}
+	if hwVersion < minimumHWVersion {
+		return machinecontroller.InvalidMachineConfiguration(
+			fmt.Sprintf(
+				"Hardware lower than %d is not supported, clone stopped. "+
+					"Detected machine template version is %d. "+
+					"Please update machine template: https://docs.openshift.com/container-platform/latest/updating/updating_a_cluster/updating-hardware-on-nodes-running-on-vsphere.html",
+				minimumHWVersion, hwVersion,
+			),
+		)
+	}
+	return nil
+}
+
+func clone(s *machineScope) (string, error) {
+	userData, err := s.GetUserData()
+	if err != nil {
+		return "", err
+	}
+
+	libraryItem, err := vsphereutil.ContentLibraryItemSource(s.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+
+	firmwareOptions, err := vsphereutil.Firmware(s.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	advancedSettings, err := vsphereutil.MachineExtraConfig(s.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	resourceAllocation, err := vsphereutil.MachineResourceAllocation(s.machine)
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
 
+	// Default clone type is FullClone, having snapshot on clonee template will cause incorrect disk sizing.
+	diskMoveType := fullCloneDiskMoveType
+	var vmTemplate *object.VirtualMachine
+	var snapshotRef *types.ManagedObjectReference
+	if libraryItem == nil {
+		vmTemplate, snapshotRef, err = getCloneTemplate(s)
+		if err != nil {
+			return "", err
+		}
 		if snapshotRef != nil {
 			diskMoveType = linkCloneDiskMoveType
 		}
+	} else if s.providerSpec.CloneMode == machinev1.LinkedClone {
+		// Content library items are deployed as new vms, they have no snapshot to create child disks from
+		return "", machinecontroller.InvalidMachineConfiguration(
+			"%s clone mode is not supported when deploying from content library item %q, use %s",
+			machinev1.LinkedClone, libraryItem, machinev1.FullClone)
 	}
 
 	var folderPath, datastorePath, resourcepoolPath string
@@ -928,14 +1228,6 @@ func clone(s *machineScope) (string, error) {
 		return "", handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
 	}
 
-	datastore, err := s.GetSession().Finder.DatastoreOrDefault(s, datastorePath)
-	if err != nil {
-		const multipleFoundMsg = "multiple datastores found, specify one in config"
-		const notFoundMsg = "datastore not found, specify valid value"
-		defaultError := fmt.Errorf("unable to get datastore for %q: %w", datastorePath, err)
-		return "", handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
-	}
-
 	resourcepool, err := s.GetSession().Finder.ResourcePoolOrDefault(s, resourcepoolPath)
 	if err != nil {
 		const multipleFoundMsg = "multiple resource pools found, specify one in config"
@@ -944,6 +1236,41 @@ func clone(s *machineScope) (string, error) {
 		return "", handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
 	}
 
+	// With a storage policy, the datastore is chosen among the ones compatible with the policy,
+	// and the policy is applied to the home directory and the disks of the vm.
+	var datastoreRef types.ManagedObjectReference
+	var storagePolicyPlacement *metav1.Condition
+	var storageProfileID string
+	var storageProfile []types.BaseVirtualMachineProfileSpec
+	if storagePolicy := vsphereutil.StoragePolicy(s.machine); storagePolicy != "" {
+		if err := vsphereutil.ValidateStoragePolicy(storagePolicy, datastorePath); err != nil {
+			return "", machinecontroller.InvalidMachineConfiguration("%v", err)
+		}
+		storageProfileID, err = s.GetSession().GetStoragePolicyID(s, storagePolicy)
+		if err != nil {
+			return "", fmt.Errorf("unable to get storage policy %q: %w", storagePolicy, err)
+		}
+		summary, err := selectStoragePolicyDatastore(s, resourcepool, storagePolicy, storageProfileID)
+		if err != nil {
+			return "", err
+		}
+		datastoreRef = *summary.Datastore
+		condition := conditionStoragePolicyPlacement(storagePolicy, summary.Name)
+		storagePolicyPlacement = &condition
+		storageProfile = []types.BaseVirtualMachineProfileSpec{
+			&types.VirtualMachineDefinedProfileSpec{ProfileId: storageProfileID},
+		}
+	} else {
+		datastore, err := s.GetSession().Finder.DatastoreOrDefault(s, datastorePath)
+		if err != nil {
+			const multipleFoundMsg = "multiple datastores found, specify one in config"
+			const notFoundMsg = "datastore not found, specify valid value"
+			defaultError := fmt.Errorf("unable to get datastore for %q: %w", datastorePath, err)
+			return "", handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
+		}
+		datastoreRef = datastore.Reference()
+	}
+
 	numCPUs := s.providerSpec.NumCPUs
 
 	numCoresPerSocket := s.providerSpec.NumCoresPerSocket
@@ -951,9 +1278,24 @@ func clone(s *machineScope) (string, error) {
 		numCoresPerSocket = numCPUs
 	}
 
-	devices, err := vmTemplate.Device(s.Context)
+	// A content library item is deployed first, and configured like a clone afterwards,
+	// the devices of the deployed vm replacing the ones of the template.
+	var deployedVM *object.VirtualMachine
+	source := vmTemplate
+	if libraryItem != nil {
+		deployedVM, err = deployContentLibraryItem(s, libraryItem, folder, resourcepool, datastoreRef, storageProfileID)
+		if err != nil {
+			return "", err
+		}
+		if err := checkHwVersion(s, deployedVM); err != nil {
+			return "", err
+		}
+		source = deployedVM
+	}
+
+	devices, err := source.Device(s.Context)
 	if err != nil {
-		return "", fmt.Errorf("error getting devices %v", err)
+		return "", fmt.Errorf("error getting devices: %w", err)
 	}
 
 	// Create a new list of device specs for cloning the VM.
@@ -968,6 +1310,12 @@ func clone(s *machineScope) (string, error) {
 		deviceSpecs = append(deviceSpecs, diskSpec)
 	}
 
+	dataDiskSpecs, dataDisks, err := getDataDiskSpecs(s, devices, storageProfile)
+	if err != nil {
+		return "", fmt.Errorf("error getting data disk specs: %w", err)
+	}
+	deviceSpecs = append(deviceSpecs, dataDiskSpecs...)
+
 	klog.V(3).Infof("Getting network devices")
 	networkDevices, err := getNetworkDevices(s, resourcepool, devices)
 	if err != nil {
@@ -976,7 +1324,7 @@ func clone(s *machineScope) (string, error) {
 
 	deviceSpecs = append(deviceSpecs, networkDevices...)
 
-	extraConfig := []types.BaseOptionValue{}
+	extraConfig := getExtraConfigOptionValues(advancedSettings)
 
 	extraConfig = append(extraConfig, IgnitionConfig(userData)...)
 	extraConfig = append(extraConfig, &types.OptionValue{
@@ -1018,7 +1366,7 @@ func clone(s *machineScope) (string, error) {
 			MemoryMB:          s.providerSpec.MemoryMiB,
 		},
 		Location: types.VirtualMachineRelocateSpec{
-			Datastore:    types.NewReference(datastore.Reference()),
+			Datastore:    types.NewReference(datastoreRef),
 			Folder:       types.NewReference(folder.Reference()),
 			Pool:         types.NewReference(resourcepool.Reference()),
 			DiskMoveType: diskMoveType,
@@ -1026,11 +1374,40 @@ func clone(s *machineScope) (string, error) {
 		PowerOn:  false, // Create powered off machine, for power it on later in "create" procedure
 		Snapshot: snapshotRef,
 	}
+	if storageProfile != nil {
+		spec.Location.Profile = storageProfile
+		spec.Location.Disk = getStoragePolicyDiskLocators(devices, datastoreRef, storageProfile)
+	}
+	if firmwareOptions != nil {
+		if err := configureFirmware(s, source, devices, spec.Config, firmwareOptions); err != nil {
+			return "", err
+		}
+	}
+	if resourceAllocation != nil {
+		configureResourceAllocation(spec.Config, resourceAllocation)
+	}
 
-	task, err := vmTemplate.Clone(s, folder, s.machine.GetName(), spec)
-	if err != nil {
-		return "", fmt.Errorf("error triggering clone op for machine %v: %w", s, err)
+	// The task counts against the maximum number of tasks in flight on the vCenter
+	var task *object.Task
+	if deployedVM != nil {
+		task, err = s.session.StartTask(func() (*object.Task, error) {
+			return deployedVM.Reconfigure(s, *spec.Config)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error triggering reconfigure op for machine %v: %w", s, err)
+		}
+	} else {
+		task, err = s.session.StartTask(func() (*object.Task, error) {
+			return vmTemplate.Clone(s, folder, s.machine.GetName(), spec)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error triggering clone op for machine %v: %w", s, err)
+		}
+	}
+	if storagePolicyPlacement != nil {
+		s.providerStatus.Conditions = setConditions(*storagePolicyPlacement, s.providerStatus.Conditions)
 	}
+	s.dataDisks = dataDisks
 	taskVal := task.Reference().Value
 	klog.V(3).Infof("%v: running task: %+v", s.machine.GetName(), taskVal)
 	return taskVal, nil
@@ -1088,6 +1465,161 @@ func getDiskSpec(s *machineScope, devices object.VirtualDeviceList) (types.BaseV
 	}, nil
 }
 
+// getDataDiskSpecs returns the specs creating the data disks of the machine, along with the
+// specs adding the controllers they are attached to when the template does not have them,
+// and the records of the data disks.
+// Disks without a datastore or storage policy of their own get the storage profile of the vm, if any.
+func getDataDiskSpecs(s *machineScope, devices object.VirtualDeviceList, storageProfile []types.BaseVirtualMachineProfileSpec) ([]types.BaseVirtualDeviceConfigSpec, []dataDiskRecord, error) {
+	dataDisks, err := vsphereutil.DataDisks(s.machine)
+	if err != nil {
+		return nil, nil, machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+
+	var specs []types.BaseVirtualDeviceConfigSpec
+	var records []dataDiskRecord
+	for _, dataDisk := range dataDisks {
+		controller, err := findDataDiskController(devices, dataDisk.Controller)
+		if err != nil {
+			return nil, nil, err
+		}
+		if controller == nil {
+			controllerDevice, err := createDataDiskController(devices, dataDisk.Controller)
+			if err != nil {
+				return nil, nil, err
+			}
+			specs = append(specs, &types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+				Device:    controllerDevice,
+			})
+			devices = append(devices, controllerDevice)
+			controller = controllerDevice.(types.BaseVirtualController)
+		}
+
+		backing := &types.VirtualDiskFlatVer2BackingInfo{
+			DiskMode:        string(types.VirtualDiskModePersistent),
+			ThinProvisioned: ptr.To(dataDisk.ProvisioningMode == vsphereutil.ProvisioningModeThin),
+			EagerlyScrub:    ptr.To(dataDisk.ProvisioningMode == vsphereutil.ProvisioningModeEagerlyZeroed),
+		}
+		// Without a datastore, the disk is placed in the directory of the vm on its datastore
+		if dataDisk.Datastore != "" {
+			datastore, err := s.GetSession().Finder.Datastore(s, dataDisk.Datastore)
+			if err != nil {
+				const multipleFoundMsg = "multiple datastores found for data disk, specify one in config"
+				const notFoundMsg = "data disk datastore not found, specify valid value"
+				defaultError := fmt.Errorf("unable to get datastore for data disk %q: %w", dataDisk.Name, err)
+				return nil, nil, handleVSphereError(multipleFoundMsg, notFoundMsg, defaultError, err)
+			}
+			backing.FileName = fmt.Sprintf("[%s]", datastore.Name())
+			backing.Datastore = types.NewReference(datastore.Reference())
+		}
+
+		disk := &types.VirtualDisk{
+			VirtualDevice: types.VirtualDevice{
+				Key:     devices.NewKey(),
+				Backing: backing,
+			},
+			CapacityInKB: int64(dataDisk.SizeGiB) * 1024 * 1024,
+		}
+		if err := assignDataDiskUnit(devices, disk, controller, dataDisk); err != nil {
+			return nil, nil, err
+		}
+
+		spec := &types.VirtualDeviceConfigSpec{
+			Operation:     types.VirtualDeviceConfigSpecOperationAdd,
+			FileOperation: types.VirtualDeviceConfigSpecFileOperationCreate,
+			Device:        disk,
+		}
+		switch {
+		case dataDisk.StoragePolicy != "":
+			profileID, err := s.GetSession().GetStoragePolicyID(s, dataDisk.StoragePolicy)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to get storage policy %q of data disk %q: %w", dataDisk.StoragePolicy, dataDisk.Name, err)
+			}
+			spec.Profile = []types.BaseVirtualMachineProfileSpec{
+				&types.VirtualMachineDefinedProfileSpec{ProfileId: profileID},
+			}
+		case dataDisk.Datastore == "":
+			spec.Profile = storageProfile
+		}
+
+		klog.V(3).Infof("%v: adding %s data disk %q of %dGiB", s.machine.GetName(), dataDisk.ProvisioningMode, dataDisk.Name, dataDisk.SizeGiB)
+		specs = append(specs, spec)
+		devices = append(devices, disk)
+		records = append(records, dataDiskRecord{
+			Name:           dataDisk.Name,
+			ControllerType: dataDisk.Controller.Type,
+			BusNumber:      dataDisk.Controller.BusNumber,
+			UnitNumber:     *disk.UnitNumber,
+		})
+	}
+	return specs, records, nil
+}
+
+// findDataDiskController returns the controller of the given type and bus number, if the device list has it
+func findDataDiskController(devices object.VirtualDeviceList, c *vsphereutil.DataDiskController) (types.BaseVirtualController, error) {
+	for _, device := range devices {
+		switch controller := device.(type) {
+		case types.BaseVirtualSCSIController:
+			if c.Type == vsphereutil.ControllerTypeSCSI && controller.GetVirtualSCSIController().BusNumber == c.BusNumber {
+				return device.(types.BaseVirtualController), nil
+			}
+		case *types.VirtualNVMEController:
+			if c.Type == vsphereutil.ControllerTypeNVMe && controller.BusNumber == c.BusNumber {
+				return controller, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// createDataDiskController returns a new controller of the given type and bus number
+func createDataDiskController(devices object.VirtualDeviceList, c *vsphereutil.DataDiskController) (types.BaseVirtualDevice, error) {
+	switch c.Type {
+	case vsphereutil.ControllerTypeNVMe:
+		device, err := devices.CreateNVMEController()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create NVMe controller: %w", err)
+		}
+		device.(*types.VirtualNVMEController).BusNumber = c.BusNumber
+		return device, nil
+	default:
+		device, err := devices.CreateSCSIController("pvscsi")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create SCSI controller: %w", err)
+		}
+		controller := device.(types.BaseVirtualSCSIController).GetVirtualSCSIController()
+		controller.BusNumber = c.BusNumber
+		controller.SharedBus = types.VirtualSCSISharingNoSharing
+		return device, nil
+	}
+}
+
+// assignDataDiskUnit attaches the disk to the controller, on the requested unit number or on the first free one
+func assignDataDiskUnit(devices object.VirtualDeviceList, disk *types.VirtualDisk, controller types.BaseVirtualController, dataDisk vsphereutil.DataDisk) error {
+	unitNumber := dataDisk.Controller.UnitNumber
+	if unitNumber == nil {
+		devices.AssignController(disk, controller)
+		if *disk.UnitNumber < 0 {
+			return machinecontroller.InvalidMachineConfiguration(
+				"data disk %q: %s controller %d has no free unit", dataDisk.Name, dataDisk.Controller.Type, dataDisk.Controller.BusNumber)
+		}
+		return nil
+	}
+
+	controllerKey := controller.GetVirtualController().Key
+	for _, device := range devices {
+		d := device.GetVirtualDevice()
+		if d.ControllerKey == controllerKey && d.UnitNumber != nil && *d.UnitNumber == *unitNumber {
+			return machinecontroller.InvalidMachineConfiguration(
+				"data disk %q: unit %d of %s controller %d is already used by the template",
+				dataDisk.Name, *unitNumber, dataDisk.Controller.Type, dataDisk.Controller.BusNumber)
+		}
+	}
+	disk.ControllerKey = controllerKey
+	disk.UnitNumber = ptr.To(*unitNumber)
+	return nil
+}
+
 func getNetworkDevices(s *machineScope, resourcepool *object.ResourcePool, devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
 	var networkDevices []types.BaseVirtualDeviceConfigSpec
 	// Remove any existing NICs
@@ -1544,12 +2076,15 @@ func (vm *virtualMachine) getAttachedDisks() ([]attachedDisk, error) {
 	}
 
 	for _, disk := range devices.SelectByType((*types.VirtualDisk)(nil)) {
-		backingInfo := disk.GetVirtualDevice().Backing.(types.BaseVirtualDeviceFileBackingInfo).(*types.VirtualDiskFlatVer2BackingInfo)
-		attachedDiskList = append(attachedDiskList, attachedDisk{
-			device:   disk.(*types.VirtualDisk),
-			fileName: backingInfo.FileName,
-			diskMode: backingInfo.DiskMode,
-		})
+		attached := attachedDisk{device: disk.(*types.VirtualDisk)}
+		// Disks of other backing types, e.g. RDMs or sparse disks, are not necessarily flat files
+		if backingInfo, ok := disk.GetVirtualDevice().Backing.(types.BaseVirtualDeviceFileBackingInfo); ok {
+			attached.fileName = backingInfo.GetVirtualDeviceFileBackingInfo().FileName
+		}
+		if backingInfo, ok := disk.GetVirtualDevice().Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok {
+			attached.diskMode = backingInfo.DiskMode
+		}
+		attachedDiskList = append(attachedDiskList, attached)
 	}
 
 	return attachedDiskList, nil
@@ -1561,6 +2096,10 @@ func (vm *virtualMachine) detachDisks(disks []attachedDisk) error {
 	for _, disk := range disks {
 		klog.V(3).Infof("Detaching disk associated with file %v", disk.fileName)
 		if err := vm.Obj.RemoveDevice(vm.Context, true, disk.device); err != nil {
+			if isThrottled(err) {
+				// The other disks are detached once the vCenter is not throttled anymore
+				return fmt.Errorf("failed to detach disk associated with file %v: %w", disk.fileName, err)
+			}
 			errList = append(errList, err)
 			klog.Errorf("Failed to detach disk associated with file %v ", disk.fileName)
 		} else {
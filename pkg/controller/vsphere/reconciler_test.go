@@ -24,15 +24,19 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/library"
 	"github.com/vmware/govmomi/vapi/rest"
 	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vapi/vcenter"
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
 
 	corev1 "k8s.io/api/core/v1"
@@ -40,6 +44,7 @@ import (
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	vsphere "k8s.io/cloud-provider-vsphere/pkg/common/config"
+	"k8s.io/utils/ptr"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
@@ -48,8 +53,10 @@ import (
 
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/controller/vsphere/session"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
 	ipamv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 
+	_ "github.com/vmware/govmomi/pbm/simulator"
 	_ "github.com/vmware/govmomi/vapi/simulator"
 )
 
@@ -67,6 +74,20 @@ func init() {
 
 type simulatorModelOption func(m *simulator.Model)
 
+// throttlingRoundTripper throttles the requests sent to the vCenter once the given number of requests were sent
+type throttlingRoundTripper struct {
+	next     soap.RoundTripper
+	requests int
+}
+
+func (rt *throttlingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	if rt.requests <= 0 {
+		return &session.ThrottledError{Server: "vcenter", Reason: session.ThrottledReasonRateLimit, RetryAfter: time.Second}
+	}
+	rt.requests--
+	return rt.next.RoundTrip(ctx, req, res)
+}
+
 func initSimulator(t *testing.T) (*simulator.Model, *session.Session, *simulator.Server) {
 	model := simulator.VPX()
 	model.Host = 0
@@ -543,6 +564,453 @@ func TestClone(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Test data disks", func(t *testing.T) {
+		providerSpec := &machinev1.VSphereMachineProviderSpec{
+			CredentialsSecret: &corev1.LocalObjectReference{
+				Name: "test",
+			},
+			Workspace: &machinev1.Workspace{
+				Server:    server.URL.Host,
+				Datastore: "LocalDS_0",
+			},
+			DiskGiB:  diskSize,
+			Template: vm.Name,
+			UserDataSecret: &corev1.LocalObjectReference{
+				Name: userDataSecretName,
+			},
+		}
+
+		cases := []struct {
+			name      string
+			dataDisks string
+			errMsg    string
+		}{
+			{
+				name: "Clone with data disks",
+				dataDisks: `[
+					{"name": "images", "sizeGiB": 10},
+					{"name": "logs", "sizeGiB": 1, "datastore": "/DC0/datastore/LocalDS_0", "provisioningMode": "EagerlyZeroed",
+					 "controller": {"type": "NVMe", "busNumber": 1, "unitNumber": 2}},
+					{"name": "data", "sizeGiB": 2, "storagePolicy": "vSAN Default Storage Policy", "provisioningMode": "Thick",
+					 "controller": {"busNumber": 2}}
+				]`,
+			},
+			{
+				name:      "Invalid data disks",
+				dataDisks: `[{"name": "images"}]`,
+				errMsg:    "error getting data disk specs: invalid machine.openshift.io/vsphere-data-disks annotation: disk \"images\": sizeGiB must be between 1 and 63488, got 0",
+			},
+			{
+				name:      "Data disk datastore not found",
+				dataDisks: `[{"name": "images", "sizeGiB": 10, "datastore": "invalid"}]`,
+				errMsg:    "error getting data disk specs: data disk datastore not found, specify valid value",
+			},
+			{
+				name:      "Data disk storage policy not found",
+				dataDisks: `[{"name": "images", "sizeGiB": 10, "storagePolicy": "invalid"}]`,
+				errMsg:    "error getting data disk specs: unable to get storage policy \"invalid\" of data disk \"images\": no pbm profile found with name: \"invalid\"",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				scope := getMachineScope(providerSpec)
+				scope.machine.Name = "data-disks"
+				scope.machine.Annotations = map[string]string{vsphereutil.DataDisksAnnotation: tc.dataDisks}
+				taskRef, err := clone(scope)
+				if tc.errMsg != "" {
+					g.Expect(err).To(MatchError(tc.errMsg))
+					return
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+
+				task := object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: taskRef})
+				g.Expect(task.Wait(context.TODO())).To(Succeed())
+
+				clonedVM, err := session.Finder.VirtualMachine(context.TODO(), scope.machine.Name)
+				g.Expect(err).ToNot(HaveOccurred())
+				clonedDevices, err := clonedVM.Device(context.TODO())
+				g.Expect(err).ToNot(HaveOccurred())
+
+				nvme, err := clonedDevices.FindNVMEController("")
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(nvme.BusNumber).To(BeEquivalentTo(1))
+
+				provisioning := map[int64]string{}
+				for _, device := range clonedDevices.SelectByType((*types.VirtualDisk)(nil)) {
+					disk := device.(*types.VirtualDisk)
+					backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+					switch {
+					case disk.ControllerKey == nvme.Key:
+						g.Expect(*disk.UnitNumber).To(BeEquivalentTo(2))
+						provisioning[disk.CapacityInKB] = "nvme"
+					case ptr.Deref(backing.EagerlyScrub, false):
+						provisioning[disk.CapacityInKB] = "eagerlyZeroed"
+					case ptr.Deref(backing.ThinProvisioned, false):
+						provisioning[disk.CapacityInKB] = "thin"
+					default:
+						provisioning[disk.CapacityInKB] = "thick"
+					}
+				}
+				g.Expect(provisioning).To(HaveKeyWithValue(int64(10*1024*1024), "thin"))
+				g.Expect(provisioning).To(HaveKeyWithValue(int64(1*1024*1024), "nvme"))
+				g.Expect(provisioning).To(HaveKeyWithValue(int64(2*1024*1024), "thick"))
+
+				// The data disks are destroyed along with the vm, so they must not block its deletion
+				g.Expect(scope.dataDisks).To(HaveLen(3))
+				clonedMachine := &virtualMachine{Context: context.TODO(), Obj: clonedVM, Ref: clonedVM.Reference()}
+				g.Expect(clonedMachine.recordDataDiskFiles(scope.dataDisks)).To(Succeed())
+				for _, dataDisk := range scope.dataDisks {
+					g.Expect(dataDisk.FileName).ToNot(BeEmpty())
+				}
+				disks, err := clonedMachine.getAttachedDisks()
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(disks).To(HaveLen(4))
+				g.Expect(filterOutMachineDataDisks(disks, scope.dataDisks)).To(HaveLen(1))
+			})
+		}
+	})
+
+	t.Run("Test storage policy", func(t *testing.T) {
+		cases := []struct {
+			name          string
+			storagePolicy string
+			datastore     string
+			errMsg        string
+		}{
+			{
+				name:          "Clone with storage policy",
+				storagePolicy: "vSAN Default Storage Policy",
+			},
+			{
+				name:          "Storage policy along with a datastore",
+				storagePolicy: "vSAN Default Storage Policy",
+				datastore:     "LocalDS_0",
+				errMsg:        "a storage policy can not be combined with providerSpec.workspace.datastore, the datastore is chosen among the ones compatible with the policy",
+			},
+			{
+				name:          "Storage policy not found",
+				storagePolicy: "invalid",
+				errMsg:        "unable to get storage policy \"invalid\": no pbm profile found with name: \"invalid\"",
+			},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				scope := getMachineScope(&machinev1.VSphereMachineProviderSpec{
+					CredentialsSecret: &corev1.LocalObjectReference{
+						Name: "test",
+					},
+					Workspace: &machinev1.Workspace{
+						Server:    server.URL.Host,
+						Datastore: tc.datastore,
+					},
+					DiskGiB:  diskSize,
+					Template: vm.Name,
+					UserDataSecret: &corev1.LocalObjectReference{
+						Name: userDataSecretName,
+					},
+				})
+				scope.machine.Name = "storage-policy"
+				scope.machine.Annotations = map[string]string{
+					vsphereutil.StoragePolicyAnnotation: tc.storagePolicy,
+					vsphereutil.DataDisksAnnotation:     `[{"name": "images", "sizeGiB": 1}]`,
+				}
+				taskRef, err := clone(scope)
+				if tc.errMsg != "" {
+					g.Expect(err).To(MatchError(tc.errMsg))
+					g.Expect(findCondition(scope.providerStatus.Conditions, storagePolicyPlacementCondition)).To(BeNil())
+					return
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+
+				task := object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: taskRef})
+				g.Expect(task.Wait(context.TODO())).To(Succeed())
+
+				clonedVM, err := session.Finder.VirtualMachine(context.TODO(), scope.machine.Name)
+				g.Expect(err).ToNot(HaveOccurred())
+				var clonedMo mo.VirtualMachine
+				g.Expect(clonedVM.Properties(context.TODO(), clonedVM.Reference(), []string{"datastore"}, &clonedMo)).To(Succeed())
+				g.Expect(clonedMo.Datastore).To(HaveLen(1))
+				datastore := object.NewDatastore(session.Client.Client, clonedMo.Datastore[0])
+				datastoreName, err := datastore.ObjectName(context.TODO())
+				g.Expect(err).ToNot(HaveOccurred())
+
+				condition := findCondition(scope.providerStatus.Conditions, storagePolicyPlacementCondition)
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(condition.Message).To(Equal(fmt.Sprintf("Datastore %q selected for storage policy %q", datastoreName, tc.storagePolicy)))
+			})
+		}
+	})
+
+	t.Run("Test content library", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// Publish the template as a VM template item of a content library
+		datastore, err := session.Finder.Datastore(context.TODO(), "LocalDS_0")
+		g.Expect(err).ToNot(HaveOccurred())
+		folder, err := session.Finder.DefaultFolder(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		pool, err := session.Finder.DefaultResourcePool(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(session.WithRestClient(context.TODO(), func(c *rest.Client) error {
+			libraryID, err := library.NewManager(c).CreateLibrary(context.TODO(), library.Library{
+				Name:    "rhcos",
+				Type:    "LOCAL",
+				Storage: []library.StorageBackings{{DatastoreID: datastore.Reference().Value, Type: "DATASTORE"}},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = vcenter.NewManager(c).CreateTemplate(context.TODO(), vcenter.Template{
+				Name:     "rhcos-4.16",
+				Library:  libraryID,
+				SourceVM: vm.Reference().Value,
+				Placement: &vcenter.Placement{
+					Folder:       folder.Reference().Value,
+					ResourcePool: pool.Reference().Value,
+				},
+			})
+			return err
+		})).To(Succeed())
+
+		cases := []struct {
+			name        string
+			libraryItem string
+			cloneMode   machinev1.CloneMode
+			errMsg      string
+		}{
+			{
+				name:        "Deploy from content library item",
+				libraryItem: `{"library": "rhcos", "item": "rhcos-4.16"}`,
+			},
+			{
+				name:        "Linked clone from content library item",
+				libraryItem: `{"library": "rhcos", "item": "rhcos-4.16"}`,
+				cloneMode:   machinev1.LinkedClone,
+				errMsg:      "linkedClone clone mode is not supported when deploying from content library item \"rhcos/rhcos-4.16\", use fullClone",
+			},
+			{
+				name:        "Content library not found",
+				libraryItem: `{"library": "invalid", "item": "rhcos-4.16"}`,
+				errMsg:      "content library \"invalid\" not found: library name (invalid) not found",
+			},
+			{
+				name:        "Content library item not found",
+				libraryItem: `{"library": "rhcos", "item": "invalid"}`,
+				errMsg:      "content library item \"rhcos/invalid\" not found",
+			},
+			{
+				name:        "Invalid content library item",
+				libraryItem: `{"library": "rhcos"}`,
+				errMsg:      "invalid machine.openshift.io/vsphere-content-library-item annotation: item is required",
+			},
+		}
+		for i, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				g := NewWithT(t)
+
+				scope := getMachineScope(&machinev1.VSphereMachineProviderSpec{
+					CredentialsSecret: &corev1.LocalObjectReference{
+						Name: "test",
+					},
+					Workspace: &machinev1.Workspace{
+						Server:    server.URL.Host,
+						Datastore: "LocalDS_0",
+					},
+					// The template is ignored in favor of the content library item
+					Template:  "invalid",
+					CloneMode: tc.cloneMode,
+					NumCPUs:   4,
+					MemoryMiB: 4096,
+					DiskGiB:   diskSize,
+					UserDataSecret: &corev1.LocalObjectReference{
+						Name: userDataSecretName,
+					},
+				})
+				scope.machine.Name = fmt.Sprintf("content-library-%d", i)
+				scope.machine.UID = apimachinerytypes.UID(fmt.Sprintf("b2a5c0b5-4b5c-4c3a-9b6e-5d1d8e4f0a1%d", i))
+				scope.machine.Annotations = map[string]string{vsphereutil.ContentLibraryItemAnnotation: tc.libraryItem}
+				scope.client = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+					WithRuntimeObjects(&credentialsSecret, &userDataSecret, scope.machine).WithStatusSubresource(scope.machine).Build()
+				scope.machineToBePatched = runtimeclient.MergeFrom(scope.machine.DeepCopy())
+				taskRef, err := clone(scope)
+				if tc.errMsg != "" {
+					g.Expect(err).To(MatchError(tc.errMsg))
+					return
+				}
+				g.Expect(err).ToNot(HaveOccurred())
+
+				// Unlike vCenter, vcsim deploys VM template items as templates, which can not be reconfigured
+				task := object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: taskRef})
+				g.Expect(task.Wait(context.TODO())).ToNot(Succeed())
+				deployedVM, err := session.Finder.VirtualMachine(context.TODO(), scope.machine.Name)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(deployedVM.MarkAsVirtualMachine(context.TODO(), *pool, nil)).To(Succeed())
+
+				// The vm is deployed once, a retry only configures it again
+				taskRef, err = clone(scope)
+				g.Expect(err).ToNot(HaveOccurred())
+				vms, err := session.Finder.VirtualMachineList(context.TODO(), scope.machine.Name)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(vms).To(HaveLen(1))
+
+				task = object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: taskRef})
+				g.Expect(task.Wait(context.TODO())).To(Succeed())
+				// vcsim does not use the description IDs of vCenter tasks
+				g.Expect(isCreationTask(scope, reconfigureVmTaskDescriptionId)).To(BeTrue())
+
+				// The deployed vm is configured like a clone
+				vmRef, err := findVM(scope)
+				g.Expect(err).ToNot(HaveOccurred())
+				var deployed mo.VirtualMachine
+				g.Expect(object.NewVirtualMachine(session.Client.Client, vmRef).Properties(
+					context.TODO(), vmRef, []string{"config"}, &deployed)).To(Succeed())
+				g.Expect(deployed.Config.InstanceUuid).To(BeEquivalentTo(scope.machine.UID))
+				g.Expect(deployed.Config.Hardware.NumCPU).To(BeEquivalentTo(4))
+				g.Expect(deployed.Config.Hardware.MemoryMB).To(BeEquivalentTo(4096))
+				g.Expect(deployed.Config.ExtraConfig).To(ContainElement(&types.OptionValue{Key: GuestInfoHostname, Value: scope.machine.Name}))
+			})
+		}
+
+		t.Run("Resume the configuration of the deployed vm", func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := getMachineScope(&machinev1.VSphereMachineProviderSpec{
+				CredentialsSecret: &corev1.LocalObjectReference{
+					Name: "test",
+				},
+				Workspace: &machinev1.Workspace{
+					Server:    server.URL.Host,
+					Datastore: "LocalDS_0",
+				},
+				NumCPUs:   4,
+				MemoryMiB: 4096,
+				DiskGiB:   diskSize,
+				UserDataSecret: &corev1.LocalObjectReference{
+					Name: userDataSecretName,
+				},
+			})
+			scope.machine.Name = "content-library-resume"
+			scope.machine.UID = "b2a5c0b5-4b5c-4c3a-9b6e-5d1d8e4f0a20"
+			scope.machine.Annotations = map[string]string{
+				vsphereutil.ContentLibraryItemAnnotation: `{"library": "rhcos", "item": "rhcos-4.16"}`,
+			}
+			scope.machine.Status.Phase = ptr.To(machinev1.PhaseProvisioning)
+			scope.client = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+				WithRuntimeObjects(&credentialsSecret, &userDataSecret, scope.machine).WithStatusSubresource(scope.machine).Build()
+			scope.machineToBePatched = runtimeclient.MergeFrom(scope.machine.DeepCopy())
+			r := newReconciler(scope)
+
+			// vcsim deploys VM template items as templates, so the configuration of the deployed vm fails
+			g.Expect(r.create()).To(Succeed())
+			deployedVM := scope.deployedVM
+			g.Expect(deployedVM).ToNot(BeEmpty())
+			task := object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef})
+			g.Expect(task.Wait(context.TODO())).ToNot(Succeed())
+
+			// The deployed vm is recorded before its configuration starts
+			machine := &machinev1.Machine{}
+			g.Expect(scope.client.Get(context.TODO(), runtimeclient.ObjectKeyFromObject(scope.machine), machine)).To(Succeed())
+			status, err := extendedProviderStatusFromRawExtension(machine.Status.ProviderStatus)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(status.DeployedVM).To(Equal(deployedVM))
+
+			// Once the reconfigure task is lost, the powered off vm is found by its name but not powered on
+			vm := object.NewVirtualMachine(session.Client.Client, deployedVMRef(scope))
+			g.Expect(vm.MarkAsVirtualMachine(context.TODO(), *pool, nil)).To(Succeed())
+			scope.providerStatus.TaskRef = ""
+			exists, err := r.exists()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(exists).To(BeFalse())
+			g.Expect(scope.providerStatus.InstanceState).To(Equal(ptr.To(string(types.VirtualMachinePowerStatePoweredOff))))
+
+			g.Expect(r.create()).To(Succeed())
+			g.Expect(scope.deployedVM).To(Equal(deployedVM))
+			task = object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef})
+			g.Expect(task.Wait(context.TODO())).To(Succeed())
+			g.Expect(getTaskOperation(scope, &mo.Task{ExtensibleManagedObject: mo.ExtensibleManagedObject{
+				Self: task.Reference(),
+			}})).To(Equal(taskOperationCreate))
+
+			powerState, err := (&virtualMachine{Context: context.TODO(), Obj: vm, Ref: vm.Reference()}).getPowerState()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(powerState).To(Equal(types.VirtualMachinePowerStatePoweredOff))
+			configured, err := isDeployedVMConfigured(scope)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(configured).To(BeTrue())
+			vms, err := session.Finder.VirtualMachineList(context.TODO(), scope.machine.Name)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(vms).To(HaveLen(1))
+
+			// The configured vm is powered on once its creation task finished
+			g.Expect(r.create()).To(Succeed())
+			g.Expect(scope.deployedVM).To(BeEmpty())
+			g.Expect(getTaskOperation(scope, &mo.Task{ExtensibleManagedObject: mo.ExtensibleManagedObject{
+				Self: types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef},
+			}})).To(Equal(taskOperationPowerOn))
+		})
+	})
+
+	t.Run("Throttled vCenter", func(t *testing.T) {
+		g := NewWithT(t)
+
+		scope := getMachineScope(&machinev1.VSphereMachineProviderSpec{
+			CredentialsSecret: &corev1.LocalObjectReference{
+				Name: "test",
+			},
+			Workspace: &machinev1.Workspace{
+				Server:    server.URL.Host,
+				Datastore: "LocalDS_0",
+			},
+			DiskGiB:  diskSize,
+			Template: vm.Name,
+			UserDataSecret: &corev1.LocalObjectReference{
+				Name: userDataSecretName,
+			},
+		})
+		scope.machine.Name = "throttled"
+		scope.client = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithRuntimeObjects(&credentialsSecret, &userDataSecret, scope.machine).WithStatusSubresource(scope.machine).Build()
+		scope.machineToBePatched = runtimeclient.MergeFrom(scope.machine.DeepCopy())
+		r := newReconciler(scope)
+
+		roundTripper := session.Client.Client.RoundTripper
+		defer func() { session.Client.Client.RoundTripper = roundTripper }()
+
+		// Each request sent to the vCenter by a step of the creation is throttled in turn,
+		// the machine is requeued without failing until the step succeeds
+		createThrottled := func() {
+			for requests := 0; ; requests++ {
+				session.Client.Client.RoundTripper = &throttlingRoundTripper{next: roundTripper, requests: requests}
+				err := r.create()
+				session.Client.Client.RoundTripper = roundTripper
+				if err == nil {
+					return
+				}
+				err = fmt.Errorf(reconcilerFailFmt, scope.machine.GetName(), createEventAction, err)
+				g.Expect(requeueIfThrottled(err)).To(BeAssignableToTypeOf(&machinecontroller.RequeueAfterError{}), "request %d: %v", requests, err)
+				g.Expect(scope.providerStatus.Conditions).ToNot(ContainElement(SatisfyAll(
+					HaveField("Type", string(machinev1.MachineCreation)), HaveField("Status", metav1.ConditionFalse))))
+			}
+		}
+
+		createThrottled()
+		g.Expect(getTaskOperation(scope, &mo.Task{ExtensibleManagedObject: mo.ExtensibleManagedObject{
+			Self: types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef},
+		}})).To(Equal(taskOperationCreate))
+		task := object.NewTask(session.Client.Client, types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef})
+		g.Expect(task.Wait(context.TODO())).To(Succeed())
+
+		createThrottled()
+		g.Expect(getTaskOperation(scope, &mo.Task{ExtensibleManagedObject: mo.ExtensibleManagedObject{
+			Self: types.ManagedObjectReference{Type: "Task", Value: scope.providerStatus.TaskRef},
+		}})).To(Equal(taskOperationPowerOn))
+	})
 }
 
 func TestPowerOn(t *testing.T) {
@@ -912,9 +1380,64 @@ func testStaticIPsWithSimulator(t *testing.T, model *simulator.Model, server *si
 			Gateway: "192.168.1.1",
 		},
 	}
+	addressClaimDualStack := []machinev1.NetworkDeviceSpec{
+		{
+			AddressesFromPools: []machinev1.AddressesFromPool{
+				{
+					Name:     "test-pool",
+					Group:    poolGroup,
+					Resource: "ippools",
+				},
+				{
+					Name:     "test-pool-v6",
+					Group:    poolGroup,
+					Resource: "ippools",
+				},
+			},
+			Nameservers: []string{"192.168.1.100"},
+		},
+	}
+	addressClaimSecondaryDevice := []machinev1.NetworkDeviceSpec{
+		addressClaim[0],
+		{
+			AddressesFromPools: []machinev1.AddressesFromPool{
+				{
+					Name:     "test-pool-secondary",
+					Group:    poolGroup,
+					Resource: "ippools",
+				},
+			},
+		},
+	}
+	dualStackSecondaryDevice := []machinev1.NetworkDeviceSpec{
+		ipv4Static[0],
+		{
+			Gateway: "192.168.20.1",
+			IPAddrs: []string{"192.168.20.2/24", "2001:db8:2::2/64"},
+		},
+	}
+
+	newIPAddressClaim := func(name, poolName, addressName string) *ipamv1beta1.IPAddressClaim {
+		claim := ipAddressClaim.DeepCopy()
+		claim.Name = name
+		claim.Spec.PoolRef.Name = poolName
+		claim.Status.AddressRef.Name = addressName
+		return claim
+	}
+	newIPAddress := func(name, poolName, address string, prefix int, gateway string) *ipamv1beta1.IPAddress {
+		ipAddress := ipAddress.DeepCopy()
+		ipAddress.Name = name
+		ipAddress.Spec.PoolRef.Name = poolName
+		ipAddress.Spec.Address = address
+		ipAddress.Spec.Prefix = prefix
+		ipAddress.Spec.Gateway = gateway
+		return ipAddress
+	}
+
 	testCases := []struct {
 		testCase    string
 		networkSpec []machinev1.NetworkDeviceSpec
+		annotations map[string]string
 		expected    string
 		err         string
 	}{
@@ -943,6 +1466,51 @@ func testStaticIPsWithSimulator(t *testing.T, model *simulator.Model, server *si
 			networkSpec: addressClaimAndIpPool,
 			expected:    "ip=192.168.1.2::192.168.1.1:255.255.255.0:::none ip=192.168.1.11::192.168.1.1:255.255.255.0:::none nameserver=192.168.1.100",
 		},
+		{
+			testCase:    "IPAM Allocated dual stack addresses",
+			networkSpec: addressClaimDualStack,
+			expected:    "ip=192.168.1.11::192.168.1.1:255.255.255.0:::none ip=[2001:db8::11]::[2001:db8::1]:64:::none nameserver=192.168.1.100",
+		},
+		{
+			testCase:    "Valid dual stack with IPv6 gateway annotation",
+			networkSpec: dualStackStatic,
+			annotations: map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{"gateways": ["2001::1"]}]`},
+			expected:    "ip=192.168.1.2::192.168.1.1:255.255.255.0:::none ip=[2001::2]::[2001::1]:64:::none nameserver=192.168.1.100",
+		},
+		{
+			testCase:    "IPAM Allocated secondary device with route",
+			networkSpec: addressClaimSecondaryDevice,
+			annotations: map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{}, {"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}]}]`},
+			expected:    "ip=192.168.1.11::192.168.1.1:255.255.255.0:::none nameserver=192.168.1.100 ip=192.168.20.11:::255.255.255.0:::none rd.route=10.20.0.0/16:192.168.20.1",
+		},
+		{
+			testCase:    "IPAM Allocated secondary device without annotation",
+			networkSpec: addressClaimSecondaryDevice,
+			expected:    "ip=192.168.1.11::192.168.1.1:255.255.255.0:::none nameserver=192.168.1.100 ip=192.168.20.11::192.168.20.1:255.255.255.0:::none",
+		},
+		{
+			testCase:    "Dual stack secondary device without annotation",
+			networkSpec: dualStackSecondaryDevice,
+			expected:    "ip=192.168.1.2::192.168.1.1:255.255.255.0:::none nameserver=192.168.1.100 ip=192.168.20.2::192.168.20.1:255.255.255.0:::none ip=[2001:db8:2::2]:::64:::none",
+		},
+		{
+			testCase:    "Dual stack secondary device with routes",
+			networkSpec: dualStackSecondaryDevice,
+			annotations: map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{}, {"gateways": ["2001:db8:2::1"], "routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}, {"to": "2001:db8:20::/48", "via": "2001:db8:2::1"}]}]`},
+			expected:    "ip=192.168.1.2::192.168.1.1:255.255.255.0:::none nameserver=192.168.1.100 ip=192.168.20.2:::255.255.255.0:::none ip=[2001:db8:2::2]::[2001:db8:2::1]:64:::none rd.route=10.20.0.0/16:192.168.20.1 rd.route=[2001:db8:20::/48]:[2001:db8:2::1]",
+		},
+		{
+			testCase:    "Route without address of its family",
+			networkSpec: ipv4Static,
+			annotations: map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{"routes": [{"to": "2001:db8:20::/48", "via": "2001:db8:2::1"}]}]`},
+			err:         "network device 0 has a route to 2001:db8:20::/48, but no IPv6 address",
+		},
+		{
+			testCase:    "Options for a missing device",
+			networkSpec: ipv4Static,
+			annotations: map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{}, {"gateways": ["192.168.20.1"]}]`},
+			err:         "machine.openshift.io/vsphere-network-devices annotation has options for 2 network devices, but the machine has 1",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -950,14 +1518,19 @@ func testStaticIPsWithSimulator(t *testing.T, model *simulator.Model, server *si
 			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(
 				&ipAddressClaim,
 				&ipAddress,
+				newIPAddressClaim("test-claim-0-1", "test-pool-v6", "test-test-1"),
+				newIPAddress("test-test-1", "test-pool-v6", "2001:db8::11", 64, "2001:db8::1"),
+				newIPAddressClaim("test-claim-1-0", "test-pool-secondary", "test-test-2"),
+				newIPAddress("test-test-2", "test-pool-secondary", "192.168.20.11", 24, "192.168.20.1"),
 			).Build()
 
 			machineScope := machineScope{
 				Context: context.Background(),
 				machine: &machinev1.Machine{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "test",
-						Namespace: "openshift-machine-api",
+						Name:        "test",
+						Namespace:   "openshift-machine-api",
+						Annotations: tc.annotations,
 					},
 				},
 				providerSpec: &machinev1.VSphereMachineProviderSpec{
@@ -2059,7 +2632,10 @@ func TestDelete(t *testing.T) {
 		machine     func(t *testing.T, simServerHost string) *machinev1.Machine
 		node        func(t *testing.T) *corev1.Node
 		attachDisks bool
+		diskName    string
+		dataDisk    bool
 		errMessage  string
+		destroyed   bool
 	}{
 		{
 			name:        "extra disk attached",
@@ -2081,6 +2657,50 @@ func TestDelete(t *testing.T) {
 			},
 			errMessage: "additional attached disks detected, block vm destruction and wait for disks to be detached",
 		},
+		{
+			name:        "data disk of the machine attached",
+			attachDisks: true,
+			diskName:    "defaultFolder_1",
+			dataDisk:    true,
+			machine: func(t *testing.T, simServerHost string) *machinev1.Machine {
+				return getMachineWithStatus(t, machinev1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{
+						Name: nodeName,
+					},
+				}, simServerHost)
+			},
+			node: func(t *testing.T) *corev1.Node {
+				return getNodeWithConditions([]corev1.NodeCondition{
+					{
+						Type:   corev1.NodeReady,
+						Status: corev1.ConditionTrue,
+					},
+				})
+			},
+			errMessage: "destroying vm in progress, requeuing",
+			destroyed:  true,
+		},
+		{
+			name:        "disk named like a data disk of the machine attached",
+			attachDisks: true,
+			diskName:    "defaultFolder_1",
+			machine: func(t *testing.T, simServerHost string) *machinev1.Machine {
+				return getMachineWithStatus(t, machinev1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{
+						Name: nodeName,
+					},
+				}, simServerHost)
+			},
+			node: func(t *testing.T) *corev1.Node {
+				return getNodeWithConditions([]corev1.NodeCondition{
+					{
+						Type:   corev1.NodeReady,
+						Status: corev1.ConditionTrue,
+					},
+				})
+			},
+			errMessage: "additional attached disks detected, block vm destruction and wait for disks to be detached",
+		},
 		{
 			name:        "extra disk attached with no drain annotation",
 			attachDisks: true,
@@ -2218,7 +2838,11 @@ func TestDelete(t *testing.T) {
 
 			if tc.attachDisks {
 				simClient := sess.Client.Client
-				g.Expect(addDiskToVm(context.TODO(), vm, fmt.Sprintf("%s-%s", vm.Name, tc.name), simClient)).To(Succeed())
+				diskName := tc.diskName
+				if diskName == "" {
+					diskName = fmt.Sprintf("%s-%s", vm.Name, tc.name)
+				}
+				g.Expect(addDiskToVm(context.TODO(), vm, diskName, simClient)).To(Succeed())
 			}
 
 			nodeNameIndexExtractor := func(rawObj runtimeclient.Object) []string {
@@ -2245,6 +2869,12 @@ func TestDelete(t *testing.T) {
 			g.Expect(err).NotTo(HaveOccurred())
 
 			reconciler := newReconciler(mScope)
+			if tc.dataDisk {
+				reconciler.dataDisks = []dataDiskRecord{{
+					Name:     "disk1",
+					FileName: fmt.Sprintf("[LocalDS_0] %s/%s.vmdk", vm.Name, tc.diskName),
+				}}
+			}
 
 			// expect the first call to delete to make the vSphere power off request
 			// and always return error to let it reconcile and monitor power off tasks until completion
@@ -2252,6 +2882,12 @@ func TestDelete(t *testing.T) {
 
 			// second reconciliation should block vm destruction with an err
 			g.Expect(reconciler.delete()).To(MatchError(ContainSubstring(tc.errMessage)))
+
+			if tc.destroyed {
+				// wait for the vm destruction to complete before the simulator is replaced by the next test case
+				destroyTask := object.NewTask(sess.Client.Client, types.ManagedObjectReference{Type: "Task", Value: reconciler.providerStatus.TaskRef})
+				g.Expect(destroyTask.Wait(context.TODO())).To(Succeed())
+			}
 		})
 	}
 }
@@ -3248,6 +3884,43 @@ func TestVmDisksManipulation(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Test filter data disks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var disks []attachedDisk
+		for _, filename := range []string{
+			fmt.Sprintf("[DS] %s/%s.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS] %s/%s_1.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS2] %s/%s_12.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS] %s/%s_pv.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS] %s/other-%s_1.vmdk", machineObj.Name, machineObj.Name),
+			"[DS] kubevols/pv.vmdk",
+		} {
+			disks = append(disks, attachedDisk{fileName: filename})
+		}
+
+		// Only the recorded data disks are filtered out, a disk named after the machine is not necessarily one of them
+		dataDisks := []dataDiskRecord{
+			{Name: "images", FileName: fmt.Sprintf("[DS] %s/%s_1.vmdk", machineObj.Name, machineObj.Name)},
+			{Name: "logs", FileName: fmt.Sprintf("[DS2] %s/%s_12.vmdk", machineObj.Name, machineObj.Name)},
+			{Name: "not yet cloned"},
+		}
+
+		var filteredDisksFilenames []string
+		for _, disk := range filterOutMachineDataDisks(disks, dataDisks) {
+			filteredDisksFilenames = append(filteredDisksFilenames, disk.fileName)
+		}
+		g.Expect(filteredDisksFilenames).To(Equal([]string{
+			fmt.Sprintf("[DS] %s/%s.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS] %s/%s_pv.vmdk", machineObj.Name, machineObj.Name),
+			fmt.Sprintf("[DS] %s/other-%s_1.vmdk", machineObj.Name, machineObj.Name),
+			"[DS] kubevols/pv.vmdk",
+		}))
+
+		// Without recorded data disks, no disk is filtered out
+		g.Expect(filterOutMachineDataDisks(disks, nil)).To(Equal(disks))
+	})
 }
 
 func TestReconcilePowerStateAnnontation(t *testing.T) {
@@ -0,0 +1,295 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+const (
+	// resizeCondition reports the in-place changes of the CPUs and memory of the vm
+	resizeCondition = "Resized"
+
+	resizeSucceededReason    = "ResizeSucceeded"
+	powerCycleRequiredReason = "PowerCycleRequired"
+
+	// The reasons of the resizes which do not power cycle the vm, while their task is in flight
+	hotAddingReason          = "HotAdding"
+	resizingPoweredOffReason = "ResizingPoweredOff"
+	// reconfiguringReason is the step of a power cycle resizing the powered off vm
+	reconfiguringReason = "Reconfiguring"
+
+	// mirrorPodAnnotation is set on the API server copies of the static pods of the node, which can not be evicted
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// reconcileResize applies the changes of the CPUs and memory of the provider spec to the vm. The changes are
+// hot added when the vm allows it. Otherwise the node is drained and the vm power cycled to apply them, if the
+// machine allows it. Each task of the resize is tracked by the task reference of the provider status, and the
+// resize resumed from its step on the next reconcile. It returns true while a task of the resize is started.
+func (r *Reconciler) reconcileResize(vm *virtualMachine) (bool, error) {
+	if hwUpgradePowerCycle.inProgress(r.providerStatus.Conditions) {
+		// The vm is resized once powered on again by the upgrade of its hardware version
+		return false, nil
+	}
+
+	var o mo.VirtualMachine
+	if err := vm.Obj.Properties(r.Context, vm.Ref, []string{"config", "runtime.powerState"}, &o); err != nil {
+		return false, fmt.Errorf("unable to get configuration of vm: %w", err)
+	}
+	if o.Config == nil {
+		return false, nil
+	}
+	hardware := o.Config.Hardware
+
+	// Unset values keep the ones of the template
+	numCPUs := r.providerSpec.NumCPUs
+	if numCPUs == 0 {
+		numCPUs = hardware.NumCPU
+	}
+	memoryMiB := r.providerSpec.MemoryMiB
+	if memoryMiB == 0 {
+		memoryMiB = int64(hardware.MemoryMB)
+	}
+
+	condition := findCondition(r.providerStatus.Conditions, resizeCondition)
+	powerCycling := resizePowerCycle.inProgress(r.providerStatus.Conditions)
+	poweredOff := o.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOff
+
+	if numCPUs == hardware.NumCPU && memoryMiB == int64(hardware.MemoryMB) {
+		if powerCycling {
+			return r.finishPowerCycle(resizePowerCycle, vm, poweredOff, "Powering on the resized vm", "Resized with a power cycle")
+		}
+		if condition != nil && condition.Status != metav1.ConditionTrue {
+			switch condition.Reason {
+			case hotAddingReason:
+				r.setResizeCondition(metav1.ConditionTrue, resizeSucceededReason, "Resized with hot add")
+			case resizingPoweredOffReason:
+				r.setResizeCondition(metav1.ConditionTrue, resizeSucceededReason, "Resized while powered off")
+			default:
+				// The provider spec was reverted before the vm could be resized
+				r.setResizeCondition(metav1.ConditionTrue, resizeSucceededReason, "CPUs and memory match the provider spec")
+			}
+		}
+		return false, nil
+	}
+
+	klog.Infof("%v: resizing vm from %d CPUs and %dMiB of memory to %d CPUs and %dMiB of memory",
+		r.machine.GetName(), hardware.NumCPU, hardware.MemoryMB, numCPUs, memoryMiB)
+
+	switch {
+	case poweredOff && powerCycling:
+		taskRef, err := r.startResize(vm, coldResizeSpec(r.providerSpec.NumCoresPerSocket, numCPUs, memoryMiB))
+		if err != nil {
+			return false, r.stepFailed(resizeCondition, reconfiguringReason, err)
+		}
+		r.startStep(resizeCondition, taskRef, taskOperationResize, reconfiguringReason, "Resizing the powered off vm")
+		return true, nil
+	case poweredOff:
+		taskRef, err := r.startResize(vm, coldResizeSpec(r.providerSpec.NumCoresPerSocket, numCPUs, memoryMiB))
+		if err != nil {
+			return false, err
+		}
+		r.startStep(resizeCondition, taskRef, taskOperationResize, resizingPoweredOffReason, "Resizing the powered off vm")
+		return true, nil
+	case canHotResize(o.Config, numCPUs, memoryMiB):
+		spec := types.VirtualMachineConfigSpec{}
+		if numCPUs != hardware.NumCPU {
+			spec.NumCPUs = numCPUs
+		}
+		if memoryMiB != int64(hardware.MemoryMB) {
+			spec.MemoryMB = memoryMiB
+		}
+		taskRef, err := r.startResize(vm, spec)
+		if err != nil {
+			return false, err
+		}
+		r.startStep(resizeCondition, taskRef, taskOperationResize, hotAddingReason, "Hot adding the changes")
+		return true, nil
+	}
+
+	allowed, err := vsphereutil.ResizePowerCycleAllowed(r.machine)
+	if err != nil {
+		return false, machinecontroller.InvalidMachineConfiguration("%v", err)
+	}
+	if !allowed {
+		if powerCycling {
+			// The power cycle was disallowed while draining the node
+			if err := r.uncordonNode(); err != nil {
+				return false, err
+			}
+		}
+		r.setResizeCondition(metav1.ConditionFalse, powerCycleRequiredReason, fmt.Sprintf(
+			"The vm does not allow to hot add the changes, set the %s annotation to \"true\" to drain the node and power cycle the vm",
+			vsphereutil.ResizePowerCycleAnnotation))
+		return false, nil
+	}
+
+	return r.powerOff(resizePowerCycle, vm)
+}
+
+// startResize starts the reconfiguration of the CPUs and memory of the vm
+func (r *Reconciler) startResize(vm *virtualMachine, spec types.VirtualMachineConfigSpec) (string, error) {
+	// The task counts against the maximum number of tasks in flight on the vCenter
+	task, err := r.session.StartTask(func() (*object.Task, error) {
+		return vm.Obj.Reconfigure(r.Context, spec)
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to resize vm: %w", err)
+	}
+	return task.Reference().Value, nil
+}
+
+func (r *Reconciler) setResizeCondition(status metav1.ConditionStatus, reason, message string) {
+	r.setStepCondition(resizeCondition, status, reason, message)
+}
+
+// isResizing returns true when the conditions report a step of a resize, whether it power cycles the vm or not
+func isResizing(conditions []metav1.Condition) bool {
+	if resizePowerCycle.inProgress(conditions) {
+		return true
+	}
+	condition := findCondition(conditions, resizeCondition)
+	return condition != nil && (condition.Reason == hotAddingReason || condition.Reason == resizingPoweredOffReason)
+}
+
+// canHotResize returns true when the changes can be applied to the running vm
+func canHotResize(config *types.VirtualMachineConfigInfo, numCPUs int32, memoryMiB int64) bool {
+	hardware := config.Hardware
+	coresPerSocket := max(hardware.NumCoresPerSocket, 1)
+
+	switch {
+	case numCPUs > hardware.NumCPU && !ptr.Deref(config.CpuHotAddEnabled, false):
+		return false
+	case numCPUs < hardware.NumCPU && !ptr.Deref(config.CpuHotRemoveEnabled, false):
+		return false
+	case numCPUs%coresPerSocket != 0:
+		// Sockets are added or removed, their number of cores can not change
+		return false
+	case memoryMiB > int64(hardware.MemoryMB) && !ptr.Deref(config.MemoryHotAddEnabled, false):
+		return false
+	case memoryMiB < int64(hardware.MemoryMB):
+		// Memory can not be hot removed
+		return false
+	}
+	return true
+}
+
+// coldResizeSpec returns the spec resizing a powered off vm, with the cores per socket of a clone
+func coldResizeSpec(numCoresPerSocket, numCPUs int32, memoryMiB int64) types.VirtualMachineConfigSpec {
+	if numCoresPerSocket == 0 {
+		numCoresPerSocket = numCPUs
+	}
+	return types.VirtualMachineConfigSpec{
+		NumCPUs:           numCPUs,
+		NumCoresPerSocket: numCoresPerSocket,
+		MemoryMB:          memoryMiB,
+	}
+}
+
+// drainNode cordons the node of the machine and evicts its pods, respecting their disruption budgets.
+// It returns true once the node has no pod left to evict.
+func (r *Reconciler) drainNode() (bool, error) {
+	node, err := r.getMachineNode()
+	if err != nil {
+		return false, err
+	}
+	if node == nil {
+		return true, nil
+	}
+	if err := r.setNodeUnschedulable(node, true); err != nil {
+		return false, err
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.apiReader.List(r.Context, pods, runtimeclient.MatchingFields{"spec.nodeName": node.Name}); err != nil {
+		return false, fmt.Errorf("unable to list pods of node %s: %w", node.Name, err)
+	}
+
+	remaining := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !isEvictable(pod) {
+			continue
+		}
+		remaining++
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+		if err := r.client.SubResource("eviction").Create(r.Context, pod, eviction); err != nil {
+			switch {
+			case apierrors.IsNotFound(err):
+				remaining--
+			case apierrors.IsTooManyRequests(err):
+				klog.V(3).Infof("%v: eviction of pod %s/%s blocked by its disruption budget", r.machine.GetName(), pod.Namespace, pod.Name)
+			default:
+				return false, fmt.Errorf("unable to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+			continue
+		}
+		klog.V(3).Infof("%v: evicted pod %s/%s", r.machine.GetName(), pod.Namespace, pod.Name)
+	}
+	klog.V(3).Infof("%v: %d pods left to evict from node %s", r.machine.GetName(), remaining, node.Name)
+	return remaining == 0, nil
+}
+
+// uncordonNode makes the node of the machine schedulable again after a power cycle
+func (r *Reconciler) uncordonNode() error {
+	node, err := r.getMachineNode()
+	if err != nil || node == nil {
+		return err
+	}
+	return r.setNodeUnschedulable(node, false)
+}
+
+// getMachineNode returns the node of the machine, or nil if the machine has no node
+func (r *Reconciler) getMachineNode() (*corev1.Node, error) {
+	if r.machine.Status.NodeRef == nil {
+		return nil, nil
+	}
+	node := &corev1.Node{}
+	if err := r.client.Get(r.Context, runtimeclient.ObjectKey{Name: r.machine.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get node %s: %w", r.machine.Status.NodeRef.Name, err)
+	}
+	return node, nil
+}
+
+func (r *Reconciler) setNodeUnschedulable(node *corev1.Node, unschedulable bool) error {
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+	patch := runtimeclient.MergeFrom(node.DeepCopy())
+	node.Spec.Unschedulable = unschedulable
+	if err := r.client.Patch(r.Context, node, patch); err != nil {
+		return fmt.Errorf("unable to set node %s unschedulable to %t: %w", node.Name, unschedulable, err)
+	}
+	return nil
+}
+
+// isEvictable returns false for the pods which are not evicted by a drain: the mirror pods of static pods,
+// which can not be, the pods of daemon sets, which are recreated on the node anyway, and finished pods.
+func isEvictable(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
@@ -0,0 +1,316 @@
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
+)
+
+func TestReconcileResize(t *testing.T) {
+	testCases := []struct {
+		name              string
+		hotAdd            bool
+		poweredOff        bool
+		annotations       map[string]string
+		numCPUs           int32
+		memoryMiB         int64
+		expectedStep      string
+		expectedCondition *metav1.Condition
+		expectedNumCPUs   int32
+		expectedMemoryMiB int32
+		expectedPowerOff  bool
+	}{
+		{
+			name:              "Without changes",
+			numCPUs:           2,
+			memoryMiB:         2048,
+			expectedNumCPUs:   2,
+			expectedMemoryMiB: 2048,
+		},
+		{
+			name:              "Unset values keep the ones of the vm",
+			expectedNumCPUs:   2,
+			expectedMemoryMiB: 2048,
+		},
+		{
+			name:              "Hot add",
+			hotAdd:            true,
+			numCPUs:           4,
+			memoryMiB:         4096,
+			expectedStep:      hotAddingReason,
+			expectedCondition: &metav1.Condition{Status: metav1.ConditionTrue, Reason: resizeSucceededReason, Message: "Resized with hot add"},
+			expectedNumCPUs:   4,
+			expectedMemoryMiB: 4096,
+		},
+		{
+			name:              "Powered off",
+			poweredOff:        true,
+			numCPUs:           4,
+			memoryMiB:         1024,
+			expectedStep:      resizingPoweredOffReason,
+			expectedCondition: &metav1.Condition{Status: metav1.ConditionTrue, Reason: resizeSucceededReason, Message: "Resized while powered off"},
+			expectedNumCPUs:   4,
+			expectedMemoryMiB: 1024,
+			expectedPowerOff:  true,
+		},
+		{
+			name:      "Power cycle required without hot add",
+			numCPUs:   4,
+			memoryMiB: 2048,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  powerCycleRequiredReason,
+				Message: "The vm does not allow to hot add the changes, set the machine.openshift.io/vsphere-resize-power-cycle annotation to \"true\" to drain the node and power cycle the vm",
+			},
+			expectedNumCPUs:   2,
+			expectedMemoryMiB: 2048,
+		},
+		{
+			name:        "Power cycle required to remove memory",
+			hotAdd:      true,
+			annotations: map[string]string{vsphereutil.ResizePowerCycleAnnotation: "false"},
+			numCPUs:     2,
+			memoryMiB:   1024,
+			expectedCondition: &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  powerCycleRequiredReason,
+				Message: "The vm does not allow to hot add the changes, set the machine.openshift.io/vsphere-resize-power-cycle annotation to \"true\" to drain the node and power cycle the vm",
+			},
+			expectedNumCPUs:   2,
+			expectedMemoryMiB: 2048,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, tc.hotAdd, tc.poweredOff)
+			client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			r := newReconciler(&machineScope{
+				Context:        context.TODO(),
+				session:        session,
+				client:         client,
+				apiReader:      client,
+				machine:        &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "test", Annotations: tc.annotations}},
+				providerSpec:   &machinev1.VSphereMachineProviderSpec{NumCPUs: tc.numCPUs, MemoryMiB: tc.memoryMiB},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{},
+			})
+
+			resizing, err := r.reconcileResize(vm)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(resizing).To(Equal(tc.expectedStep != ""))
+			if tc.expectedStep != "" {
+				// The resize is finished by the reconcile following its task
+				g.Expect(findCondition(r.providerStatus.Conditions, resizeCondition).Reason).To(Equal(tc.expectedStep))
+				g.Expect(waitForTaskRef(session.Client.Client, r.providerStatus.TaskRef)).To(Succeed())
+				g.Expect(r.reconcileResize(vm)).To(BeFalse())
+			}
+
+			condition := findCondition(r.providerStatus.Conditions, resizeCondition)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+			} else {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+				g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+				g.Expect(condition.Message).To(Equal(tc.expectedCondition.Message))
+			}
+
+			var o mo.VirtualMachine
+			g.Expect(vm.Obj.Properties(context.TODO(), vm.Ref, []string{"config.hardware", "runtime.powerState"}, &o)).To(Succeed())
+			g.Expect(o.Config.Hardware.NumCPU).To(Equal(tc.expectedNumCPUs))
+			g.Expect(o.Config.Hardware.MemoryMB).To(Equal(tc.expectedMemoryMiB))
+			g.Expect(o.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOff).To(Equal(tc.expectedPowerOff))
+		})
+	}
+
+	t.Run("Power cycle", func(t *testing.T) {
+		g := NewWithT(t)
+
+		model, session, server := initSimulator(t)
+		defer model.Remove()
+		defer server.Close()
+
+		vm := getResizeTestVM(t, session.Client.Client, false, false)
+
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+		workload := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "test"},
+			Spec:       corev1.PodSpec{NodeName: node.Name},
+		}
+		daemon := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "daemon",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: appsv1.SchemeGroupVersion.String(),
+					Kind:       "DaemonSet",
+					Name:       "daemon",
+					Controller: ptr.To(true),
+				}},
+			},
+			Spec: corev1.PodSpec{NodeName: node.Name},
+		}
+		client := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(node, workload, daemon).
+			WithIndex(&corev1.Pod{}, "spec.nodeName", func(o runtimeclient.Object) []string {
+				return []string{o.(*corev1.Pod).Spec.NodeName}
+			}).
+			Build()
+
+		machine := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "machine",
+				Namespace:   "test",
+				Annotations: map[string]string{vsphereutil.ResizePowerCycleAnnotation: "true"},
+			},
+			Status: machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: node.Name}},
+		}
+		r := newReconciler(&machineScope{
+			Context:        context.TODO(),
+			session:        session,
+			client:         client,
+			apiReader:      client,
+			machine:        machine,
+			providerSpec:   &machinev1.VSphereMachineProviderSpec{NumCPUs: 4, MemoryMiB: 4096},
+			providerStatus: &machinev1.VSphereMachineProviderStatus{},
+		})
+
+		// expectStep expects the reconcile to start the task of the step, and waits for the task
+		expectStep := func(reason string) {
+			g.Expect(r.reconcileResize(vm)).To(BeTrue())
+			condition := findCondition(r.providerStatus.Conditions, resizeCondition)
+			g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			g.Expect(condition.Reason).To(Equal(reason))
+			g.Expect(waitForTaskRef(session.Client.Client, r.providerStatus.TaskRef)).To(Succeed())
+		}
+
+		// The node is cordoned and its workload evicted first
+		resizing, err := r.reconcileResize(vm)
+		g.Expect(err).To(MatchError("waiting for the node of the machine to be drained before powering off the vm"))
+		g.Expect(resizing).To(BeFalse())
+		condition := findCondition(r.providerStatus.Conditions, resizeCondition)
+		g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(condition.Reason).To(Equal(drainingReason))
+		g.Expect(client.Get(context.TODO(), runtimeclient.ObjectKeyFromObject(node), node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeTrue())
+		pods := &corev1.PodList{}
+		g.Expect(client.List(context.TODO(), pods)).To(Succeed())
+		g.Expect(pods.Items).To(HaveLen(1))
+		g.Expect(pods.Items[0].Name).To(Equal(daemon.Name))
+
+		// Once drained, the vm is power cycled, a step per reconcile, and the node uncordoned
+		expectStep(poweringOffReason)
+		g.Expect(isPowerCycling(r.providerStatus.Conditions)).To(BeTrue())
+		expectStep(reconfiguringReason)
+		expectStep(poweringOnReason)
+		g.Expect(r.reconcileResize(vm)).To(BeFalse())
+		condition = findCondition(r.providerStatus.Conditions, resizeCondition)
+		g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		g.Expect(condition.Reason).To(Equal(resizeSucceededReason))
+		g.Expect(condition.Message).To(Equal("Resized with a power cycle"))
+		g.Expect(isPowerCycling(r.providerStatus.Conditions)).To(BeFalse())
+		g.Expect(client.Get(context.TODO(), runtimeclient.ObjectKeyFromObject(node), node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeFalse())
+
+		var o mo.VirtualMachine
+		g.Expect(vm.Obj.Properties(context.TODO(), vm.Ref, []string{"config.hardware", "runtime.powerState"}, &o)).To(Succeed())
+		g.Expect(o.Config.Hardware.NumCPU).To(BeEquivalentTo(4))
+		g.Expect(o.Config.Hardware.NumCoresPerSocket).To(BeEquivalentTo(4))
+		g.Expect(o.Config.Hardware.MemoryMB).To(BeEquivalentTo(4096))
+		g.Expect(o.Runtime.PowerState).To(Equal(types.VirtualMachinePowerStatePoweredOn))
+
+		// The tasks of the steps are kept in the task history
+		var operations []taskOperation
+		for _, record := range r.taskHistory {
+			operations = append(operations, record.Operation)
+		}
+		g.Expect(operations).To(Equal([]taskOperation{taskOperationPowerOff, taskOperationResize, taskOperationPowerOn}))
+
+		// A power cycle interrupted after powering off the vm is resumed
+		r.setResizeCondition(metav1.ConditionFalse, poweringOffReason, "Powering off the vm")
+		task, err := vm.Obj.PowerOff(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(task.Wait(context.TODO())).To(Succeed())
+		r.providerSpec.NumCPUs = 2
+		expectStep(reconfiguringReason)
+		expectStep(poweringOnReason)
+		g.Expect(r.reconcileResize(vm)).To(BeFalse())
+		g.Expect(vm.Obj.Properties(context.TODO(), vm.Ref, []string{"config.hardware", "runtime.powerState"}, &o)).To(Succeed())
+		g.Expect(o.Config.Hardware.NumCPU).To(BeEquivalentTo(2))
+		g.Expect(o.Runtime.PowerState).To(Equal(types.VirtualMachinePowerStatePoweredOn))
+		g.Expect(findCondition(r.providerStatus.Conditions, resizeCondition).Reason).To(Equal(resizeSucceededReason))
+	})
+
+	t.Run("Failed step", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := newReconciler(&machineScope{
+			Context:        context.TODO(),
+			machine:        &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "test"}},
+			providerStatus: &machinev1.VSphereMachineProviderStatus{TaskRef: "task-1"},
+		})
+
+		// The failed task of a finished resize is not retried
+		r.setResizeCondition(metav1.ConditionTrue, resizeSucceededReason, "Resized with hot add")
+		g.Expect(r.stepTaskFailed(errors.New("task failed"))).To(BeFalse())
+		g.Expect(r.providerStatus.TaskRef).To(Equal("task-1"))
+
+		// The failed task of a step is forgotten, so the step is retried
+		r.setResizeCondition(metav1.ConditionFalse, reconfiguringReason, "Resizing the powered off vm")
+		g.Expect(r.stepTaskFailed(errors.New("task failed"))).To(BeTrue())
+		g.Expect(r.providerStatus.TaskRef).To(BeEmpty())
+		condition := findCondition(r.providerStatus.Conditions, resizeCondition)
+		g.Expect(condition.Reason).To(Equal(reconfiguringReason))
+		g.Expect(condition.Message).To(Equal("task failed"))
+	})
+}
+
+// getResizeTestVM returns a simulator vm with 2 CPUs and 2GiB of memory
+func getResizeTestVM(t *testing.T, c *vim25.Client, hotAdd, poweredOff bool) *virtualMachine {
+	simVM := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	simVM.Config.Hardware.NumCPU = 2
+	simVM.Config.Hardware.NumCoresPerSocket = 1
+	simVM.Config.Hardware.MemoryMB = 2048
+	simVM.Config.CpuHotAddEnabled = ptr.To(hotAdd)
+	simVM.Config.CpuHotRemoveEnabled = ptr.To(hotAdd)
+	simVM.Config.MemoryHotAddEnabled = ptr.To(hotAdd)
+
+	vm := &virtualMachine{
+		Context: context.TODO(),
+		Obj:     object.NewVirtualMachine(c, simVM.Reference()),
+		Ref:     simVM.Reference(),
+	}
+	if poweredOff {
+		task, err := vm.Obj.PowerOff(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := task.Wait(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vm
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+)
+
+// Results of a vCenter API request, or of a task
+const (
+	requestResultSuccess = "success"
+	// requestResultFault is a request rejected by vCenter, e.g. a SOAP fault or a REST 4xx status
+	requestResultFault = "fault"
+	// requestResultError is a request which failed to be served, e.g. a transport error or a REST 5xx status
+	requestResultError = "error"
+)
+
+const (
+	tagCacheKindTag      = "tag"
+	tagCacheKindCategory = "category"
+
+	// observedTaskTTL is how long a finished task is remembered, so that its duration is observed once
+	observedTaskTTL = time.Hour
+)
+
+// taskMetricNames maps the description IDs of the tasks of the machine lifecycle to the task label of their duration
+var taskMetricNames = map[string]string{
+	"VirtualMachine.clone":    "clone",
+	"VirtualMachine.powerOn":  "power_on",
+	"Datacenter.powerOnVm":    "power_on",
+	"VirtualMachine.powerOff": "power_off",
+	"VirtualMachine.destroy":  "destroy",
+}
+
+// observedTasks holds the finished tasks whose duration was observed, along with the time they were observed
+var observedTasks = map[string]time.Time{}
+var observedTasksMU sync.Mutex
+
+// instrumentedRoundTripper observes the latency of the SOAP requests of a vim25 client.
+type instrumentedRoundTripper struct {
+	server string
+	next   soap.RoundTripper
+}
+
+func (rt *instrumentedRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	start := time.Now()
+	err := rt.next.RoundTrip(ctx, req, res)
+
+	result := requestResultSuccess
+	if soap.IsSoapFault(err) {
+		result = requestResultFault
+	} else if err != nil {
+		result = requestResultError
+	}
+	metrics.ObserveVSphereAPIRequest(rt.server, soapMethod(req), result, time.Since(start))
+	return err
+}
+
+// soapMethod returns the method of a SOAP request, e.g. RetrieveProperties for a RetrievePropertiesBody.
+func soapMethod(req soap.HasFault) string {
+	t := reflect.TypeOf(req)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Body")
+}
+
+// instrumentedTransport observes the latency of the HTTP requests of a REST client.
+type instrumentedTransport struct {
+	server string
+	next   http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	result := requestResultSuccess
+	switch {
+	case err != nil || res.StatusCode >= http.StatusInternalServerError:
+		result = requestResultError
+	case res.StatusCode >= http.StatusBadRequest:
+		result = requestResultFault
+	}
+	metrics.ObserveVSphereAPIRequest(t.server, restMethod(req), result, time.Since(start))
+	return res, err
+}
+
+// restMethod returns the method of a REST request, its HTTP method and path without the IDs of the objects, along
+// with its action, e.g. "POST /rest/com/vmware/cis/tagging/tag-association?~action=list-attached-objects".
+func restMethod(req *http.Request) string {
+	var segments []string
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if strings.HasPrefix(segment, "id:") || strings.HasPrefix(segment, "urn:") {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	method := req.Method + " " + strings.Join(segments, "/")
+	if action := req.URL.Query().Get("~action"); action != "" {
+		method += "?~action=" + action
+	}
+	return method
+}
+
+// observeTaskDuration records the duration of a finished task of the machine lifecycle, once per task.
+func observeTaskDuration(server string, info types.TaskInfo) {
+	task, ok := taskMetricNames[info.DescriptionId]
+	if !ok || info.StartTime == nil || info.CompleteTime == nil {
+		return
+	}
+
+	observedTasksMU.Lock()
+	defer observedTasksMU.Unlock()
+
+	for key, observed := range observedTasks {
+		if time.Since(observed) > observedTaskTTL {
+			delete(observedTasks, key)
+		}
+	}
+	key := server + "/" + info.Task.Value
+	if _, ok := observedTasks[key]; ok {
+		return
+	}
+	observedTasks[key] = time.Now()
+
+	result := requestResultSuccess
+	if info.State == types.TaskInfoStateError {
+		result = requestResultError
+	}
+	metrics.ObserveVSphereTaskDuration(server, task, result, info.CompleteTime.Sub(*info.StartTime))
+}
+
+// updateActiveSessions records the number of sessions cached for a vCenter. sessionMU must be held.
+func updateActiveSessions(server string) {
+	count := 0
+	for _, cached := range sessionCache {
+		if cached.server == server {
+			count++
+		}
+	}
+	metrics.SetVSphereActiveSessions(server, count)
+}
@@ -0,0 +1,231 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/methods"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// metricValue returns the value of a counter or gauge, or the sample count of a histogram, with the given labels
+func metricValue(g Gomega, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			switch {
+			case metric.Counter != nil:
+				return metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				return metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, label := range metric.GetLabel() {
+		if value, ok := labels[label.GetName()]; ok {
+			if value != label.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestAPIRequestMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	vcenter := server.URL.Host
+
+	success := map[string]string{"vcenter": vcenter, "method": "RetrievePropertiesEx", "result": requestResultSuccess}
+	fault := map[string]string{"vcenter": vcenter, "method": "RetrievePropertiesEx", "result": requestResultFault}
+	successBefore := metricValue(g, "mapi_vsphere_api_request_duration_seconds", success)
+	faultBefore := metricValue(g, "mapi_vsphere_api_request_duration_seconds", fault)
+
+	obj := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vm := object.NewVirtualMachine(session.Client.Client, obj.Reference())
+	task, err := vm.PowerOff(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(context.TODO())).To(Succeed())
+
+	_, err = session.GetTask(context.TODO(), task.Reference().Value)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(metricValue(g, "mapi_vsphere_api_request_duration_seconds", success)).To(Equal(successBefore + 1))
+
+	_, err = session.GetTask(context.TODO(), "task-404")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(metricValue(g, "mapi_vsphere_api_request_duration_seconds", fault)).To(Equal(faultBefore + 1))
+
+	// REST requests are observed as well
+	login := map[string]string{"vcenter": vcenter, "method": "POST /rest/com/vmware/cis/session", "result": requestResultSuccess}
+	loginBefore := metricValue(g, "mapi_vsphere_api_request_duration_seconds", login)
+	g.Expect(session.WithRestClient(context.TODO(), func(c *rest.Client) error { return nil })).To(Succeed())
+	g.Expect(metricValue(g, "mapi_vsphere_api_request_duration_seconds", login)).To(Equal(loginBefore + 1))
+
+	// Storage policy requests are observed as well, the client being created once
+	serviceContent := map[string]string{"vcenter": vcenter, "method": "PbmRetrieveServiceContent", "result": requestResultSuccess}
+	queryProfile := map[string]string{"vcenter": vcenter, "method": "PbmQueryProfile", "result": requestResultSuccess}
+	serviceContentBefore := metricValue(g, "mapi_vsphere_api_request_duration_seconds", serviceContent)
+	queryProfileBefore := metricValue(g, "mapi_vsphere_api_request_duration_seconds", queryProfile)
+	for i := 0; i < 2; i++ {
+		_, err = session.GetStoragePolicyID(context.TODO(), "vSAN Default Storage Policy")
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(metricValue(g, "mapi_vsphere_api_request_duration_seconds", serviceContent)).To(Equal(serviceContentBefore + 1))
+	g.Expect(metricValue(g, "mapi_vsphere_api_request_duration_seconds", queryProfile)).To(Equal(queryProfileBefore + 2))
+}
+
+func TestTaskDurationMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	vcenter := server.URL.Host
+
+	powerOff := map[string]string{"vcenter": vcenter, "task": "power_off", "result": requestResultSuccess}
+	destroy := map[string]string{"vcenter": vcenter, "task": "destroy", "result": requestResultSuccess}
+
+	obj := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vm := object.NewVirtualMachine(session.Client.Client, obj.Reference())
+
+	// The duration of a task is observed once it is finished, and only once
+	task, err := vm.PowerOff(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(context.TODO())).To(Succeed())
+	for i := 0; i < 2; i++ {
+		_, err = session.GetTask(context.TODO(), task.Reference().Value)
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(metricValue(g, "mapi_vsphere_task_duration_seconds", powerOff)).To(Equal(1.0))
+
+	task, err = vm.Destroy(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(context.TODO())).To(Succeed())
+	_, err = session.GetTask(context.TODO(), task.Reference().Value)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(metricValue(g, "mapi_vsphere_task_duration_seconds", destroy)).To(Equal(1.0))
+}
+
+func TestActiveSessionsMetric(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	vcenter := map[string]string{"vcenter": server.URL.Host}
+
+	g.Expect(metricValue(g, "mapi_vsphere_active_sessions", vcenter)).To(Equal(1.0))
+
+	InvalidateCredentials(context.TODO(), server.URL.Host, session.username, session.password)
+	g.Expect(metricValue(g, "mapi_vsphere_active_sessions", vcenter)).To(Equal(0.0))
+}
+
+func TestTagCacheMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+	defer purgeCache()
+
+	ctx := context.TODO()
+	tag := map[string]string{"kind": tagCacheKindTag}
+	category := map[string]string{"kind": tagCacheKindCategory}
+	tagHits := metricValue(g, "mapi_vsphere_tag_cache_hits", tag)
+	tagMisses := metricValue(g, "mapi_vsphere_tag_cache_misses", tag)
+	categoryHits := metricValue(g, "mapi_vsphere_tag_cache_hits", category)
+	categoryMisses := metricValue(g, "mapi_vsphere_tag_cache_misses", category)
+
+	g.Expect(session.WithCachingTagsManager(ctx, func(m *CachingTagsManager) error {
+		createTagsAndCategories(ctx, []string{"foo"}, nil, m, g)
+		defer cleanupTagsAndCategories(ctx, m, g)
+
+		for i := 0; i < 3; i++ {
+			_, err := m.GetTag(ctx, "foo")
+			g.Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := m.GetCategory(ctx, "test")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// Lookups by ID do not use the cache
+		tagID, found := getOrCreateSessionCache(session.sessionKey).tags.Get("foo")
+		g.Expect(found).To(BeTrue())
+		_, err = m.GetTag(ctx, tagID)
+		g.Expect(err).ToNot(HaveOccurred())
+		return nil
+	})).To(Succeed())
+
+	g.Expect(metricValue(g, "mapi_vsphere_tag_cache_misses", tag)).To(Equal(tagMisses + 1))
+	g.Expect(metricValue(g, "mapi_vsphere_tag_cache_hits", tag)).To(Equal(tagHits + 2))
+	g.Expect(metricValue(g, "mapi_vsphere_tag_cache_misses", category)).To(Equal(categoryMisses + 1))
+	g.Expect(metricValue(g, "mapi_vsphere_tag_cache_hits", category)).To(Equal(categoryHits))
+}
+
+func TestSOAPMethod(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(soapMethod(&methods.RetrievePropertiesExBody{})).To(Equal("RetrievePropertiesEx"))
+	g.Expect(soapMethod(&methods.CloneVM_TaskBody{})).To(Equal("CloneVM_Task"))
+}
+
+func TestRESTMethod(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		expected string
+	}{
+		{
+			name:     "Login",
+			method:   http.MethodPost,
+			url:      "https://vcenter/rest/com/vmware/cis/session",
+			expected: "POST /rest/com/vmware/cis/session",
+		},
+		{
+			name:     "Tag by ID",
+			method:   http.MethodGet,
+			url:      "https://vcenter/rest/com/vmware/cis/tagging/tag/id:urn:vmomi:InventoryServiceTag:1b6f3d9b:GLOBAL",
+			expected: "GET /rest/com/vmware/cis/tagging/tag",
+		},
+		{
+			name:     "Action",
+			method:   http.MethodPost,
+			url:      "https://vcenter/rest/com/vmware/cis/tagging/tag-association/id:urn:vmomi:InventoryServiceTag:1b6f3d9b:GLOBAL?~action=list-attached-objects",
+			expected: "POST /rest/com/vmware/cis/tagging/tag-association?~action=list-attached-objects",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(restMethod(req)).To(Equal(tc.expected))
+		})
+	}
+}
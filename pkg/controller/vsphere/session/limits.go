@@ -0,0 +1,340 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
+)
+
+const (
+	DefaultQPS                    = 10
+	DefaultBurst                  = 20
+	DefaultMaxInFlightTasks       = 10
+	DefaultFailureThreshold       = 5
+	DefaultCircuitBreakerCooldown = time.Minute
+
+	// maxRateLimitWait is how long a request waits for the rate limit, a longer wait requeues the machine instead
+	maxRateLimitWait = 5 * time.Second
+	// inFlightTaskTTL releases the slot of a task whose completion was never observed, e.g. the clone of a machine
+	// deleted before its clone finished
+	inFlightTaskTTL = time.Hour
+	// throttledTaskRetryAfter is how long a machine waits for a slot when the maximum number of tasks is in flight
+	throttledTaskRetryAfter = 30 * time.Second
+	// circuitBreakerProbeRetryAfter is how long a machine waits while another request probes a vCenter
+	circuitBreakerProbeRetryAfter = 10 * time.Second
+)
+
+// Reasons of a ThrottledError
+const (
+	ThrottledReasonRateLimit        = "RateLimit"
+	ThrottledReasonCircuitBreaker   = "CircuitBreakerOpen"
+	ThrottledReasonMaxInFlightTasks = "MaxInFlightTasks"
+)
+
+// ClientLimits are the limits of the requests of the controller to each vCenter, shared by all its sessions.
+type ClientLimits struct {
+	// QPS is the sustained rate of API requests to a vCenter. 0 disables the rate limit.
+	QPS float32
+	// Burst is the number of API requests which can be sent at once above QPS.
+	Burst int
+	// MaxInFlightTasks is the maximum number of tasks, e.g. clones, started on a vCenter and not finished yet.
+	// 0 disables the cap.
+	MaxInFlightTasks int
+	// FailureThreshold is the number of consecutive server faults which open the circuit breaker of a vCenter.
+	// 0 disables the circuit breaker.
+	FailureThreshold int
+	// CircuitBreakerCooldown is how long the circuit breaker stays open before a request probes the vCenter again.
+	CircuitBreakerCooldown time.Duration
+}
+
+// DefaultClientLimits returns the limits used when none are set.
+func DefaultClientLimits() ClientLimits {
+	return ClientLimits{
+		QPS:                    DefaultQPS,
+		Burst:                  DefaultBurst,
+		MaxInFlightTasks:       DefaultMaxInFlightTasks,
+		FailureThreshold:       DefaultFailureThreshold,
+		CircuitBreakerCooldown: DefaultCircuitBreakerCooldown,
+	}
+}
+
+var clientLimits = DefaultClientLimits()
+var limiters = map[string]*vCenterLimiter{}
+var limitersMU sync.Mutex
+
+// SetClientLimits sets the limits of the requests to each vCenter, and resets the state of the limiters.
+// It is meant to be called on start up, before any session is created.
+func SetClientLimits(limits ClientLimits) {
+	limitersMU.Lock()
+	defer limitersMU.Unlock()
+
+	clientLimits = limits
+	limiters = map[string]*vCenterLimiter{}
+}
+
+// ThrottledError is returned instead of sending a request or starting a task when a vCenter is throttled.
+// The request is meant to be retried after RetryAfter, e.g. by requeueing the machine.
+type ThrottledError struct {
+	Server     string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("requests to vCenter %s are throttled (%s), retrying after %v", e.Server, e.Reason, e.RetryAfter)
+}
+
+type circuitBreakerState int
+
+const (
+	circuitBreakerClosed circuitBreakerState = iota
+	circuitBreakerOpen
+	// circuitBreakerHalfOpen lets a single request probe the vCenter once the cooldown is over
+	circuitBreakerHalfOpen
+)
+
+// vCenterLimiter rate limits the requests, caps the tasks in flight and breaks the circuit of a vCenter.
+type vCenterLimiter struct {
+	server      string
+	limits      ClientLimits
+	rateLimiter *rate.Limiter
+
+	// mu guards the state of the circuit breaker
+	mu       sync.Mutex
+	state    circuitBreakerState
+	failures int
+	openedAt time.Time
+
+	// tasksMU guards the tasks in flight, by task reference, along with the time they were started
+	tasksMU       sync.Mutex
+	inFlightTasks map[string]time.Time
+}
+
+// getLimiter returns the limiter shared by the sessions of a vCenter.
+func getLimiter(server string) *vCenterLimiter {
+	limitersMU.Lock()
+	defer limitersMU.Unlock()
+
+	if l, ok := limiters[server]; ok {
+		return l
+	}
+	l := newLimiter(server, clientLimits)
+	limiters[server] = l
+	return l
+}
+
+func newLimiter(server string, limits ClientLimits) *vCenterLimiter {
+	rateLimiter := rate.NewLimiter(rate.Inf, 0)
+	if limits.QPS > 0 {
+		rateLimiter = rate.NewLimiter(rate.Limit(limits.QPS), max(limits.Burst, 1))
+	}
+	return &vCenterLimiter{
+		server:        server,
+		limits:        limits,
+		rateLimiter:   rateLimiter,
+		inFlightTasks: map[string]time.Time{},
+	}
+}
+
+// wait blocks until a request can be sent to the vCenter. It returns a ThrottledError without waiting when the
+// circuit breaker is open, or when the rate limit would delay the request for too long.
+func (l *vCenterLimiter) wait(ctx context.Context) error {
+	reservation := l.rateLimiter.Reserve()
+	if !reservation.OK() {
+		metrics.RegisterVSphereRequestThrottled(l.server, ThrottledReasonRateLimit)
+		return &ThrottledError{Server: l.server, Reason: ThrottledReasonRateLimit, RetryAfter: maxRateLimitWait}
+	}
+	if delay := reservation.Delay(); delay > 0 {
+		if delay > maxRateLimitWait {
+			reservation.Cancel()
+			metrics.RegisterVSphereRequestThrottled(l.server, ThrottledReasonRateLimit)
+			return &ThrottledError{Server: l.server, Reason: ThrottledReasonRateLimit, RetryAfter: delay}
+		}
+		metrics.RegisterVSphereRequestDelayed(l.server)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			reservation.Cancel()
+			return ctx.Err()
+		}
+	}
+	return l.allow()
+}
+
+// allow returns a ThrottledError when the circuit breaker is open. Once the cooldown is over, the breaker is half
+// open and lets a single request through, to probe whether the vCenter recovered.
+func (l *vCenterLimiter) allow() error {
+	if l.limits.FailureThreshold <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch l.state {
+	case circuitBreakerOpen:
+		if elapsed := time.Since(l.openedAt); elapsed < l.limits.CircuitBreakerCooldown {
+			metrics.RegisterVSphereRequestThrottled(l.server, ThrottledReasonCircuitBreaker)
+			return &ThrottledError{
+				Server:     l.server,
+				Reason:     ThrottledReasonCircuitBreaker,
+				RetryAfter: l.limits.CircuitBreakerCooldown - elapsed,
+			}
+		}
+		klog.Infof("Circuit breaker of vCenter %s is half open, probing vCenter", l.server)
+		l.state = circuitBreakerHalfOpen
+		return nil
+	case circuitBreakerHalfOpen:
+		metrics.RegisterVSphereRequestThrottled(l.server, ThrottledReasonCircuitBreaker)
+		return &ThrottledError{Server: l.server, Reason: ThrottledReasonCircuitBreaker, RetryAfter: circuitBreakerProbeRetryAfter}
+	default:
+		return nil
+	}
+}
+
+// observe records the outcome of a request sent to the vCenter. Consecutive server faults open the circuit breaker,
+// a request served without a server fault closes it. Requests cancelled by the caller are ignored.
+func (l *vCenterLimiter) observe(ctx context.Context, err error, serverFault bool) {
+	if l.limits.FailureThreshold <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		// A cancelled probe leaves the cooldown over, the next request probes the vCenter instead
+		if l.state == circuitBreakerHalfOpen {
+			l.state = circuitBreakerOpen
+		}
+		return
+	}
+
+	if !serverFault {
+		if l.state != circuitBreakerClosed {
+			klog.Infof("Circuit breaker of vCenter %s closed", l.server)
+			metrics.SetVSphereCircuitBreakerOpen(l.server, false)
+		}
+		l.state = circuitBreakerClosed
+		l.failures = 0
+		return
+	}
+
+	l.failures++
+	if l.state == circuitBreakerHalfOpen || (l.state == circuitBreakerClosed && l.failures >= l.limits.FailureThreshold) {
+		klog.Warningf("Circuit breaker of vCenter %s opened for %v after %d consecutive server faults, last one: %v",
+			l.server, l.limits.CircuitBreakerCooldown, l.failures, err)
+		l.state = circuitBreakerOpen
+		l.openedAt = time.Now()
+		metrics.SetVSphereCircuitBreakerOpen(l.server, true)
+	}
+}
+
+// startTask starts a task unless the maximum number of tasks is in flight on the vCenter, in which case it returns
+// a ThrottledError. The task is in flight until finishTask is called with its reference.
+func (l *vCenterLimiter) startTask(start func() (*object.Task, error)) (*object.Task, error) {
+	l.tasksMU.Lock()
+	defer l.tasksMU.Unlock()
+
+	for ref, started := range l.inFlightTasks {
+		if time.Since(started) > inFlightTaskTTL {
+			delete(l.inFlightTasks, ref)
+		}
+	}
+	if l.limits.MaxInFlightTasks > 0 && len(l.inFlightTasks) >= l.limits.MaxInFlightTasks {
+		metrics.RegisterVSphereRequestThrottled(l.server, ThrottledReasonMaxInFlightTasks)
+		return nil, &ThrottledError{Server: l.server, Reason: ThrottledReasonMaxInFlightTasks, RetryAfter: throttledTaskRetryAfter}
+	}
+
+	task, err := start()
+	if err != nil {
+		return nil, err
+	}
+	l.inFlightTasks[task.Reference().Value] = time.Now()
+	metrics.SetVSphereInFlightTasks(l.server, len(l.inFlightTasks))
+	return task, nil
+}
+
+// finishTask releases the slot of a task started by startTask.
+func (l *vCenterLimiter) finishTask(taskRef string) {
+	l.tasksMU.Lock()
+	defer l.tasksMU.Unlock()
+
+	if _, ok := l.inFlightTasks[taskRef]; !ok {
+		return
+	}
+	delete(l.inFlightTasks, taskRef)
+	metrics.SetVSphereInFlightTasks(l.server, len(l.inFlightTasks))
+}
+
+// isServerFault tells whether an error returned by vCenter means the server is unhealthy, as opposed to a fault of
+// the request, e.g. a missing object or invalid credentials.
+func isServerFault(err error) bool {
+	if err == nil {
+		return false
+	}
+	if soap.IsCertificateUntrusted(err) {
+		return false
+	}
+	if soap.IsSoapFault(err) {
+		switch soap.ToSoapFault(err).VimFault().(type) {
+		case types.SystemError, *types.SystemError, types.HostCommunication, *types.HostCommunication:
+			return true
+		default:
+			return false
+		}
+	}
+	// Transport errors, and responses with an unexpected HTTP status
+	return true
+}
+
+// limitedRoundTripper limits the SOAP requests of a vim25 client.
+type limitedRoundTripper struct {
+	limiter *vCenterLimiter
+	next    soap.RoundTripper
+}
+
+func (rt *limitedRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	if err := rt.limiter.wait(ctx); err != nil {
+		return err
+	}
+	err := rt.next.RoundTrip(ctx, req, res)
+	rt.limiter.observe(ctx, err, isServerFault(err))
+	return err
+}
+
+// limitedTransport limits the HTTP requests of a REST client.
+type limitedTransport struct {
+	limiter *vCenterLimiter
+	next    http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.limiter.observe(ctx, err, true)
+	} else {
+		var statusErr error
+		if res.StatusCode >= http.StatusInternalServerError {
+			statusErr = fmt.Errorf("%s", res.Status)
+		}
+		t.limiter.observe(ctx, statusErr, statusErr != nil)
+	}
+	return res, err
+}
@@ -0,0 +1,214 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestRateLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	l := newLimiter("vcenter", ClientLimits{QPS: 0.1, Burst: 1})
+	g.Expect(l.wait(context.TODO())).To(Succeed())
+
+	// The next token is 10 seconds away, longer than a request waits
+	err := l.wait(context.TODO())
+	var throttledErr *ThrottledError
+	g.Expect(errors.As(err, &throttledErr)).To(BeTrue())
+	g.Expect(throttledErr.Reason).To(Equal(ThrottledReasonRateLimit))
+	g.Expect(throttledErr.RetryAfter).To(BeNumerically("~", 10*time.Second, time.Second))
+
+	// Without a rate limit, requests are never delayed
+	l = newLimiter("vcenter", ClientLimits{})
+	for i := 0; i < 100; i++ {
+		g.Expect(l.wait(context.TODO())).To(Succeed())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+	fault := errors.New("connection refused")
+
+	l := newLimiter("vcenter", ClientLimits{FailureThreshold: 2, CircuitBreakerCooldown: 100 * time.Millisecond})
+
+	// A success resets the consecutive faults
+	l.observe(ctx, fault, true)
+	l.observe(ctx, nil, false)
+	l.observe(ctx, fault, true)
+	g.Expect(l.allow()).To(Succeed())
+
+	// Faults of the requests are not server faults
+	l.observe(ctx, errors.New("not found"), false)
+	l.observe(ctx, fault, true)
+	g.Expect(l.allow()).To(Succeed())
+
+	l.observe(ctx, fault, true)
+	err := l.allow()
+	var throttledErr *ThrottledError
+	g.Expect(errors.As(err, &throttledErr)).To(BeTrue())
+	g.Expect(throttledErr.Reason).To(Equal(ThrottledReasonCircuitBreaker))
+	g.Expect(throttledErr.RetryAfter).To(BeNumerically("<=", 100*time.Millisecond))
+
+	// Once the cooldown is over, a single request probes the vCenter
+	time.Sleep(100 * time.Millisecond)
+	g.Expect(l.allow()).To(Succeed())
+	g.Expect(l.allow()).ToNot(Succeed())
+
+	// A failed probe opens the breaker again
+	l.observe(ctx, fault, true)
+	g.Expect(l.allow()).ToNot(Succeed())
+
+	// A cancelled probe lets the next request probe
+	time.Sleep(100 * time.Millisecond)
+	g.Expect(l.allow()).To(Succeed())
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	l.observe(cancelled, context.Canceled, true)
+	g.Expect(l.allow()).To(Succeed())
+
+	// A successful probe closes the breaker
+	l.observe(ctx, nil, false)
+	g.Expect(l.allow()).To(Succeed())
+	g.Expect(l.allow()).To(Succeed())
+}
+
+func TestCircuitBreakerOpensOnServerFaults(t *testing.T) {
+	g := NewWithT(t)
+
+	SetClientLimits(ClientLimits{FailureThreshold: 2, CircuitBreakerCooldown: time.Hour})
+	defer SetClientLimits(DefaultClientLimits())
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+
+	// Requests to a stopped vCenter fail with transport errors
+	server.Close()
+	var throttledErr *ThrottledError
+	for i := 0; i < 2; i++ {
+		_, err := session.GetTask(context.TODO(), "task-1")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(errors.As(err, &throttledErr)).To(BeFalse())
+	}
+
+	_, err := session.GetTask(context.TODO(), "task-1")
+	g.Expect(errors.As(err, &throttledErr)).To(BeTrue())
+	g.Expect(throttledErr.Reason).To(Equal(ThrottledReasonCircuitBreaker))
+	g.Expect(throttledErr.Server).To(Equal(server.URL.Host))
+}
+
+func TestCircuitBreakerLimitsStoragePolicyRequests(t *testing.T) {
+	g := NewWithT(t)
+
+	SetClientLimits(ClientLimits{FailureThreshold: 1, CircuitBreakerCooldown: time.Hour})
+	defer SetClientLimits(DefaultClientLimits())
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+
+	server.Close()
+	_, err := session.GetTask(context.TODO(), "task-1")
+	g.Expect(err).To(HaveOccurred())
+
+	var throttledErr *ThrottledError
+	_, err = session.GetStoragePolicyID(context.TODO(), "vSAN Default Storage Policy")
+	g.Expect(errors.As(err, &throttledErr)).To(BeTrue())
+	g.Expect(throttledErr.Reason).To(Equal(ThrottledReasonCircuitBreaker))
+}
+
+func TestMaxInFlightTasks(t *testing.T) {
+	g := NewWithT(t)
+
+	SetClientLimits(ClientLimits{MaxInFlightTasks: 1})
+	defer SetClientLimits(DefaultClientLimits())
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	obj := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	vm := object.NewVirtualMachine(session.Client.Client, obj.Reference())
+
+	task, err := session.StartTask(func() (*object.Task, error) {
+		return vm.PowerOff(context.TODO())
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	started := false
+	_, err = session.StartTask(func() (*object.Task, error) {
+		started = true
+		return vm.PowerOn(context.TODO())
+	})
+	var throttledErr *ThrottledError
+	g.Expect(errors.As(err, &throttledErr)).To(BeTrue())
+	g.Expect(throttledErr.Reason).To(Equal(ThrottledReasonMaxInFlightTasks))
+	g.Expect(started).To(BeFalse())
+
+	// The slot of the task is released once it is found finished
+	g.Expect(task.Wait(context.TODO())).To(Succeed())
+	moTask, err := session.GetTask(context.TODO(), task.Reference().Value)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(moTask.Info.State).To(Equal(types.TaskInfoStateSuccess))
+
+	_, err = session.StartTask(func() (*object.Task, error) {
+		return vm.PowerOn(context.TODO())
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestIsServerFault(t *testing.T) {
+	soapFault := func(fault types.AnyType) error {
+		f := &soap.Fault{}
+		f.Detail.Fault = fault
+		return soap.WrapSoapFault(f)
+	}
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "No error",
+		},
+		{
+			name:     "Transport error",
+			err:      fmt.Errorf("dial tcp: connection refused"),
+			expected: true,
+		},
+		{
+			name:     "System error",
+			err:      soapFault(types.SystemError{Reason: "vpxd is restarting"}),
+			expected: true,
+		},
+		{
+			name:     "Host communication error",
+			err:      soapFault(&types.HostCommunication{}),
+			expected: true,
+		},
+		{
+			name: "Object not found",
+			err:  soapFault(types.ManagedObjectNotFound{}),
+		},
+		{
+			name: "Invalid login",
+			err:  soapFault(types.InvalidLogin{}),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(isServerFault(tc.err)).To(Equal(tc.expected))
+		})
+	}
+}
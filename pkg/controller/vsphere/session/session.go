@@ -18,12 +18,19 @@ package session
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/vmware/govmomi/pbm"
+	pbmmethods "github.com/vmware/govmomi/pbm/methods"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
 	"github.com/vmware/govmomi/vapi/rest"
 	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25/mo"
@@ -40,6 +47,14 @@ import (
 var sessionCache = map[string]Session{}
 var sessionMU sync.Mutex
 
+// loggedInCredentials holds the fingerprint of the last credentials which logged in to a vCenter datacenter,
+// to tell a login failing with rotated credentials apart. It is guarded by sessionMU.
+var loggedInCredentials = map[string]string{}
+
+// sessionLogoutGracePeriod is how long an evicted session stays logged in, so the reconciles still using it can
+// finish their requests.
+var sessionLogoutGracePeriod = 1 * time.Minute
+
 const (
 	managedObjectTypeTask = "Task"
 	clientTimeout         = 15 * time.Second
@@ -54,7 +69,46 @@ type Session struct {
 	username string
 	password string
 
+	// server, datacenter and fingerprint identify the sessions to evict when their credentials are rotated
+	server      string
+	datacenter  string
+	fingerprint string
+	// host is the host name of the server, for logging
+	host string
+
 	sessionKey string
+
+	// pbm is shared by the copies of the session, so its storage policy client is created once
+	pbm *pbmClient
+}
+
+// pbmClient is the storage policy client of a session, created on first use.
+type pbmClient struct {
+	mu     sync.Mutex
+	client *pbm.Client
+}
+
+// LoginError is returned by GetOrCreate when vCenter rejects the credentials.
+type LoginError struct {
+	Server string
+	// CredentialsRotated is true when other credentials logged in to the vCenter datacenter before, e.g. the ones
+	// held by the credentials secret before it was rotated.
+	CredentialsRotated bool
+	Err                error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("unable to login to vCenter: %v", e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// credentialsFingerprint identifies credentials in the session keys without exposing the password.
+func credentialsFingerprint(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(sum[:8])
 }
 
 func newClientWithTimeout(ctx context.Context, u *url.URL, insecure bool, timeout time.Duration) (*govmomi.Client, error) {
@@ -78,10 +132,16 @@ func GetOrCreate(
 	sessionMU.Lock()
 	defer sessionMU.Unlock()
 
-	sessionKey := server + username + datacenter
+	// The password is part of the key, so a rotated password does not reuse the session of the previous one
+	fingerprint := credentialsFingerprint(username, password)
+	sessionKey := server + datacenter + fingerprint
 	if session, ok := sessionCache[sessionKey]; ok {
 		sessionActive, err := session.SessionManager.SessionIsActive(ctx)
 		if err != nil {
+			var throttledErr *ThrottledError
+			if errors.As(err, &throttledErr) {
+				return nil, err
+			}
 			klog.Errorf("Error performing session check request to vSphere: %v", err)
 		}
 		if sessionActive {
@@ -107,15 +167,26 @@ func GetOrCreate(
 	}
 	// Set up user agent before login for being able to track mapi component in vcenter sessions list
 	client.UserAgent = "machineAPIvSphereProvider"
+	// The requests of all the sessions of a vCenter share its limits
+	client.Client.RoundTripper = &limitedRoundTripper{
+		limiter: getLimiter(server),
+		next:    &instrumentedRoundTripper{server: server, next: client.Client.RoundTripper},
+	}
 	if err := client.Login(ctx, url.UserPassword(username, password)); err != nil {
-		return nil, fmt.Errorf("unable to login to vCenter: %w", err)
+		previous, ok := loggedInCredentials[server+datacenter]
+		return nil, &LoginError{Server: server, CredentialsRotated: ok && previous != fingerprint, Err: err}
 	}
 
 	session := Session{
-		Client:     client,
-		username:   username,
-		password:   password,
-		sessionKey: sessionKey,
+		Client:      client,
+		username:    username,
+		password:    password,
+		server:      server,
+		host:        soapURL.Hostname(),
+		datacenter:  datacenter,
+		fingerprint: fingerprint,
+		sessionKey:  sessionKey,
+		pbm:         &pbmClient{},
 	}
 
 	session.Finder = find.NewFinder(session.Client.Client, false)
@@ -127,12 +198,86 @@ func GetOrCreate(
 	session.Datacenter = dc
 	session.Finder.SetDatacenter(dc)
 
+	// The sessions of the previous passwords of the user are superseded
+	for key, cached := range sessionCache {
+		if key != sessionKey && cached.server == server && cached.datacenter == datacenter && cached.username == username {
+			evictSession(key, cached)
+		}
+	}
+
 	// Cache the session.
 	sessionCache[sessionKey] = session
+	loggedInCredentials[server+datacenter] = fingerprint
+	updateActiveSessions(server)
 
 	return &session, nil
 }
 
+// InvalidateCredentials logs out and evicts the cached sessions logged in to the vCenter server with the given
+// credentials, along with their tags caches. It returns the number of evicted sessions.
+// It is called when the credentials are rotated or removed from the credentials secret, whose keys are named after
+// the server of the workspace of the machines.
+func InvalidateCredentials(ctx context.Context, server, username, password string) int {
+	sessionMU.Lock()
+	defer sessionMU.Unlock()
+
+	fingerprint := credentialsFingerprint(username, password)
+	evicted := 0
+	for key, cached := range sessionCache {
+		if isSessionOfServer(cached.server, server) && cached.fingerprint == fingerprint {
+			evictSession(key, cached)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// isSessionOfServer returns true when the session was created for the given server, which sessions are created for
+// along with the vCenter port of the cloud provider config, if any, as <server>:<port>.
+func isSessionOfServer(sessionServer, server string) bool {
+	if sessionServer == server {
+		return true
+	}
+	port, ok := strings.CutPrefix(sessionServer, server+":")
+	if !ok {
+		return false
+	}
+	if port == "" {
+		return true
+	}
+	_, err := strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+// evictSession removes a cached session and its tags cache, and logs it out once the logout grace period elapsed.
+// The last logged in credentials of the vCenter datacenter are forgotten along with its last session.
+// sessionMU must be held.
+func evictSession(key string, session Session) {
+	delete(sessionCache, key)
+	deleteSessionCache(key)
+	updateActiveSessions(session.server)
+
+	lastSession := true
+	for _, cached := range sessionCache {
+		if cached.server == session.server && cached.datacenter == session.datacenter {
+			lastSession = false
+			break
+		}
+	}
+	if lastSession {
+		delete(loggedInCredentials, session.server+session.datacenter)
+	}
+
+	klog.Infof("Logging out superseded vCenter session of user %s on %s in %s", session.username, session.host, sessionLogoutGracePeriod)
+	time.AfterFunc(sessionLogoutGracePeriod, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+		if err := session.Client.Logout(ctx); err != nil {
+			klog.Errorf("Failed to logout superseded vCenter session of user %s on %s: %v", session.username, session.host, err)
+		}
+	})
+}
+
 func (s *Session) FindVM(ctx context.Context, UUID, name string) (*object.VirtualMachine, error) {
 	if !isValidUUID(UUID) {
 		klog.V(3).Infof("Invalid UUID for VM %q: %s, trying to find by name", name, UUID)
@@ -154,6 +299,11 @@ func (s *Session) FindRefByInstanceUUID(ctx context.Context, UUID string) (objec
 	return s.findRefByUUID(ctx, UUID, true)
 }
 
+// FindRefByBIOSUUID finds an object by its BIOS UUID, the UUID of the provider ID of a Machine.
+func (s *Session) FindRefByBIOSUUID(ctx context.Context, UUID string) (object.Reference, error) {
+	return s.findRefByUUID(ctx, UUID, false)
+}
+
 func (s *Session) findRefByUUID(ctx context.Context, UUID string, findByInstanceUUID bool) (object.Reference, error) {
 	if s.Client == nil {
 		return nil, errors.New("vSphere client is not initialized")
@@ -203,11 +353,99 @@ func (s *Session) GetTask(ctx context.Context, taskRef string) (*mo.Task, error)
 	if err := s.RetrieveOne(ctx, moRef, []string{"info"}, &obj); err != nil {
 		return nil, err
 	}
+	if obj.Info.State == types.TaskInfoStateSuccess || obj.Info.State == types.TaskInfoStateError {
+		getLimiter(s.server).finishTask(taskRef)
+		observeTaskDuration(s.server, obj.Info)
+	}
 	return &obj, nil
 }
 
-func (s *Session) WithRestClient(ctx context.Context, f func(c *rest.Client) error) error {
+// StartTask starts a task, e.g. a clone, unless the maximum number of tasks started by the controller is in flight
+// on the vCenter, in which case a ThrottledError is returned. The task is in flight until GetTask finds it finished.
+func (s *Session) StartTask(start func() (*object.Task, error)) (*object.Task, error) {
+	return getLimiter(s.server).startTask(start)
+}
+
+// getPbmClient returns the storage policy client of the session, creating it on first use.
+// Its requests share the limits of the vCenter, and are observed, as the ones of the vim25 client.
+func (s *Session) getPbmClient(ctx context.Context) (*pbm.Client, error) {
+	s.pbm.mu.Lock()
+	defer s.pbm.mu.Unlock()
+	if s.pbm.client != nil {
+		return s.pbm.client, nil
+	}
+
+	sc := s.Client.Client.NewServiceClient(pbm.Path, pbm.Namespace)
+	rt := &limitedRoundTripper{
+		limiter: getLimiter(s.server),
+		next:    &instrumentedRoundTripper{server: s.server, next: sc},
+	}
+	req := pbmtypes.PbmRetrieveServiceContent{This: pbm.ServiceInstance}
+	res, err := pbmmethods.PbmRetrieveServiceContent(ctx, rt, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pbm.client = &pbm.Client{Client: sc, ServiceContent: res.Returnval, RoundTripper: rt}
+	return s.pbm.client, nil
+}
+
+// GetStoragePolicyID returns the ID of the storage policy with the given name.
+func (s *Session) GetStoragePolicyID(ctx context.Context, name string) (string, error) {
+	c, err := s.getPbmClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to create storage policy client: %w", err)
+	}
+	return c.ProfileIDByName(ctx, name)
+}
+
+// GetCompatibleDatastores returns the datastores, among the given ones, which are compatible with the storage policy.
+func (s *Session) GetCompatibleDatastores(ctx context.Context, profileID string, datastores []types.ManagedObjectReference) ([]types.ManagedObjectReference, error) {
+	c, err := s.getPbmClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create storage policy client: %w", err)
+	}
+
+	hubs := make([]pbmtypes.PbmPlacementHub, 0, len(datastores))
+	for _, ds := range datastores {
+		hubs = append(hubs, pbmtypes.PbmPlacementHub{HubType: ds.Type, HubId: ds.Value})
+	}
+	requirements := []pbmtypes.BasePbmPlacementRequirement{
+		&pbmtypes.PbmPlacementCapabilityProfileRequirement{
+			ProfileId: pbmtypes.PbmProfileId{UniqueId: profileID},
+		},
+	}
+	result, err := c.CheckRequirements(ctx, hubs, nil, requirements)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check storage policy requirements: %w", err)
+	}
+
+	var compatible []types.ManagedObjectReference
+	for _, hub := range result.CompatibleDatastores() {
+		ref := types.ManagedObjectReference{Type: hub.HubType, Value: hub.HubId}
+		// Only keep the hubs which were searched
+		for _, ds := range datastores {
+			if ds == ref {
+				compatible = append(compatible, ref)
+				break
+			}
+		}
+	}
+	return compatible, nil
+}
+
+// newRestClient returns a REST client whose requests share the limits of the vCenter, and are observed.
+func (s *Session) newRestClient() *rest.Client {
 	c := rest.NewClient(s.Client.Client)
+	c.Client.Client.Transport = &limitedTransport{
+		limiter: getLimiter(s.server),
+		next:    &instrumentedTransport{server: s.server, next: c.Client.Client.Transport},
+	}
+	return c
+}
+
+func (s *Session) WithRestClient(ctx context.Context, f func(c *rest.Client) error) error {
+	c := s.newRestClient()
 
 	user := url.UserPassword(s.username, s.password)
 	if err := c.Login(ctx, user); err != nil {
@@ -224,7 +462,7 @@ func (s *Session) WithRestClient(ctx context.Context, f func(c *rest.Client) err
 }
 
 func (s *Session) WithCachingTagsManager(ctx context.Context, f func(m *CachingTagsManager) error) error {
-	c := rest.NewClient(s.Client.Client)
+	c := s.newRestClient()
 
 	user := url.UserPassword(s.username, s.password)
 	if err := c.Login(ctx, user); err != nil {
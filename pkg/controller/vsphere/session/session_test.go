@@ -21,12 +21,17 @@ import (
 
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
 
+	_ "github.com/vmware/govmomi/pbm/simulator"
 	_ "github.com/vmware/govmomi/vapi/simulator"
 )
 
@@ -251,6 +256,121 @@ func TestGetTask(t *testing.T) {
 	}
 }
 
+func TestGetStoragePolicyID(t *testing.T) {
+	g := NewWithT(t)
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	id, err := session.GetStoragePolicyID(context.TODO(), "vSAN Default Storage Policy")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(id).ToNot(BeEmpty())
+
+	_, err = session.GetStoragePolicyID(context.TODO(), "missing")
+	g.Expect(err).To(MatchError("no pbm profile found with name: \"missing\""))
+}
+
+func TestGetCompatibleDatastores(t *testing.T) {
+	g := NewWithT(t)
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	id, err := session.GetStoragePolicyID(context.TODO(), "vSAN Default Storage Policy")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	datastore := simulator.Map.Any("Datastore").Reference()
+	compatible, err := session.GetCompatibleDatastores(context.TODO(), id, []types.ManagedObjectReference{datastore})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(compatible).To(ConsistOf(datastore))
+
+	compatible, err = session.GetCompatibleDatastores(context.TODO(), id, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(compatible).To(BeEmpty())
+}
+
+func TestGetOrCreateCredentialsRotation(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	// Forget the sessions of the other tests, logged in to other simulators with the same credentials
+	sessionCache = map[string]Session{}
+	gracePeriod := sessionLogoutGracePeriod
+	sessionLogoutGracePeriod = 500 * time.Millisecond
+	defer func() { sessionLogoutGracePeriod = gracePeriod }()
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	username := server.URL.User.Username()
+	password, _ := server.URL.User.Password()
+	getOrCreateSessionCache(session.sessionKey)
+	defer purgeCache()
+
+	// vCenter only accepts the rotated password from now on
+	model.Service.Listen.User = url.UserPassword(username, "rotated")
+
+	// The session of the previous password is still active
+	cached, err := GetOrCreate(ctx, server.URL.Host, "", username, password, true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cached.sessionKey).To(Equal(session.sessionKey))
+
+	// The session of the rotated password supersedes it
+	rotated, err := GetOrCreate(ctx, server.URL.Host, "", username, "rotated", true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rotated.sessionKey).ToNot(Equal(session.sessionKey))
+	g.Expect(sessionCache).ToNot(HaveKey(session.sessionKey))
+	g.Expect(sessionAnnotatedCache).ToNot(HaveKey(session.sessionKey))
+
+	// The superseded session is logged out after the grace period, the requests in flight can still use it
+	active, _ := session.SessionManager.SessionIsActive(ctx)
+	g.Expect(active).To(BeTrue())
+	g.Eventually(func() bool {
+		active, _ := session.SessionManager.SessionIsActive(ctx)
+		return active
+	}).Should(BeFalse())
+
+	// A login failing after the rotation is reported
+	_, err = GetOrCreate(ctx, server.URL.Host, "", username, "wrong", true)
+	var loginErr *LoginError
+	g.Expect(errors.As(err, &loginErr)).To(BeTrue())
+	g.Expect(loginErr.CredentialsRotated).To(BeTrue())
+	g.Expect(err).To(MatchError(HavePrefix("unable to login to vCenter: ")))
+
+	// Invalidated credentials are logged out, the server of the credentials secret keys including the port
+	g.Expect(InvalidateCredentials(ctx, server.URL.Host, username, password)).To(BeZero())
+	g.Expect(InvalidateCredentials(ctx, server.URL.Hostname()+":1", username, "rotated")).To(BeZero())
+	g.Expect(InvalidateCredentials(ctx, server.URL.Host, username, "rotated")).To(Equal(1))
+	g.Expect(sessionCache).ToNot(HaveKey(rotated.sessionKey))
+
+	// The credentials are forgotten along with the last session of the vCenter datacenter
+	g.Expect(loggedInCredentials).ToNot(HaveKey(server.URL.Host))
+}
+
+func TestIsSessionOfServer(t *testing.T) {
+	testCases := []struct {
+		sessionServer string
+		server        string
+		expected      bool
+	}{
+		{sessionServer: "vcenter.example.com", server: "vcenter.example.com", expected: true},
+		{sessionServer: "vcenter.example.com:443", server: "vcenter.example.com", expected: true},
+		{sessionServer: "vcenter.example.com:", server: "vcenter.example.com", expected: true},
+		{sessionServer: "vcenter.example.com:8443", server: "vcenter.example.com:8443", expected: true},
+		{sessionServer: "vcenter.example.com:8443:443", server: "vcenter.example.com:8443", expected: true},
+		{sessionServer: "vcenter.example.com:8443:443", server: "vcenter.example.com", expected: false},
+		{sessionServer: "vcenter.example.com.eu:443", server: "vcenter.example.com", expected: false},
+		{sessionServer: "vcenter.example.com:443", server: "vcenter.example.com:8443", expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s of %s", tc.sessionServer, tc.server), func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(isSessionOfServer(tc.sessionServer, tc.server)).To(Equal(tc.expected))
+		})
+	}
+}
+
 func TestClientTimeout(t *testing.T) {
 
 	t.Run("Global delay which not exceeds the timeout", func(t *testing.T) {
@@ -11,6 +11,8 @@ import (
 	"github.com/vmware/govmomi/vapi/tags"
 
 	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-operator/pkg/metrics"
 )
 
 const (
@@ -84,6 +86,14 @@ func getOrCreateSessionCache(sessionKey string) *tagsAndCategoriesCache {
 	return cache
 }
 
+// deleteSessionCache removes the tags and categories cache of an evicted session
+func deleteSessionCache(sessionKey string) {
+	sessionCacheMU.Lock()
+	defer sessionCacheMU.Unlock()
+
+	delete(sessionAnnotatedCache, sessionKey)
+}
+
 // CachingTagsManager wraps tags.Manager from vSphere SDK for
 // cache mapping between tags or categories name and their ids.
 // Reasoning behind this is the implementation details of tags/categories lookup by name,
@@ -135,6 +145,7 @@ func (t *CachingTagsManager) GetTag(ctx context.Context, id string) (*tags.Tag,
 	cache := getOrCreateSessionCache(t.sessionKey)
 	cachedTagID, found := cache.tags.Get(id)
 	if found {
+		metrics.RegisterVSphereTagCacheHit(tagCacheKindTag)
 		klog.V(4).Infof("tag %s: found cached tag id value", id)
 		if cachedTagID == notFoundValue {
 			klog.V(4).Infof("tag %s: cache contains special value indicates that tag was not found when cache was filled, treating as non existed tag", id)
@@ -155,6 +166,7 @@ func (t *CachingTagsManager) GetTag(ctx context.Context, id string) (*tags.Tag,
 	}
 
 	klog.V(3).Infof("tag %s: tags cache miss, trying to find tag by name, it might take time", id)
+	metrics.RegisterVSphereTagCacheMiss(tagCacheKindTag)
 	tag, err := t.Manager.GetTag(ctx, id)
 	if err != nil {
 		if isObjectNotFoundErr(err) {
@@ -188,6 +200,7 @@ func (t *CachingTagsManager) GetCategory(ctx context.Context, id string) (*tags.
 	cache := getOrCreateSessionCache(t.sessionKey)
 	cachedCategoryID, found := cache.categories.Get(id)
 	if found {
+		metrics.RegisterVSphereTagCacheHit(tagCacheKindCategory)
 		klog.V(4).Infof("category %s: found cached category id value", id)
 		if cachedCategoryID == notFoundValue {
 			klog.V(4).Infof("category %s: cache contains special value indicates that tag was not found when cache was filled, treating as non existing category", id)
@@ -207,6 +220,7 @@ func (t *CachingTagsManager) GetCategory(ctx context.Context, id string) (*tags.
 	}
 
 	klog.V(3).Infof("category %s: categories cache miss, trying to find category by name, it might take time", id)
+	metrics.RegisterVSphereTagCacheMiss(tagCacheKindCategory)
 	category, err := t.Manager.GetCategory(ctx, id)
 	if err != nil {
 		if isObjectNotFoundErr(err) {
@@ -0,0 +1,120 @@
+package vsphere
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+)
+
+const (
+	// storagePolicyPlacementCondition reports the datastore chosen for the storage policy of the machine
+	storagePolicyPlacementCondition = "StoragePolicyPlacement"
+	// storagePolicyCompatibleReason is the reason of the condition once a compatible datastore was chosen
+	storagePolicyCompatibleReason = "CompatibleDatastoreSelected"
+)
+
+// selectStoragePolicyDatastore returns the datastore compatible with the storage policy which has the most
+// free space, among the datastores shared by the hosts of the cluster owning the resource pool.
+func selectStoragePolicyDatastore(s *machineScope, resourcepool *object.ResourcePool, policy, profileID string) (*types.DatastoreSummary, error) {
+	owner, err := resourcepool.Owner(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get owner of resource pool %s: %w", resourcepool.Reference().Value, err)
+	}
+
+	pc := property.DefaultCollector(s.session.Client.Client)
+	var computeResource mo.ComputeResource
+	if err := pc.RetrieveOne(s, owner.Reference(), []string{"host"}, &computeResource); err != nil {
+		return nil, fmt.Errorf("unable to get hosts of %s %s: %w", owner.Reference().Type, owner.Reference().Value, err)
+	}
+	var hosts []mo.HostSystem
+	if len(computeResource.Host) > 0 {
+		if err := pc.Retrieve(s, computeResource.Host, []string{"datastore"}, &hosts); err != nil {
+			return nil, fmt.Errorf("unable to get datastores of %s %s: %w", owner.Reference().Type, owner.Reference().Value, err)
+		}
+	}
+
+	compatible, err := s.session.GetCompatibleDatastores(s, profileID, sharedDatastores(hosts))
+	if err != nil {
+		return nil, err
+	}
+	if len(compatible) == 0 {
+		return nil, machinecontroller.InvalidMachineConfiguration("no datastore compatible with storage policy %q", policy)
+	}
+
+	var datastores []mo.Datastore
+	if err := pc.Retrieve(s, compatible, []string{"summary"}, &datastores); err != nil {
+		return nil, fmt.Errorf("unable to get datastores compatible with storage policy %q: %w", policy, err)
+	}
+
+	var selected *types.DatastoreSummary
+	for i := range datastores {
+		summary := &datastores[i].Summary
+		if !summary.Accessible {
+			continue
+		}
+		// The name breaks ties, so that the machines of a set spread the same way on each reconcile
+		if selected == nil || summary.FreeSpace > selected.FreeSpace ||
+			(summary.FreeSpace == selected.FreeSpace && summary.Name < selected.Name) {
+			summary.Datastore = types.NewReference(datastores[i].Self)
+			selected = summary
+		}
+	}
+	if selected == nil {
+		return nil, machinecontroller.InvalidMachineConfiguration("no accessible datastore compatible with storage policy %q", policy)
+	}
+
+	klog.V(3).Infof("%v: selected datastore %q with %d bytes free for storage policy %q",
+		s.machine.GetName(), selected.Name, selected.FreeSpace, policy)
+	return selected, nil
+}
+
+// sharedDatastores returns the datastores mounted on all the hosts, the vm being free to move between them
+func sharedDatastores(hosts []mo.HostSystem) []types.ManagedObjectReference {
+	if len(hosts) == 0 {
+		return nil
+	}
+	var shared []types.ManagedObjectReference
+	for _, datastore := range hosts[0].Datastore {
+		mounted := true
+		for _, host := range hosts[1:] {
+			if !slices.Contains(host.Datastore, datastore) {
+				mounted = false
+				break
+			}
+		}
+		if mounted {
+			shared = append(shared, datastore)
+		}
+	}
+	return shared
+}
+
+// getStoragePolicyDiskLocators places the disks of the template on the datastore with the storage policy
+func getStoragePolicyDiskLocators(devices object.VirtualDeviceList, datastore types.ManagedObjectReference, profile []types.BaseVirtualMachineProfileSpec) []types.VirtualMachineRelocateSpecDiskLocator {
+	var locators []types.VirtualMachineRelocateSpecDiskLocator
+	for _, disk := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		locators = append(locators, types.VirtualMachineRelocateSpecDiskLocator{
+			DiskId:    disk.GetVirtualDevice().Key,
+			Datastore: datastore,
+			Profile:   profile,
+		})
+	}
+	return locators
+}
+
+func conditionStoragePolicyPlacement(policy, datastore string) metav1.Condition {
+	return metav1.Condition{
+		Type:    storagePolicyPlacementCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  storagePolicyCompatibleReason,
+		Message: fmt.Sprintf("Datastore %q selected for storage policy %q", datastore, policy),
+	}
+}
@@ -0,0 +1,115 @@
+package vsphere
+
+import (
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// taskHistoryLength is the maximum number of tasks kept in the task history of a machine
+const taskHistoryLength = 10
+
+// taskOperation is the operation of the machine controller a vSphere task is started for
+type taskOperation string
+
+const (
+	// taskOperationCreate creates the vm, by a clone or by configuring a vm deployed from a content library item
+	taskOperationCreate taskOperation = "Create"
+	// taskOperationPowerOn powers on the vm, after its creation, its hardware upgrade, its resize or an out-of-band power off
+	taskOperationPowerOn taskOperation = "PowerOn"
+	// taskOperationPowerOff powers off the vm to upgrade its hardware or resize it
+	taskOperationPowerOff taskOperation = "PowerOff"
+	// taskOperationUpgradeHardware upgrades the hardware version of the vm
+	taskOperationUpgradeHardware taskOperation = "UpgradeHardware"
+	// taskOperationResize changes the CPUs and memory of the vm
+	taskOperationResize taskOperation = "Resize"
+	// taskOperationDelete powers off and destroys the vm of a deleted machine
+	taskOperationDelete taskOperation = "Delete"
+)
+
+// taskRecord is a vSphere task started by the machine controller, as last seen by the controller
+type taskRecord struct {
+	// Ref is the reference of the task, the TaskRef of the provider status while it is the last task
+	Ref string `json:"ref"`
+	// Operation is the operation of the machine controller the task is started for
+	Operation taskOperation `json:"operation"`
+	// DescriptionID identifies the vSphere method of the task, e.g. VirtualMachine.clone
+	DescriptionID string `json:"descriptionId,omitempty"`
+	// State is queued, running, success or error
+	State types.TaskInfoState `json:"state"`
+	// StartTime is the time the task was started, or queued
+	StartTime metav1.Time `json:"startTime"`
+	// CompletionTime is the time the task finished, if it did
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Error is the error of the task, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// recordTask adds a task started by the controller to the task history of the machine, the oldest tasks are dropped
+// from the history beyond its maximum length.
+func recordTask(s *machineScope, taskRef string, operation taskOperation) {
+	if taskRef == "" {
+		return
+	}
+	s.taskHistory = append(s.taskHistory, taskRecord{
+		Ref:       taskRef,
+		Operation: operation,
+		State:     types.TaskInfoStateQueued,
+		StartTime: metav1.Now(),
+	})
+	if len(s.taskHistory) > taskHistoryLength {
+		s.taskHistory = s.taskHistory[len(s.taskHistory)-taskHistoryLength:]
+	}
+}
+
+// updateTaskHistory updates the task in the task history of the machine with its state on the vCenter. A task
+// missing from the history, started before the history was kept, is added to it.
+func updateTaskHistory(s *machineScope, moTask *mo.Task) {
+	record := findTaskRecord(s.taskHistory, moTask.Reference().Value)
+	if record == nil {
+		recordTask(s, moTask.Reference().Value, taskOperationFromDescriptionID(s, moTask.Info.DescriptionId))
+		record = &s.taskHistory[len(s.taskHistory)-1]
+	}
+
+	record.DescriptionID = moTask.Info.DescriptionId
+	record.State = moTask.Info.State
+	if moTask.Info.StartTime != nil {
+		record.StartTime = metav1.NewTime(*moTask.Info.StartTime)
+	}
+	if moTask.Info.CompleteTime != nil {
+		completionTime := metav1.NewTime(*moTask.Info.CompleteTime)
+		record.CompletionTime = &completionTime
+	}
+	if moTask.Info.Error != nil {
+		record.Error = moTask.Info.Error.LocalizedMessage
+	}
+}
+
+// getTaskOperation returns the operation the task was started for
+func getTaskOperation(s *machineScope, moTask *mo.Task) taskOperation {
+	if record := findTaskRecord(s.taskHistory, moTask.Reference().Value); record != nil {
+		return record.Operation
+	}
+	return taskOperationFromDescriptionID(s, moTask.Info.DescriptionId)
+}
+
+// taskOperationFromDescriptionID guesses the operation of a task missing from the task history from its vSphere
+// method. It returns an empty operation when the method is used by several operations.
+func taskOperationFromDescriptionID(s *machineScope, descriptionID string) taskOperation {
+	switch {
+	case isCreationTask(s, descriptionID):
+		return taskOperationCreate
+	case descriptionID == destroyVmTaskDescriptionId:
+		return taskOperationDelete
+	}
+	return ""
+}
+
+func findTaskRecord(taskHistory []taskRecord, taskRef string) *taskRecord {
+	for i := range taskHistory {
+		if taskHistory[i].Ref == taskRef {
+			return &taskHistory[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordTask(t *testing.T) {
+	g := NewWithT(t)
+
+	s := &machineScope{}
+	recordTask(s, "", taskOperationCreate)
+	g.Expect(s.taskHistory).To(BeEmpty())
+
+	for i := 0; i < taskHistoryLength+2; i++ {
+		recordTask(s, fmt.Sprintf("task-%d", i), taskOperationPowerOn)
+	}
+	g.Expect(s.taskHistory).To(HaveLen(taskHistoryLength))
+	g.Expect(s.taskHistory[0].Ref).To(Equal("task-2"))
+	g.Expect(s.taskHistory[taskHistoryLength-1].Ref).To(Equal(fmt.Sprintf("task-%d", taskHistoryLength+1)))
+	g.Expect(s.taskHistory[0].Operation).To(Equal(taskOperationPowerOn))
+	g.Expect(s.taskHistory[0].State).To(Equal(types.TaskInfoStateQueued))
+}
+
+func TestUpdateTaskHistory(t *testing.T) {
+	g := NewWithT(t)
+
+	model, session, server := initSimulator(t)
+	defer model.Remove()
+	defer server.Close()
+
+	vm := getResizeTestVM(t, session.Client.Client, false, false)
+	s := &machineScope{
+		Context: context.TODO(),
+		session: session,
+		machine: &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine"}},
+	}
+
+	// The upgrade of a powered on vm fails
+	upgradeTask, err := vm.Obj.UpgradeVM(context.TODO(), "vmx-17")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(upgradeTask.Wait(context.TODO())).ToNot(Succeed())
+	recordTask(s, upgradeTask.Reference().Value, taskOperationUpgradeHardware)
+
+	powerOffTaskRef, err := vm.powerOffVM()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(waitForTaskRef(session.Client.Client, powerOffTaskRef)).To(Succeed())
+
+	for _, taskRef := range []string{upgradeTask.Reference().Value, powerOffTaskRef} {
+		moTask, err := session.GetTask(context.TODO(), taskRef)
+		g.Expect(err).ToNot(HaveOccurred())
+		updateTaskHistory(s, moTask)
+	}
+
+	g.Expect(s.taskHistory).To(HaveLen(2))
+
+	failed := s.taskHistory[0]
+	g.Expect(failed.Operation).To(Equal(taskOperationUpgradeHardware))
+	g.Expect(failed.DescriptionID).To(Equal("VirtualMachine.upgradeVm"))
+	g.Expect(failed.State).To(Equal(types.TaskInfoStateError))
+	g.Expect(failed.CompletionTime).ToNot(BeNil())
+	g.Expect(failed.Error).ToNot(BeEmpty())
+
+	// A task missing from the history is added with the operation of its method, unknown for a power off
+	unknown := s.taskHistory[1]
+	g.Expect(unknown.Ref).To(Equal(powerOffTaskRef))
+	g.Expect(unknown.Operation).To(BeEmpty())
+	g.Expect(unknown.DescriptionID).To(Equal(powerOffVmTaskDescriptionId))
+	g.Expect(unknown.State).To(Equal(types.TaskInfoStateSuccess))
+	g.Expect(unknown.Error).To(BeEmpty())
+}
+
+func TestDeleteWithFailedTask(t *testing.T) {
+	testCases := []struct {
+		name          string
+		operation     taskOperation
+		expectedError bool
+	}{
+		{
+			name:      "Failed task of another operation",
+			operation: taskOperationUpgradeHardware,
+		},
+		{
+			name:          "Failed task of the deletion",
+			operation:     taskOperationDelete,
+			expectedError: true,
+		},
+		{
+			name:          "Failed task of an unknown operation",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			model, session, server := initSimulator(t)
+			defer model.Remove()
+			defer server.Close()
+
+			vm := getResizeTestVM(t, session.Client.Client, false, false)
+			task, err := vm.Obj.UpgradeVM(context.TODO(), "vmx-17")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(task.Wait(context.TODO())).ToNot(Succeed())
+
+			r := newReconciler(&machineScope{
+				Context:      context.TODO(),
+				session:      session,
+				machine:      &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "missing", UID: "45c4ab0f-b7a4-4d8b-8f0c-3d1b1b7b7a1e"}},
+				providerSpec: &machinev1.VSphereMachineProviderSpec{},
+				providerStatus: &machinev1.VSphereMachineProviderStatus{
+					TaskRef: task.Reference().Value,
+				},
+			})
+			if tc.operation != "" {
+				recordTask(r.machineScope, task.Reference().Value, tc.operation)
+			}
+
+			err = r.delete()
+			if tc.expectedError {
+				g.Expect(err).To(MatchError(ContainSubstring("finished with error")))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+			g.Expect(findTaskRecord(r.taskHistory, task.Reference().Value).State).To(Equal(types.TaskInfoStateError))
+		})
+	}
+}
@@ -17,12 +17,19 @@ limitations under the License.
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
 	DefaultHealthCheckMetricsAddress = ":8083"
+
+	// RemediationStrategyDelete is the strategy label used for remediations performed by deleting the Machine
+	RemediationStrategyDelete = "delete"
+	// RemediationStrategyExternal is the strategy label used for remediations delegated to an external remediator
+	RemediationStrategyExternal = "external"
 )
 
 var (
@@ -49,6 +56,40 @@ var (
 			Help: "Short circuit status for MachineHealthCheck (0=no, 1=yes)",
 		}, []string{"name", "namespace"},
 	)
+
+	// MachineHealthCheckTimeToRemediationSeconds is a Prometheus metric, which reports the time between a target being detected unhealthy and its remediation
+	MachineHealthCheckTimeToRemediationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_machinehealthcheck_time_to_remediation_seconds",
+			Help:    "Number of seconds between a target being detected unhealthy and its remediation by MachineHealthChecks",
+			Buckets: []float64{30, 60, 120, 300, 450, 600, 900, 1200, 1800, 3600, 7200},
+		}, []string{"name", "namespace", "strategy"},
+	)
+
+	// MachineHealthCheckTimeToReplacementReadySeconds is a Prometheus metric, which reports the time between a remediation and the remediated or replacement node becoming Ready
+	MachineHealthCheckTimeToReplacementReadySeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_machinehealthcheck_time_to_replacement_ready_seconds",
+			Help:    "Number of seconds between a remediation by MachineHealthChecks and the remediated or replacement node becoming Ready",
+			Buckets: []float64{60, 120, 180, 240, 300, 450, 600, 900, 1200, 1800, 3600},
+		}, []string{"name", "namespace", "strategy"},
+	)
+
+	// MachineHealthCheckRemediationFailureTotal is a Prometheus metric, which reports the number of failed remediations by MachineHealthChecks
+	MachineHealthCheckRemediationFailureTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_machinehealthcheck_remediation_failure_total",
+			Help: "Number of failed remediations performed by MachineHealthChecks",
+		}, []string{"name", "namespace", "strategy", "reason"},
+	)
+
+	// MachineHealthCheckTargetsPendingTimeout is a Prometheus metric, which reports the number of targets which are unhealthy, or have no node yet, and are waiting for their timeout to expire
+	MachineHealthCheckTargetsPendingTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_machinehealthcheck_targets_pending_timeout",
+			Help: "Number of targets of MachineHealthChecks waiting for their timeout to expire before being remediated",
+		}, []string{"name", "namespace"},
+	)
 )
 
 func InitializeMachineHealthCheckMetrics() {
@@ -56,6 +97,10 @@ func InitializeMachineHealthCheckMetrics() {
 		MachineHealthCheckNodesCovered,
 		MachineHealthCheckRemediationSuccessTotal,
 		MachineHealthCheckShortCircuit,
+		MachineHealthCheckTimeToRemediationSeconds,
+		MachineHealthCheckTimeToReplacementReadySeconds,
+		MachineHealthCheckRemediationFailureTotal,
+		MachineHealthCheckTargetsPendingTimeout,
 	)
 }
 
@@ -93,3 +138,42 @@ func ObserveMachineHealthCheckShortCircuitEnabled(name string, namespace string)
 		"namespace": namespace,
 	}).Set(1)
 }
+
+func ObserveMachineHealthCheckTimeToRemediation(name string, namespace string, strategy string, duration time.Duration) {
+	MachineHealthCheckTimeToRemediationSeconds.With(prometheus.Labels{
+		"name":      name,
+		"namespace": namespace,
+		"strategy":  strategy,
+	}).Observe(duration.Seconds())
+}
+
+func ObserveMachineHealthCheckTimeToReplacementReady(name string, namespace string, strategy string, duration time.Duration) {
+	MachineHealthCheckTimeToReplacementReadySeconds.With(prometheus.Labels{
+		"name":      name,
+		"namespace": namespace,
+		"strategy":  strategy,
+	}).Observe(duration.Seconds())
+}
+
+func ObserveMachineHealthCheckRemediationFailure(name string, namespace string, strategy string, reason string) {
+	MachineHealthCheckRemediationFailureTotal.With(prometheus.Labels{
+		"name":      name,
+		"namespace": namespace,
+		"strategy":  strategy,
+		"reason":    reason,
+	}).Inc()
+}
+
+func DeleteMachineHealthCheckTargetsPendingTimeout(name string, namespace string) {
+	MachineHealthCheckTargetsPendingTimeout.Delete(prometheus.Labels{
+		"name":      name,
+		"namespace": namespace,
+	})
+}
+
+func ObserveMachineHealthCheckTargetsPendingTimeout(name string, namespace string, count int) {
+	MachineHealthCheckTargetsPendingTimeout.With(prometheus.Labels{
+		"name":      name,
+		"namespace": namespace,
+	}).Set(float64(count))
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	machineinformers "github.com/openshift/client-go/machine/informers/externalversions/machine/v1beta1"
 	machinelisters "github.com/openshift/client-go/machine/listers/machine/v1beta1"
@@ -62,6 +64,85 @@ var (
 			Help: "Number of times provider instance delete has failed.",
 		}, []string{"name", "namespace", "reason"},
 	)
+
+	vSphereOrphanedVMs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_vsphere_orphaned_vms",
+			Help: "Number of vSphere vms tagged with the infrastructure ID of the cluster which do not belong to any Machine.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereOrphanedVMsDestroyedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_vsphere_orphaned_vms_destroyed",
+			Help: "Number of orphaned vSphere vms destroyed.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereRequestsDelayedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_vsphere_requests_delayed",
+			Help: "Number of vCenter API requests delayed by the rate limit of the vCenter.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereRequestsThrottledCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_vsphere_requests_throttled",
+			Help: "Number of vCenter API requests and tasks rejected, and requeued, because the vCenter is throttled.",
+		}, []string{"vcenter", "reason"},
+	)
+
+	vSphereInFlightTasks = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_vsphere_inflight_tasks",
+			Help: "Number of vCenter tasks started by the machine controller which are not finished yet.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereCircuitBreakerOpen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_vsphere_circuit_breaker_open",
+			Help: "Whether the circuit breaker of a vCenter is open, rejecting API requests after repeated server faults.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_vsphere_api_request_duration_seconds",
+			Help:    "Latency of the vCenter API requests, by method and result.",
+			Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 15},
+		}, []string{"vcenter", "method", "result"},
+	)
+
+	vSphereTaskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_vsphere_task_duration_seconds",
+			Help:    "Duration of the vCenter tasks of the machine lifecycle, as reported by vCenter, by task and result.",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		}, []string{"vcenter", "task", "result"},
+	)
+
+	vSphereActiveSessions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_vsphere_active_sessions",
+			Help: "Number of vCenter sessions cached by the machine controller.",
+		}, []string{"vcenter"},
+	)
+
+	vSphereTagCacheHitsCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_vsphere_tag_cache_hits",
+			Help: "Number of vSphere tag and category lookups by name served from the cache.",
+		}, []string{"kind"},
+	)
+
+	vSphereTagCacheMissesCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_vsphere_tag_cache_misses",
+			Help: "Number of vSphere tag and category lookups by name which had to search vCenter.",
+		}, []string{"kind"},
+	)
 )
 
 // Metrics for use in the Machine controller
@@ -83,6 +164,17 @@ func init() {
 		failedInstanceCreateCount,
 		failedInstanceUpdateCount,
 		failedInstanceDeleteCount,
+		vSphereOrphanedVMs,
+		vSphereOrphanedVMsDestroyedCount,
+		vSphereRequestsDelayedCount,
+		vSphereRequestsThrottledCount,
+		vSphereInFlightTasks,
+		vSphereCircuitBreakerOpen,
+		vSphereAPIRequestDuration,
+		vSphereTaskDuration,
+		vSphereActiveSessions,
+		vSphereTagCacheHitsCount,
+		vSphereTagCacheMissesCount,
 	)
 }
 
@@ -226,3 +318,57 @@ func RegisterFailedInstanceDelete(labels *MachineLabels) {
 		"reason":    labels.Reason,
 	}).Inc()
 }
+
+// SetVSphereOrphanedVMs records the number of orphaned vms found on a vCenter by its last scan
+func SetVSphereOrphanedVMs(vcenter string, count int) {
+	vSphereOrphanedVMs.With(prometheus.Labels{"vcenter": vcenter}).Set(float64(count))
+}
+
+func RegisterVSphereOrphanedVMDestroyed(vcenter string) {
+	vSphereOrphanedVMsDestroyedCount.With(prometheus.Labels{"vcenter": vcenter}).Inc()
+}
+
+func RegisterVSphereRequestDelayed(vcenter string) {
+	vSphereRequestsDelayedCount.With(prometheus.Labels{"vcenter": vcenter}).Inc()
+}
+
+func RegisterVSphereRequestThrottled(vcenter, reason string) {
+	vSphereRequestsThrottledCount.With(prometheus.Labels{"vcenter": vcenter, "reason": reason}).Inc()
+}
+
+// SetVSphereInFlightTasks records the number of tasks started on a vCenter which are not finished yet
+func SetVSphereInFlightTasks(vcenter string, count int) {
+	vSphereInFlightTasks.With(prometheus.Labels{"vcenter": vcenter}).Set(float64(count))
+}
+
+// SetVSphereCircuitBreakerOpen records whether the circuit breaker of a vCenter is open
+func SetVSphereCircuitBreakerOpen(vcenter string, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	vSphereCircuitBreakerOpen.With(prometheus.Labels{"vcenter": vcenter}).Set(value)
+}
+
+// ObserveVSphereAPIRequest records the latency of a vCenter API request
+func ObserveVSphereAPIRequest(vcenter, method, result string, duration time.Duration) {
+	vSphereAPIRequestDuration.With(prometheus.Labels{"vcenter": vcenter, "method": method, "result": result}).Observe(duration.Seconds())
+}
+
+// ObserveVSphereTaskDuration records the duration of a finished vCenter task
+func ObserveVSphereTaskDuration(vcenter, task, result string, duration time.Duration) {
+	vSphereTaskDuration.With(prometheus.Labels{"vcenter": vcenter, "task": task, "result": result}).Observe(duration.Seconds())
+}
+
+// SetVSphereActiveSessions records the number of sessions cached for a vCenter
+func SetVSphereActiveSessions(vcenter string, count int) {
+	vSphereActiveSessions.With(prometheus.Labels{"vcenter": vcenter}).Set(float64(count))
+}
+
+func RegisterVSphereTagCacheHit(kind string) {
+	vSphereTagCacheHitsCount.With(prometheus.Labels{"kind": kind}).Inc()
+}
+
+func RegisterVSphereTagCacheMiss(kind string) {
+	vSphereTagCacheMissesCount.With(prometheus.Labels{"kind": kind}).Inc()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Machine API Operator authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	DefaultNodeLinkMetricsAddress = ":8084"
+)
+
+var (
+	// UnlinkedNodes is a Prometheus metric, which reports the number of Nodes not linked to any Machine
+	UnlinkedNodes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mapi_unlinked_nodes",
+			Help: "Number of nodes not linked to any machine",
+		},
+	)
+
+	// UnlinkedMachines is a Prometheus metric, which reports the number of Machines not linked to any Node
+	UnlinkedMachines = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mapi_unlinked_machines",
+			Help: "Number of machines not linked to any node",
+		},
+	)
+
+	// UnlinkedNodeSinceTimestampSeconds is a Prometheus metric, which reports since when each unlinked Node has been unlinked
+	UnlinkedNodeSinceTimestampSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_unlinked_node_since_timestamp_seconds",
+			Help: "Timestamp since which the node has not been linked to any machine",
+		}, []string{"node"},
+	)
+
+	// UnlinkedMachineSinceTimestampSeconds is a Prometheus metric, which reports since when each unlinked Machine has been unlinked
+	UnlinkedMachineSinceTimestampSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_unlinked_machine_since_timestamp_seconds",
+			Help: "Timestamp since which the machine has not been linked to any node",
+		}, []string{"name", "namespace"},
+	)
+)
+
+func InitializeNodeLinkMetrics() {
+	metrics.Registry.MustRegister(
+		UnlinkedNodes,
+		UnlinkedMachines,
+		UnlinkedNodeSinceTimestampSeconds,
+		UnlinkedMachineSinceTimestampSeconds,
+	)
+}
+
+// ObserveUnlinkedNodes replaces the reported unlinked Nodes, by name, with the given ones
+func ObserveUnlinkedNodes(since map[string]time.Time) {
+	UnlinkedNodes.Set(float64(len(since)))
+	UnlinkedNodeSinceTimestampSeconds.Reset()
+	for name, t := range since {
+		UnlinkedNodeSinceTimestampSeconds.With(prometheus.Labels{
+			"node": name,
+		}).Set(float64(t.Unix()))
+	}
+}
+
+// ObserveUnlinkedMachines replaces the reported unlinked Machines with the given ones
+func ObserveUnlinkedMachines(since map[types.NamespacedName]time.Time) {
+	UnlinkedMachines.Set(float64(len(since)))
+	UnlinkedMachineSinceTimestampSeconds.Reset()
+	for machine, t := range since {
+		UnlinkedMachineSinceTimestampSeconds.With(prometheus.Labels{
+			"name":      machine.Name,
+			"namespace": machine.Namespace,
+		}).Set(float64(t.Unix()))
+	}
+}
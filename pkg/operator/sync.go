@@ -38,6 +38,7 @@ const (
 	machineExposeMetricsPort            = 8441
 	machineSetExposeMetricsPort         = 8442
 	machineHealthCheckExposeMetricsPort = 8444
+	nodeLinkExposeMetricsPort           = 8445
 	defaultMachineHealthPort            = 9440
 	defaultMachineSetHealthPort         = 9441
 	defaultMachineHealthCheckHealthPort = 9442
@@ -813,6 +814,7 @@ func newKubeProxyContainers(image string, withMHCProxy bool) []corev1.Container
 	proxyContainers := []corev1.Container{
 		newKubeProxyContainer(image, "machineset-mtrc", metrics.DefaultMachineSetMetricsAddress, machineSetExposeMetricsPort),
 		newKubeProxyContainer(image, "machine-mtrc", metrics.DefaultMachineMetricsAddress, machineExposeMetricsPort),
+		newKubeProxyContainer(image, "nodelink-mtrc", metrics.DefaultNodeLinkMetricsAddress, nodeLinkExposeMetricsPort),
 	}
 	if withMHCProxy {
 		proxyContainers = append(proxyContainers,
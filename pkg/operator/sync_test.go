@@ -1,6 +1,7 @@
 package operator
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
@@ -508,6 +509,14 @@ func TestSyncWebhookConfiguration(t *testing.T) {
 				"wrong nr of mutating webhooks")
 			g.Expect(nrValidatingWebhooks).To(BeNumerically("==", tc.expectedNrValidatingWebhooks),
 				"wrong nr of validating webhooks")
+
+			validatingWebhookConfiguration, err := optr.kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), "machine-api", metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(validatingWebhookConfiguration.Webhooks).To(ContainElement(HaveField("Name", "validation.machinehealthcheck.machine.openshift.io")))
+
+			mutatingWebhookConfiguration, err := optr.kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "machine-api", metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(mutatingWebhookConfiguration.Webhooks).To(ContainElement(HaveField("Name", "default.machinehealthcheck.machine.openshift.io")))
 		})
 	}
 }
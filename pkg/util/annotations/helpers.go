@@ -10,6 +10,31 @@ const (
 	// from processing it.
 	// TODO: move this annotation to the openshift/api package
 	PausedAnnotation = "cluster.x-k8s.io/paused"
+
+	// RemediationStrategyAnnotation is an annotation that can be applied to MachineHealthCheck objects to select
+	// the built-in remediation strategy.
+	// TODO: move this annotation to the openshift/api package
+	RemediationStrategyAnnotation = "machine.openshift.io/remediation-strategy"
+
+	// ExternalRemediationTimeoutAnnotation is an annotation that can be applied to MachineHealthCheck objects using a
+	// RemediationTemplate to limit how long an external remediation request may take to bring its target back to healthy.
+	// TODO: move this annotation to the openshift/api package
+	ExternalRemediationTimeoutAnnotation = "machine.openshift.io/external-remediation-timeout"
+
+	// ExcludeFromRemediationAnnotation is an annotation that can be applied to Machine objects to exclude them from
+	// remediation by MachineHealthChecks. The value is either empty, or an RFC 3339 time after which the exclusion expires.
+	// TODO: move this annotation to the openshift/api package
+	ExcludeFromRemediationAnnotation = "machine.openshift.io/exclude-from-remediation"
+
+	// MaintenanceWindowsAnnotation is an annotation that can be applied to MachineHealthCheck objects to suppress
+	// remediation during recurring maintenance windows, e.g. `[{"schedule": "0 2 * * 6", "duration": "4h"}]`.
+	// TODO: move this annotation to the openshift/api package
+	MaintenanceWindowsAnnotation = "machine.openshift.io/maintenance-windows"
+
+	// PropagateNodeMetadataAnnotation is an annotation that can be applied to MachineSet objects, with the value "true",
+	// to propagate changes of the template node labels, annotations and taints to the existing Machines in place.
+	// TODO: move this annotation to the openshift/api package
+	PropagateNodeMetadataAnnotation = "machine.openshift.io/propagate-node-metadata"
 )
 
 // IsPaused returns true if the Cluster is paused or the object has the `paused` annotation.
@@ -123,6 +123,23 @@ func MarkFalse(to interface{}, t machinev1.ConditionType, reason string, severit
 	Set(to, FalseCondition(t, reason, severity, messageFormat, messageArgs...))
 }
 
+// Delete deletes the condition with the given type.
+func Delete(to interface{}, t machinev1.ConditionType) {
+	if to == nil {
+		return
+	}
+
+	obj := getWrapperObject(to)
+	conditions := obj.GetConditions()
+	newConditions := make([]machinev1.Condition, 0, len(conditions))
+	for _, condition := range conditions {
+		if condition.Type != t {
+			newConditions = append(newConditions, condition)
+		}
+	}
+	obj.SetConditions(newConditions)
+}
+
 // lexicographicLess returns true if a condition is less than another with regards to the
 // to order of conditions designed for convenience of the consumer, i.e. kubectl.
 func lexicographicLess(i, j *machinev1.Condition) bool {
@@ -173,6 +173,47 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestDelete(t *testing.T) {
+	a := TrueCondition("a")
+	b := TrueCondition("b")
+
+	tests := []struct {
+		name          string
+		to            *machinev1.MachineHealthCheck
+		conditionType machinev1.ConditionType
+		want          []machinev1.Condition
+	}{
+		{
+			name:          "Delete removes an existing condition",
+			to:            setterWithConditions(a, b),
+			conditionType: "a",
+			want:          conditionList(b),
+		},
+		{
+			name:          "Delete ignores a condition that does not exist",
+			to:            setterWithConditions(a, b),
+			conditionType: "c",
+			want:          conditionList(a, b),
+		},
+		{
+			name:          "Delete on empty conditions",
+			to:            setterWithConditions(),
+			conditionType: "a",
+			want:          conditionList(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			Delete(tt.to, tt.conditionType)
+
+			g.Expect(tt.to.Status.Conditions).To(haveSameConditionsOf(tt.want))
+		})
+	}
+}
+
 func TestSetLastTransitionTime(t *testing.T) {
 	x := metav1.Date(2012, time.January, 1, 12, 15, 30, 5e8, time.UTC)
 
@@ -10,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -229,3 +230,42 @@ func VerifyIPAddressOwners(
 	}
 	return nil
 }
+
+// ReleaseIPAddressClaimsForOwner removes the protection finalizer of the IPAddressClaims controlled by the owner
+// with the given UID, and deletes them, so their addresses return to their pools. It is used when the owning
+// Machine is already gone, e.g. for the claims of an orphaned vm.
+func ReleaseIPAddressClaimsForOwner(
+	ctx context.Context,
+	runtimeClient client.Client,
+	namespace string,
+	ownerUID types.UID) (int, error) {
+	ipAddressClaimList := &ipamv1beta1.IPAddressClaimList{}
+	if err := runtimeClient.List(ctx, ipAddressClaimList, client.InNamespace(namespace)); err != nil {
+		return 0, fmt.Errorf("unable to list IPAddressClaims: %w", err)
+	}
+
+	released := 0
+	for i := range ipAddressClaimList.Items {
+		ipAddressClaim := &ipAddressClaimList.Items[i]
+		owner := metav1.GetControllerOf(ipAddressClaim)
+		if owner == nil || owner.UID != ownerUID {
+			continue
+		}
+		finalizers := sets.NewString(ipAddressClaim.ObjectMeta.Finalizers...)
+		if finalizers.Has(machinev1.IPClaimProtectionFinalizer) {
+			finalizers.Delete(machinev1.IPClaimProtectionFinalizer)
+			ipAddressClaim.ObjectMeta.Finalizers = finalizers.List()
+			if err := runtimeClient.Update(ctx, ipAddressClaim); err != nil {
+				return released, fmt.Errorf("unable to update IPAddressClaim: %w", err)
+			}
+		}
+		if ipAddressClaim.DeletionTimestamp.IsZero() {
+			if err := runtimeClient.Delete(ctx, ipAddressClaim); err != nil && !apierrors.IsNotFound(err) {
+				return released, fmt.Errorf("unable to delete IPAddressClaim: %w", err)
+			}
+		}
+		klog.Infof("released IPAddressClaim %s/%s", ipAddressClaim.Namespace, ipAddressClaim.Name)
+		released++
+	}
+	return released, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance implements recurring maintenance windows.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Window is a recurring maintenance window, starting on a standard cron schedule
+// interpreted in UTC, and lasting for the given duration.
+type Window struct {
+	// Schedule is a standard 5 fields cron expression, e.g. "0 2 * * 6" for every Saturday at 02:00 UTC
+	Schedule string `json:"schedule"`
+	// Duration is how long the window lasts from each scheduled start, e.g. "4h"
+	Duration metav1.Duration `json:"duration"`
+
+	schedule cron.Schedule
+}
+
+// Parse parses a JSON list of maintenance windows, e.g. `[{"schedule": "0 2 * * 6", "duration": "4h"}]`.
+func Parse(value string) ([]Window, error) {
+	var windows []Window
+	if err := json.Unmarshal([]byte(value), &windows); err != nil {
+		return nil, fmt.Errorf("must be a JSON list of maintenance windows: %v", err)
+	}
+
+	for i := range windows {
+		schedule, err := cron.ParseStandard(windows[i].Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: invalid schedule %q: %v", i, windows[i].Schedule, err)
+		}
+		if windows[i].Duration.Duration <= 0 {
+			return nil, fmt.Errorf("window %d: duration must be positive, got %v", i, windows[i].Duration.Duration)
+		}
+		windows[i].schedule = schedule
+	}
+	return windows, nil
+}
+
+// Active returns whether one of the windows is active at the given time,
+// and if so, when the latest ending of the active windows ends.
+func Active(windows []Window, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+
+	var end time.Time
+	for _, w := range windows {
+		if w.schedule == nil {
+			continue
+		}
+		// The latest start of the window not older than its duration, if any
+		start := w.schedule.Next(now.Add(-w.Duration.Duration))
+		if start.After(now) {
+			continue
+		}
+		if windowEnd := start.Add(w.Duration.Duration); windowEnd.After(end) {
+			end = windowEnd
+		}
+	}
+	return end, !end.IsZero()
+}
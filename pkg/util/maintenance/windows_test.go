@@ -0,0 +1,129 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expectedCount int
+		expectedError string
+	}{
+		{
+			name:          "with valid windows",
+			value:         `[{"schedule": "0 2 * * 6", "duration": "4h"}, {"schedule": "30 22 * * *", "duration": "30m"}]`,
+			expectedCount: 2,
+		},
+		{
+			name:          "with an empty list",
+			value:         `[]`,
+			expectedCount: 0,
+		},
+		{
+			name:          "with invalid JSON",
+			value:         `0 2 * * 6`,
+			expectedError: "must be a JSON list of maintenance windows: invalid character '2' after top-level value",
+		},
+		{
+			name:          "with an invalid schedule",
+			value:         `[{"schedule": "every saturday", "duration": "4h"}]`,
+			expectedError: "window 0: invalid schedule \"every saturday\": Expected exactly 5 fields, found 2: every saturday",
+		},
+		{
+			name:          "without a duration",
+			value:         `[{"schedule": "0 2 * * 6"}]`,
+			expectedError: "window 0: duration must be positive, got 0s",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			windows, err := Parse(tc.value)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(windows).To(HaveLen(tc.expectedCount))
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	// Saturday
+	saturday := time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+	windows, err := Parse(`[{"schedule": "0 2 * * 6", "duration": "4h"}, {"schedule": "0 5 * * *", "duration": "2h"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		now            time.Time
+		expectedActive bool
+		expectedEnd    time.Time
+	}{
+		{
+			name:           "before any window",
+			now:            saturday.Add(time.Hour),
+			expectedActive: false,
+		},
+		{
+			name:           "at the start of a window",
+			now:            saturday.Add(2 * time.Hour),
+			expectedActive: true,
+			expectedEnd:    saturday.Add(6 * time.Hour),
+		},
+		{
+			name:           "within overlapping windows",
+			now:            saturday.Add(5*time.Hour + 30*time.Minute),
+			expectedActive: true,
+			expectedEnd:    saturday.Add(7 * time.Hour),
+		},
+		{
+			name:           "at the end of all windows",
+			now:            saturday.Add(7 * time.Hour),
+			expectedActive: false,
+		},
+		{
+			name:           "in another time zone",
+			now:            saturday.Add(3 * time.Hour).In(time.FixedZone("UTC+10", 10*60*60)),
+			expectedActive: true,
+			expectedEnd:    saturday.Add(6 * time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			end, active := Active(windows, tc.now)
+			g.Expect(active).To(Equal(tc.expectedActive))
+			g.Expect(end).To(BeTemporally("==", tc.expectedEnd))
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AdoptVMAnnotation is an annotation that can be applied to a new Machine object to adopt an existing virtual
+	// machine instead of cloning one, e.g. a worker of a cluster installed on user-provisioned infrastructure.
+	// The virtual machine is referenced by its BIOS or instance UUID, or by its inventory path,
+	// e.g. `/datacenter/vm/cluster/worker-0`.
+	// TODO: move this annotation to the openshift/api package
+	AdoptVMAnnotation = "machine.openshift.io/vsphere-adopt-vm"
+
+	// AdoptVMDryRunAnnotation is an annotation that can be applied to a Machine object with the adopt vm annotation,
+	// with the value "true", to report what the adoption would change without adopting the virtual machine.
+	// TODO: move this annotation to the openshift/api package
+	AdoptVMDryRunAnnotation = "machine.openshift.io/vsphere-adopt-vm-dry-run"
+)
+
+// AdoptedVM references the existing virtual machine adopted by a Machine, by UUID or by inventory path.
+type AdoptedVM struct {
+	// UUID is the BIOS or instance UUID of the virtual machine.
+	UUID string
+	// InventoryPath is the inventory path of the virtual machine, e.g. `/datacenter/vm/worker-0`.
+	InventoryPath string
+}
+
+// String returns the reference of the virtual machine as it is given in the annotation.
+func (vm *AdoptedVM) String() string {
+	if vm.UUID != "" {
+		return vm.UUID
+	}
+	return vm.InventoryPath
+}
+
+// ParseAdoptedVM parses the value of the adopt vm annotation, a UUID or an absolute inventory path.
+func ParseAdoptedVM(value string) (*AdoptedVM, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "/") {
+		if strings.HasSuffix(value, "/") {
+			return nil, fmt.Errorf("inventory path must end with the name of the vm")
+		}
+		return &AdoptedVM{InventoryPath: value}, nil
+	}
+
+	parsed, err := uuid.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("must be the UUID or the absolute inventory path of a vm: %v", err)
+	}
+	return &AdoptedVM{UUID: parsed.String()}, nil
+}
+
+// AdoptVM returns the existing virtual machine the Machine adopts, if any.
+func AdoptVM(machine metav1.Object) (*AdoptedVM, error) {
+	value, ok := machine.GetAnnotations()[AdoptVMAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	vm, err := ParseAdoptedVM(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", AdoptVMAnnotation, err)
+	}
+	return vm, nil
+}
+
+// ParseAdoptVMDryRun parses the value of the adopt vm dry run annotation.
+func ParseAdoptVMDryRun(value string) (bool, error) {
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("must be a boolean: %v", err)
+	}
+	return dryRun, nil
+}
+
+// AdoptVMDryRun returns true when the adoption of the virtual machine of the Machine is only reported.
+func AdoptVMDryRun(machine metav1.Object) (bool, error) {
+	value, ok := machine.GetAnnotations()[AdoptVMDryRunAnnotation]
+	if !ok {
+		return false, nil
+	}
+	dryRun, err := ParseAdoptVMDryRun(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", AdoptVMDryRunAnnotation, err)
+	}
+	return dryRun, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdoptVM(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      *AdoptedVM
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "UUID",
+			annotations: map[string]string{AdoptVMAnnotation: "4217B9A5-0F2D-4D8E-A5F4-0D3C5E1F8A31"},
+			expected:    &AdoptedVM{UUID: "4217b9a5-0f2d-4d8e-a5f4-0d3c5e1f8a31"},
+		},
+		{
+			name:        "inventory path",
+			annotations: map[string]string{AdoptVMAnnotation: "/datacenter/vm/cluster/worker-0"},
+			expected:    &AdoptedVM{InventoryPath: "/datacenter/vm/cluster/worker-0"},
+		},
+		{
+			name:          "inventory path of a folder",
+			annotations:   map[string]string{AdoptVMAnnotation: "/datacenter/vm/cluster/"},
+			expectedError: "invalid machine.openshift.io/vsphere-adopt-vm annotation: inventory path must end with the name of the vm",
+		},
+		{
+			name:          "name",
+			annotations:   map[string]string{AdoptVMAnnotation: "worker-0"},
+			expectedError: "invalid machine.openshift.io/vsphere-adopt-vm annotation: must be the UUID or the absolute inventory path of a vm: invalid UUID length: 8",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vm, err := AdoptVM(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(vm).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestAdoptVMDryRun(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      bool
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "dry run",
+			annotations: map[string]string{AdoptVMDryRunAnnotation: "true"},
+			expected:    true,
+		},
+		{
+			name:        "not dry run",
+			annotations: map[string]string{AdoptVMDryRunAnnotation: "false"},
+		},
+		{
+			name:          "invalid",
+			annotations:   map[string]string{AdoptVMDryRunAnnotation: "yes"},
+			expectedError: "invalid machine.openshift.io/vsphere-adopt-vm-dry-run annotation: must be a boolean: strconv.ParseBool: parsing \"yes\": invalid syntax",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dryRun, err := AdoptVMDryRun(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(dryRun).To(Equal(tc.expected))
+		})
+	}
+}
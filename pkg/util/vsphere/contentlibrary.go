@@ -0,0 +1,73 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ContentLibraryItemAnnotation is an annotation that can be applied to Machine objects, usually through the template
+// of their MachineSet, to deploy the virtual machine from an OVF or VM template item of a content library instead
+// of cloning the template of the provider spec, e.g. `{"library": "rhcos", "item": "rhcos-4.16"}`.
+// TODO: move this annotation to the openshift/api package
+const ContentLibraryItemAnnotation = "machine.openshift.io/vsphere-content-library-item"
+
+// ContentLibraryItem identifies an item of a content library by the names of the library and of the item.
+type ContentLibraryItem struct {
+	// Library is the name of the content library, e.g. a library subscribed to the one publishing the images.
+	Library string `json:"library"`
+	// Item is the name of the OVF or VM template item of the library.
+	Item string `json:"item"`
+}
+
+// String returns the library and item names, as shown in the content library paths of govc.
+func (i *ContentLibraryItem) String() string {
+	return fmt.Sprintf("%s/%s", i.Library, i.Item)
+}
+
+// ParseContentLibraryItem parses a JSON content library item, e.g. `{"library": "rhcos", "item": "rhcos-4.16"}`.
+func ParseContentLibraryItem(value string) (*ContentLibraryItem, error) {
+	item := &ContentLibraryItem{}
+	if err := json.Unmarshal([]byte(value), item); err != nil {
+		return nil, fmt.Errorf("must be a JSON object with the library and item names: %v", err)
+	}
+
+	if item.Library == "" {
+		return nil, errors.New("library is required")
+	}
+	if item.Item == "" {
+		return nil, errors.New("item is required")
+	}
+	return item, nil
+}
+
+// ContentLibraryItemSource returns the content library item the Machine is deployed from, if any.
+func ContentLibraryItemSource(machine metav1.Object) (*ContentLibraryItem, error) {
+	value, ok := machine.GetAnnotations()[ContentLibraryItemAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	item, err := ParseContentLibraryItem(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ContentLibraryItemAnnotation, err)
+	}
+	return item, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestContentLibraryItemSource(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      *ContentLibraryItem
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "with a library item",
+			annotations: map[string]string{ContentLibraryItemAnnotation: `{"library": "rhcos", "item": "rhcos-4.16"}`},
+			expected:    &ContentLibraryItem{Library: "rhcos", Item: "rhcos-4.16"},
+		},
+		{
+			name:          "without library",
+			annotations:   map[string]string{ContentLibraryItemAnnotation: `{"item": "rhcos-4.16"}`},
+			expectedError: "invalid machine.openshift.io/vsphere-content-library-item annotation: library is required",
+		},
+		{
+			name:          "without item",
+			annotations:   map[string]string{ContentLibraryItemAnnotation: `{"library": "rhcos"}`},
+			expectedError: "invalid machine.openshift.io/vsphere-content-library-item annotation: item is required",
+		},
+		{
+			name:          "not an object",
+			annotations:   map[string]string{ContentLibraryItemAnnotation: `rhcos/rhcos-4.16`},
+			expectedError: "invalid machine.openshift.io/vsphere-content-library-item annotation: must be a JSON object with the library and item names: invalid character 'r' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			item, err := ContentLibraryItemSource(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(item).To(Equal(tc.expected))
+		})
+	}
+}
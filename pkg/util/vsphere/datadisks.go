@@ -0,0 +1,192 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vsphere implements the vSphere Machine options which are not part of the
+// VSphereMachineProviderSpec, and are set as annotations on Machines instead.
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DataDisksAnnotation is an annotation that can be applied to Machine objects, usually through the
+	// template of their MachineSet, to add data disks to the virtual machine when it is cloned,
+	// e.g. `[{"name": "images", "sizeGiB": 100, "provisioningMode": "Thin"}]`.
+	// TODO: move this annotation to the openshift/api package
+	DataDisksAnnotation = "machine.openshift.io/vsphere-data-disks"
+
+	// maxDataDiskSizeGiB is the largest virtual disk supported by vSphere, 62TiB
+	maxDataDiskSizeGiB = 62 * 1024
+	// maxControllerBusNumber is the largest bus number of both SCSI and NVMe controllers
+	maxControllerBusNumber = 3
+)
+
+// DiskProvisioningMode is the way the space of a data disk is allocated on its datastore.
+type DiskProvisioningMode string
+
+const (
+	// ProvisioningModeThin allocates the space of the disk on demand
+	ProvisioningModeThin DiskProvisioningMode = "Thin"
+	// ProvisioningModeThick allocates the space of the disk upfront, zeroing it on first write
+	ProvisioningModeThick DiskProvisioningMode = "Thick"
+	// ProvisioningModeEagerlyZeroed allocates and zeroes the space of the disk upfront
+	ProvisioningModeEagerlyZeroed DiskProvisioningMode = "EagerlyZeroed"
+)
+
+// DiskControllerType is the type of the controller a data disk is attached to.
+type DiskControllerType string
+
+const (
+	// ControllerTypeSCSI attaches the disk to a paravirtual SCSI controller
+	ControllerTypeSCSI DiskControllerType = "SCSI"
+	// ControllerTypeNVMe attaches the disk to a NVMe controller
+	ControllerTypeNVMe DiskControllerType = "NVMe"
+)
+
+var dataDiskNamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([-_a-zA-Z0-9]{0,61}[a-zA-Z0-9])?$`)
+
+// DataDisk is an additional disk of a virtual machine, created along with it and destroyed with it.
+type DataDisk struct {
+	// Name identifies the disk among the data disks of the Machine
+	Name string `json:"name"`
+	// SizeGiB is the size of the disk
+	SizeGiB int32 `json:"sizeGiB"`
+	// Datastore is the name or inventory path of the datastore to place the disk on.
+	// Defaults to the datastore of the virtual machine.
+	Datastore string `json:"datastore,omitempty"`
+	// StoragePolicy is the name of the storage policy to apply to the disk.
+	// It can not be combined with a datastore.
+	StoragePolicy string `json:"storagePolicy,omitempty"`
+	// ProvisioningMode is one of Thin, Thick or EagerlyZeroed. Defaults to Thin.
+	ProvisioningMode DiskProvisioningMode `json:"provisioningMode,omitempty"`
+	// Controller places the disk on a specific controller of the virtual machine.
+	// Defaults to the first SCSI controller.
+	Controller *DataDiskController `json:"controller,omitempty"`
+}
+
+// DataDiskController is the controller a data disk is attached to. The controller is
+// added to the virtual machine if it does not exist yet.
+type DataDiskController struct {
+	// Type is either SCSI or NVMe. Defaults to SCSI.
+	Type DiskControllerType `json:"type,omitempty"`
+	// BusNumber is the bus number of the controller, from 0 to 3
+	BusNumber int32 `json:"busNumber,omitempty"`
+	// UnitNumber is the unit number of the disk on the controller.
+	// Defaults to the first free unit number.
+	UnitNumber *int32 `json:"unitNumber,omitempty"`
+}
+
+// ParseDataDisks parses a JSON list of data disks, e.g. `[{"name": "images", "sizeGiB": 100}]`,
+// and defaults their provisioning mode and controller.
+func ParseDataDisks(value string) ([]DataDisk, error) {
+	var disks []DataDisk
+	if err := json.Unmarshal([]byte(value), &disks); err != nil {
+		return nil, fmt.Errorf("must be a JSON list of data disks: %v", err)
+	}
+
+	names := map[string]bool{}
+	units := map[string]bool{}
+	for i := range disks {
+		disk := &disks[i]
+		if !dataDiskNamePattern.MatchString(disk.Name) {
+			return nil, fmt.Errorf("disk %d: name %q must consist of up to 63 alphanumeric characters, '-' or '_', and start and end with an alphanumeric character", i, disk.Name)
+		}
+		if names[disk.Name] {
+			return nil, fmt.Errorf("disk %d: duplicate name %q", i, disk.Name)
+		}
+		names[disk.Name] = true
+
+		if disk.SizeGiB <= 0 || disk.SizeGiB > maxDataDiskSizeGiB {
+			return nil, fmt.Errorf("disk %q: sizeGiB must be between 1 and %d, got %d", disk.Name, maxDataDiskSizeGiB, disk.SizeGiB)
+		}
+		if disk.Datastore != "" && disk.StoragePolicy != "" {
+			return nil, fmt.Errorf("disk %q: datastore and storagePolicy are mutually exclusive", disk.Name)
+		}
+
+		switch disk.ProvisioningMode {
+		case "":
+			disk.ProvisioningMode = ProvisioningModeThin
+		case ProvisioningModeThin, ProvisioningModeThick, ProvisioningModeEagerlyZeroed:
+		default:
+			return nil, fmt.Errorf("disk %q: unknown provisioningMode %q, must be one of %s, %s or %s",
+				disk.Name, disk.ProvisioningMode, ProvisioningModeThin, ProvisioningModeThick, ProvisioningModeEagerlyZeroed)
+		}
+
+		if disk.Controller == nil {
+			disk.Controller = &DataDiskController{}
+		}
+		if err := validateController(disk.Controller); err != nil {
+			return nil, fmt.Errorf("disk %q: %v", disk.Name, err)
+		}
+		if disk.Controller.UnitNumber != nil {
+			unit := fmt.Sprintf("%s%d:%d", disk.Controller.Type, disk.Controller.BusNumber, *disk.Controller.UnitNumber)
+			if units[unit] {
+				return nil, fmt.Errorf("disk %q: unit %d of %s controller %d is used by another disk",
+					disk.Name, *disk.Controller.UnitNumber, disk.Controller.Type, disk.Controller.BusNumber)
+			}
+			units[unit] = true
+		}
+	}
+	return disks, nil
+}
+
+// validateController defaults the type of the controller and validates its bus and unit numbers
+func validateController(controller *DataDiskController) error {
+	var maxUnitNumber int32
+	switch controller.Type {
+	case "":
+		controller.Type = ControllerTypeSCSI
+		maxUnitNumber = 15
+	case ControllerTypeSCSI:
+		maxUnitNumber = 15
+	case ControllerTypeNVMe:
+		maxUnitNumber = 14
+	default:
+		return fmt.Errorf("unknown controller type %q, must be one of %s or %s", controller.Type, ControllerTypeSCSI, ControllerTypeNVMe)
+	}
+
+	if controller.BusNumber < 0 || controller.BusNumber > maxControllerBusNumber {
+		return fmt.Errorf("controller busNumber must be between 0 and %d, got %d", maxControllerBusNumber, controller.BusNumber)
+	}
+	if unit := controller.UnitNumber; unit != nil {
+		if *unit < 0 || *unit > maxUnitNumber {
+			return fmt.Errorf("controller unitNumber must be between 0 and %d, got %d", maxUnitNumber, *unit)
+		}
+		// The SCSI controller itself sits on unit 7 of its bus
+		if controller.Type == ControllerTypeSCSI && *unit == 7 {
+			return fmt.Errorf("controller unitNumber 7 is reserved for the SCSI controller")
+		}
+	}
+	return nil
+}
+
+// DataDisks returns the data disks of the Machine, if any.
+func DataDisks(machine metav1.Object) ([]DataDisk, error) {
+	value, ok := machine.GetAnnotations()[DataDisksAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	disks, err := ParseDataDisks(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", DataDisksAnnotation, err)
+	}
+	return disks, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseDataDisks(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      []DataDisk
+		expectedError string
+	}{
+		{
+			name:  "with defaults",
+			value: `[{"name": "images", "sizeGiB": 100}]`,
+			expected: []DataDisk{{
+				Name:             "images",
+				SizeGiB:          100,
+				ProvisioningMode: ProvisioningModeThin,
+				Controller:       &DataDiskController{Type: ControllerTypeSCSI},
+			}},
+		},
+		{
+			name: "with all fields",
+			value: `[
+				{"name": "logs", "sizeGiB": 10, "datastore": "/DC0/datastore/LocalDS_1", "provisioningMode": "EagerlyZeroed",
+				 "controller": {"type": "NVMe", "busNumber": 1, "unitNumber": 3}},
+				{"name": "data", "sizeGiB": 20, "storagePolicy": "gold", "provisioningMode": "Thick"}
+			]`,
+			expected: []DataDisk{
+				{
+					Name:             "logs",
+					SizeGiB:          10,
+					Datastore:        "/DC0/datastore/LocalDS_1",
+					ProvisioningMode: ProvisioningModeEagerlyZeroed,
+					Controller:       &DataDiskController{Type: ControllerTypeNVMe, BusNumber: 1, UnitNumber: ptr.To[int32](3)},
+				},
+				{
+					Name:             "data",
+					SizeGiB:          20,
+					StoragePolicy:    "gold",
+					ProvisioningMode: ProvisioningModeThick,
+					Controller:       &DataDiskController{Type: ControllerTypeSCSI},
+				},
+			},
+		},
+		{
+			name:          "not a list",
+			value:         `{"name": "images"}`,
+			expectedError: "must be a JSON list of data disks: json: cannot unmarshal object into Go value of type []vsphere.DataDisk",
+		},
+		{
+			name:          "invalid name",
+			value:         `[{"name": "-images", "sizeGiB": 100}]`,
+			expectedError: "disk 0: name \"-images\" must consist of up to 63 alphanumeric characters, '-' or '_', and start and end with an alphanumeric character",
+		},
+		{
+			name:          "duplicate name",
+			value:         `[{"name": "images", "sizeGiB": 100}, {"name": "images", "sizeGiB": 10}]`,
+			expectedError: "disk 1: duplicate name \"images\"",
+		},
+		{
+			name:          "missing size",
+			value:         `[{"name": "images"}]`,
+			expectedError: "disk \"images\": sizeGiB must be between 1 and 63488, got 0",
+		},
+		{
+			name:          "datastore and storage policy",
+			value:         `[{"name": "images", "sizeGiB": 100, "datastore": "ds", "storagePolicy": "gold"}]`,
+			expectedError: "disk \"images\": datastore and storagePolicy are mutually exclusive",
+		},
+		{
+			name:          "unknown provisioning mode",
+			value:         `[{"name": "images", "sizeGiB": 100, "provisioningMode": "Lazy"}]`,
+			expectedError: "disk \"images\": unknown provisioningMode \"Lazy\", must be one of Thin, Thick or EagerlyZeroed",
+		},
+		{
+			name:          "unknown controller type",
+			value:         `[{"name": "images", "sizeGiB": 100, "controller": {"type": "IDE"}}]`,
+			expectedError: "disk \"images\": unknown controller type \"IDE\", must be one of SCSI or NVMe",
+		},
+		{
+			name:          "invalid bus number",
+			value:         `[{"name": "images", "sizeGiB": 100, "controller": {"busNumber": 4}}]`,
+			expectedError: "disk \"images\": controller busNumber must be between 0 and 3, got 4",
+		},
+		{
+			name:          "reserved SCSI unit number",
+			value:         `[{"name": "images", "sizeGiB": 100, "controller": {"unitNumber": 7}}]`,
+			expectedError: "disk \"images\": controller unitNumber 7 is reserved for the SCSI controller",
+		},
+		{
+			name:          "invalid NVMe unit number",
+			value:         `[{"name": "images", "sizeGiB": 100, "controller": {"type": "NVMe", "unitNumber": 15}}]`,
+			expectedError: "disk \"images\": controller unitNumber must be between 0 and 14, got 15",
+		},
+		{
+			name: "shared unit number",
+			value: `[{"name": "images", "sizeGiB": 100, "controller": {"busNumber": 1, "unitNumber": 2}},
+				{"name": "logs", "sizeGiB": 100, "controller": {"type": "SCSI", "busNumber": 1, "unitNumber": 2}}]`,
+			expectedError: "disk \"logs\": unit 2 of SCSI controller 1 is used by another disk",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			disks, err := ParseDataDisks(tc.value)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(disks).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestDataDisks(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &metav1.ObjectMeta{}
+	g.Expect(DataDisks(machine)).To(BeEmpty())
+
+	machine.Annotations = map[string]string{DataDisksAnnotation: `[{"name": "images", "sizeGiB": 100}]`}
+	g.Expect(DataDisks(machine)).To(HaveLen(1))
+
+	machine.Annotations[DataDisksAnnotation] = `[{"name": "images"}]`
+	_, err := DataDisks(machine)
+	g.Expect(err).To(MatchError("invalid machine.openshift.io/vsphere-data-disks annotation: disk \"images\": sizeGiB must be between 1 and 63488, got 0"))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DRSAnnotation is an annotation that can be applied to Machine objects, usually through the template of their
+// MachineSet, to add the virtual machine to a DRS VM group of its cluster, and optionally keep the VMs of the group
+// on different hosts or on a group of hosts, e.g. `{"antiAffinity": true, "hostGroup": "rack-a"}`.
+// TODO: move this annotation to the openshift/api package
+const DRSAnnotation = "machine.openshift.io/vsphere-drs"
+
+// maxDRSNameLength is the longest name of a DRS group or rule
+const maxDRSNameLength = 80
+
+// DRSOptions places the virtual machine of a Machine in a DRS VM group, and configures the DRS rules of the group.
+type DRSOptions struct {
+	// VMGroup is the name of the DRS VM group to add the virtual machine to. The group is created if it does not exist.
+	// Defaults to the name of the MachineSet owning the Machine.
+	VMGroup string `json:"vmGroup,omitempty"`
+	// AntiAffinity keeps the virtual machines of the group on different hosts, with a VM-VM anti-affinity rule.
+	AntiAffinity bool `json:"antiAffinity,omitempty"`
+	// HostGroup is the name of an existing DRS host group. When set, the virtual machines of the group
+	// should run on the hosts of the group, with a non mandatory VM-Host affinity rule.
+	HostGroup string `json:"hostGroup,omitempty"`
+}
+
+// AntiAffinityRuleName returns the name of the VM-VM anti-affinity rule of the VM group.
+func (o *DRSOptions) AntiAffinityRuleName() string {
+	return o.VMGroup + "-anti-affinity"
+}
+
+// HostAffinityRuleName returns the name of the VM-Host affinity rule of the VM group.
+func (o *DRSOptions) HostAffinityRuleName() string {
+	return o.VMGroup + "-host-affinity"
+}
+
+// ParseDRSOptions parses JSON DRS options, e.g. `{"vmGroup": "workers", "antiAffinity": true}`.
+func ParseDRSOptions(value string) (*DRSOptions, error) {
+	options := &DRSOptions{}
+	if err := json.Unmarshal([]byte(value), options); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of DRS options: %v", err)
+	}
+
+	if err := validateVMGroup(options.VMGroup); err != nil {
+		return nil, err
+	}
+	if len(options.HostGroup) > maxDRSNameLength {
+		return nil, fmt.Errorf("hostGroup must be at most %d characters long", maxDRSNameLength)
+	}
+	return options, nil
+}
+
+// DRS returns the DRS options of the Machine, if any, with the VM group defaulted
+// to the name of the MachineSet owning the Machine.
+func DRS(machine metav1.Object) (*DRSOptions, error) {
+	value, ok := machine.GetAnnotations()[DRSAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	options, err := ParseDRSOptions(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", DRSAnnotation, err)
+	}
+
+	if options.VMGroup == "" {
+		if owner := metav1.GetControllerOf(machine); owner != nil && owner.Kind == "MachineSet" {
+			options.VMGroup = owner.Name
+		}
+	}
+	if options.VMGroup == "" {
+		return nil, fmt.Errorf("invalid %s annotation: vmGroup is required for Machines not owned by a MachineSet", DRSAnnotation)
+	}
+	if err := validateVMGroup(options.VMGroup); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", DRSAnnotation, err)
+	}
+	return options, nil
+}
+
+// validateVMGroup validates the length of the VM group name, leaving room for the suffixes of the rule names
+func validateVMGroup(name string) error {
+	if maxLength := maxDRSNameLength - len("-anti-affinity"); len(name) > maxLength {
+		return fmt.Errorf("vmGroup %q must be at most %d characters long", name, maxLength)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestDRS(t *testing.T) {
+	ownedBy := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+	}
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		owners        []metav1.OwnerReference
+		expected      *DRSOptions
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "with a VM group",
+			annotations: map[string]string{DRSAnnotation: `{"vmGroup": "infra", "antiAffinity": true, "hostGroup": "rack-a"}`},
+			owners:      ownedBy("MachineSet", "workers"),
+			expected:    &DRSOptions{VMGroup: "infra", AntiAffinity: true, HostGroup: "rack-a"},
+		},
+		{
+			name:        "VM group defaults to the MachineSet",
+			annotations: map[string]string{DRSAnnotation: `{"antiAffinity": true}`},
+			owners:      ownedBy("MachineSet", "workers"),
+			expected:    &DRSOptions{VMGroup: "workers", AntiAffinity: true},
+		},
+		{
+			name:          "VM group is required without a MachineSet",
+			annotations:   map[string]string{DRSAnnotation: `{"antiAffinity": true}`},
+			owners:        ownedBy("ControlPlaneMachineSet", "cluster"),
+			expectedError: "invalid machine.openshift.io/vsphere-drs annotation: vmGroup is required for Machines not owned by a MachineSet",
+		},
+		{
+			name:          "invalid JSON",
+			annotations:   map[string]string{DRSAnnotation: `[]`},
+			expectedError: "invalid machine.openshift.io/vsphere-drs annotation: must be a JSON object of DRS options: json: cannot unmarshal array into Go value of type vsphere.DRSOptions",
+		},
+		{
+			name:          "too long MachineSet name",
+			annotations:   map[string]string{DRSAnnotation: `{}`},
+			owners:        ownedBy("MachineSet", strings.Repeat("a", 67)),
+			expectedError: "invalid machine.openshift.io/vsphere-drs annotation: vmGroup \"" + strings.Repeat("a", 67) + "\" must be at most 66 characters long",
+		},
+		{
+			name:          "too long host group",
+			annotations:   map[string]string{DRSAnnotation: `{"hostGroup": "` + strings.Repeat("a", 81) + `"}`},
+			owners:        ownedBy("MachineSet", "workers"),
+			expectedError: "invalid machine.openshift.io/vsphere-drs annotation: hostGroup must be at most 80 characters long",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			options, err := DRS(&metav1.ObjectMeta{Annotations: tc.annotations, OwnerReferences: tc.owners})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(options).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExtraConfigAnnotation is an annotation that can be applied to Machine objects, usually through the template of
+// their MachineSet, to set advanced settings of the virtual machine when it is cloned, e.g.
+// `{"sched.cpu.latencySensitivity": "high", "isolation.tools.copy.disable": "TRUE"}`.
+// Only the allowed keys can be set.
+// TODO: move this annotation to the openshift/api package
+const ExtraConfigAnnotation = "machine.openshift.io/vsphere-extra-config"
+
+// allowedExtraConfigKeys are the advanced settings which can be set by the extra config annotation
+var allowedExtraConfigKeys = []string{
+	"disk.EnableUUID",
+	"log.keepOld",
+	"log.rotateSize",
+	"mks.enable3d",
+	"numa.nodeAffinity",
+	"RemoteDisplay.maxConnections",
+	"sched.cpu.latencySensitivity",
+	"sched.mem.pin",
+	"svga.present",
+	"tools.guest.desktop.autolock",
+	"tools.setInfo.sizeLimit",
+}
+
+// allowedExtraConfigKeyPrefixes are the groups of advanced settings which can be set by the extra config annotation
+var allowedExtraConfigKeyPrefixes = []string{
+	"isolation.",
+	"time.synchronize.",
+}
+
+// reservedExtraConfigKeyPrefixes are the advanced settings set by the machine controller, which can not be
+// overridden: the ignition config and the network kargs read by the guest, its hostname, and the steal clock.
+var reservedExtraConfigKeyPrefixes = []string{
+	"guestinfo.ignition.",
+	"guestinfo.afterburn.",
+	"guestinfo.hostname",
+	"stealclock.enable",
+}
+
+// ExtraConfig is a set of advanced settings of a virtual machine, by key.
+type ExtraConfig map[string]string
+
+// Keys returns the keys of the advanced settings, sorted.
+func (c ExtraConfig) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateExtraConfigKey returns an error when the advanced setting can not be set by the extra config annotation.
+func ValidateExtraConfigKey(key string) error {
+	for _, prefix := range reservedExtraConfigKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return fmt.Errorf("%s is reserved by the machine controller", key)
+		}
+	}
+	for _, allowed := range allowedExtraConfigKeys {
+		if key == allowed {
+			return nil
+		}
+	}
+	for _, prefix := range allowedExtraConfigKeyPrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an allowed key, allowed keys are %s, and the ones starting with %s",
+		key, strings.Join(allowedExtraConfigKeys, ", "), strings.Join(allowedExtraConfigKeyPrefixes, ", "))
+}
+
+// ParseExtraConfig parses JSON advanced settings, e.g. `{"sched.cpu.latencySensitivity": "high"}`.
+func ParseExtraConfig(value string) (ExtraConfig, error) {
+	var extraConfig ExtraConfig
+	if err := json.Unmarshal([]byte(value), &extraConfig); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of string settings: %v", err)
+	}
+
+	for _, key := range extraConfig.Keys() {
+		if err := ValidateExtraConfigKey(key); err != nil {
+			return nil, err
+		}
+		if extraConfig[key] == "" {
+			return nil, fmt.Errorf("%s must have a value", key)
+		}
+	}
+	return extraConfig, nil
+}
+
+// MachineExtraConfig returns the advanced settings of the Machine, if any.
+func MachineExtraConfig(machine metav1.Object) (ExtraConfig, error) {
+	value, ok := machine.GetAnnotations()[ExtraConfigAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	extraConfig, err := ParseExtraConfig(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ExtraConfigAnnotation, err)
+	}
+	return extraConfig, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineExtraConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      ExtraConfig
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name: "allowed keys",
+			annotations: map[string]string{
+				ExtraConfigAnnotation: `{"disk.EnableUUID": "TRUE", "sched.cpu.latencySensitivity": "high", "isolation.tools.copy.disable": "TRUE"}`,
+			},
+			expected: ExtraConfig{
+				"disk.EnableUUID":              "TRUE",
+				"sched.cpu.latencySensitivity": "high",
+				"isolation.tools.copy.disable": "TRUE",
+			},
+		},
+		{
+			name:          "ignition config",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"guestinfo.ignition.config.data": "e30="}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: guestinfo.ignition.config.data is reserved by the machine controller",
+		},
+		{
+			name:          "hostname",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"guestinfo.hostname": "node"}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: guestinfo.hostname is reserved by the machine controller",
+		},
+		{
+			name:          "key not allowed",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"guestinfo.metadata": "e30="}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: guestinfo.metadata is not an allowed key, allowed keys are disk.EnableUUID, log.keepOld, log.rotateSize, mks.enable3d, numa.nodeAffinity, RemoteDisplay.maxConnections, sched.cpu.latencySensitivity, sched.mem.pin, svga.present, tools.guest.desktop.autolock, tools.setInfo.sizeLimit, and the ones starting with isolation., time.synchronize.",
+		},
+		{
+			name:          "prefix only",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"isolation.": "TRUE"}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: isolation. is not an allowed key, allowed keys are disk.EnableUUID, log.keepOld, log.rotateSize, mks.enable3d, numa.nodeAffinity, RemoteDisplay.maxConnections, sched.cpu.latencySensitivity, sched.mem.pin, svga.present, tools.guest.desktop.autolock, tools.setInfo.sizeLimit, and the ones starting with isolation., time.synchronize.",
+		},
+		{
+			name:          "empty value",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"disk.EnableUUID": ""}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: disk.EnableUUID must have a value",
+		},
+		{
+			name:          "not a string",
+			annotations:   map[string]string{ExtraConfigAnnotation: `{"disk.EnableUUID": true}`},
+			expectedError: "invalid machine.openshift.io/vsphere-extra-config annotation: must be a JSON object of string settings: json: cannot unmarshal bool into Go struct field ExtraConfig.disk.EnableUUID of type string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			extraConfig, err := MachineExtraConfig(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(extraConfig).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirmwareAnnotation is an annotation that can be applied to Machine objects, usually through the template of their
+// MachineSet, to configure the firmware of the virtual machine when it is cloned, and optionally enable Secure Boot
+// and add a virtual TPM, e.g. `{"firmware": "efi", "secureBoot": true, "vTPM": true}`.
+// TODO: move this annotation to the openshift/api package
+const FirmwareAnnotation = "machine.openshift.io/vsphere-firmware"
+
+// Firmware types of a virtual machine
+const (
+	FirmwareBIOS = "bios"
+	FirmwareEFI  = "efi"
+)
+
+const (
+	// SecureBootMinimumHWVersion is the lowest hardware version supporting UEFI Secure Boot
+	SecureBootMinimumHWVersion = 13
+	// VTPMMinimumHWVersion is the lowest hardware version supporting a virtual TPM
+	VTPMMinimumHWVersion = 14
+)
+
+// FirmwareOptions configures the firmware and the security devices of the virtual machine of a Machine.
+type FirmwareOptions struct {
+	// Firmware is the firmware of the virtual machine, bios or efi. Defaults to the firmware of the template.
+	Firmware string `json:"firmware,omitempty"`
+	// SecureBoot enables, or disables, UEFI Secure Boot. Defaults to the setting of the template.
+	// Requires the efi firmware.
+	SecureBoot *bool `json:"secureBoot,omitempty"`
+	// VTPM adds a virtual TPM to the virtual machine, unless the template has one. Requires the efi firmware, and a
+	// key provider configured on the vCenter.
+	VTPM bool `json:"vTPM,omitempty"`
+}
+
+// MinimumHWVersion returns the lowest hardware version supporting the options, zero when any version does.
+func (o *FirmwareOptions) MinimumHWVersion() int {
+	version := 0
+	if o.SecureBoot != nil && *o.SecureBoot {
+		version = max(version, SecureBootMinimumHWVersion)
+	}
+	if o.VTPM {
+		version = max(version, VTPMMinimumHWVersion)
+	}
+	return version
+}
+
+// String returns a summary of the options, e.g. "firmware efi, Secure Boot enabled, vTPM".
+func (o *FirmwareOptions) String() string {
+	firmware := o.Firmware
+	if firmware == "" {
+		firmware = "of the template"
+	}
+	summary := "firmware " + firmware
+	if o.SecureBoot != nil {
+		if *o.SecureBoot {
+			summary += ", Secure Boot enabled"
+		} else {
+			summary += ", Secure Boot disabled"
+		}
+	}
+	if o.VTPM {
+		summary += ", vTPM"
+	}
+	return summary
+}
+
+// ParseFirmwareOptions parses JSON firmware options, e.g. `{"firmware": "efi", "secureBoot": true}`.
+func ParseFirmwareOptions(value string) (*FirmwareOptions, error) {
+	options := &FirmwareOptions{}
+	if err := json.Unmarshal([]byte(value), options); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of firmware options: %v", err)
+	}
+
+	switch options.Firmware {
+	case "", FirmwareBIOS, FirmwareEFI:
+	default:
+		return nil, fmt.Errorf("firmware must be %q or %q", FirmwareBIOS, FirmwareEFI)
+	}
+	// Secure Boot and the vTPM are UEFI features, the firmware of the template is unknown until the clone
+	if options.SecureBoot != nil && *options.SecureBoot && options.Firmware != FirmwareEFI {
+		return nil, fmt.Errorf("secureBoot requires the %q firmware", FirmwareEFI)
+	}
+	if options.VTPM && options.Firmware != FirmwareEFI {
+		return nil, fmt.Errorf("vTPM requires the %q firmware", FirmwareEFI)
+	}
+	return options, nil
+}
+
+// Firmware returns the firmware options of the Machine, if any.
+func Firmware(machine metav1.Object) (*FirmwareOptions, error) {
+	value, ok := machine.GetAnnotations()[FirmwareAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	options, err := ParseFirmwareOptions(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", FirmwareAnnotation, err)
+	}
+	return options, nil
+}
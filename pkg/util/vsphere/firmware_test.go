@@ -0,0 +1,97 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestFirmware(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		expected          *FirmwareOptions
+		expectedHWVersion int
+		expectedSummary   string
+		expectedError     string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:            "EFI",
+			annotations:     map[string]string{FirmwareAnnotation: `{"firmware": "efi"}`},
+			expected:        &FirmwareOptions{Firmware: FirmwareEFI},
+			expectedSummary: "firmware efi",
+		},
+		{
+			name:              "Secure Boot and vTPM",
+			annotations:       map[string]string{FirmwareAnnotation: `{"firmware": "efi", "secureBoot": true, "vTPM": true}`},
+			expected:          &FirmwareOptions{Firmware: FirmwareEFI, SecureBoot: ptr.To(true), VTPM: true},
+			expectedHWVersion: VTPMMinimumHWVersion,
+			expectedSummary:   "firmware efi, Secure Boot enabled, vTPM",
+		},
+		{
+			name:            "Secure Boot disabled",
+			annotations:     map[string]string{FirmwareAnnotation: `{"secureBoot": false}`},
+			expected:        &FirmwareOptions{SecureBoot: ptr.To(false)},
+			expectedSummary: "firmware of the template, Secure Boot disabled",
+		},
+		{
+			name:          "unknown firmware",
+			annotations:   map[string]string{FirmwareAnnotation: `{"firmware": "uefi"}`},
+			expectedError: "invalid machine.openshift.io/vsphere-firmware annotation: firmware must be \"bios\" or \"efi\"",
+		},
+		{
+			name:          "Secure Boot with BIOS",
+			annotations:   map[string]string{FirmwareAnnotation: `{"firmware": "bios", "secureBoot": true}`},
+			expectedError: "invalid machine.openshift.io/vsphere-firmware annotation: secureBoot requires the \"efi\" firmware",
+		},
+		{
+			name:          "vTPM without firmware",
+			annotations:   map[string]string{FirmwareAnnotation: `{"vTPM": true}`},
+			expectedError: "invalid machine.openshift.io/vsphere-firmware annotation: vTPM requires the \"efi\" firmware",
+		},
+		{
+			name:          "invalid JSON",
+			annotations:   map[string]string{FirmwareAnnotation: `efi`},
+			expectedError: "invalid machine.openshift.io/vsphere-firmware annotation: must be a JSON object of firmware options: invalid character 'e' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			options, err := Firmware(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(options).To(Equal(tc.expected))
+			if options != nil {
+				g.Expect(options.MinimumHWVersion()).To(Equal(tc.expectedHWVersion))
+				g.Expect(options.String()).To(Equal(tc.expectedSummary))
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MinimumHWVersionAnnotation is an annotation that can be applied to Machine objects, usually through the template of
+// their MachineSet, to upgrade the virtual machine to a minimum hardware version after it is cloned, before it is
+// powered on for the first time, e.g. `vmx-19`.
+// TODO: move this annotation to the openshift/api package
+const MinimumHWVersionAnnotation = "machine.openshift.io/vsphere-minimum-hw-version"
+
+// HWUpgradePowerCycleAnnotation is an annotation that can be applied to Machine objects, usually through the template
+// of their MachineSet, to allow the machine controller to drain the node and power cycle the virtual machine of a
+// running Machine to upgrade it to the minimum hardware version, e.g. `true`.
+// TODO: move this annotation to the openshift/api package
+const HWUpgradePowerCycleAnnotation = "machine.openshift.io/vsphere-hw-upgrade-power-cycle"
+
+// ParseMinimumHWVersion parses a hardware version, e.g. `vmx-19`, or `19`.
+func ParseMinimumHWVersion(value string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(value, "vmx-"))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("must be a hardware version, e.g. vmx-19")
+	}
+	return version, nil
+}
+
+// MinimumHWVersion returns the minimum hardware version of the Machine, zero if it has none.
+func MinimumHWVersion(machine metav1.Object) (int, error) {
+	value, ok := machine.GetAnnotations()[MinimumHWVersionAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	version, err := ParseMinimumHWVersion(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation: %w", MinimumHWVersionAnnotation, err)
+	}
+	return version, nil
+}
+
+// ParseHWUpgradePowerCycle parses the value of the hardware upgrade power cycle annotation.
+func ParseHWUpgradePowerCycle(value string) (bool, error) {
+	allowed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("must be a boolean: %v", err)
+	}
+	return allowed, nil
+}
+
+// HWUpgradePowerCycleAllowed returns true when the Machine allows power cycles to upgrade the hardware version of its
+// running virtual machine.
+func HWUpgradePowerCycleAllowed(machine metav1.Object) (bool, error) {
+	value, ok := machine.GetAnnotations()[HWUpgradePowerCycleAnnotation]
+	if !ok {
+		return false, nil
+	}
+	allowed, err := ParseHWUpgradePowerCycle(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", HWUpgradePowerCycleAnnotation, err)
+	}
+	return allowed, nil
+}
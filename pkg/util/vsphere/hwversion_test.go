@@ -0,0 +1,108 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMinimumHWVersion(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      int
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "vmx version",
+			annotations: map[string]string{MinimumHWVersionAnnotation: "vmx-19"},
+			expected:    19,
+		},
+		{
+			name:        "version number",
+			annotations: map[string]string{MinimumHWVersionAnnotation: "17"},
+			expected:    17,
+		},
+		{
+			name:          "zero",
+			annotations:   map[string]string{MinimumHWVersionAnnotation: "vmx-0"},
+			expectedError: "invalid machine.openshift.io/vsphere-minimum-hw-version annotation: must be a hardware version, e.g. vmx-19",
+		},
+		{
+			name:          "invalid",
+			annotations:   map[string]string{MinimumHWVersionAnnotation: "latest"},
+			expectedError: "invalid machine.openshift.io/vsphere-minimum-hw-version annotation: must be a hardware version, e.g. vmx-19",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			version, err := MinimumHWVersion(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(version).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestHWUpgradePowerCycleAllowed(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      bool
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "allowed",
+			annotations: map[string]string{HWUpgradePowerCycleAnnotation: "true"},
+			expected:    true,
+		},
+		{
+			name:          "invalid",
+			annotations:   map[string]string{HWUpgradePowerCycleAnnotation: "yes"},
+			expectedError: "invalid machine.openshift.io/vsphere-hw-upgrade-power-cycle annotation: must be a boolean: strconv.ParseBool: parsing \"yes\": invalid syntax",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			allowed, err := HWUpgradePowerCycleAllowed(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(allowed).To(Equal(tc.expected))
+		})
+	}
+}
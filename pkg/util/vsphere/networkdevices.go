@@ -0,0 +1,117 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NetworkDevicesAnnotation is an annotation that can be applied to Machine objects, usually through the template of
+// their MachineSet, to set the gateways of each IP family and the static routes of the statically addressed network
+// devices of the virtual machine. The options of the n-th element apply to the n-th network device of the provider
+// spec, e.g. `[{"gateways": ["2001:db8::1"]}, {"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}]}]`.
+// TODO: move this annotation to the openshift/api package
+const NetworkDevicesAnnotation = "machine.openshift.io/vsphere-network-devices"
+
+// IP families of the addresses, gateways and routes of a network device
+const (
+	IPv4Family = "IPv4"
+	IPv6Family = "IPv6"
+)
+
+// NetworkDeviceOptions configures the gateways and routes of a network device, in addition to its provider spec.
+type NetworkDeviceOptions struct {
+	// Gateways are the gateways of the device, at most one of each IP family. The gateway of the provider spec, or
+	// of an IP address pool, takes precedence over the one of its family.
+	Gateways []string `json:"gateways,omitempty"`
+	// Routes are the static routes of the device.
+	Routes []NetworkRoute `json:"routes,omitempty"`
+}
+
+// NetworkRoute is a static route of a network device.
+type NetworkRoute struct {
+	// To is the destination network, e.g. 10.20.0.0/16.
+	To string `json:"to"`
+	// Via is the gateway to the destination network, in the IP family of the network.
+	Via string `json:"via"`
+}
+
+// AddressFamily returns the IP family of the address.
+func AddressFamily(addr netip.Addr) string {
+	if addr.Is4() {
+		return IPv4Family
+	}
+	return IPv6Family
+}
+
+// ParseNetworkDevices parses a JSON list of network device options, e.g.
+// `[{"gateways": ["192.168.1.1", "2001:db8::1"]}, {"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}]}]`.
+func ParseNetworkDevices(value string) ([]NetworkDeviceOptions, error) {
+	var devices []NetworkDeviceOptions
+	if err := json.Unmarshal([]byte(value), &devices); err != nil {
+		return nil, fmt.Errorf("must be a JSON list of network device options: %v", err)
+	}
+
+	for i, device := range devices {
+		families := map[string]bool{}
+		for _, gateway := range device.Gateways {
+			addr, err := netip.ParseAddr(gateway)
+			if err != nil {
+				return nil, fmt.Errorf("devices[%d]: gateway %q must be an IP address", i, gateway)
+			}
+			family := AddressFamily(addr)
+			if families[family] {
+				return nil, fmt.Errorf("devices[%d]: at most one %s gateway can be set", i, family)
+			}
+			families[family] = true
+		}
+		for _, route := range device.Routes {
+			to, err := netip.ParsePrefix(route.To)
+			if err != nil {
+				return nil, fmt.Errorf("devices[%d]: route destination %q must be a network in CIDR notation, e.g. 10.20.0.0/16", i, route.To)
+			}
+			if to != to.Masked() {
+				return nil, fmt.Errorf("devices[%d]: route destination %q must be a network address, e.g. %s", i, route.To, to.Masked())
+			}
+			via, err := netip.ParseAddr(route.Via)
+			if err != nil {
+				return nil, fmt.Errorf("devices[%d]: gateway %q of the route to %s must be an IP address", i, route.Via, route.To)
+			}
+			if AddressFamily(to.Addr()) != AddressFamily(via) {
+				return nil, fmt.Errorf("devices[%d]: gateway %s of the route to %s must be an %s address", i, route.Via, route.To, AddressFamily(to.Addr()))
+			}
+		}
+	}
+	return devices, nil
+}
+
+// MachineNetworkDevices returns the network device options of the Machine, if any.
+func MachineNetworkDevices(machine metav1.Object) ([]NetworkDeviceOptions, error) {
+	value, ok := machine.GetAnnotations()[NetworkDevicesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	devices, err := ParseNetworkDevices(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", NetworkDevicesAnnotation, err)
+	}
+	return devices, nil
+}
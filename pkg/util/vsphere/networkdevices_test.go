@@ -0,0 +1,96 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMachineNetworkDevices(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      []NetworkDeviceOptions
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name: "gateways and routes",
+			annotations: map[string]string{
+				NetworkDevicesAnnotation: `[{"gateways": ["192.168.1.1", "2001:db8::1"]}, {"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}, {"to": "2001:db8:20::/48", "via": "2001:db8:2::1"}]}]`,
+			},
+			expected: []NetworkDeviceOptions{
+				{Gateways: []string{"192.168.1.1", "2001:db8::1"}},
+				{Routes: []NetworkRoute{{To: "10.20.0.0/16", Via: "192.168.20.1"}, {To: "2001:db8:20::/48", Via: "2001:db8:2::1"}}},
+			},
+		},
+		{
+			name:          "invalid gateway",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{"gateways": ["192.168.1"]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[0]: gateway \"192.168.1\" must be an IP address",
+		},
+		{
+			name:          "two gateways of a family",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{}, {"gateways": ["2001:db8::1", "2001:db8::2"]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[1]: at most one IPv6 gateway can be set",
+		},
+		{
+			name:          "route to an address",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{"routes": [{"to": "10.20.0.1/16", "via": "192.168.20.1"}]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[0]: route destination \"10.20.0.1/16\" must be a network address, e.g. 10.20.0.0/16",
+		},
+		{
+			name:          "route without prefix length",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{"routes": [{"to": "10.20.0.0", "via": "192.168.20.1"}]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[0]: route destination \"10.20.0.0\" must be a network in CIDR notation, e.g. 10.20.0.0/16",
+		},
+		{
+			name:          "route without gateway",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{"routes": [{"to": "10.20.0.0/16"}]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[0]: gateway \"\" of the route to 10.20.0.0/16 must be an IP address",
+		},
+		{
+			name:          "route through a gateway of another family",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `[{"routes": [{"to": "2001:db8:20::/48", "via": "192.168.20.1"}]}]`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: devices[0]: gateway 192.168.20.1 of the route to 2001:db8:20::/48 must be an IPv6 address",
+		},
+		{
+			name:          "invalid JSON",
+			annotations:   map[string]string{NetworkDevicesAnnotation: `{"gateways": ["192.168.1.1"]}`},
+			expectedError: "invalid machine.openshift.io/vsphere-network-devices annotation: must be a JSON list of network device options: json: cannot unmarshal object into Go value of type []vsphere.NetworkDeviceOptions",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			devices, err := MachineNetworkDevices(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(devices).To(Equal(tc.expected))
+		})
+	}
+}
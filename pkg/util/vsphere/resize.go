@@ -0,0 +1,52 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResizePowerCycleAnnotation is an annotation that can be applied to Machine objects, usually through the template
+// of their MachineSet, to allow the machine controller to drain the node and power cycle the virtual machine to apply
+// CPU or memory changes which can not be hot added, e.g. `true`.
+// TODO: move this annotation to the openshift/api package
+const ResizePowerCycleAnnotation = "machine.openshift.io/vsphere-resize-power-cycle"
+
+// ParseResizePowerCycle parses the value of the resize power cycle annotation.
+func ParseResizePowerCycle(value string) (bool, error) {
+	allowed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("must be a boolean: %v", err)
+	}
+	return allowed, nil
+}
+
+// ResizePowerCycleAllowed returns true when the Machine allows power cycles to apply CPU or memory changes.
+func ResizePowerCycleAllowed(machine metav1.Object) (bool, error) {
+	value, ok := machine.GetAnnotations()[ResizePowerCycleAnnotation]
+	if !ok {
+		return false, nil
+	}
+	allowed, err := ParseResizePowerCycle(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", ResizePowerCycleAnnotation, err)
+	}
+	return allowed, nil
+}
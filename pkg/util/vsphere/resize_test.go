@@ -0,0 +1,65 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResizePowerCycleAllowed(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      bool
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name:        "allowed",
+			annotations: map[string]string{ResizePowerCycleAnnotation: "true"},
+			expected:    true,
+		},
+		{
+			name:        "not allowed",
+			annotations: map[string]string{ResizePowerCycleAnnotation: "false"},
+		},
+		{
+			name:          "invalid",
+			annotations:   map[string]string{ResizePowerCycleAnnotation: "yes"},
+			expectedError: "invalid machine.openshift.io/vsphere-resize-power-cycle annotation: must be a boolean: strconv.ParseBool: parsing \"yes\": invalid syntax",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			allowed, err := ResizePowerCycleAllowed(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(allowed).To(Equal(tc.expected))
+		})
+	}
+}
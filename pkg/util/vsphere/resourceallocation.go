@@ -0,0 +1,127 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceAllocationAnnotation is an annotation that can be applied to Machine objects, usually through the template
+// of their MachineSet, to set the CPU and memory reservations and shares of the virtual machine when it is cloned,
+// e.g. `{"cpu": {"reservationMHz": 4000, "sharesLevel": "high"}, "memory": {"reservationMiB": 16384}}`.
+// TODO: move this annotation to the openshift/api package
+const ResourceAllocationAnnotation = "machine.openshift.io/vsphere-resource-allocation"
+
+// Shares levels of a resource allocation
+const (
+	SharesLevelLow    = "low"
+	SharesLevelNormal = "normal"
+	SharesLevelHigh   = "high"
+	SharesLevelCustom = "custom"
+)
+
+// ResourceAllocation configures the CPU and memory allocation of the virtual machine of a Machine.
+type ResourceAllocation struct {
+	// CPU is the CPU allocation. Defaults to the allocation of the template.
+	CPU *CPUAllocation `json:"cpu,omitempty"`
+	// Memory is the memory allocation. Defaults to the allocation of the template.
+	Memory *MemoryAllocation `json:"memory,omitempty"`
+}
+
+// CPUAllocation is the CPU reservation and shares of a virtual machine.
+type CPUAllocation struct {
+	// ReservationMHz is the CPU guaranteed to the virtual machine, in MHz.
+	ReservationMHz *int64 `json:"reservationMHz,omitempty"`
+	ResourceShares
+}
+
+// MemoryAllocation is the memory reservation and shares of a virtual machine.
+type MemoryAllocation struct {
+	// ReservationMiB is the memory guaranteed to the virtual machine, in MiB.
+	ReservationMiB *int64 `json:"reservationMiB,omitempty"`
+	ResourceShares
+}
+
+// ResourceShares is the relative priority of a virtual machine to access a resource.
+type ResourceShares struct {
+	// SharesLevel is low, normal, high or custom.
+	SharesLevel string `json:"sharesLevel,omitempty"`
+	// Shares is the number of shares, required by the custom level only.
+	Shares *int32 `json:"shares,omitempty"`
+}
+
+func (s *ResourceShares) validate() error {
+	switch s.SharesLevel {
+	case "", SharesLevelLow, SharesLevelNormal, SharesLevelHigh:
+		if s.Shares != nil {
+			return fmt.Errorf("shares can only be set with the %q sharesLevel", SharesLevelCustom)
+		}
+	case SharesLevelCustom:
+		if s.Shares == nil {
+			return fmt.Errorf("shares must be set with the %q sharesLevel", SharesLevelCustom)
+		}
+		if *s.Shares <= 0 {
+			return fmt.Errorf("shares must be positive")
+		}
+	default:
+		return fmt.Errorf("sharesLevel must be %q, %q, %q or %q",
+			SharesLevelLow, SharesLevelNormal, SharesLevelHigh, SharesLevelCustom)
+	}
+	return nil
+}
+
+// ParseResourceAllocation parses a JSON resource allocation, e.g. `{"memory": {"reservationMiB": 16384}}`.
+func ParseResourceAllocation(value string) (*ResourceAllocation, error) {
+	allocation := &ResourceAllocation{}
+	if err := json.Unmarshal([]byte(value), allocation); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of cpu and memory allocations: %v", err)
+	}
+
+	if allocation.CPU != nil {
+		if allocation.CPU.ReservationMHz != nil && *allocation.CPU.ReservationMHz < 0 {
+			return nil, fmt.Errorf("cpu: reservationMHz must not be negative")
+		}
+		if err := allocation.CPU.validate(); err != nil {
+			return nil, fmt.Errorf("cpu: %w", err)
+		}
+	}
+	if allocation.Memory != nil {
+		if allocation.Memory.ReservationMiB != nil && *allocation.Memory.ReservationMiB < 0 {
+			return nil, fmt.Errorf("memory: reservationMiB must not be negative")
+		}
+		if err := allocation.Memory.validate(); err != nil {
+			return nil, fmt.Errorf("memory: %w", err)
+		}
+	}
+	return allocation, nil
+}
+
+// MachineResourceAllocation returns the resource allocation of the Machine, if any.
+func MachineResourceAllocation(machine metav1.Object) (*ResourceAllocation, error) {
+	value, ok := machine.GetAnnotations()[ResourceAllocationAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	allocation, err := ParseResourceAllocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", ResourceAllocationAnnotation, err)
+	}
+	return allocation, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestMachineResourceAllocation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      *ResourceAllocation
+		expectedError string
+	}{
+		{
+			name: "without annotation",
+		},
+		{
+			name: "reservations and shares",
+			annotations: map[string]string{
+				ResourceAllocationAnnotation: `{"cpu": {"reservationMHz": 4000, "sharesLevel": "high"}, "memory": {"reservationMiB": 16384, "sharesLevel": "custom", "shares": 163840}}`,
+			},
+			expected: &ResourceAllocation{
+				CPU: &CPUAllocation{
+					ReservationMHz: ptr.To[int64](4000),
+					ResourceShares: ResourceShares{SharesLevel: SharesLevelHigh},
+				},
+				Memory: &MemoryAllocation{
+					ReservationMiB: ptr.To[int64](16384),
+					ResourceShares: ResourceShares{SharesLevel: SharesLevelCustom, Shares: ptr.To[int32](163840)},
+				},
+			},
+		},
+		{
+			name:          "negative reservation",
+			annotations:   map[string]string{ResourceAllocationAnnotation: `{"memory": {"reservationMiB": -1}}`},
+			expectedError: "invalid machine.openshift.io/vsphere-resource-allocation annotation: memory: reservationMiB must not be negative",
+		},
+		{
+			name:          "unknown shares level",
+			annotations:   map[string]string{ResourceAllocationAnnotation: `{"cpu": {"sharesLevel": "highest"}}`},
+			expectedError: "invalid machine.openshift.io/vsphere-resource-allocation annotation: cpu: sharesLevel must be \"low\", \"normal\", \"high\" or \"custom\"",
+		},
+		{
+			name:          "custom shares level without shares",
+			annotations:   map[string]string{ResourceAllocationAnnotation: `{"cpu": {"sharesLevel": "custom"}}`},
+			expectedError: "invalid machine.openshift.io/vsphere-resource-allocation annotation: cpu: shares must be set with the \"custom\" sharesLevel",
+		},
+		{
+			name:          "shares without custom shares level",
+			annotations:   map[string]string{ResourceAllocationAnnotation: `{"memory": {"sharesLevel": "low", "shares": 100}}`},
+			expectedError: "invalid machine.openshift.io/vsphere-resource-allocation annotation: memory: shares can only be set with the \"custom\" sharesLevel",
+		},
+		{
+			name:          "invalid JSON",
+			annotations:   map[string]string{ResourceAllocationAnnotation: `high`},
+			expectedError: "invalid machine.openshift.io/vsphere-resource-allocation annotation: must be a JSON object of cpu and memory allocations: invalid character 'h' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			allocation, err := MachineResourceAllocation(&metav1.ObjectMeta{Annotations: tc.annotations})
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(allocation).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"errors"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StoragePolicyAnnotation is an annotation that can be applied to Machine objects, usually through the template of
+// their MachineSet, to place the virtual machine on a datastore compatible with the named storage policy, and apply
+// the policy to its home directory and disks, e.g. `vSAN Default Storage Policy`.
+// TODO: move this annotation to the openshift/api package
+const StoragePolicyAnnotation = "machine.openshift.io/vsphere-storage-policy"
+
+// StoragePolicy returns the name of the storage policy of the Machine, if any.
+func StoragePolicy(machine metav1.Object) string {
+	return strings.TrimSpace(machine.GetAnnotations()[StoragePolicyAnnotation])
+}
+
+// ValidateStoragePolicy validates the storage policy name, as set in the annotation, against the
+// datastore of the workspace. The datastore is chosen among the ones compatible with the policy, so
+// setting both would be ambiguous.
+func ValidateStoragePolicy(value, workspaceDatastore string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("storage policy name must not be empty")
+	}
+	if workspaceDatastore != "" {
+		return errors.New("a storage policy can not be combined with providerSpec.workspace.datastore, the datastore is chosen among the ones compatible with the policy")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestValidateStoragePolicy(t *testing.T) {
+	testCases := []struct {
+		name               string
+		value              string
+		workspaceDatastore string
+		expectedError      string
+	}{
+		{
+			name:  "with a storage policy",
+			value: "vSAN Default Storage Policy",
+		},
+		{
+			name:          "with an empty storage policy",
+			value:         "  ",
+			expectedError: "storage policy name must not be empty",
+		},
+		{
+			name:               "with a datastore",
+			value:              "gold",
+			workspaceDatastore: "datastore1",
+			expectedError:      "a storage policy can not be combined with providerSpec.workspace.datastore, the datastore is chosen among the ones compatible with the policy",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := ValidateStoragePolicy(tc.value, tc.workspaceDatastore)
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
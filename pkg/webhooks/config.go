@@ -14,6 +14,8 @@ const (
 	DefaultMachineValidatingHookPath                   = "/validate-machine-openshift-io-v1beta1-machine"
 	DefaultMachineSetMutatingHookPath                  = "/mutate-machine-openshift-io-v1beta1-machineset"
 	DefaultMachineSetValidatingHookPath                = "/validate-machine-openshift-io-v1beta1-machineset"
+	DefaultMachineHealthCheckMutatingHookPath          = "/mutate-machine-openshift-io-v1beta1-machinehealthcheck"
+	DefaultMachineHealthCheckValidatingHookPath        = "/validate-machine-openshift-io-v1beta1-machinehealthcheck"
 	DefaultMetal3RemediationMutatingHookPath           = "/mutate-infrastructure-cluster-x-k8s-io-v1beta1-metal3remediation"
 	DefaultMetal3RemediationValidatingHookPath         = "/validate-infrastructure-cluster-x-k8s-io-v1beta1-metal3remediation"
 	DefaultMetal3RemediationTemplateMutatingHookPath   = "/mutate-infrastructure-cluster-x-k8s-io-v1beta1-metal3remediationtemplate"
@@ -43,7 +45,7 @@ var (
 	webhookSideEffects   = admissionregistrationv1.SideEffectClassNone
 )
 
-// NewMachineValidatingWebhookConfiguration creates a validation webhook configuration with configured Machine and MachineSet webhooks
+// NewMachineValidatingWebhookConfiguration creates a validation webhook configuration with configured Machine, MachineSet and MachineHealthCheck webhooks
 func NewMachineValidatingWebhookConfiguration() *admissionregistrationv1.ValidatingWebhookConfiguration {
 	validatingWebhookConfiguration := &admissionregistrationv1.ValidatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
@@ -55,6 +57,7 @@ func NewMachineValidatingWebhookConfiguration() *admissionregistrationv1.Validat
 		Webhooks: []admissionregistrationv1.ValidatingWebhook{
 			MachineValidatingWebhook(),
 			MachineSetValidatingWebhook(),
+			MachineHealthCheckValidatingWebhook(),
 		},
 	}
 
@@ -128,6 +131,38 @@ func MachineSetValidatingWebhook() admissionregistrationv1.ValidatingWebhook {
 	}
 }
 
+// MachineHealthCheckValidatingWebhook returns validating webhooks for machineHealthCheck to populate the configuration
+func MachineHealthCheckValidatingWebhook() admissionregistrationv1.ValidatingWebhook {
+	serviceReference := admissionregistrationv1.ServiceReference{
+		Namespace: defaultWebhookServiceNamespace,
+		Name:      defaultWebhookServiceName,
+		Path:      ptr.To[string](DefaultMachineHealthCheckValidatingHookPath),
+		Port:      ptr.To[int32](defaultWebhookServicePort),
+	}
+	return admissionregistrationv1.ValidatingWebhook{
+		AdmissionReviewVersions: []string{"v1"},
+		Name:                    "validation.machinehealthcheck.machine.openshift.io",
+		FailurePolicy:           &webhookFailurePolicy,
+		SideEffects:             &webhookSideEffects,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &serviceReference,
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{machinev1beta1.GroupName},
+					APIVersions: []string{machinev1beta1.SchemeGroupVersion.Version},
+					Resources:   []string{"machinehealthchecks"},
+				},
+				Operations: []admissionregistrationv1.OperationType{
+					admissionregistrationv1.Create,
+					admissionregistrationv1.Update,
+				},
+			},
+		},
+	}
+}
+
 // NewMetal3RemediationValidatingWebhookConfiguration creates a validation webhook configuration with configured
 // metal3remediation(template) webhooks. Metal3Remediation(Templates) were backported from metal3, their CRDs and the
 // actual webhook implementation can be found in cluster-api-provider-baremetal
@@ -215,7 +250,7 @@ func Metal3RemediationTemplateValidatingWebhook() admissionregistrationv1.Valida
 	}
 }
 
-// NewMachineMutatingWebhookConfiguration creates a mutating webhook configuration with configured Machine and MachineSet webhooks
+// NewMachineMutatingWebhookConfiguration creates a mutating webhook configuration with configured Machine, MachineSet and MachineHealthCheck webhooks
 func NewMachineMutatingWebhookConfiguration() *admissionregistrationv1.MutatingWebhookConfiguration {
 	mutatingWebhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
@@ -227,6 +262,7 @@ func NewMachineMutatingWebhookConfiguration() *admissionregistrationv1.MutatingW
 		Webhooks: []admissionregistrationv1.MutatingWebhook{
 			MachineMutatingWebhook(),
 			MachineSetMutatingWebhook(),
+			MachineHealthCheckMutatingWebhook(),
 		},
 	}
 
@@ -298,6 +334,37 @@ func MachineSetMutatingWebhook() admissionregistrationv1.MutatingWebhook {
 	}
 }
 
+// MachineHealthCheckMutatingWebhook returns mutating webhook for machineHealthCheck to apply in configuration
+func MachineHealthCheckMutatingWebhook() admissionregistrationv1.MutatingWebhook {
+	serviceReference := admissionregistrationv1.ServiceReference{
+		Namespace: defaultWebhookServiceNamespace,
+		Name:      defaultWebhookServiceName,
+		Path:      ptr.To[string](DefaultMachineHealthCheckMutatingHookPath),
+		Port:      ptr.To[int32](defaultWebhookServicePort),
+	}
+	return admissionregistrationv1.MutatingWebhook{
+		AdmissionReviewVersions: []string{"v1"},
+		Name:                    "default.machinehealthcheck.machine.openshift.io",
+		FailurePolicy:           &webhookFailurePolicy,
+		SideEffects:             &webhookSideEffects,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &serviceReference,
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{machinev1beta1.GroupName},
+					APIVersions: []string{machinev1beta1.SchemeGroupVersion.Version},
+					Resources:   []string{"machinehealthchecks"},
+				},
+				Operations: []admissionregistrationv1.OperationType{
+					admissionregistrationv1.Create,
+				},
+			},
+		},
+	}
+}
+
 // NewMetal3RemediationMutatingWebhookConfiguration creates a mutating webhook configuration with configured
 // metal3remediation(template) webhooks. Metal3Remediation(Templates) were backported from metal3, their CRDs and the
 // actual webhook implementation can be found in cluster-api-provider-baremetal
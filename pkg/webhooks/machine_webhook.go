@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
+	"reflect"
 	"regexp"
 	goruntime "runtime"
 	"strconv"
@@ -20,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 	"k8s.io/utils/strings/slices"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,6 +35,7 @@ import (
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
 	osclientset "github.com/openshift/client-go/config/clientset/versioned"
 	"github.com/openshift/machine-api-operator/pkg/util/lifecyclehooks"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
 )
 
 type systemSpecifications struct {
@@ -317,6 +321,9 @@ func getDNS() (*osconfigv1.DNS, error) {
 
 type machineAdmissionFn func(m *machinev1beta1.Machine, config *admissionConfig) (bool, []string, field.ErrorList)
 
+// machineUpdateAdmissionFn validates the changes made to a Machine, the old Machine is nil on create.
+type machineUpdateAdmissionFn func(m, oldM *machinev1beta1.Machine) ([]string, field.ErrorList)
+
 type admissionConfig struct {
 	clusterID       string
 	platformStatus  *osconfigv1.PlatformStatus
@@ -327,6 +334,7 @@ type admissionConfig struct {
 type admissionHandler struct {
 	*admissionConfig
 	webhookOperations machineAdmissionFn
+	updateOperations  machineUpdateAdmissionFn
 	decoder           *admission.Decoder
 }
 
@@ -376,10 +384,23 @@ func createMachineValidator(infra *osconfigv1.Infrastructure, client client.Clie
 		admissionHandler: &admissionHandler{
 			admissionConfig:   admissionConfig,
 			webhookOperations: getMachineValidatorOperation(infra.Status.PlatformStatus.Type),
+			updateOperations:  getMachineUpdateValidatorOperation(infra.Status.PlatformStatus.Type),
 		},
 	}
 }
 
+func getMachineUpdateValidatorOperation(platform osconfigv1.PlatformType) machineUpdateAdmissionFn {
+	switch platform {
+	case osconfigv1.VSpherePlatformType:
+		return validateVSphereUpdate
+	default:
+		// just no-op
+		return func(m, oldM *machinev1beta1.Machine) ([]string, field.ErrorList) {
+			return nil, nil
+		}
+	}
+}
+
 func getMachineValidatorOperation(platform osconfigv1.PlatformType) machineAdmissionFn {
 	switch platform {
 	case osconfigv1.AWSPlatformType:
@@ -466,6 +487,11 @@ func (h *machineValidatorHandler) validateMachine(m, oldM *machinev1beta1.Machin
 	if !ok {
 		errs = append(errs, opErrs...)
 	}
+	if h.updateOperations != nil {
+		updateWarnings, updateErrs := h.updateOperations(m, oldM)
+		warnings = append(warnings, updateWarnings...)
+		errs = append(errs, updateErrs...)
+	}
 
 	if len(errs) > 0 {
 		return false, warnings, errs
@@ -1431,7 +1457,18 @@ func validateVSphere(m *machinev1beta1.Machine, config *admissionConfig) (bool,
 		warnings = append(warnings, fmt.Sprintf("incorrect GroupVersionKind for VSphereMachineProviderSpec object: %s", providerSpec.GroupVersionKind()))
 	}
 
-	if providerSpec.Template == "" {
+	// The template is not used by Machines deployed from a content library item
+	if value, ok := m.GetAnnotations()[vsphereutil.ContentLibraryItemAnnotation]; ok {
+		annotationPath := field.NewPath("metadata", "annotations").Key(vsphereutil.ContentLibraryItemAnnotation)
+		if _, err := vsphereutil.ParseContentLibraryItem(value); err != nil {
+			errs = append(errs, field.Invalid(annotationPath, value, err.Error()))
+		}
+		if providerSpec.CloneMode == machinev1beta1.LinkedClone {
+			errs = append(errs, field.Invalid(field.NewPath("providerSpec", "cloneMode"), providerSpec.CloneMode,
+				fmt.Sprintf("%s clone mode is not supported when deploying from a content library item", machinev1beta1.LinkedClone)))
+		}
+	} else if _, ok := m.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; !ok && providerSpec.Template == "" {
+		// The template is not used by Machines adopting an existing virtual machine
 		errs = append(errs, field.Required(field.NewPath("providerSpec", "template"), "template must be provided"))
 	}
 
@@ -1441,6 +1478,93 @@ func validateVSphere(m *machinev1beta1.Machine, config *admissionConfig) (bool,
 
 	errs = append(errs, validateVSphereNetwork(providerSpec.Network, field.NewPath("providerSpec", "network"))...)
 
+	if value, ok := m.GetAnnotations()[vsphereutil.DataDisksAnnotation]; ok {
+		if _, err := vsphereutil.ParseDataDisks(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.DataDisksAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.StoragePolicyAnnotation]; ok {
+		var workspaceDatastore string
+		if providerSpec.Workspace != nil {
+			workspaceDatastore = providerSpec.Workspace.Datastore
+		}
+		if err := vsphereutil.ValidateStoragePolicy(value, workspaceDatastore); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.StoragePolicyAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.DRSAnnotation]; ok {
+		if _, err := vsphereutil.ParseDRSOptions(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.DRSAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; ok {
+		annotationPath := field.NewPath("metadata", "annotations").Key(vsphereutil.AdoptVMAnnotation)
+		if _, err := vsphereutil.ParseAdoptedVM(value); err != nil {
+			errs = append(errs, field.Invalid(annotationPath, value, err.Error()))
+		}
+		for _, device := range providerSpec.Network.Devices {
+			if len(device.AddressesFromPools) > 0 {
+				errs = append(errs, field.Invalid(annotationPath, value, "an existing virtual machine can not be adopted by a Machine with IP address pools"))
+				break
+			}
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.AdoptVMDryRunAnnotation]; ok {
+		if _, err := vsphereutil.ParseAdoptVMDryRun(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.AdoptVMDryRunAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.FirmwareAnnotation]; ok {
+		if _, err := vsphereutil.ParseFirmwareOptions(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.FirmwareAnnotation), value, err.Error()))
+		} else if _, adopted := m.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; adopted {
+			warnings = append(warnings, fmt.Sprintf("%s is not applied to an adopted virtual machine, it is only reported", vsphereutil.FirmwareAnnotation))
+		}
+	}
+	var extraConfig vsphereutil.ExtraConfig
+	if value, ok := m.GetAnnotations()[vsphereutil.ExtraConfigAnnotation]; ok {
+		var err error
+		if extraConfig, err = vsphereutil.ParseExtraConfig(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.ExtraConfigAnnotation), value, err.Error()))
+		}
+	}
+	var resourceAllocation *vsphereutil.ResourceAllocation
+	if value, ok := m.GetAnnotations()[vsphereutil.ResourceAllocationAnnotation]; ok {
+		annotationPath := field.NewPath("metadata", "annotations").Key(vsphereutil.ResourceAllocationAnnotation)
+		var err error
+		if resourceAllocation, err = vsphereutil.ParseResourceAllocation(value); err != nil {
+			errs = append(errs, field.Invalid(annotationPath, value, err.Error()))
+		} else if resourceAllocation.Memory != nil && resourceAllocation.Memory.ReservationMiB != nil &&
+			providerSpec.MemoryMiB != 0 && *resourceAllocation.Memory.ReservationMiB > providerSpec.MemoryMiB {
+			// The memory of a vm cloned with no memoryMiB is the memory of its template, which is unknown here
+			errs = append(errs, field.Invalid(annotationPath, value,
+				fmt.Sprintf("memory: reservationMiB must not be greater than providerSpec.memoryMiB (%d)", providerSpec.MemoryMiB)))
+		}
+	}
+	// A high latency sensitivity requires the memory of the vm to be fully reserved
+	if extraConfig["sched.cpu.latencySensitivity"] == "high" && (resourceAllocation == nil || resourceAllocation.Memory == nil ||
+		ptr.Deref(resourceAllocation.Memory.ReservationMiB, 0) < providerSpec.MemoryMiB) {
+		warnings = append(warnings, fmt.Sprintf("sched.cpu.latencySensitivity is high: the memory of the virtual machine should be fully reserved with %s", vsphereutil.ResourceAllocationAnnotation))
+	}
+	if _, adopted := m.GetAnnotations()[vsphereutil.AdoptVMAnnotation]; adopted && (extraConfig != nil || resourceAllocation != nil) {
+		warnings = append(warnings, fmt.Sprintf("%s and %s are not applied to an adopted virtual machine", vsphereutil.ExtraConfigAnnotation, vsphereutil.ResourceAllocationAnnotation))
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.MinimumHWVersionAnnotation]; ok {
+		if _, err := vsphereutil.ParseMinimumHWVersion(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.MinimumHWVersionAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.HWUpgradePowerCycleAnnotation]; ok {
+		if _, err := vsphereutil.ParseHWUpgradePowerCycle(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.HWUpgradePowerCycleAnnotation), value, err.Error()))
+		}
+	}
+	if value, ok := m.GetAnnotations()[vsphereutil.ResizePowerCycleAnnotation]; ok {
+		if _, err := vsphereutil.ParseResizePowerCycle(value); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(vsphereutil.ResizePowerCycleAnnotation), value, err.Error()))
+		}
+	}
+
 	if providerSpec.NumCPUs < minVSphereCPU {
 		warnings = append(warnings, fmt.Sprintf("providerSpec.numCPUs: %d is missing or less than the minimum value (%d): nodes may not boot correctly", providerSpec.NumCPUs, minVSphereCPU))
 	}
@@ -1488,6 +1612,48 @@ func validateVSphere(m *machinev1beta1.Machine, config *admissionConfig) (bool,
 	return true, warnings, nil
 }
 
+// validateVSphereUpdate validates the changes made to a vSphere Machine.
+func validateVSphereUpdate(m, oldM *machinev1beta1.Machine) ([]string, field.ErrorList) {
+	var errs field.ErrorList
+
+	if oldM != nil {
+		// The vm adopted by a Machine can not change once the Machine is created
+		value, ok := m.GetAnnotations()[vsphereutil.AdoptVMAnnotation]
+		oldValue, oldOk := oldM.GetAnnotations()[vsphereutil.AdoptVMAnnotation]
+		if ok != oldOk || value != oldValue {
+			errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(vsphereutil.AdoptVMAnnotation),
+				"can only be set when the Machine is created and is immutable"))
+		}
+	}
+
+	providerSpec := new(machinev1beta1.VSphereMachineProviderSpec)
+	if err := unmarshalInto(m, providerSpec); err != nil {
+		// Reported by validateVSphere
+		return nil, errs
+	}
+	warnings, networkErrs := validateVSphereNetworkAddresses(m.GetAnnotations(), providerSpec.Network, field.NewPath("providerSpec", "network"))
+	if len(networkErrs) > 0 && oldM != nil && !vsphereNetworkChanged(m, oldM, providerSpec.Network) {
+		// A Machine admitted before the network addresses were validated is only rejected once its network changes
+		for _, err := range networkErrs {
+			warnings = append(warnings, err.Error())
+		}
+		networkErrs = nil
+	}
+
+	return warnings, append(errs, networkErrs...)
+}
+
+// vsphereNetworkChanged returns true when the network devices or the network devices annotation of the Machine changed.
+func vsphereNetworkChanged(m, oldM *machinev1beta1.Machine, network machinev1beta1.NetworkSpec) bool {
+	oldProviderSpec := new(machinev1beta1.VSphereMachineProviderSpec)
+	if err := unmarshalInto(oldM, oldProviderSpec); err != nil {
+		return true
+	}
+	value, ok := m.GetAnnotations()[vsphereutil.NetworkDevicesAnnotation]
+	oldValue, oldOk := oldM.GetAnnotations()[vsphereutil.NetworkDevicesAnnotation]
+	return ok != oldOk || value != oldValue || !reflect.DeepEqual(network, oldProviderSpec.Network)
+}
+
 func validateVSphereWorkspace(workspace *machinev1beta1.Workspace, parentPath *field.Path) ([]string, field.ErrorList) {
 	if workspace == nil {
 		return []string{}, field.ErrorList{field.Required(parentPath, "workspace must be provided")}
@@ -1528,6 +1694,108 @@ func validateVSphereNetwork(network machinev1beta1.NetworkSpec, parentPath *fiel
 	return errs
 }
 
+// validateVSphereNetworkAddresses validates the addresses, gateways and routes of the network devices,
+// and the network devices annotation.
+func validateVSphereNetworkAddresses(annotations map[string]string, network machinev1beta1.NetworkSpec, parentPath *field.Path) ([]string, field.ErrorList) {
+	annotationPath := field.NewPath("metadata", "annotations").Key(vsphereutil.NetworkDevicesAnnotation)
+	value, singleDefaultGateway := annotations[vsphereutil.NetworkDevicesAnnotation]
+	var deviceOptions []vsphereutil.NetworkDeviceOptions
+	if singleDefaultGateway {
+		var err error
+		if deviceOptions, err = vsphereutil.ParseNetworkDevices(value); err != nil {
+			return nil, field.ErrorList{field.Invalid(annotationPath, value, err.Error())}
+		}
+	}
+	if len(network.Devices) == 0 {
+		return nil, nil
+	}
+
+	var errs field.ErrorList
+	var warnings []string
+	if len(deviceOptions) > len(network.Devices) {
+		errs = append(errs, field.Invalid(annotationPath, len(deviceOptions),
+			fmt.Sprintf("has options for %d network devices, but %d are provided", len(deviceOptions), len(network.Devices))))
+	}
+
+	// the first device with a gateway of each IP family
+	gatewayDevices := map[string]int{}
+	for i, spec := range network.Devices {
+		fldPath := parentPath.Child("devices").Index(i)
+
+		var options vsphereutil.NetworkDeviceOptions
+		if i < len(deviceOptions) {
+			options = deviceOptions[i]
+		}
+		optionsPath := fmt.Sprintf("devices[%d]", i)
+
+		// The families of the addresses of a device with IP address pools are only known once its claims are fulfilled
+		families := map[string]bool{}
+		knownFamilies := len(spec.AddressesFromPools) == 0
+		for j, address := range spec.IPAddrs {
+			prefix, err := netip.ParsePrefix(address)
+			if err != nil {
+				errs = append(errs, field.Invalid(fldPath.Child("ipAddrs").Index(j), address, "must be an IP address in CIDR notation, e.g. 192.168.1.100/24"))
+				knownFamilies = false
+				continue
+			}
+			families[vsphereutil.AddressFamily(prefix.Addr())] = true
+		}
+		if len(spec.IPAddrs) == 0 && len(spec.AddressesFromPools) == 0 && (len(options.Gateways) > 0 || len(options.Routes) > 0) {
+			errs = append(errs, field.Invalid(annotationPath, optionsPath,
+				fmt.Sprintf("gateways and routes require ipAddrs or addressesFromPools on %s", fldPath)))
+			continue
+		}
+
+		gatewayFamilies := map[string]bool{}
+		if spec.Gateway != "" {
+			gateway, err := netip.ParseAddr(spec.Gateway)
+			if err != nil {
+				errs = append(errs, field.Invalid(fldPath.Child("gateway"), spec.Gateway, "must be an IP address"))
+			} else {
+				family := vsphereutil.AddressFamily(gateway)
+				gatewayFamilies[family] = true
+				if knownFamilies && !families[family] {
+					errs = append(errs, field.Invalid(fldPath.Child("gateway"), spec.Gateway,
+						fmt.Sprintf("is an %s address, but ipAddrs has no %s address", family, family)))
+				}
+			}
+		}
+		for _, gateway := range options.Gateways {
+			family := vsphereutil.AddressFamily(netip.MustParseAddr(gateway))
+			if gatewayFamilies[family] {
+				errs = append(errs, field.Invalid(annotationPath, optionsPath,
+					fmt.Sprintf("the %s gateway %s is already set by %s", family, gateway, fldPath.Child("gateway"))))
+			} else if knownFamilies && !families[family] {
+				errs = append(errs, field.Invalid(annotationPath, optionsPath,
+					fmt.Sprintf("the %s gateway %s requires an %s address in %s", family, gateway, family, fldPath.Child("ipAddrs"))))
+			}
+			gatewayFamilies[family] = true
+		}
+		for _, route := range options.Routes {
+			family := vsphereutil.AddressFamily(netip.MustParseAddr(route.Via))
+			if knownFamilies && !families[family] {
+				errs = append(errs, field.Invalid(annotationPath, optionsPath,
+					fmt.Sprintf("the route to %s requires an %s address in %s", route.To, family, fldPath.Child("ipAddrs"))))
+			}
+		}
+
+		for _, family := range []string{vsphereutil.IPv4Family, vsphereutil.IPv6Family} {
+			// Without the annotation, the gateway of every device is a default gateway
+			if !singleDefaultGateway || !gatewayFamilies[family] {
+				continue
+			}
+			if first, ok := gatewayDevices[family]; ok {
+				warnings = append(warnings, fmt.Sprintf("%s: only the %s gateway of %s is a default gateway, the %s gateway of this device is only used by its routes",
+					fldPath, family, parentPath.Child("devices").Index(first), family))
+			} else {
+				gatewayDevices[family] = i
+			}
+		}
+	}
+
+	return warnings, errs
+}
+
 func defaultNutanix(m *machinev1beta1.Machine, config *admissionConfig) (bool, []string, field.ErrorList) {
 	klog.V(3).Infof("Defaulting nutanix providerSpec")
 
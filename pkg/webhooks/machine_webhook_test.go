@@ -12,6 +12,7 @@ import (
 	osconfigv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	vsphereutil "github.com/openshift/machine-api-operator/pkg/util/vsphere"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -3924,6 +3925,7 @@ func TestValidateVSphereProviderSpec(t *testing.T) {
 	testCases := []struct {
 		testCase         string
 		modifySpec       func(*machinev1beta1.VSphereMachineProviderSpec)
+		annotations      map[string]string
 		expectedError    string
 		expectedOk       bool
 		expectedWarnings []string
@@ -4124,6 +4126,312 @@ func TestValidateVSphereProviderSpec(t *testing.T) {
 			},
 			expectedOk: true,
 		},
+		{
+			testCase: "with data disks",
+			annotations: map[string]string{
+				vsphereutil.DataDisksAnnotation: `[{"name": "images", "sizeGiB": 100, "controller": {"type": "NVMe"}}]`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid data disks",
+			annotations: map[string]string{
+				vsphereutil.DataDisksAnnotation: `[{"name": "images", "sizeGiB": 100, "datastore": "ds", "storagePolicy": "gold"}]`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-data-disks]: Invalid value: \"[{\\\"name\\\": \\\"images\\\", \\\"sizeGiB\\\": 100, \\\"datastore\\\": \\\"ds\\\", \\\"storagePolicy\\\": \\\"gold\\\"}]\": disk \"images\": datastore and storagePolicy are mutually exclusive",
+		},
+		{
+			testCase: "with storage policy",
+			annotations: map[string]string{
+				vsphereutil.StoragePolicyAnnotation: "vSAN Default Storage Policy",
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with empty storage policy",
+			annotations: map[string]string{
+				vsphereutil.StoragePolicyAnnotation: " ",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-storage-policy]: Invalid value: \" \": storage policy name must not be empty",
+		},
+		{
+			testCase: "with storage policy and datastore",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Workspace.Datastore = "datastore"
+			},
+			annotations: map[string]string{
+				vsphereutil.StoragePolicyAnnotation: "gold",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-storage-policy]: Invalid value: \"gold\": a storage policy can not be combined with providerSpec.workspace.datastore, the datastore is chosen among the ones compatible with the policy",
+		},
+		{
+			testCase: "with content library item",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Template = ""
+			},
+			annotations: map[string]string{
+				vsphereutil.ContentLibraryItemAnnotation: `{"library": "rhcos", "item": "rhcos-4.16"}`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid content library item",
+			annotations: map[string]string{
+				vsphereutil.ContentLibraryItemAnnotation: `{"library": "rhcos"}`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-content-library-item]: Invalid value: \"{\\\"library\\\": \\\"rhcos\\\"}\": item is required",
+		},
+		{
+			testCase: "with content library item and linked clone",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.CloneMode = machinev1beta1.LinkedClone
+			},
+			annotations: map[string]string{
+				vsphereutil.ContentLibraryItemAnnotation: `{"library": "rhcos", "item": "rhcos-4.16"}`,
+			},
+			expectedOk:       false,
+			expectedError:    "providerSpec.cloneMode: Invalid value: \"linkedClone\": linkedClone clone mode is not supported when deploying from a content library item",
+			expectedWarnings: []string{"linkedClone clone mode is set. DiskGiB parameter will be ignored, disk size from template will be used."},
+		},
+		{
+			testCase: "with DRS options",
+			annotations: map[string]string{
+				vsphereutil.DRSAnnotation: `{"antiAffinity": true, "hostGroup": "rack-a"}`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid DRS options",
+			annotations: map[string]string{
+				vsphereutil.DRSAnnotation: `{"antiAffinity": "yes"}`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-drs]: Invalid value: \"{\\\"antiAffinity\\\": \\\"yes\\\"}\": must be a JSON object of DRS options: json: cannot unmarshal string into Go struct field DRSOptions.antiAffinity of type bool",
+		},
+		{
+			testCase: "with resize power cycle",
+			annotations: map[string]string{
+				vsphereutil.ResizePowerCycleAnnotation: "true",
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid resize power cycle",
+			annotations: map[string]string{
+				vsphereutil.ResizePowerCycleAnnotation: "always",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-resize-power-cycle]: Invalid value: \"always\": must be a boolean: strconv.ParseBool: parsing \"always\": invalid syntax",
+		},
+		{
+			testCase: "with vm to adopt",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Template = ""
+			},
+			annotations: map[string]string{
+				vsphereutil.AdoptVMAnnotation:       "/datacenter/vm/worker-0",
+				vsphereutil.AdoptVMDryRunAnnotation: "true",
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid vm to adopt",
+			annotations: map[string]string{
+				vsphereutil.AdoptVMAnnotation: "worker-0",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-adopt-vm]: Invalid value: \"worker-0\": must be the UUID or the absolute inventory path of a vm: invalid UUID length: 8",
+		},
+		{
+			testCase: "with vm to adopt and IP address pools",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices[0].AddressesFromPools = []machinev1beta1.AddressesFromPool{{Group: "ipamcontroller.example.io", Resource: "IPPool", Name: "pool"}}
+			},
+			annotations: map[string]string{
+				vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-adopt-vm]: Invalid value: \"/datacenter/vm/worker-0\": an existing virtual machine can not be adopted by a Machine with IP address pools",
+		},
+		{
+			testCase: "with invalid adoption dry run",
+			annotations: map[string]string{
+				vsphereutil.AdoptVMAnnotation:       "/datacenter/vm/worker-0",
+				vsphereutil.AdoptVMDryRunAnnotation: "maybe",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-adopt-vm-dry-run]: Invalid value: \"maybe\": must be a boolean: strconv.ParseBool: parsing \"maybe\": invalid syntax",
+		},
+		{
+			testCase: "with firmware options",
+			annotations: map[string]string{
+				vsphereutil.FirmwareAnnotation: `{"firmware": "efi", "secureBoot": true, "vTPM": true}`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with Secure Boot and BIOS firmware",
+			annotations: map[string]string{
+				vsphereutil.FirmwareAnnotation: `{"firmware": "bios", "secureBoot": true}`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-firmware]: Invalid value: \"{\\\"firmware\\\": \\\"bios\\\", \\\"secureBoot\\\": true}\": secureBoot requires the \"efi\" firmware",
+		},
+		{
+			testCase: "with firmware options and vm to adopt",
+			annotations: map[string]string{
+				vsphereutil.FirmwareAnnotation: `{"firmware": "efi"}`,
+				vsphereutil.AdoptVMAnnotation:  "/datacenter/vm/worker-0",
+			},
+			expectedOk:       true,
+			expectedWarnings: []string{"machine.openshift.io/vsphere-firmware is not applied to an adopted virtual machine, it is only reported"},
+		},
+		{
+			testCase: "with extra config and resource allocation",
+			annotations: map[string]string{
+				vsphereutil.ExtraConfigAnnotation:        `{"disk.EnableUUID": "TRUE", "sched.cpu.latencySensitivity": "high"}`,
+				vsphereutil.ResourceAllocationAnnotation: `{"cpu": {"reservationMHz": 4000}, "memory": {"reservationMiB": 2048}}`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with reserved extra config",
+			annotations: map[string]string{
+				vsphereutil.ExtraConfigAnnotation: `{"guestinfo.ignition.config.data": "e30="}`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-extra-config]: Invalid value: \"{\\\"guestinfo.ignition.config.data\\\": \\\"e30=\\\"}\": guestinfo.ignition.config.data is reserved by the machine controller",
+		},
+		{
+			testCase: "with memory reservation and the memory of the template",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.MemoryMiB = 0
+			},
+			annotations: map[string]string{
+				vsphereutil.ResourceAllocationAnnotation: `{"memory": {"reservationMiB": 4096}}`,
+			},
+			expectedOk:       true,
+			expectedWarnings: []string{"providerSpec.memoryMiB: 0 is missing or less than the recommended minimum value (2048): nodes may not boot correctly"},
+		},
+		{
+			testCase: "with memory reservation greater than the memory",
+			annotations: map[string]string{
+				vsphereutil.ResourceAllocationAnnotation: `{"memory": {"reservationMiB": 4096}}`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-resource-allocation]: Invalid value: \"{\\\"memory\\\": {\\\"reservationMiB\\\": 4096}}\": memory: reservationMiB must not be greater than providerSpec.memoryMiB (2048)",
+		},
+		{
+			testCase: "with high latency sensitivity without memory reservation",
+			annotations: map[string]string{
+				vsphereutil.ExtraConfigAnnotation: `{"sched.cpu.latencySensitivity": "high"}`,
+			},
+			expectedOk:       true,
+			expectedWarnings: []string{"sched.cpu.latencySensitivity is high: the memory of the virtual machine should be fully reserved with machine.openshift.io/vsphere-resource-allocation"},
+		},
+		{
+			testCase: "with minimum hardware version",
+			annotations: map[string]string{
+				vsphereutil.MinimumHWVersionAnnotation:    "vmx-19",
+				vsphereutil.HWUpgradePowerCycleAnnotation: "true",
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with invalid minimum hardware version",
+			annotations: map[string]string{
+				vsphereutil.MinimumHWVersionAnnotation: "latest",
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-minimum-hw-version]: Invalid value: \"latest\": must be a hardware version, e.g. vmx-19",
+		},
+		{
+			testCase: "with dual stack static IPs and routes of a secondary device",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices = []machinev1beta1.NetworkDeviceSpec{
+					{NetworkName: "primary", Gateway: "192.168.1.1", IPAddrs: []string{"192.168.1.2/24", "2001:db8::2/64"}},
+					{NetworkName: "secondary", AddressesFromPools: []machinev1beta1.AddressesFromPool{{Group: "ipamcontroller.example.io", Resource: "IPPool", Name: "pool"}}},
+				}
+			},
+			annotations: map[string]string{
+				vsphereutil.NetworkDevicesAnnotation: `[{"gateways": ["2001:db8::1"]}, {"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}]}]`,
+			},
+			expectedOk: true,
+		},
+		{
+			testCase: "with gateway of a family without address",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices[0].Gateway = "2001:db8::1"
+				p.Network.Devices[0].IPAddrs = []string{"192.168.1.2/24"}
+			},
+			expectedOk:    false,
+			expectedError: "providerSpec.network.devices[0].gateway: Invalid value: \"2001:db8::1\": is an IPv6 address, but ipAddrs has no IPv6 address",
+		},
+		{
+			testCase: "with invalid static IP",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices[0].IPAddrs = []string{"192.168.1.2"}
+			},
+			expectedOk:    false,
+			expectedError: "providerSpec.network.devices[0].ipAddrs[0]: Invalid value: \"192.168.1.2\": must be an IP address in CIDR notation, e.g. 192.168.1.100/24",
+		},
+		{
+			testCase: "with gateway annotation of the family of the device gateway",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices[0].Gateway = "192.168.1.1"
+				p.Network.Devices[0].IPAddrs = []string{"192.168.1.2/24"}
+			},
+			annotations: map[string]string{
+				vsphereutil.NetworkDevicesAnnotation: `[{"gateways": ["192.168.1.254"]}]`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-network-devices]: Invalid value: \"devices[0]\": the IPv4 gateway 192.168.1.254 is already set by providerSpec.network.devices[0].gateway",
+		},
+		{
+			testCase: "with routes of a DHCP device",
+			annotations: map[string]string{
+				vsphereutil.NetworkDevicesAnnotation: `[{"routes": [{"to": "10.20.0.0/16", "via": "192.168.20.1"}]}]`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-network-devices]: Invalid value: \"devices[0]\": gateways and routes require ipAddrs or addressesFromPools on providerSpec.network.devices[0]",
+		},
+		{
+			testCase: "with network device options of a missing device",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices[0].IPAddrs = []string{"192.168.1.2/24"}
+			},
+			annotations: map[string]string{
+				vsphereutil.NetworkDevicesAnnotation: `[{}, {"gateways": ["192.168.20.1"]}]`,
+			},
+			expectedOk:    false,
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-network-devices]: Invalid value: 2: has options for 2 network devices, but 1 are provided",
+		},
+		{
+			testCase: "with gateways of a family on several devices",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices = []machinev1beta1.NetworkDeviceSpec{
+					{NetworkName: "primary", Gateway: "192.168.1.1", IPAddrs: []string{"192.168.1.2/24"}},
+					{NetworkName: "secondary", Gateway: "192.168.20.1", IPAddrs: []string{"192.168.20.2/24"}},
+				}
+			},
+			annotations:      map[string]string{vsphereutil.NetworkDevicesAnnotation: `[]`},
+			expectedOk:       true,
+			expectedWarnings: []string{"providerSpec.network.devices[1]: only the IPv4 gateway of providerSpec.network.devices[0] is a default gateway, the IPv4 gateway of this device is only used by its routes"},
+		},
+		{
+			testCase: "with gateways of a family on several devices without the network devices annotation",
+			modifySpec: func(p *machinev1beta1.VSphereMachineProviderSpec) {
+				p.Network.Devices = []machinev1beta1.NetworkDeviceSpec{
+					{NetworkName: "primary", Gateway: "192.168.1.1", IPAddrs: []string{"192.168.1.2/24"}},
+					{NetworkName: "secondary", Gateway: "192.168.20.1", IPAddrs: []string{"192.168.20.2/24"}},
+				}
+			},
+			expectedOk: true,
+		},
 	}
 
 	secret := &corev1.Secret{
@@ -4173,7 +4481,8 @@ func TestValidateVSphereProviderSpec(t *testing.T) {
 
 			m := &machinev1beta1.Machine{
 				ObjectMeta: metav1.ObjectMeta{
-					Namespace: namespace.Name,
+					Namespace:   namespace.Name,
+					Annotations: tc.annotations,
 				},
 			}
 			rawBytes, err := json.Marshal(providerSpec)
@@ -4182,7 +4491,7 @@ func TestValidateVSphereProviderSpec(t *testing.T) {
 			}
 			m.Spec.ProviderSpec.Value = &kruntime.RawExtension{Raw: rawBytes}
 
-			ok, warnings, webhookErr := h.webhookOperations(m, h.admissionConfig)
+			ok, warnings, webhookErr := h.validateMachine(m, nil)
 			if ok != tc.expectedOk {
 				t.Errorf("expected: %v, got: %v", tc.expectedOk, ok)
 			}
@@ -4204,6 +4513,112 @@ func TestValidateVSphereProviderSpec(t *testing.T) {
 	}
 }
 
+func TestValidateVSphereUpdate(t *testing.T) {
+	invalidGateway := []machinev1beta1.NetworkDeviceSpec{{NetworkName: "networkName", Gateway: "2001:db8::1", IPAddrs: []string{"192.168.1.2/24"}}}
+	invalidGatewayError := "providerSpec.network.devices[0].gateway: Invalid value: \"2001:db8::1\": is an IPv6 address, but ipAddrs has no IPv6 address"
+
+	testCases := []struct {
+		testCase         string
+		oldAnnotations   map[string]string
+		annotations      map[string]string
+		oldDevices       []machinev1beta1.NetworkDeviceSpec
+		devices          []machinev1beta1.NetworkDeviceSpec
+		create           bool
+		expectedError    string
+		expectedWarnings []string
+	}{
+		{
+			testCase:    "adopt vm annotation set on create",
+			create:      true,
+			annotations: map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+		},
+		{
+			testCase:       "adopt vm annotation unchanged",
+			oldAnnotations: map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+			annotations:    map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+		},
+		{
+			testCase:      "adopt vm annotation added",
+			annotations:   map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+			expectedError: "metadata.annotations[machine.openshift.io/vsphere-adopt-vm]: Forbidden: can only be set when the Machine is created and is immutable",
+		},
+		{
+			testCase:       "adopt vm annotation changed",
+			oldAnnotations: map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+			annotations:    map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-1"},
+			expectedError:  "metadata.annotations[machine.openshift.io/vsphere-adopt-vm]: Forbidden: can only be set when the Machine is created and is immutable",
+		},
+		{
+			testCase:       "adopt vm annotation removed",
+			oldAnnotations: map[string]string{vsphereutil.AdoptVMAnnotation: "/datacenter/vm/worker-0"},
+			expectedError:  "metadata.annotations[machine.openshift.io/vsphere-adopt-vm]: Forbidden: can only be set when the Machine is created and is immutable",
+		},
+		{
+			testCase:      "invalid network on create",
+			create:        true,
+			devices:       invalidGateway,
+			expectedError: invalidGatewayError,
+		},
+		{
+			testCase:         "invalid network unchanged",
+			oldDevices:       invalidGateway,
+			devices:          invalidGateway,
+			expectedWarnings: []string{invalidGatewayError},
+		},
+		{
+			testCase: "invalid network changed",
+			oldDevices: []machinev1beta1.NetworkDeviceSpec{
+				{NetworkName: "networkName", Gateway: "2001:db8::1", IPAddrs: []string{"192.168.1.3/24"}},
+			},
+			devices:       invalidGateway,
+			expectedError: invalidGatewayError,
+		},
+		{
+			testCase:      "invalid network with a changed network devices annotation",
+			oldDevices:    invalidGateway,
+			devices:       invalidGateway,
+			annotations:   map[string]string{vsphereutil.NetworkDevicesAnnotation: `[{}]`},
+			expectedError: invalidGatewayError,
+		},
+	}
+
+	newMachine := func(annotations map[string]string, devices []machinev1beta1.NetworkDeviceSpec) *machinev1beta1.Machine {
+		if devices == nil {
+			devices = []machinev1beta1.NetworkDeviceSpec{{NetworkName: "networkName"}}
+		}
+		rawBytes, err := json.Marshal(&machinev1beta1.VSphereMachineProviderSpec{Network: machinev1beta1.NetworkSpec{Devices: devices}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &machinev1beta1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: machinev1beta1.MachineSpec{
+				ProviderSpec: machinev1beta1.ProviderSpec{Value: &kruntime.RawExtension{Raw: rawBytes}},
+			},
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testCase, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := newMachine(tc.annotations, tc.devices)
+			var oldM *machinev1beta1.Machine
+			if !tc.create {
+				oldM = newMachine(tc.oldAnnotations, tc.oldDevices)
+			}
+
+			warnings, errs := validateVSphereUpdate(m, oldM)
+			if tc.expectedError != "" {
+				g.Expect(errs.ToAggregate()).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+			g.Expect(warnings).To(Equal(tc.expectedWarnings))
+		})
+	}
+}
+
 func TestDefaultVSphereProviderSpec(t *testing.T) {
 
 	clusterID := "clusterID"
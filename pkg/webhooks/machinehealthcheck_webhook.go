@@ -0,0 +1,406 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/kube-storage-version-migrator/pkg/clients/clientset/scheme"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+	"github.com/openshift/machine-api-operator/pkg/util/external"
+	"github.com/openshift/machine-api-operator/pkg/util/maintenance"
+)
+
+const (
+	// defaultMachineHealthCheckMaxUnhealthy matches the value assumed by the MachineHealthCheck controller
+	// when maxUnhealthy is not set
+	defaultMachineHealthCheckMaxUnhealthy = "100%"
+	// defaultMachineHealthCheckNodeStartupTimeout matches the value assumed by the MachineHealthCheck controller
+	// when nodeStartupTimeout is not set
+	defaultMachineHealthCheckNodeStartupTimeout = 10 * time.Minute
+
+	machineRoleLabel        = "machine.openshift.io/cluster-api-machine-role"
+	machineControlPlaneRole = "master"
+
+	remediationStrategyExternalBaremetal = "external-baremetal"
+)
+
+// machineHealthCheckValidatorHandler validates MachineHealthCheck API resources.
+// implements type Handler interface.
+// https://godoc.org/github.com/kubernetes-sigs/controller-runtime/pkg/webhook/admission#Handler
+type machineHealthCheckValidatorHandler struct {
+	client client.Client
+}
+
+// machineHealthCheckDefaulterHandler defaults MachineHealthCheck API resources.
+// implements type Handler interface.
+// https://godoc.org/github.com/kubernetes-sigs/controller-runtime/pkg/webhook/admission#Handler
+type machineHealthCheckDefaulterHandler struct{}
+
+// NewMachineHealthCheckValidator returns a new machineHealthCheckValidatorHandler.
+func NewMachineHealthCheckValidator(client client.Client) *admission.Webhook {
+	return admission.WithCustomValidator(scheme.Scheme, &machinev1beta1.MachineHealthCheck{}, &machineHealthCheckValidatorHandler{client: client})
+}
+
+// NewMachineHealthCheckDefaulter returns a new machineHealthCheckDefaulterHandler.
+func NewMachineHealthCheckDefaulter() *admission.Webhook {
+	return admission.WithCustomDefaulter(scheme.Scheme, &machinev1beta1.MachineHealthCheck{}, &machineHealthCheckDefaulterHandler{})
+}
+
+// ValidateCreate handles create requests for admission webhook servers.
+func (h *machineHealthCheckValidatorHandler) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	mhc, ok := obj.(*machinev1beta1.MachineHealthCheck)
+	if !ok {
+		return admission.Warnings{}, apierrors.NewBadRequest(fmt.Sprintf("expected a MachineHealthCheck but got a %T", obj))
+	}
+
+	klog.V(3).Infof("Validate webhook called for MachineHealthCheck: %s", mhc.GetName())
+
+	warnings, errs := h.validateMachineHealthCheck(ctx, mhc, nil)
+	if len(errs) > 0 {
+		return warnings, errs.ToAggregate()
+	}
+	return warnings, nil
+}
+
+// ValidateUpdate handles update requests for admission webhook servers.
+func (h *machineHealthCheckValidatorHandler) ValidateUpdate(ctx context.Context, oldObj, obj runtime.Object) (admission.Warnings, error) {
+	mhc, ok := obj.(*machinev1beta1.MachineHealthCheck)
+	if !ok {
+		return admission.Warnings{}, apierrors.NewBadRequest(fmt.Sprintf("expected a MachineHealthCheck but got a %T", obj))
+	}
+
+	oldMHC, ok := oldObj.(*machinev1beta1.MachineHealthCheck)
+	if !ok {
+		return admission.Warnings{}, apierrors.NewBadRequest(fmt.Sprintf("expected a MachineHealthCheck but got a %T", oldObj))
+	}
+
+	klog.V(3).Infof("Validate webhook called for MachineHealthCheck: %s", mhc.GetName())
+
+	// Allow the object to be cleaned up, even if it would not pass the validation anymore
+	if isDeleting(mhc) {
+		return admission.Warnings{}, nil
+	}
+
+	warnings, errs := h.validateMachineHealthCheck(ctx, mhc, oldMHC)
+	if len(errs) > 0 {
+		return warnings, errs.ToAggregate()
+	}
+	return warnings, nil
+}
+
+// ValidateDelete handles delete requests for admission webhook servers.
+func (h *machineHealthCheckValidatorHandler) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return admission.Warnings{}, nil
+}
+
+// Default handles defaulting requests for admission webhook servers.
+func (h *machineHealthCheckDefaulterHandler) Default(ctx context.Context, obj runtime.Object) error {
+	mhc, ok := obj.(*machinev1beta1.MachineHealthCheck)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a MachineHealthCheck but got a %T", obj))
+	}
+
+	klog.V(3).Infof("Mutate webhook called for MachineHealthCheck: %s", mhc.GetName())
+
+	defaultMachineHealthCheck(mhc)
+	return nil
+}
+
+func defaultMachineHealthCheck(mhc *machinev1beta1.MachineHealthCheck) {
+	if mhc.Spec.MaxUnhealthy == nil {
+		maxUnhealthy := intstr.FromString(defaultMachineHealthCheckMaxUnhealthy)
+		mhc.Spec.MaxUnhealthy = &maxUnhealthy
+	}
+
+	if mhc.Spec.NodeStartupTimeout == nil {
+		mhc.Spec.NodeStartupTimeout = &metav1.Duration{Duration: defaultMachineHealthCheckNodeStartupTimeout}
+	}
+
+	if mhc.Spec.RemediationTemplate != nil && mhc.Spec.RemediationTemplate.Namespace == "" {
+		mhc.Spec.RemediationTemplate.Namespace = mhc.GetNamespace()
+	}
+}
+
+func (h *machineHealthCheckValidatorHandler) validateMachineHealthCheck(ctx context.Context, mhc, oldMHC *machinev1beta1.MachineHealthCheck) (admission.Warnings, field.ErrorList) {
+	var errs field.ErrorList
+	warnings := admission.Warnings{}
+	specPath := field.NewPath("spec")
+
+	selector, selectorErrs := validateMachineHealthCheckSelector(mhc, oldMHC, specPath.Child("selector"))
+	errs = append(errs, selectorErrs...)
+
+	// The fields are only validated on creation and once changed, MachineHealthChecks admitted before they were
+	// validated must still accept updates of their other fields, e.g. their labels
+	var maxUnhealthyErrs field.ErrorList
+	if mhc.Spec.MaxUnhealthy != nil {
+		if err := validateMaxUnhealthy(mhc.Spec.MaxUnhealthy, specPath.Child("maxUnhealthy")); err != nil {
+			maxUnhealthyErrs = append(maxUnhealthyErrs, err)
+		}
+	}
+	fieldWarnings, fieldErrs := unchangedFieldWarnings(maxUnhealthyErrs, oldMHC == nil || !reflect.DeepEqual(mhc.Spec.MaxUnhealthy, oldMHC.Spec.MaxUnhealthy))
+	warnings = append(warnings, fieldWarnings...)
+	errs = append(errs, fieldErrs...)
+
+	var nodeStartupTimeoutErrs field.ErrorList
+	if mhc.Spec.NodeStartupTimeout != nil && mhc.Spec.NodeStartupTimeout.Duration < 0 {
+		nodeStartupTimeoutErrs = append(nodeStartupTimeoutErrs, field.Invalid(specPath.Child("nodeStartupTimeout"), mhc.Spec.NodeStartupTimeout.Duration.String(), "nodeStartupTimeout must not be negative"))
+	}
+	fieldWarnings, fieldErrs = unchangedFieldWarnings(nodeStartupTimeoutErrs, oldMHC == nil || !reflect.DeepEqual(mhc.Spec.NodeStartupTimeout, oldMHC.Spec.NodeStartupTimeout))
+	warnings = append(warnings, fieldWarnings...)
+	errs = append(errs, fieldErrs...)
+
+	fieldWarnings, fieldErrs = unchangedFieldWarnings(validateUnhealthyConditions(mhc.Spec.UnhealthyConditions, specPath.Child("unhealthyConditions")),
+		oldMHC == nil || !reflect.DeepEqual(mhc.Spec.UnhealthyConditions, oldMHC.Spec.UnhealthyConditions))
+	warnings = append(warnings, fieldWarnings...)
+	errs = append(errs, fieldErrs...)
+
+	fieldWarnings, fieldErrs = unchangedFieldWarnings(validateRemediationTemplate(mhc, specPath.Child("remediationTemplate")),
+		oldMHC == nil || !reflect.DeepEqual(mhc.Spec.RemediationTemplate, oldMHC.Spec.RemediationTemplate))
+	warnings = append(warnings, fieldWarnings...)
+	errs = append(errs, fieldErrs...)
+
+	annotationWarnings, annotationErrs := validateMachineHealthCheckAnnotations(mhc, oldMHC, field.NewPath("metadata", "annotations"))
+	warnings = append(warnings, annotationWarnings...)
+	errs = append(errs, annotationErrs...)
+
+	if len(errs) == 0 && selector != nil {
+		warnings = append(warnings, h.selectorWarnings(ctx, mhc, selector)...)
+	}
+
+	return warnings, errs
+}
+
+func validateMachineHealthCheckSelector(mhc, oldMHC *machinev1beta1.MachineHealthCheck, parentPath *field.Path) (labels.Selector, field.ErrorList) {
+	var errs field.ErrorList
+
+	selector, err := metav1.LabelSelectorAsSelector(&mhc.Spec.Selector)
+	if err != nil {
+		return nil, append(errs, field.Invalid(parentPath, mhc.Spec.Selector, fmt.Sprintf("could not convert label selector to selector: %v", err)))
+	}
+
+	// Existing MachineHealthChecks with an empty selector are still accepted as long as the selector is not changed,
+	// to not block updates of objects created before this validation was introduced.
+	selectorChanged := oldMHC == nil || !reflect.DeepEqual(mhc.Spec.Selector, oldMHC.Spec.Selector)
+	if selector.Empty() && selectorChanged {
+		errs = append(errs, field.Required(parentPath, "selector must not be empty, an empty selector matches all machines in the namespace"))
+	}
+
+	return selector, errs
+}
+
+// validateMaxUnhealthy checks maxUnhealthy is either a non negative integer or a percentage between 0% and 100%.
+// It follows the parsing rules the MachineHealthCheck controller uses, where strings are not assumed to be percentages.
+func validateMaxUnhealthy(maxUnhealthy *intstr.IntOrString, fldPath *field.Path) *field.Error {
+	switch maxUnhealthy.Type {
+	case intstr.Int:
+		if maxUnhealthy.IntValue() < 0 {
+			return field.Invalid(fldPath, maxUnhealthy.IntValue(), "maxUnhealthy must not be negative")
+		}
+	case intstr.String:
+		value := maxUnhealthy.StrVal
+		isPercent := strings.HasSuffix(value, "%")
+		v, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil {
+			return field.Invalid(fldPath, value, "maxUnhealthy must be an integer or a percentage")
+		}
+		if v < 0 {
+			return field.Invalid(fldPath, value, "maxUnhealthy must not be negative")
+		}
+		if isPercent && v > 100 {
+			return field.Invalid(fldPath, value, "maxUnhealthy must not be greater than 100%")
+		}
+	default:
+		return field.Invalid(fldPath, maxUnhealthy, "maxUnhealthy must be an integer or a percentage")
+	}
+	return nil
+}
+
+func validateUnhealthyConditions(unhealthyConditions []machinev1beta1.UnhealthyCondition, parentPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(unhealthyConditions) == 0 {
+		return append(errs, field.Required(parentPath, "at least one unhealthy condition is required"))
+	}
+
+	seen := map[string]bool{}
+	for i, c := range unhealthyConditions {
+		fldPath := parentPath.Index(i)
+		if c.Timeout.Duration < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child("timeout"), c.Timeout.Duration.String(), "timeout must not be negative"))
+		}
+		key := fmt.Sprintf("%s=%s", c.Type, c.Status)
+		if seen[key] {
+			errs = append(errs, field.Duplicate(fldPath, key))
+		}
+		seen[key] = true
+	}
+
+	return errs
+}
+
+func validateRemediationTemplate(mhc *machinev1beta1.MachineHealthCheck, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	template := mhc.Spec.RemediationTemplate
+	if template == nil {
+		return errs
+	}
+
+	if template.Namespace != "" && template.Namespace != mhc.GetNamespace() {
+		errs = append(errs, field.Invalid(fldPath.Child("namespace"), template.Namespace, fmt.Sprintf("remediationTemplate must be in the same namespace as the MachineHealthCheck (%s)", mhc.GetNamespace())))
+	}
+	if template.APIVersion == "" {
+		errs = append(errs, field.Required(fldPath.Child("apiVersion"), "apiVersion is required"))
+	}
+	if template.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), "name is required"))
+	}
+	if !strings.HasSuffix(template.Kind, external.TemplateSuffix) {
+		errs = append(errs, field.Invalid(fldPath.Child("kind"), template.Kind, fmt.Sprintf("kind must have the %q suffix", external.TemplateSuffix)))
+	}
+
+	return errs
+}
+
+func validateMachineHealthCheckAnnotations(mhc, oldMHC *machinev1beta1.MachineHealthCheck, parentPath *field.Path) ([]string, field.ErrorList) {
+	var errs field.ErrorList
+	var warnings []string
+
+	if strategy, ok := mhc.Annotations[annotations.RemediationStrategyAnnotation]; ok && strategy != remediationStrategyExternalBaremetal {
+		fldPath := parentPath.Key(annotations.RemediationStrategyAnnotation)
+		// Existing MachineHealthChecks with an unsupported strategy must still accept updates of other fields,
+		// e.g. their status and finalizers
+		if oldStrategy, oldOk := oldAnnotation(oldMHC, annotations.RemediationStrategyAnnotation); oldOk && oldStrategy == strategy {
+			warnings = append(warnings, fmt.Sprintf("%s: unsupported value %q is ignored, supported values: %q", fldPath, strategy, remediationStrategyExternalBaremetal))
+		} else {
+			errs = append(errs, field.NotSupported(fldPath, strategy, []string{remediationStrategyExternalBaremetal}))
+		}
+	}
+
+	if value, ok := mhc.Annotations[annotations.ExternalRemediationTimeoutAnnotation]; ok {
+		fldPath := parentPath.Key(annotations.ExternalRemediationTimeoutAnnotation)
+		var timeoutErrs field.ErrorList
+		timeout, err := time.ParseDuration(value)
+		switch {
+		case err != nil:
+			timeoutErrs = append(timeoutErrs, field.Invalid(fldPath, value, fmt.Sprintf("must be a valid duration: %v", err)))
+		case timeout <= 0:
+			timeoutErrs = append(timeoutErrs, field.Invalid(fldPath, value, "must be a positive duration"))
+		case mhc.Spec.RemediationTemplate == nil:
+			warnings = append(warnings, fmt.Sprintf("%s: has no effect without spec.remediationTemplate", fldPath))
+		}
+		oldValue, oldOk := oldAnnotation(oldMHC, annotations.ExternalRemediationTimeoutAnnotation)
+		timeoutWarnings, timeoutErrs := unchangedFieldWarnings(timeoutErrs, !oldOk || oldValue != value)
+		warnings = append(warnings, timeoutWarnings...)
+		errs = append(errs, timeoutErrs...)
+	}
+
+	if value, ok := mhc.Annotations[annotations.MaintenanceWindowsAnnotation]; ok {
+		var windowsErrs field.ErrorList
+		if _, err := maintenance.Parse(value); err != nil {
+			windowsErrs = append(windowsErrs, field.Invalid(parentPath.Key(annotations.MaintenanceWindowsAnnotation), value, err.Error()))
+		}
+		oldValue, oldOk := oldAnnotation(oldMHC, annotations.MaintenanceWindowsAnnotation)
+		windowsWarnings, windowsErrs := unchangedFieldWarnings(windowsErrs, !oldOk || oldValue != value)
+		warnings = append(warnings, windowsWarnings...)
+		errs = append(errs, windowsErrs...)
+	}
+
+	return warnings, errs
+}
+
+// unchangedFieldWarnings returns the errors of a field as warnings when an update did not change the field,
+// so MachineHealthChecks admitted before the field was validated are only rejected once the field changes.
+func unchangedFieldWarnings(fieldErrs field.ErrorList, changed bool) ([]string, field.ErrorList) {
+	if changed {
+		return nil, fieldErrs
+	}
+	var warnings []string
+	for _, err := range fieldErrs {
+		warnings = append(warnings, err.Error())
+	}
+	return warnings, nil
+}
+
+// oldAnnotation returns the value of the annotation of the MachineHealthCheck before an update, if any
+func oldAnnotation(oldMHC *machinev1beta1.MachineHealthCheck, key string) (string, bool) {
+	if oldMHC == nil {
+		return "", false
+	}
+	value, ok := oldMHC.Annotations[key]
+	return value, ok
+}
+
+// selectorWarnings warns about selectors matching control plane machines or overlapping
+// with the selector of another MachineHealthCheck.
+func (h *machineHealthCheckValidatorHandler) selectorWarnings(ctx context.Context, mhc *machinev1beta1.MachineHealthCheck, selector labels.Selector) []string {
+	var warnings []string
+	if h.client == nil {
+		return warnings
+	}
+
+	machines := &machinev1beta1.MachineList{}
+	if err := h.client.List(ctx, machines, client.InNamespace(mhc.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		klog.Errorf("Failed to list machines matching MachineHealthCheck %s: %v", mhc.GetName(), err)
+		return append(warnings, fmt.Sprintf("unable to list machines matching spec.selector: %v", err))
+	}
+
+	var controlPlaneMachines []string
+	for _, m := range machines.Items {
+		if m.Labels[machineRoleLabel] == machineControlPlaneRole {
+			controlPlaneMachines = append(controlPlaneMachines, m.GetName())
+		}
+	}
+	if len(controlPlaneMachines) > 0 {
+		warnings = append(warnings, fmt.Sprintf("spec.selector matches control plane machines (%s), remediating them may affect the availability of the cluster", strings.Join(controlPlaneMachines, ", ")))
+	}
+
+	mhcs := &machinev1beta1.MachineHealthCheckList{}
+	if err := h.client.List(ctx, mhcs, client.InNamespace(mhc.GetNamespace())); err != nil {
+		klog.Errorf("Failed to list MachineHealthChecks: %v", err)
+		return append(warnings, fmt.Sprintf("unable to list MachineHealthChecks to detect overlapping selectors: %v", err))
+	}
+
+	for _, other := range mhcs.Items {
+		if other.GetName() == mhc.GetName() {
+			continue
+		}
+		otherSelector, err := metav1.LabelSelectorAsSelector(&other.Spec.Selector)
+		if err != nil {
+			continue
+		}
+
+		var overlapping []string
+		for _, m := range machines.Items {
+			if otherSelector.Matches(labels.Set(m.Labels)) {
+				overlapping = append(overlapping, m.GetName())
+			}
+		}
+		sort.Strings(overlapping)
+
+		switch {
+		case len(overlapping) > 0:
+			warnings = append(warnings, fmt.Sprintf("spec.selector overlaps with MachineHealthCheck %s, both match machines (%s)", other.GetName(), strings.Join(overlapping, ", ")))
+		case reflect.DeepEqual(mhc.Spec.Selector, other.Spec.Selector):
+			warnings = append(warnings, fmt.Sprintf("spec.selector is identical to the selector of MachineHealthCheck %s", other.GetName()))
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,430 @@
+package webhooks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/machine-api-operator/pkg/util/annotations"
+)
+
+func TestMachineHealthCheckValidation(t *testing.T) {
+	const namespace = "openshift-machine-api"
+
+	newMHC := func(name string, selector map[string]string) *machinev1beta1.MachineHealthCheck {
+		return &machinev1beta1.MachineHealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: machinev1beta1.MachineHealthCheckSpec{
+				Selector: metav1.LabelSelector{MatchLabels: selector},
+				UnhealthyConditions: []machinev1beta1.UnhealthyCondition{
+					{
+						Type:    corev1.NodeReady,
+						Status:  corev1.ConditionFalse,
+						Timeout: metav1.Duration{Duration: 5 * time.Minute},
+					},
+				},
+			},
+		}
+	}
+
+	newMachine := func(name string, labels map[string]string) *machinev1beta1.Machine {
+		return &machinev1beta1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    labels,
+			},
+		}
+	}
+
+	workerLabels := map[string]string{"machine.openshift.io/cluster-api-machineset": "worker"}
+	workerRoleLabels := map[string]string{machineRoleLabel: "worker"}
+	masterLabels := map[string]string{machineRoleLabel: machineControlPlaneRole}
+
+	testCases := []struct {
+		name             string
+		mhc              func() *machinev1beta1.MachineHealthCheck
+		oldMHC           func() *machinev1beta1.MachineHealthCheck
+		existingObjects  []runtime.Object
+		expectedError    string
+		expectedWarnings []string
+	}{
+		{
+			name: "with a valid MachineHealthCheck",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("40%"))
+				return mhc
+			},
+		},
+		{
+			name: "with an empty selector",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", nil)
+			},
+			expectedError: "spec.selector: Required value: selector must not be empty, an empty selector matches all machines in the namespace",
+		},
+		{
+			name: "with an unchanged empty selector on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", nil)
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", nil)
+			},
+		},
+		{
+			name: "with maxUnhealthy above 100%",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("200%"))
+				return mhc
+			},
+			expectedError: "spec.maxUnhealthy: Invalid value: \"200%\": maxUnhealthy must not be greater than 100%",
+		},
+		{
+			name: "with an unparsable maxUnhealthy",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("1%0"))
+				return mhc
+			},
+			expectedError: "spec.maxUnhealthy: Invalid value: \"1%0\": maxUnhealthy must be an integer or a percentage",
+		},
+		{
+			name: "with a negative maxUnhealthy",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromInt32(-1))
+				return mhc
+			},
+			expectedError: "spec.maxUnhealthy: Invalid value: -1: maxUnhealthy must not be negative",
+		},
+		{
+			name: "with a negative unhealthy condition timeout",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.UnhealthyConditions[0].Timeout = metav1.Duration{Duration: -time.Minute}
+				return mhc
+			},
+			expectedError: "spec.unhealthyConditions[0].timeout: Invalid value: \"-1m0s\": timeout must not be negative",
+		},
+		{
+			name: "with a remediation template in another namespace",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.RemediationTemplate = &corev1.ObjectReference{
+					APIVersion: "infrastructure.machine.openshift.io/v1alpha3",
+					Kind:       "InfrastructureRemediationTemplate",
+					Name:       "template",
+					Namespace:  "other",
+				}
+				return mhc
+			},
+			expectedError: "spec.remediationTemplate.namespace: Invalid value: \"other\": remediationTemplate must be in the same namespace as the MachineHealthCheck (openshift-machine-api)",
+		},
+		{
+			name: "with an invalid external remediation timeout",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.ExternalRemediationTimeoutAnnotation: "forever"}
+				return mhc
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/external-remediation-timeout]: Invalid value: \"forever\": must be a valid duration: time: invalid duration \"forever\"",
+		},
+		{
+			name: "with an external remediation timeout but no remediation template",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.ExternalRemediationTimeoutAnnotation: "30m"}
+				return mhc
+			},
+			expectedWarnings: []string{"metadata.annotations[machine.openshift.io/external-remediation-timeout]: has no effect without spec.remediationTemplate"},
+		},
+		{
+			name: "with valid maintenance windows",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.MaintenanceWindowsAnnotation: `[{"schedule": "0 2 * * 6", "duration": "4h"}]`}
+				return mhc
+			},
+		},
+		{
+			name: "with invalid maintenance windows",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.MaintenanceWindowsAnnotation: `[{"schedule": "0 2 * * 6"}]`}
+				return mhc
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/maintenance-windows]: Invalid value: \"[{\\\"schedule\\\": \\\"0 2 * * 6\\\"}]\": window 0: duration must be positive, got 0s",
+		},
+		{
+			name: "with an unknown remediation strategy",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.RemediationStrategyAnnotation: "reboot"}
+				return mhc
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/remediation-strategy]: Unsupported value: \"reboot\": supported values: \"external-baremetal\"",
+		},
+		{
+			name: "with an unknown remediation strategy changed on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.RemediationStrategyAnnotation: "reboot"}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.RemediationStrategyAnnotation: remediationStrategyExternalBaremetal}
+				return mhc
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/remediation-strategy]: Unsupported value: \"reboot\": supported values: \"external-baremetal\"",
+		},
+		{
+			name: "with an unchanged unknown remediation strategy on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.RemediationStrategyAnnotation: "reboot"}
+				mhc.Finalizers = []string{"example.com/finalizer"}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.RemediationStrategyAnnotation: "reboot"}
+				return mhc
+			},
+			expectedWarnings: []string{"metadata.annotations[machine.openshift.io/remediation-strategy]: unsupported value \"reboot\" is ignored, supported values: \"external-baremetal\""},
+		},
+		{
+			name: "with an unchanged maxUnhealthy above 100% on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("200%"))
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("200%"))
+				return mhc
+			},
+			expectedWarnings: []string{"spec.maxUnhealthy: Invalid value: \"200%\": maxUnhealthy must not be greater than 100%"},
+		},
+		{
+			name: "with a maxUnhealthy changed above 100% on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("200%"))
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromString("300%"))
+				return mhc
+			},
+			expectedError: "spec.maxUnhealthy: Invalid value: \"200%\": maxUnhealthy must not be greater than 100%",
+		},
+		{
+			name: "with an unchanged negative node startup timeout on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Spec.NodeStartupTimeout = &metav1.Duration{Duration: -time.Minute}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.NodeStartupTimeout = &metav1.Duration{Duration: -time.Minute}
+				return mhc
+			},
+			expectedWarnings: []string{"spec.nodeStartupTimeout: Invalid value: \"-1m0s\": nodeStartupTimeout must not be negative"},
+		},
+		{
+			name: "with an unchanged negative unhealthy condition timeout on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Spec.UnhealthyConditions[0].Timeout = metav1.Duration{Duration: -time.Minute}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.UnhealthyConditions[0].Timeout = metav1.Duration{Duration: -time.Minute}
+				return mhc
+			},
+			expectedWarnings: []string{"spec.unhealthyConditions[0].timeout: Invalid value: \"-1m0s\": timeout must not be negative"},
+		},
+		{
+			name: "with an unchanged remediation template in another namespace on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Spec.RemediationTemplate = &corev1.ObjectReference{
+					APIVersion: "infrastructure.machine.openshift.io/v1alpha3",
+					Kind:       "InfrastructureRemediationTemplate",
+					Name:       "template",
+					Namespace:  "other",
+				}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Spec.RemediationTemplate = &corev1.ObjectReference{
+					APIVersion: "infrastructure.machine.openshift.io/v1alpha3",
+					Kind:       "InfrastructureRemediationTemplate",
+					Name:       "template",
+					Namespace:  "other",
+				}
+				return mhc
+			},
+			expectedWarnings: []string{"spec.remediationTemplate.namespace: Invalid value: \"other\": remediationTemplate must be in the same namespace as the MachineHealthCheck (openshift-machine-api)"},
+		},
+		{
+			name: "with an unchanged invalid external remediation timeout on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Annotations = map[string]string{annotations.ExternalRemediationTimeoutAnnotation: "-30m"}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.ExternalRemediationTimeoutAnnotation: "-30m"}
+				return mhc
+			},
+			expectedWarnings: []string{"metadata.annotations[machine.openshift.io/external-remediation-timeout]: Invalid value: \"-30m\": must be a positive duration"},
+		},
+		{
+			name: "with unchanged invalid maintenance windows on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Labels = map[string]string{"example.com/team": "compute"}
+				mhc.Annotations = map[string]string{annotations.MaintenanceWindowsAnnotation: `[{"schedule": "0 2 * * 6"}]`}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.MaintenanceWindowsAnnotation: `[{"schedule": "0 2 * * 6"}]`}
+				return mhc
+			},
+			expectedWarnings: []string{"metadata.annotations[machine.openshift.io/maintenance-windows]: Invalid value: \"[{\\\"schedule\\\": \\\"0 2 * * 6\\\"}]\": window 0: duration must be positive, got 0s"},
+		},
+		{
+			name: "with invalid maintenance windows changed on update",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				mhc := newMHC("worker", workerLabels)
+				mhc.Annotations = map[string]string{annotations.MaintenanceWindowsAnnotation: `[{"schedule": "0 2 * * 6"}]`}
+				return mhc
+			},
+			oldMHC: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", workerLabels)
+			},
+			expectedError: "metadata.annotations[machine.openshift.io/maintenance-windows]: Invalid value: \"[{\\\"schedule\\\": \\\"0 2 * * 6\\\"}]\": window 0: duration must be positive, got 0s",
+		},
+		{
+			name: "with a selector matching control plane machines",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("master", masterLabels)
+			},
+			existingObjects: []runtime.Object{
+				newMachine("master-0", masterLabels),
+				newMachine("worker-0", workerRoleLabels),
+			},
+			expectedWarnings: []string{"spec.selector matches control plane machines (master-0), remediating them may affect the availability of the cluster"},
+		},
+		{
+			name: "with a selector overlapping another MachineHealthCheck",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", workerLabels)
+			},
+			existingObjects: []runtime.Object{
+				newMHC("all-workers", workerRoleLabels),
+				newMachine("worker-0", map[string]string{
+					"machine.openshift.io/cluster-api-machineset": "worker",
+					machineRoleLabel: "worker",
+				}),
+			},
+			expectedWarnings: []string{"spec.selector overlaps with MachineHealthCheck all-workers, both match machines (worker-0)"},
+		},
+		{
+			name: "with a selector identical to another MachineHealthCheck",
+			mhc: func() *machinev1beta1.MachineHealthCheck {
+				return newMHC("worker", workerLabels)
+			},
+			existingObjects: []runtime.Object{
+				newMHC("worker-copy", workerLabels),
+			},
+			expectedWarnings: []string{"spec.selector is identical to the selector of MachineHealthCheck worker-copy"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			h := &machineHealthCheckValidatorHandler{
+				client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(tc.existingObjects...).Build(),
+			}
+
+			var oldMHC *machinev1beta1.MachineHealthCheck
+			if tc.oldMHC != nil {
+				oldMHC = tc.oldMHC()
+			}
+			warnings, errs := h.validateMachineHealthCheck(context.Background(), tc.mhc(), oldMHC)
+
+			if tc.expectedError != "" {
+				g.Expect(errs.ToAggregate()).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+			g.Expect(warnings).To(ConsistOf(tc.expectedWarnings))
+		})
+	}
+}
+
+func TestMachineHealthCheckDefaulting(t *testing.T) {
+	g := NewWithT(t)
+
+	mhc := &machinev1beta1.MachineHealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker",
+			Namespace: "openshift-machine-api",
+		},
+		Spec: machinev1beta1.MachineHealthCheckSpec{
+			RemediationTemplate: &corev1.ObjectReference{
+				APIVersion: "infrastructure.machine.openshift.io/v1alpha3",
+				Kind:       "InfrastructureRemediationTemplate",
+				Name:       "template",
+			},
+		},
+	}
+
+	h := &machineHealthCheckDefaulterHandler{}
+	g.Expect(h.Default(context.Background(), mhc)).To(Succeed())
+
+	g.Expect(mhc.Spec.MaxUnhealthy).To(Equal(ptr.To(intstr.FromString("100%"))))
+	g.Expect(mhc.Spec.NodeStartupTimeout).To(Equal(&metav1.Duration{Duration: 10 * time.Minute}))
+	g.Expect(mhc.Spec.RemediationTemplate.Namespace).To(Equal("openshift-machine-api"))
+
+	// Explicitly set values must be preserved
+	mhc.Spec.MaxUnhealthy = ptr.To(intstr.FromInt32(2))
+	mhc.Spec.NodeStartupTimeout = &metav1.Duration{}
+	g.Expect(h.Default(context.Background(), mhc)).To(Succeed())
+
+	g.Expect(mhc.Spec.MaxUnhealthy).To(Equal(ptr.To(intstr.FromInt32(2))))
+	g.Expect(mhc.Spec.NodeStartupTimeout).To(Equal(&metav1.Duration{}))
+}
@@ -59,6 +59,7 @@ func createMachineSetValidator(infra *osconfigv1.Infrastructure, client client.C
 		admissionHandler: &admissionHandler{
 			admissionConfig:   admissionConfig,
 			webhookOperations: getMachineValidatorOperation(infra.Status.PlatformStatus.Type),
+			updateOperations:  getMachineUpdateValidatorOperation(infra.Status.PlatformStatus.Type),
 		},
 	})
 }
@@ -167,7 +168,8 @@ func (h *machineSetValidatorHandler) validateMachineSet(ms, oldMS *machinev1beta
 	// Create a Machine from the MachineSet and validate the Machine template
 	m := &machinev1beta1.Machine{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: ms.GetNamespace(),
+			Namespace:   ms.GetNamespace(),
+			Annotations: ms.Spec.Template.ObjectMeta.Annotations,
 		},
 		Spec: ms.Spec.Template.Spec,
 	}
@@ -175,6 +177,21 @@ func (h *machineSetValidatorHandler) validateMachineSet(ms, oldMS *machinev1beta
 	if !ok {
 		errs = append(errs, opsErrs...)
 	}
+	if h.updateOperations != nil {
+		var oldM *machinev1beta1.Machine
+		if oldMS != nil {
+			oldM = &machinev1beta1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   oldMS.GetNamespace(),
+					Annotations: oldMS.Spec.Template.ObjectMeta.Annotations,
+				},
+				Spec: oldMS.Spec.Template.Spec,
+			}
+		}
+		updateWarnings, updateErrs := h.updateOperations(m, oldM)
+		warnings = append(warnings, updateWarnings...)
+		errs = append(errs, updateErrs...)
+	}
 
 	if len(errs) > 0 {
 		return false, warnings, errs